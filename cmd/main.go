@@ -2,34 +2,72 @@ package main
 
 import (
 	"context"
-	"field_archive/server/handlers"
 	"field_archive/server/internal/config"
 	"field_archive/server/internal/database"
-	"field_archive/server/internal/server"
-	"field_archive/server/repositories"
-	"field_archive/server/routes"
-	"field_archive/server/services"
+	"fmt"
 	"log"
+	"os"
 )
 
+const usage = `usage: server [command] [arguments]
+
+Commands:
+  serve                                    run the web server (the default)
+  migrate up|down [n]|status               apply, revert or list schema migrations
+  user create [-role r] [-password-stdin] <username> <email>
+                                           add a user
+  user promote <username> <role>           change a user's role
+  user disable <username>                  stop a user logging in
+  seed --fixtures                          load example users, locations and recordings
+  recordings rescan [id...]                re-read audio metadata, of every recording by default
+  storage verify                           check every stored file the database refers to exists
+  storage rekey [-dry-run]                 turn file paths saved by older versions into storage keys`
+
+// commands are the subcommands by name. Each is given the arguments that
+// follow its name.
+var commands = map[string]func(args []string) error{
+	"serve":      serve,
+	"migrate":    migrate,
+	"user":       user,
+	"seed":       seed,
+	"recordings": recordings,
+	"storage":    storageCommand,
+}
+
 func main() {
-	// Loading configuration
+	name, args := "serve", []string{}
+	if len(os.Args) > 1 {
+		name, args = os.Args[1], os.Args[2:]
+	}
+	if name == "help" || name == "-h" || name == "--help" {
+		fmt.Println(usage)
+		return
+	}
+	command, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s\n", name, usage)
+		os.Exit(2)
+	}
+	if err := command(args); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// connect loads the configuration and connects to the database, for the
+// commands other than serve.
+func connect(ctx context.Context) (*config.Config, *database.Postgres, error) {
 	cfg, err := config.LoadConfig()
 	if err != nil {
-		log.Fatalf("Error loading Config %v", err)
+		return nil, nil, fmt.Errorf("error loading config %w", err)
 	}
-
-	// Building database connection
-	db, err := database.Connect(context.Background(), cfg)
+	db, err := database.Connect(ctx, cfg)
 	if err != nil {
-		log.Fatalf("Couldn't connect to Database %v", err)
+		return nil, nil, fmt.Errorf("couldn't connect to database %w", err)
 	}
+	return cfg, db, nil
+}
 
-	// Setting up 'recordings' interactors
-	recRepo := repositories.NewRecordingRepo(db)
-	service := services.NewRecordingService(recRepo)
-	handler := handlers.NewRecordingHandler(service)
-
-	// Starting server
-	server.Start(cfg, routes.DefineRoutes, handler)
+// usageError reports a command used wrongly, along with how to use it.
+func usageError(format string, args ...any) error {
+	return fmt.Errorf(format+"\n\n%s", append(args, usage)...)
 }
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"field_archive/server/internal/database/migrations"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"text/tabwriter"
+)
+
+// migrate runs the migrate subcommand with the arguments following it.
+func migrate(args []string) error {
+	if len(args) == 0 {
+		return usageError("migrate needs up, down or status")
+	}
+	if !slices.Contains([]string{"up", "down", "status"}, args[0]) {
+		return usageError("unknown migrate command %q", args[0])
+	}
+
+	ctx := context.Background()
+	_, db, err := connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	m, err := migrations.New(db)
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "up":
+		applied, err := m.Up(ctx)
+		for _, mig := range applied {
+			fmt.Printf("applied %04d_%s\n", mig.Version, mig.Name)
+		}
+		if err == nil && len(applied) == 0 {
+			fmt.Println("no pending migrations")
+		}
+		return err
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			if steps, err = strconv.Atoi(args[1]); err != nil || steps < 1 {
+				return fmt.Errorf("down takes a positive number of migrations, got %q", args[1])
+			}
+		}
+		reverted, err := m.Down(ctx, steps)
+		for _, mig := range reverted {
+			fmt.Printf("reverted %04d_%s\n", mig.Version, mig.Name)
+		}
+		return err
+	case "status":
+		list, err := m.Status(ctx)
+		if err != nil {
+			return err
+		}
+		printStatus(os.Stdout, list)
+	}
+	return nil
+}
+
+func printStatus(out io.Writer, list []migrations.Status) {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED")
+	for _, s := range list {
+		applied := "pending"
+		switch {
+		case s.AppliedAt != nil && s.Up == "":
+			applied = s.AppliedAt.Format("2006-01-02 15:04:05") + " (unknown to this build)"
+		case s.Modified:
+			applied = s.AppliedAt.Format("2006-01-02 15:04:05") + " (modified since)"
+		case s.AppliedAt != nil:
+			applied = s.AppliedAt.Format("2006-01-02 15:04:05")
+		}
+		fmt.Fprintf(w, "%04d\t%s\t%s\n", s.Version, s.Name, applied)
+	}
+	w.Flush()
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"field_archive/server/entities"
+	"field_archive/server/internal/storage"
+	"field_archive/server/repositories"
+	"field_archive/server/services"
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// recordingsPageSize is how many recordings are read at a time when going
+// through them all.
+const recordingsPageSize = 100
+
+// recordings runs the recordings subcommands. rescan re-reads the audio of
+// the recordings given by ID, or of every recording, and updates their size,
+// format, duration and channels.
+func recordings(args []string) error {
+	if len(args) == 0 || args[0] != "rescan" {
+		return usageError("recordings needs rescan")
+	}
+	ids := []int{}
+	for _, arg := range args[1:] {
+		id, err := strconv.Atoi(arg)
+		if err != nil || id < 1 {
+			return usageError("recordings rescan takes recording IDs, got %q", arg)
+		}
+		ids = append(ids, id)
+	}
+
+	ctx := services.WithUser(context.Background(), services.Operator)
+	cfg, db, err := connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	store, err := storage.New(ctx, cfg)
+	if err != nil {
+		return fmt.Errorf("couldn't open storage %w", err)
+	}
+	repo := repositories.NewRecordingRepo(db, repositories.Grids{Low: cfg.LocationGridLow, High: cfg.LocationGridHigh})
+	s := services.NewRecordingService(repo, store)
+
+	if len(ids) == 0 {
+		err := eachRecording(ctx, repo, func(recording entities.Recording) error {
+			ids = append(ids, recording.ID)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	failed := 0
+	for _, id := range ids {
+		recording, err := s.Rescan(id, ctx)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "recording %d: %v\n", id, err)
+			failed++
+			continue
+		}
+		fmt.Printf("recording %d: %s, %d s, %s channels, %.0f bytes\n",
+			id, recording.Format, recording.Duration, recording.Channels, recording.Size)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d recordings couldn't be rescanned", failed, len(ids))
+	}
+	return nil
+}
+
+// eachRecording calls fn with every recording, whatever its visibility,
+// a page at a time. It stops at the first error fn returns.
+func eachRecording(ctx context.Context, repo repositories.RecordingRepository, fn func(recording entities.Recording) error) error {
+	q := repositories.RecordingQuery{
+		Filter: repositories.RecordingFilter{Viewer: repositories.Viewer{SeesAll: true}},
+		Sort:   "recording_date",
+		Limit:  recordingsPageSize,
+	}
+	for {
+		page, err := repo.ListPage(ctx, q)
+		if err != nil {
+			return fmt.Errorf("problem listing recordings %w", err)
+		}
+		for _, recording := range page {
+			if err := fn(recording); err != nil {
+				return err
+			}
+		}
+		if len(page) < q.Limit {
+			return nil
+		}
+		cursor := repositories.CursorAfter(page[len(page)-1], q.Sort, q.Desc)
+		q.After = &cursor
+	}
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"field_archive/server/entities"
+	"field_archive/server/internal/storage"
+	"field_archive/server/repositories"
+	"field_archive/server/services"
+	"flag"
+	"fmt"
+	"math"
+	"time"
+)
+
+//go:embed fixtures/fixtures.json
+var fixturesJSON []byte
+
+// fixtures are example users, locations, recordings and collections for
+// development. Everything refers to everything else by name, and recording
+// audio is generated rather than stored alongside.
+type fixtures struct {
+	Password string
+	Users    []struct {
+		Username string
+		Email    string
+		Role     string
+	}
+	Locations []struct {
+		Owner       string
+		Name        string
+		Description string
+		Latitude    float64
+		Longitude   float64
+		Sensitivity string
+	}
+	Recordings []struct {
+		Owner         string
+		Title         string
+		Location      string
+		RecordingDate time.Time `json:"recording_date"`
+		Seconds       int
+		Channels      int
+		Description   string
+		Equipment     string
+		License       string
+		Visibility    string
+		Tags          []string
+	}
+	Collections []struct {
+		Owner       string
+		Title       string
+		Description string
+		Recordings  []string
+	}
+}
+
+// seed loads the fixtures through the services, so they're validated and
+// stored just as if they'd come through the API.
+func seed(args []string) error {
+	flags := flag.NewFlagSet("seed", flag.ExitOnError)
+	withFixtures := flags.Bool("fixtures", false, "load the built in example data")
+	flags.Parse(args)
+	if !*withFixtures || flags.NArg() > 0 {
+		return usageError("seed needs --fixtures")
+	}
+	var f fixtures
+	if err := json.Unmarshal(fixturesJSON, &f); err != nil {
+		return fmt.Errorf("problem reading fixtures %w", err)
+	}
+
+	ctx := context.Background()
+	cfg, db, err := connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	store, err := storage.New(ctx, cfg)
+	if err != nil {
+		return fmt.Errorf("couldn't open storage %w", err)
+	}
+	grids := repositories.Grids{Low: cfg.LocationGridLow, High: cfg.LocationGridHigh}
+	recRepo := repositories.NewRecordingRepo(db, grids)
+	userService := services.NewUserService(repositories.NewUserRepo(db), repositories.NewRefreshTokenRepo(db), nil, *cfg)
+	locService := services.NewLocationService(repositories.NewLocationRepo(db, grids))
+	recService := services.NewRecordingService(recRepo, store)
+	tagService := services.NewTagService(repositories.NewTagRepo(db), recRepo)
+	collectionService := services.NewCollectionService(repositories.NewCollectionRepo(db), recRepo, store)
+
+	users := map[string]entities.User{}
+	as := func(username string) context.Context {
+		return services.WithUser(ctx, users[username])
+	}
+	for _, u := range f.Users {
+		created, err := userService.Create(services.Registration{Username: u.Username, Email: u.Email, Password: f.Password}, u.Role, ctx)
+		if errors.Is(err, repositories.ErrConflict) {
+			return fmt.Errorf("user %s already exists, have the fixtures been loaded already? %w", u.Username, err)
+		}
+		if err != nil {
+			return fmt.Errorf("user %s: %w", u.Username, err)
+		}
+		users[u.Username] = created
+	}
+
+	locations := map[string]int{}
+	for _, l := range f.Locations {
+		id, err := locService.Create(entities.Location{
+			Name:        l.Name,
+			Description: l.Description,
+			Latitude:    &l.Latitude,
+			Longitude:   &l.Longitude,
+			Sensitivity: l.Sensitivity,
+		}, as(l.Owner))
+		if err != nil {
+			return fmt.Errorf("location %s: %w", l.Name, err)
+		}
+		locations[l.Name] = id
+	}
+
+	recordings := map[string]int{}
+	for _, r := range f.Recordings {
+		audio := services.Upload{Filename: "fixture.wav", Content: bytes.NewReader(toneWAV(r.Seconds, r.Channels, 440+110*float64(len(recordings))))}
+		id, err := recService.Create(entities.Recording{
+			Title:         r.Title,
+			RecordingDate: r.RecordingDate,
+			LocationID:    locations[r.Location],
+			Description:   r.Description,
+			Equipment:     r.Equipment,
+			License:       r.License,
+			Visibility:    r.Visibility,
+		}, audio, nil, as(r.Owner))
+		if err != nil {
+			return fmt.Errorf("recording %s: %w", r.Title, err)
+		}
+		recordings[r.Title] = id
+		for _, tag := range r.Tags {
+			if _, err := tagService.Attach(id, tag, as(r.Owner)); err != nil {
+				return fmt.Errorf("recording %s tag %s: %w", r.Title, tag, err)
+			}
+		}
+	}
+
+	for _, c := range f.Collections {
+		ids := []int{}
+		for _, title := range c.Recordings {
+			ids = append(ids, recordings[title])
+		}
+		_, err := collectionService.Create(entities.Collection{
+			Title:        c.Title,
+			Description:  c.Description,
+			RecordingIDs: ids,
+		}, as(c.Owner))
+		if err != nil {
+			return fmt.Errorf("collection %s: %w", c.Title, err)
+		}
+	}
+
+	fmt.Printf("loaded %d users, %d locations, %d recordings and %d collections\n",
+		len(users), len(locations), len(recordings), len(f.Collections))
+	fmt.Printf("every fixture user's password is %q\n", f.Password)
+	return nil
+}
+
+// toneWAV returns a 16 bit PCM WAV file holding a sine tone at hz, fading in
+// and out so it doesn't click.
+func toneWAV(seconds, channels int, hz float64) []byte {
+	const rate = 8000
+	frames := seconds * rate
+	dataSize := frames * channels * 2
+
+	var buf bytes.Buffer
+	write := func(v any) { binary.Write(&buf, binary.LittleEndian, v) }
+	buf.WriteString("RIFF")
+	write(uint32(36 + dataSize))
+	buf.WriteString("WAVEfmt ")
+	write(uint32(16))
+	write(uint16(1)) // PCM
+	write(uint16(channels))
+	write(uint32(rate))
+	write(uint32(rate * channels * 2))
+	write(uint16(channels * 2))
+	write(uint16(16))
+	buf.WriteString("data")
+	write(uint32(dataSize))
+
+	fade := float64(rate) / 10
+	for i := 0; i < frames; i++ {
+		gain := math.Min(1, math.Min(float64(i), float64(frames-i))/fade)
+		sample := int16(0.3 * gain * math.MaxInt16 * math.Sin(2*math.Pi*hz*float64(i)/rate))
+		for c := 0; c < channels; c++ {
+			write(sample)
+		}
+	}
+	return buf.Bytes()
+}
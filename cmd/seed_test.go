@@ -0,0 +1,51 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"field_archive/server/internal/metadata"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestToneWAV(t *testing.T) {
+	info, err := metadata.Parse(bytes.NewReader(toneWAV(3, 2, 440)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "wav", info.Format)
+	assert.Equal(t, 2, info.Channels)
+	assert.Equal(t, 8000, info.SampleRate)
+	assert.Equal(t, 3*time.Second, info.Duration)
+}
+
+// TestFixtures checks the fixtures only refer to things they define, as seed
+// can't tell a missing name from an empty one.
+func TestFixtures(t *testing.T) {
+	var f fixtures
+	if err := json.Unmarshal(fixturesJSON, &f); err != nil {
+		t.Fatal(err)
+	}
+	users, locations, recordings := map[string]bool{}, map[string]bool{}, map[string]bool{}
+	for _, u := range f.Users {
+		users[u.Username] = true
+	}
+	for _, l := range f.Locations {
+		assert.True(t, users[l.Owner], "location %s owner", l.Name)
+		locations[l.Name] = true
+	}
+	for _, r := range f.Recordings {
+		assert.True(t, users[r.Owner], "recording %s owner", r.Title)
+		assert.True(t, locations[r.Location], "recording %s location", r.Title)
+		assert.False(t, r.RecordingDate.IsZero(), "recording %s date", r.Title)
+		recordings[r.Title] = true
+	}
+	for _, c := range f.Collections {
+		assert.True(t, users[c.Owner], "collection %s owner", c.Title)
+		for _, title := range c.Recordings {
+			assert.True(t, recordings[title], "collection %s recording %s", c.Title, title)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"field_archive/server/handlers"
+	"field_archive/server/internal/config"
+	"field_archive/server/internal/database"
+	"field_archive/server/internal/database/migrations"
+	"field_archive/server/internal/health"
+	"field_archive/server/internal/metrics"
+	"field_archive/server/internal/server"
+	"field_archive/server/internal/storage"
+	"field_archive/server/repositories"
+	"field_archive/server/routes"
+	"field_archive/server/services"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// serve runs the web server until it's sent SIGINT or SIGTERM.
+func serve(args []string) error {
+	if len(args) > 0 {
+		return usageError("serve takes no arguments")
+	}
+
+	// Loading configuration
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return fmt.Errorf("error loading config %w", err)
+	}
+
+	// Loading token signing keys
+	keys, err := services.LoadTokenKeys(*cfg)
+	if err != nil {
+		return fmt.Errorf("refusing to start without a usable token key %w", err)
+	}
+
+	// Sensitive locations are shown on these grids to the public
+	grids := repositories.Grids{Low: cfg.LocationGridLow, High: cfg.LocationGridHigh}
+	if err := grids.Validate(); err != nil {
+		return fmt.Errorf("refusing to start with invalid LOCATION_GRID_LOW or LOCATION_GRID_HIGH %w", err)
+	}
+
+	// Building database connection. Until the server is running and closes
+	// it on shutdown, it's closed here if anything else fails.
+	db, err := database.Connect(context.Background(), cfg)
+	if err != nil {
+		return fmt.Errorf("couldn't connect to database %w", err)
+	}
+
+	// Applying pending migrations, when asked to
+	migrator, err := migrations.New(db)
+	if err != nil {
+		db.Close()
+		return fmt.Errorf("couldn't load migrations %w", err)
+	}
+	if cfg.MigrateOnStart {
+		applied, err := migrator.Up(context.Background())
+		if err != nil {
+			db.Close()
+			return fmt.Errorf("couldn't migrate database %w", err)
+		}
+		for _, mig := range applied {
+			log.Printf("Applied migration %04d_%s", mig.Version, mig.Name)
+		}
+	}
+
+	// Opening the audio and artwork store
+	store, err := storage.New(context.Background(), cfg)
+	if err != nil {
+		db.Close()
+		return fmt.Errorf("couldn't open storage %w", err)
+	}
+
+	// Collecting metrics, including the database pool's
+	m := metrics.New()
+	m.WatchPool(db.DB)
+
+	// Setting up 'recordings' interactors
+	recRepo := repositories.NewRecordingRepo(db, grids)
+	service := services.NewRecordingService(recRepo, store)
+	handler := handlers.NewRecordingHandler(service, cfg.MaxUploadBytes)
+	handler.Metrics = m
+	mediaHandler := handlers.NewMediaHandler(service, store)
+	mediaHandler.Metrics = m
+
+	// Setting up 'locations' interactors
+	locRepo := repositories.NewLocationRepo(db, grids)
+	locService := services.NewLocationService(locRepo)
+	locHandler := handlers.NewLocationHandler(locService)
+
+	// Setting up 'tags' interactors
+	tagRepo := repositories.NewTagRepo(db)
+	tagService := services.NewTagService(tagRepo, recRepo)
+	tagHandler := handlers.NewTagHandler(tagService)
+
+	// Setting up 'collections' interactors
+	collectionRepo := repositories.NewCollectionRepo(db)
+	collectionService := services.NewCollectionService(collectionRepo, recRepo, store)
+	collectionHandler := handlers.NewCollectionHandler(collectionService, store, cfg.MaxUploadBytes)
+	collectionHandler.Metrics = m
+
+	// Setting up 'users' interactors
+	userRepo := repositories.NewUserRepo(db)
+	refreshRepo := repositories.NewRefreshTokenRepo(db)
+	userService := services.NewUserService(userRepo, refreshRepo, keys, *cfg)
+	authHandler := handlers.NewAuthHandler(userService, keys, cfg.SecureCookies)
+
+	// Setting up 'api keys' interactors
+	apiKeyRepo := repositories.NewAPIKeyRepo(db)
+	apiKeyService := services.NewAPIKeyService(apiKeyRepo, userRepo)
+	apiKeyHandler := handlers.NewAPIKeyHandler(apiKeyService)
+	auth := handlers.NewAuthMiddleware(userService, apiKeyService)
+
+	// Setting up health checks
+	healthHandler := handlers.NewHealthHandler(health.New(
+		health.Database(db),
+		health.PostGIS(db),
+		health.Migrations(migrator),
+		health.Storage(store),
+	))
+
+	metricsHandler := handlers.NewMetricsHandler(m, cfg.MetricsToken)
+
+	// Starting server
+	srv := server.New(cfg, func(router *gin.Engine) {
+		router.Use(m.Middleware())
+		routes.DefineRoutes(router, handler, auth)
+		routes.DefineMediaRoutes(router, mediaHandler, auth)
+		routes.DefineLocationRoutes(router, locHandler, auth)
+		routes.DefineAuthRoutes(router, authHandler)
+		routes.DefineAPIKeyRoutes(router, apiKeyHandler, auth)
+		routes.DefineTagRoutes(router, tagHandler, auth)
+		routes.DefineCollectionRoutes(router, collectionHandler, auth)
+		routes.DefineHealthRoutes(router, healthHandler)
+		routes.DefineMetricsRoutes(router, metricsHandler)
+	})
+	srv.Go(func(ctx context.Context) {
+		m.TrackRecordings(ctx, time.Minute, func(ctx context.Context) (int, error) {
+			return recRepo.Count(ctx, repositories.RecordingFilter{Viewer: repositories.Viewer{SeesAll: true}})
+		})
+	})
+	srv.OnShutdown(db.Close)
+	return srv.Run()
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"field_archive/server/entities"
+	"field_archive/server/internal/storage"
+	"field_archive/server/repositories"
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// storedPrefixes are the key prefixes the archive stores files under.
+var storedPrefixes = []string{"audio/", "artwork/", "covers/"}
+
+// storageCommand runs the storage subcommands, verify and rekey.
+func storageCommand(args []string) error {
+	switch {
+	case len(args) == 1 && args[0] == "verify":
+		return storageVerify()
+	case len(args) > 0 && args[0] == "rekey":
+		return storageRekey(args[1:])
+	}
+	return usageError("storage needs verify or rekey")
+}
+
+// storageVerify checks that every file a recording or collection refers to
+// is in the store, and that audio files are the size recorded for them.
+// Files in the store that nothing refers to are listed too, but don't make
+// it fail.
+func storageVerify() error {
+	ctx := context.Background()
+	cfg, db, err := connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	store, err := storage.New(ctx, cfg)
+	if err != nil {
+		return fmt.Errorf("couldn't open storage %w", err)
+	}
+	recordingRepo := repositories.NewRecordingRepo(db, repositories.Grids{Low: cfg.LocationGridLow, High: cfg.LocationGridHigh})
+	collectionRepo := repositories.NewCollectionRepo(db)
+
+	referenced := map[string]bool{}
+	problems := 0
+	check := func(what, key string, size *int64) error {
+		referenced[key] = true
+		info, err := store.Stat(ctx, key)
+		switch {
+		case errors.Is(err, storage.ErrNotFound):
+			fmt.Printf("missing  %s: %s\n", what, key)
+			problems++
+		case err != nil:
+			return fmt.Errorf("problem checking %s %w", key, err)
+		case size != nil && info.Size != *size:
+			fmt.Printf("size     %s: %s is %d bytes, %d recorded\n", what, key, info.Size, *size)
+			problems++
+		}
+		return nil
+	}
+
+	checked := 0
+	err = eachRecording(ctx, recordingRepo, func(recording entities.Recording) error {
+		checked++
+		what := fmt.Sprintf("recording %d audio", recording.ID)
+		size := int64(recording.Size)
+		if err := check(what, recording.AudioLocation, &size); err != nil {
+			return err
+		}
+		if recording.ArtworkLocation != nil {
+			return check(fmt.Sprintf("recording %d artwork", recording.ID), *recording.ArtworkLocation, nil)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	collections, err := collectionRepo.List(ctx, repositories.Viewer{SeesAll: true}, math.MaxInt32)
+	if err != nil {
+		return fmt.Errorf("problem listing collections %w", err)
+	}
+	for _, collection := range collections {
+		if collection.CoverLocation != nil {
+			if err := check(fmt.Sprintf("collection %d cover", collection.ID), *collection.CoverLocation, nil); err != nil {
+				return err
+			}
+		}
+	}
+
+	orphans := []string{}
+	for _, prefix := range storedPrefixes {
+		objects, err := store.List(ctx, prefix)
+		if err != nil {
+			return fmt.Errorf("problem listing %s %w", prefix, err)
+		}
+		for _, object := range objects {
+			if !referenced[object.Key] {
+				orphans = append(orphans, object.Key)
+			}
+		}
+	}
+	sort.Strings(orphans)
+	for _, key := range orphans {
+		fmt.Printf("orphan   %s\n", key)
+	}
+
+	fmt.Fprintf(os.Stderr, "checked %d recordings and %d collections: %d problems, %d unreferenced files\n",
+		checked, len(collections), problems, len(orphans))
+	if problems > 0 {
+		return fmt.Errorf("storage verify found %d problems", problems)
+	}
+	return nil
+}
+
+// storageRekey rewrites recording file locations saved before the blob store,
+// when they were filesystem paths such as /srv/archive/audio/ab12.wav, into
+// keys relative to STORAGE_ROOT such as audio/ab12.wav. Locations that are
+// already keys are left alone, and ones outside STORAGE_ROOT are reported.
+func storageRekey(args []string) error {
+	flags := flag.NewFlagSet("storage rekey", flag.ExitOnError)
+	dryRun := flags.Bool("dry-run", false, "print the changes without saving them")
+	flags.Parse(args)
+	if flags.NArg() > 0 {
+		return usageError("storage rekey takes no arguments besides -dry-run")
+	}
+
+	ctx := context.Background()
+	cfg, db, err := connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	root, err := filepath.Abs(cfg.StorageRoot)
+	if err != nil {
+		return fmt.Errorf("couldn't resolve STORAGE_ROOT %w", err)
+	}
+	repo := repositories.NewRecordingRepo(db, repositories.Grids{Low: cfg.LocationGridLow, High: cfg.LocationGridHigh})
+
+	// Pages are read by recording date, which rekeying doesn't change, so
+	// updating as we go doesn't disturb the paging.
+	changed, problems := 0, 0
+	err = eachRecording(ctx, repo, func(recording entities.Recording) error {
+		rekeyed := false
+		rekey := func(what string, location *string) {
+			key, ok := storageKey(root, *location)
+			switch {
+			case !ok:
+				fmt.Printf("outside  recording %d %s: %s\n", recording.ID, what, *location)
+				problems++
+			case key != *location:
+				fmt.Printf("rekey    recording %d %s: %s -> %s\n", recording.ID, what, *location, key)
+				*location = key
+				rekeyed = true
+			}
+		}
+		rekey("audio", &recording.AudioLocation)
+		if recording.ArtworkLocation != nil {
+			rekey("artwork", recording.ArtworkLocation)
+		}
+		if !rekeyed {
+			return nil
+		}
+		changed++
+		if *dryRun {
+			return nil
+		}
+		if err := repo.Update(recording, ctx); err != nil {
+			return fmt.Errorf("problem updating recording %d %w", recording.ID, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	verb := "rekeyed"
+	if *dryRun {
+		verb = "would rekey"
+	}
+	fmt.Fprintf(os.Stderr, "%s %d recordings, %d locations outside %s\n", verb, changed, problems, root)
+	if problems > 0 {
+		return fmt.Errorf("storage rekey found %d locations outside STORAGE_ROOT", problems)
+	}
+	return nil
+}
+
+// storageKey returns the key for a stored file location. A location under
+// one of storedPrefixes is already a key. Anything else is an old filesystem
+// path, made absolute against the working directory as the server saved it,
+// and must lie under root. ok is false when it doesn't.
+func storageKey(root, location string) (key string, ok bool) {
+	if !filepath.IsAbs(location) {
+		for _, prefix := range storedPrefixes {
+			if strings.HasPrefix(location, prefix) {
+				return location, true
+			}
+		}
+	}
+	path, err := filepath.Abs(location)
+	if err != nil {
+		return "", false
+	}
+	rel, err := filepath.Rel(root, path)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return filepath.ToSlash(rel), true
+}
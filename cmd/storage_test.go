@@ -0,0 +1,34 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStorageKey(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := filepath.Join(wd, "storage")
+
+	for _, tc := range []struct {
+		location, key string
+		ok            bool
+	}{
+		{"audio/ab12.wav", "audio/ab12.wav", true},
+		{"artwork/ab12.png", "artwork/ab12.png", true},
+		{filepath.Join(root, "audio", "ab12.wav"), "audio/ab12.wav", true},
+		{"storage/artwork/ab12.png", "artwork/ab12.png", true}, // relative to the working directory
+		{"/elsewhere/audio/ab12.wav", "", false},
+		{filepath.Join(root, "..", "audio", "ab12.wav"), "", false},
+		{root, "", false},
+	} {
+		key, ok := storageKey(root, tc.location)
+		assert.Equal(t, tc.ok, ok, tc.location)
+		assert.Equal(t, tc.key, key, tc.location)
+	}
+}
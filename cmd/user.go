@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"field_archive/server/entities"
+	"field_archive/server/repositories"
+	"field_archive/server/services"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// user runs the user subcommands: create, promote and disable.
+func user(args []string) error {
+	if len(args) == 0 {
+		return usageError("user needs create, promote or disable")
+	}
+
+	var run func(s services.UserService, ctx context.Context) error
+	switch args[0] {
+	case "create":
+		flags := flag.NewFlagSet("user create", flag.ExitOnError)
+		role := flags.String("role", entities.RoleContributor, "viewer, contributor, curator or admin")
+		fromStdin := flags.Bool("password-stdin", false, "read the password from the first line of stdin instead of generating one")
+		flags.Parse(args[1:])
+		if flags.NArg() != 2 {
+			return usageError("user create needs a username and an email")
+		}
+		run = func(s services.UserService, ctx context.Context) error {
+			return createUser(s, ctx, flags.Arg(0), flags.Arg(1), *role, *fromStdin)
+		}
+	case "promote":
+		if len(args) != 3 {
+			return usageError("user promote needs a username and a role")
+		}
+		run = func(s services.UserService, ctx context.Context) error {
+			u, err := s.SetRole(args[1], args[2], ctx)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("%s is now a %s\n", u.Username, u.Role)
+			return nil
+		}
+	case "disable":
+		if len(args) != 2 {
+			return usageError("user disable needs a username")
+		}
+		run = func(s services.UserService, ctx context.Context) error {
+			u, err := s.Disable(args[1], ctx)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("disabled %s at %s\n", u.Username, u.DisabledAt.Format("2006-01-02 15:04:05"))
+			return nil
+		}
+	default:
+		return usageError("unknown user command %q", args[0])
+	}
+
+	ctx := context.Background()
+	cfg, db, err := connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	// None of these issue tokens, so no signing keys are needed.
+	s := services.NewUserService(repositories.NewUserRepo(db), repositories.NewRefreshTokenRepo(db), nil, *cfg)
+	return run(s, ctx)
+}
+
+func createUser(s services.UserService, ctx context.Context, username, email, role string, fromStdin bool) error {
+	password, generated := "", false
+	if fromStdin {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" {
+			return fmt.Errorf("couldn't read a password from stdin %w", err)
+		}
+		password = strings.TrimRight(line, "\r\n")
+	} else {
+		b := make([]byte, 18)
+		if _, err := rand.Read(b); err != nil {
+			return err
+		}
+		password, generated = base64.RawURLEncoding.EncodeToString(b), true
+	}
+
+	u, err := s.Create(services.Registration{Username: username, Email: email, Password: password}, role, ctx)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("created %s %s (id %d)\n", u.Role, u.Username, u.ID)
+	if generated {
+		fmt.Printf("password: %s\n", password)
+	}
+	return nil
+}
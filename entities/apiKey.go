@@ -0,0 +1,19 @@
+package entities
+
+import "time"
+
+// APIKey is a long lived credential a user creates for scripts and devices
+// that can't log in interactively. Only a hash of the key is stored; Prefix
+// is kept so the owner can tell their keys apart. An empty Scopes grants
+// everything the user can do.
+type APIKey struct {
+	ID          int
+	UserID      int
+	Name        string
+	Prefix      string
+	KeyHash     string `json:"-"`
+	Scopes      []string
+	DateCreated time.Time
+	LastUsedAt  *time.Time
+	RevokedAt   *time.Time
+}
@@ -0,0 +1,36 @@
+package entities
+
+import "time"
+
+// Collection is a themed, ordered set of recordings such as a soundwalk, an
+// exhibition or a research dataset. Its visibility works as a recording's
+// does, without embargoes. RecordingIDs are in the collection's order.
+type Collection struct {
+	ID            int
+	Title         string
+	Description   string
+	CoverLocation *string
+	UserID        int
+	Visibility    string
+	DateCreated   time.Time
+	RecordingIDs  []int
+}
+
+// CollectionWithRecordings is a collection along with summaries of its
+// recordings, in order.
+type CollectionWithRecordings struct {
+	Collection
+	Recordings []RecordingSummary
+}
+
+// RecordingSummary is the part of a recording shown where it's listed
+// inside something else, such as a collection.
+type RecordingSummary struct {
+	ID            int
+	Title         string
+	RecordingDate time.Time
+	Duration      int
+	Format        string
+	LocationID    int
+	UserID        int
+}
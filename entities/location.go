@@ -1,10 +1,38 @@
 package entities
 
+// Location sensitivities. Sensitive locations, such as nesting sites of
+// protected species, are shown snapped to a coarse grid to everyone but
+// their owner and curators: low to a fine grid (1 km by default) and high to
+// a wide one (10 km by default).
+const (
+	SensitivityNone = "none"
+	SensitivityLow  = "low"
+	SensitivityHigh = "high"
+)
+
 type Location struct {
 	ID          int
 	Name        string
 	Description string
 	Geom        string
-	Longitude   *string
-	Latitude    *string
+	Longitude   *float64
+	Latitude    *float64
+	UserID      int
+	Sensitivity string
+}
+
+// LocationWithRecordings is a location along with the IDs of the recordings
+// made there.
+type LocationWithRecordings struct {
+	Location
+	RecordingIDs []int
+}
+
+// NearbyLocation is a location found by a spatial search. DistanceMetres is
+// the geodesic distance from the search point, or nil when the search had no
+// single point (a bounding box).
+type NearbyLocation struct {
+	Location
+	RecordingIDs   []int
+	DistanceMetres *float64
 }
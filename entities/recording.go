@@ -2,6 +2,16 @@ package entities
 
 import "time"
 
+// Recording visibilities. Public recordings are listed for everyone,
+// unlisted ones can be fetched by anyone who knows their ID and private ones
+// only by their owner and curators. A recording under embargo is treated as
+// private until EmbargoUntil passes, whatever its visibility.
+const (
+	VisibilityPublic   = "public"
+	VisibilityUnlisted = "unlisted"
+	VisibilityPrivate  = "private"
+)
+
 type Recording struct {
 	ID              int
 	Title           string
@@ -18,4 +28,28 @@ type Recording struct {
 	Size            float64
 	Channels        string
 	License         string
+	Visibility      string
+	EmbargoUntil    *time.Time
+}
+
+// RecordingPoint is a summary of a recording joined to the location it was
+// made at, for plotting recordings on a map.
+type RecordingPoint struct {
+	ID            int
+	Title         string
+	RecordingDate time.Time
+	Duration      int
+	Format        string
+	LocationID    int
+	LocationName  string
+	Geom          *string
+}
+
+// RecordingSearchResult is a recording matched by a full-text search, with its
+// relevance and a snippet of the matching text. Matched terms in the snippet
+// are wrapped in <mark> tags.
+type RecordingSearchResult struct {
+	Recording
+	Rank    float32
+	Snippet string
 }
@@ -0,0 +1,17 @@
+package entities
+
+import "time"
+
+// RefreshToken is a stored, hashed refresh token. Each refresh replaces the
+// token with a new one in the same family; UsedAt marks tokens that have
+// been replaced.
+type RefreshToken struct {
+	ID        int
+	UserID    int
+	FamilyID  string
+	TokenHash string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+	RevokedAt *time.Time
+}
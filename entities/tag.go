@@ -0,0 +1,8 @@
+package entities
+
+// Tag is a label such as "dawn chorus" or "hydrophone" used to group
+// recordings. Count is the number of recordings carrying it.
+type Tag struct {
+	Name  string
+	Count int
+}
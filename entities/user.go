@@ -0,0 +1,25 @@
+package entities
+
+import "time"
+
+// Roles, from least to most privileged. Viewers can only read, contributors
+// can add recordings and manage their own, curators can manage everyone's
+// recordings and the locations, and admins can do anything.
+const (
+	RoleViewer      = "viewer"
+	RoleContributor = "contributor"
+	RoleCurator     = "curator"
+	RoleAdmin       = "admin"
+)
+
+type User struct {
+	ID           int
+	Username     string
+	Email        string
+	PasswordHash string `json:"-"`
+	Role         string
+	DateCreated  time.Time
+	// DisabledAt is set once the user is disabled. Disabled users can't log
+	// in, and tokens and API keys they already hold stop working.
+	DisabledAt *time.Time
+}
@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"field_archive/server/services"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type APIKeyHandler struct {
+	Service services.APIKeyService
+}
+
+func NewAPIKeyHandler(s services.APIKeyService) *APIKeyHandler {
+	return &APIKeyHandler{Service: s}
+}
+
+type apiKeyRequest struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+}
+
+// Create makes a key for the current user. The response is the only time
+// the key itself is shown.
+func (h *APIKeyHandler) Create(c *gin.Context) {
+	var body apiKeyRequest
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "request body must contain a name and optional scopes"})
+		return
+	}
+	key, err := h.Service.Create(body.Name, body.Scopes, c.Request.Context())
+	if err != nil {
+		writeError(c, err, "api key", "unable to create api key")
+		return
+	}
+	c.JSON(http.StatusCreated, key)
+}
+
+// ListItems lists the current user's keys, without the keys themselves.
+func (h *APIKeyHandler) ListItems(c *gin.Context) {
+	keys, err := h.Service.List(c.Request.Context())
+	if err != nil {
+		writeError(c, err, "api key", "unable to fetch api keys")
+		return
+	}
+	c.JSON(http.StatusOK, keys)
+}
+
+// Revoke stops one of the current user's keys from being accepted.
+func (h *APIKeyHandler) Revoke(c *gin.Context) {
+	id, ok := pathID(c)
+	if !ok {
+		return
+	}
+	if err := h.Service.Revoke(id, c.Request.Context()); err != nil {
+		writeError(c, err, "api key", "unable to revoke api key")
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
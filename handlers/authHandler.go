@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"errors"
+	"field_archive/server/services"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type AuthHandler struct {
+	Service       services.UserService
+	Keys          *services.TokenKeys
+	SecureCookies bool
+}
+
+func NewAuthHandler(s services.UserService, keys *services.TokenKeys, secureCookies bool) *AuthHandler {
+	return &AuthHandler{Service: s, Keys: keys, SecureCookies: secureCookies}
+}
+
+type registerRequest struct {
+	Username string `json:"username"`
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+type loginRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+type refreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+const (
+	// RefreshCookie holds the refresh token for browser clients. It is only
+	// sent to the auth routes.
+	RefreshCookie     = "refresh_token"
+	refreshCookiePath = "/auth"
+)
+
+func (h *AuthHandler) Register(c *gin.Context) {
+	var body registerRequest
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "request body must contain a username, email and password"})
+		return
+	}
+	user, err := h.Service.Register(services.Registration{
+		Username: body.Username,
+		Email:    body.Email,
+		Password: body.Password,
+	}, c.Request.Context())
+	if err != nil {
+		writeError(c, err, "user", "unable to register user")
+		return
+	}
+	c.JSON(http.StatusCreated, user)
+}
+
+// Login returns an access token and a refresh token for the user, also
+// setting both as HTTP-only cookies for browser clients.
+func (h *AuthHandler) Login(c *gin.Context) {
+	var body loginRequest
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "request body must contain a username and password"})
+		return
+	}
+	tokens, err := h.Service.Login(body.Username, body.Password, c.Request.Context())
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidCredentials) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid username or password"})
+			return
+		}
+		writeError(c, err, "user", "unable to log in")
+		return
+	}
+	h.writeTokens(c, tokens)
+}
+
+// Refresh exchanges a refresh token, from the body or the refresh cookie,
+// for a new access and refresh token.
+func (h *AuthHandler) Refresh(c *gin.Context) {
+	token, ok := refreshTokenFrom(c)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "a refresh_token is required"})
+		return
+	}
+	tokens, err := h.Service.Refresh(token, c.Request.Context())
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidCredentials) {
+			h.clearCookies(c)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid or expired refresh token"})
+			return
+		}
+		writeError(c, err, "refresh token", "unable to refresh token")
+		return
+	}
+	h.writeTokens(c, tokens)
+}
+
+// Logout revokes the refresh token and clears the auth cookies.
+func (h *AuthHandler) Logout(c *gin.Context) {
+	if token, ok := refreshTokenFrom(c); ok {
+		if err := h.Service.Logout(token, c.Request.Context()); err != nil {
+			writeError(c, err, "refresh token", "unable to log out")
+			return
+		}
+	}
+	h.clearCookies(c)
+	c.Status(http.StatusNoContent)
+}
+
+// JWKS publishes the public keys tokens can be verified with, so other
+// services can check them without sharing a secret.
+func (h *AuthHandler) JWKS(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, h.Keys.JWKS())
+}
+
+func (h *AuthHandler) writeTokens(c *gin.Context, tokens services.TokenPair) {
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(TokenCookie, tokens.AccessToken, int(tokens.AccessExpiresIn.Seconds()), "/", "", h.SecureCookies, true)
+	c.SetCookie(RefreshCookie, tokens.RefreshToken, int(tokens.RefreshExpiresIn.Seconds()), refreshCookiePath, "", h.SecureCookies, true)
+	c.JSON(http.StatusOK, gin.H{
+		"token":              tokens.AccessToken,
+		"expires_in":         int(tokens.AccessExpiresIn.Seconds()),
+		"refresh_token":      tokens.RefreshToken,
+		"refresh_expires_in": int(tokens.RefreshExpiresIn.Seconds()),
+	})
+}
+
+func (h *AuthHandler) clearCookies(c *gin.Context) {
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(TokenCookie, "", -1, "/", "", h.SecureCookies, true)
+	c.SetCookie(RefreshCookie, "", -1, refreshCookiePath, "", h.SecureCookies, true)
+}
+
+// refreshTokenFrom reads the refresh token from a JSON body, falling back to
+// the refresh cookie.
+func refreshTokenFrom(c *gin.Context) (string, bool) {
+	var body refreshRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&body); err == nil && body.RefreshToken != "" {
+			return body.RefreshToken, true
+		}
+	}
+	if cookie, err := c.Cookie(RefreshCookie); err == nil && cookie != "" {
+		return cookie, true
+	}
+	return "", false
+}
@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"errors"
+	"field_archive/server/entities"
+	"field_archive/server/services"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// TokenCookie is the HTTP-only cookie Login stores the access token in,
+	// for browser clients that don't send an Authorization header.
+	TokenCookie = "access_token"
+	// APIKeyHeader carries an API key, for scripts and devices that can't
+	// log in interactively.
+	APIKeyHeader = "X-API-Key"
+
+	userContextKey   = "user"
+	apiKeyContextKey = "api_key"
+)
+
+// AuthMiddleware resolves the caller from an API key, a Bearer token or the
+// token cookie and gates route groups on who they are.
+type AuthMiddleware struct {
+	Service services.UserService
+	Keys    services.APIKeyService
+}
+
+func NewAuthMiddleware(s services.UserService, keys services.APIKeyService) *AuthMiddleware {
+	return &AuthMiddleware{Service: s, Keys: keys}
+}
+
+// Public lets every request through, placing the user in the context when
+// valid credentials are given. Bad credentials are ignored so a stale cookie
+// doesn't lock anyone out of public pages.
+func (m *AuthMiddleware) Public() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		m.identify(c)
+		c.Next()
+	}
+}
+
+// Authenticated rejects requests without valid credentials with a 401.
+func (m *AuthMiddleware) Authenticated() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, ok := m.require(c); ok {
+			c.Next()
+		}
+	}
+}
+
+// Admin rejects requests without valid credentials with a 401, and those
+// from anyone but an admin with a 403.
+func (m *AuthMiddleware) Admin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := m.require(c)
+		if !ok {
+			return
+		}
+		if user.Role != entities.RoleAdmin {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "admin access required"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// CurrentUser returns the user the request was authenticated as, if any.
+func CurrentUser(c *gin.Context) (entities.User, bool) {
+	v, ok := c.Get(userContextKey)
+	if !ok {
+		return entities.User{}, false
+	}
+	user, ok := v.(entities.User)
+	return user, ok
+}
+
+// CurrentAPIKey returns the API key the request was authenticated with, if
+// it was made with one.
+func CurrentAPIKey(c *gin.Context) (entities.APIKey, bool) {
+	v, ok := c.Get(apiKeyContextKey)
+	if !ok {
+		return entities.APIKey{}, false
+	}
+	key, ok := v.(entities.APIKey)
+	return key, ok
+}
+
+func (m *AuthMiddleware) require(c *gin.Context) (entities.User, bool) {
+	user, found, err := m.identify(c)
+	if err == nil && found {
+		return user, true
+	}
+	c.Header("WWW-Authenticate", `Bearer realm="field_archive"`)
+	switch {
+	case err == nil:
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
+	case errors.Is(err, services.ErrInvalidCredentials) && c.GetHeader(APIKeyHeader) != "":
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid or revoked api key"})
+	case errors.Is(err, services.ErrInvalidCredentials):
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid or expired token"})
+	default:
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "unable to authenticate"})
+	}
+	return entities.User{}, false
+}
+
+// identify authenticates the request's credentials, if it has any, and
+// stores the user in the gin context and the request context services
+// authorize against. An API key takes precedence over a token. found
+// reports whether credentials were given at all.
+func (m *AuthMiddleware) identify(c *gin.Context) (user entities.User, found bool, err error) {
+	if apiKey := c.GetHeader(APIKeyHeader); apiKey != "" && m.Keys != nil {
+		user, key, err := m.Keys.Authenticate(apiKey, c.Request.Context())
+		if err != nil {
+			return entities.User{}, true, err
+		}
+		c.Set(userContextKey, user)
+		c.Set(apiKeyContextKey, key)
+		ctx := services.WithAPIKey(services.WithUser(c.Request.Context(), user), key)
+		c.Request = c.Request.WithContext(ctx)
+		return user, true, nil
+	}
+	token, found := requestToken(c)
+	if !found {
+		return entities.User{}, false, nil
+	}
+	user, err = m.Service.Authenticate(token, c.Request.Context())
+	if err != nil {
+		return entities.User{}, true, err
+	}
+	c.Set(userContextKey, user)
+	c.Request = c.Request.WithContext(services.WithUser(c.Request.Context(), user))
+	return user, true, nil
+}
+
+// requestToken reads the token from the Authorization header, falling back
+// to the token cookie.
+func requestToken(c *gin.Context) (string, bool) {
+	if header := c.GetHeader("Authorization"); header != "" {
+		scheme, token, ok := strings.Cut(header, " ")
+		if !ok || !strings.EqualFold(scheme, "Bearer") {
+			return "", true
+		}
+		return strings.TrimSpace(token), true
+	}
+	if cookie, err := c.Cookie(TokenCookie); err == nil && cookie != "" {
+		return cookie, true
+	}
+	return "", false
+}
@@ -0,0 +1,183 @@
+package handlers
+
+import (
+	"errors"
+	"field_archive/server/entities"
+	"field_archive/server/internal/metrics"
+	"field_archive/server/internal/storage"
+	"field_archive/server/services"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+const defaultCollectionLimit = 100
+
+// CollectionHandler serves collections and their cover images, which are
+// read from Store.
+type CollectionHandler struct {
+	Service        services.CollectionService
+	Store          storage.Blob
+	MaxUploadBytes int64
+	// Metrics, if set, records the sizes of accepted covers.
+	Metrics *metrics.Metrics
+}
+
+func NewCollectionHandler(s services.CollectionService, store storage.Blob, maxUploadBytes int64) *CollectionHandler {
+	return &CollectionHandler{Service: s, Store: store, MaxUploadBytes: maxUploadBytes}
+}
+
+// collectionRequest is the JSON body accepted by Create and Update. A missing
+// recording_ids leaves an existing collection's recordings as they are.
+type collectionRequest struct {
+	Title        string `json:"title"`
+	Description  string `json:"description"`
+	Visibility   string `json:"visibility"`
+	RecordingIDs []int  `json:"recording_ids"`
+}
+
+func (r collectionRequest) toEntity(id int) entities.Collection {
+	return entities.Collection{
+		ID:           id,
+		Title:        r.Title,
+		Description:  r.Description,
+		Visibility:   r.Visibility,
+		RecordingIDs: r.RecordingIDs,
+	}
+}
+
+// GetByID serves a collection with summaries of its recordings, in order.
+func (h *CollectionHandler) GetByID(c *gin.Context) {
+	id, ok := pathID(c)
+	if !ok {
+		return
+	}
+	collection, err := h.Service.GetByID(id, c.Request.Context())
+	if err != nil {
+		writeError(c, err, "collection", "unable to fetch collection")
+		return
+	}
+	c.JSON(http.StatusOK, collection)
+}
+
+func (h *CollectionHandler) ListItems(c *gin.Context) {
+	limit := defaultCollectionLimit
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be a valid integer"})
+			return
+		}
+		limit = n
+	}
+	collections, err := h.Service.ListItems(limit, c.Request.Context())
+	if err != nil {
+		writeError(c, err, "collection", "unable to retrieve collections")
+		return
+	}
+	c.JSON(http.StatusOK, collections)
+}
+
+func (h *CollectionHandler) Create(c *gin.Context) {
+	var body collectionRequest
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "request body must be a valid collection"})
+		return
+	}
+	id, err := h.Service.Create(body.toEntity(0), c.Request.Context())
+	if err != nil {
+		writeError(c, err, "collection", "unable to create collection")
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"id": id})
+}
+
+func (h *CollectionHandler) Update(c *gin.Context) {
+	id, ok := pathID(c)
+	if !ok {
+		return
+	}
+	var body collectionRequest
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "request body must be a valid collection"})
+		return
+	}
+	collection, err := h.Service.Update(body.toEntity(id), c.Request.Context())
+	if err != nil {
+		writeError(c, err, "collection", "unable to update collection")
+		return
+	}
+	c.JSON(http.StatusOK, collection)
+}
+
+func (h *CollectionHandler) Delete(c *gin.Context) {
+	id, ok := pathID(c)
+	if !ok {
+		return
+	}
+	if err := h.Service.Delete(id, c.Request.Context()); err != nil {
+		writeError(c, err, "collection", "unable to delete collection")
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// SetCover accepts a multipart form holding a "cover" image, replacing the
+// collection's current one.
+func (h *CollectionHandler) SetCover(c *gin.Context) {
+	id, ok := pathID(c)
+	if !ok {
+		return
+	}
+	if h.MaxUploadBytes > 0 {
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, h.MaxUploadBytes)
+	}
+	header, err := c.FormFile("cover")
+	if err != nil {
+		var maxErr *http.MaxBytesError
+		switch {
+		case errors.As(err, &maxErr):
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "upload is too large"})
+		case errors.Is(err, http.ErrMissingFile):
+			verr := &services.ValidationError{}
+			verr.Add("cover", "a cover image is required")
+			validationFailed(c, verr)
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "request must be a multipart form"})
+		}
+		return
+	}
+	f, err := header.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unable to read cover image"})
+		return
+	}
+	defer f.Close()
+
+	collection, err := h.Service.SetCover(id, services.Upload{Filename: header.Filename, Content: f}, c.Request.Context())
+	if err != nil {
+		writeError(c, err, "collection", "unable to update cover")
+		return
+	}
+	h.Metrics.Uploaded(metrics.UploadCover, header.Size)
+	c.JSON(http.StatusOK, collection)
+}
+
+// Cover serves a collection's cover image.
+func (h *CollectionHandler) Cover(c *gin.Context) {
+	id, ok := pathID(c)
+	if !ok {
+		return
+	}
+	collection, err := h.Service.GetByID(id, c.Request.Context())
+	if err != nil {
+		writeError(c, err, "collection", "unable to fetch collection")
+		return
+	}
+	if collection.CoverLocation == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "cover not found"})
+		return
+	}
+	serveBlob(c, h.Store, *collection.CoverLocation, "cover", collection.Visibility == entities.VisibilityPrivate)
+}
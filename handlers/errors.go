@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"errors"
+	"field_archive/server/repositories"
+	"field_archive/server/services"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// writeError maps service errors onto a status code, falling back to a 500
+// with msg. resource names the thing that was missing for a 404 or already
+// existed for a 409.
+func writeError(c *gin.Context, err error, resource, msg string) {
+	var verr *services.ValidationError
+	switch {
+	case errors.As(err, &verr):
+		validationFailed(c, verr)
+	case errors.Is(err, repositories.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": resource + " not found"})
+	case errors.Is(err, repositories.ErrConflict):
+		c.JSON(http.StatusConflict, gin.H{"error": resource + " already exists"})
+	case errors.Is(err, services.ErrForbidden):
+		c.JSON(http.StatusForbidden, gin.H{"error": "not allowed to change this " + resource})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+	}
+}
+
+func validationFailed(c *gin.Context, verr *services.ValidationError) {
+	c.JSON(http.StatusBadRequest, gin.H{
+		"error":  "validation failed",
+		"fields": verr.Fields,
+	})
+}
+
+// pathID reads the ":id" route parameter, writing a 400 if it isn't an integer.
+func pathID(c *gin.Context) (int, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "ID must be a valid integer",
+		})
+		return 0, false
+	}
+	return id, true
+}
@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"field_archive/server/internal/health"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type HealthHandler struct {
+	Checker *health.Checker
+}
+
+func NewHealthHandler(checker *health.Checker) *HealthHandler {
+	return &HealthHandler{Checker: checker}
+}
+
+// Live reports that the process is up and serving. It deliberately checks
+// nothing else, so a failing dependency doesn't get the process restarted.
+func (h *HealthHandler) Live(c *gin.Context) {
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, gin.H{"Status": health.StatusOK})
+}
+
+// Ready reports on each dependency, with 503 Service Unavailable unless they
+// are all ok. Anyone can ask, so why a check failed is logged rather than
+// answered, as the errors can name hosts and paths.
+func (h *HealthHandler) Ready(c *gin.Context) {
+	report := h.Checker.Run(c.Request.Context())
+	status := http.StatusOK
+	if report.Status != health.StatusOK {
+		status = http.StatusServiceUnavailable
+	}
+	for name, result := range report.Checks {
+		if result.Error != "" {
+			log.Printf("Readiness check %s failing: %s", name, result.Error)
+			report.Checks[name] = health.Result{Status: result.Status}
+		}
+	}
+	c.Header("Cache-Control", "no-store")
+	c.JSON(status, report)
+}
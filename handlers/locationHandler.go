@@ -0,0 +1,231 @@
+package handlers
+
+import (
+	"errors"
+	"field_archive/server/entities"
+	"field_archive/server/internal/geojson"
+	"field_archive/server/repositories"
+	"field_archive/server/services"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultLocationLimit = 100
+	defaultNearest       = 10
+)
+
+type LocationHandler struct {
+	Service services.LocationService
+}
+
+func NewLocationHandler(s services.LocationService) *LocationHandler {
+	return &LocationHandler{Service: s}
+}
+
+// locationRequest is the JSON body accepted by Create and Update.
+type locationRequest struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Latitude    *float64 `json:"latitude"`
+	Longitude   *float64 `json:"longitude"`
+	Sensitivity string   `json:"sensitivity"`
+}
+
+func (r locationRequest) toEntity(id int) entities.Location {
+	return entities.Location{
+		ID:          id,
+		Name:        r.Name,
+		Description: r.Description,
+		Latitude:    r.Latitude,
+		Longitude:   r.Longitude,
+		Sensitivity: r.Sensitivity,
+	}
+}
+
+func (h *LocationHandler) GetByID(c *gin.Context) {
+	id, ok := pathID(c)
+	if !ok {
+		return
+	}
+	location, err := h.Service.GetByID(id, c.Request.Context())
+	if err != nil {
+		writeError(c, err, "location", "unable to fetch location")
+		return
+	}
+	c.JSON(http.StatusOK, location)
+}
+
+// ListItems lists locations, optionally narrowed by one spatial filter:
+// ?bbox=minLon,minLat,maxLon,maxLat, ?near=lat,lon&radius_m= or
+// ?nearest=lat,lon&k=.
+func (h *LocationHandler) ListItems(c *gin.Context) {
+	limit := defaultLocationLimit
+	if v := c.Query("limit"); v != "" {
+		var err error
+		limit, err = strconv.Atoi(v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "limit must be valid integer",
+			})
+			return
+		}
+	}
+
+	bbox, near, nearest := c.Query("bbox"), c.Query("near"), c.Query("nearest")
+	filters := 0
+	for _, f := range []string{bbox, near, nearest} {
+		if f != "" {
+			filters++
+		}
+	}
+	if filters > 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "only one of bbox, near or nearest may be given"})
+		return
+	}
+	if filters == 1 {
+		h.search(c, limit)
+		return
+	}
+
+	locations, err := h.Service.ListItems(limit, c.Request.Context())
+	if err != nil {
+		writeError(c, err, "location", "Unable to retrieve items")
+		return
+	}
+	c.JSON(http.StatusOK, locations)
+}
+
+func (h *LocationHandler) search(c *gin.Context, limit int) {
+	verr := &services.ValidationError{}
+	var (
+		locations []entities.NearbyLocation
+		err       error
+	)
+	switch {
+	case c.Query("bbox") != "":
+		box, ok := parseFloats(c.Query("bbox"), 4)
+		if !ok {
+			verr.Add("bbox", "must be four comma separated numbers: minLon,minLat,maxLon,maxLat")
+			break
+		}
+		locations, err = h.Service.WithinBounds(c.Request.Context(), box[0], box[1], box[2], box[3], limit)
+	case c.Query("near") != "":
+		point, ok := parseFloats(c.Query("near"), 2)
+		if !ok {
+			verr.Add("near", "must be two comma separated numbers: lat,lon")
+		}
+		radius, perr := strconv.ParseFloat(c.Query("radius_m"), 64)
+		if perr != nil {
+			verr.Add("radius_m", "is required with near and must be a number")
+		}
+		if verr.HasErrors() {
+			break
+		}
+		locations, err = h.Service.WithinRadius(c.Request.Context(), point[0], point[1], radius, limit)
+	default:
+		point, ok := parseFloats(c.Query("nearest"), 2)
+		if !ok {
+			verr.Add("nearest", "must be two comma separated numbers: lat,lon")
+		}
+		k := defaultNearest
+		if v := c.Query("k"); v != "" {
+			var perr error
+			if k, perr = strconv.Atoi(v); perr != nil {
+				verr.Add("k", "must be a valid integer")
+			}
+		}
+		if verr.HasErrors() {
+			break
+		}
+		locations, err = h.Service.Nearest(c.Request.Context(), point[0], point[1], k)
+	}
+	if verr.HasErrors() {
+		validationFailed(c, verr)
+		return
+	}
+	if err != nil {
+		writeError(c, err, "location", "unable to search locations")
+		return
+	}
+	c.JSON(http.StatusOK, locations)
+}
+
+// parseFloats splits a comma separated list of exactly n numbers.
+func parseFloats(v string, n int) ([]float64, bool) {
+	parts := strings.Split(v, ",")
+	if len(parts) != n {
+		return nil, false
+	}
+	res := make([]float64, n)
+	for i, p := range parts {
+		f, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+		if err != nil {
+			return nil, false
+		}
+		res[i] = f
+	}
+	return res, true
+}
+
+func (h *LocationHandler) Create(c *gin.Context) {
+	var body locationRequest
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "request body must be a valid location"})
+		return
+	}
+	id, err := h.Service.Create(body.toEntity(0), c.Request.Context())
+	if err != nil {
+		writeError(c, err, "location", "unable to create location")
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"id": id})
+}
+
+func (h *LocationHandler) Update(c *gin.Context) {
+	id, ok := pathID(c)
+	if !ok {
+		return
+	}
+	var body locationRequest
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "request body must be a valid location"})
+		return
+	}
+	location, err := h.Service.Update(body.toEntity(id), c.Request.Context())
+	if err != nil {
+		writeError(c, err, "location", "unable to update location")
+		return
+	}
+	c.JSON(http.StatusOK, location)
+}
+
+func (h *LocationHandler) Delete(c *gin.Context) {
+	id, ok := pathID(c)
+	if !ok {
+		return
+	}
+	if err := h.Service.Delete(id, c.Request.Context()); err != nil {
+		if errors.Is(err, repositories.ErrConflict) {
+			c.JSON(http.StatusConflict, gin.H{"error": "location is still used by recordings"})
+			return
+		}
+		writeError(c, err, "location", "unable to delete location")
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// GeoJSON writes every location as an RFC 7946 FeatureCollection.
+func (h *LocationHandler) GeoJSON(c *gin.Context) {
+	fc, err := h.Service.FeatureCollection(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "unable to build location features"})
+		return
+	}
+	c.Header("Content-Type", geojson.ContentType)
+	c.JSON(http.StatusOK, fc)
+}
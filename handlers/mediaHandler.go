@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"errors"
+	"field_archive/server/entities"
+	"field_archive/server/internal/metrics"
+	"field_archive/server/internal/storage"
+	"field_archive/server/services"
+	"net/http"
+	"path"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// MediaHandler serves the audio and artwork files of recordings. Files are
+// looked up by recording ID and only ever read from Store.
+type MediaHandler struct {
+	Service services.RecordingService
+	Store   storage.Blob
+	// Metrics, if set, counts the bytes of audio served.
+	Metrics *metrics.Metrics
+}
+
+func NewMediaHandler(s services.RecordingService, store storage.Blob) *MediaHandler {
+	return &MediaHandler{Service: s, Store: store}
+}
+
+// Audio streams a recording's audio file. Range requests and ETag or
+// Last-Modified conditional requests are supported so players can seek.
+// Recordings the caller can't see are reported as not found.
+func (h *MediaHandler) Audio(c *gin.Context) {
+	id, ok := pathID(c)
+	if !ok {
+		return
+	}
+	recording, err := h.Service.GetByID(id, c.Request.Context())
+	if err != nil {
+		writeError(c, err, "recording", "unable to fetch recording")
+		return
+	}
+	h.serve(c, recording, recording.AudioLocation, "audio file")
+	// Only audio counts, not error bodies. Ranges count what was sent.
+	if c.Writer.Status() < http.StatusMultipleChoices {
+		h.Metrics.AudioServed(c.Writer.Size())
+	}
+}
+
+// Artwork serves a recording's artwork image.
+func (h *MediaHandler) Artwork(c *gin.Context) {
+	id, ok := pathID(c)
+	if !ok {
+		return
+	}
+	recording, err := h.Service.GetByID(id, c.Request.Context())
+	if err != nil {
+		writeError(c, err, "recording", "unable to fetch recording")
+		return
+	}
+	if recording.ArtworkLocation == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "artwork not found"})
+		return
+	}
+	h.serve(c, recording, *recording.ArtworkLocation, "artwork")
+}
+
+func (h *MediaHandler) serve(c *gin.Context, recording entities.Recording, key, resource string) {
+	private := recording.Visibility == entities.VisibilityPrivate ||
+		recording.EmbargoUntil != nil && recording.EmbargoUntil.After(time.Now())
+	serveBlob(c, h.Store, key, resource, private)
+}
+
+// serveBlob writes the stored object key, supporting range and conditional
+// requests. Only objects anyone may fetch can be kept by shared caches, so
+// private ones are marked as such.
+func serveBlob(c *gin.Context, store storage.Blob, key, resource string, private bool) {
+	obj, info, err := store.Get(c.Request.Context(), key)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) || errors.Is(err, storage.ErrInvalidKey) {
+			c.JSON(http.StatusNotFound, gin.H{"error": resource + " not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "unable to open " + resource})
+		return
+	}
+	defer obj.Close()
+
+	c.Header("Content-Type", info.ContentType)
+	if info.ETag != "" {
+		c.Header("ETag", info.ETag)
+	}
+	if private {
+		c.Header("Cache-Control", "private, no-cache")
+	} else {
+		c.Header("Cache-Control", "no-cache")
+	}
+	http.ServeContent(c.Writer, c.Request, path.Base(key), info.ModTime, obj)
+}
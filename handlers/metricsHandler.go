@@ -0,0 +1,34 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"field_archive/server/internal/metrics"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type MetricsHandler struct {
+	Metrics *metrics.Metrics
+	// Token, if set, must be presented as a bearer token to scrape.
+	Token string
+}
+
+func NewMetricsHandler(m *metrics.Metrics, token string) *MetricsHandler {
+	return &MetricsHandler{Metrics: m, Token: token}
+}
+
+// Scrape serves the metrics for Prometheus. Scrapers aren't users, so the
+// token is checked here rather than through the auth middleware.
+func (h *MetricsHandler) Scrape(c *gin.Context) {
+	if h.Token != "" {
+		given := []byte(c.GetHeader("Authorization"))
+		want := []byte("Bearer " + h.Token)
+		if subtle.ConstantTimeCompare(given, want) != 1 {
+			c.Header("WWW-Authenticate", `Bearer realm="metrics"`)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid or missing metrics token"})
+			return
+		}
+	}
+	h.Metrics.Handler().ServeHTTP(c.Writer, c.Request)
+}
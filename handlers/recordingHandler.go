@@ -1,20 +1,28 @@
 package handlers
 
 import (
+	"errors"
+	"field_archive/server/entities"
+	"field_archive/server/internal/geojson"
+	"field_archive/server/internal/metrics"
 	"field_archive/server/services"
-	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
 type RecordingHandler struct {
-	Service services.RecordingService
+	Service        services.RecordingService
+	MaxUploadBytes int64
+	// Metrics, if set, records the sizes of accepted uploads.
+	Metrics *metrics.Metrics
 }
 
-func NewRecordingHandler(s services.RecordingService) *RecordingHandler {
-	return &RecordingHandler{Service: s}
+func NewRecordingHandler(s services.RecordingService, maxUploadBytes int64) *RecordingHandler {
+	return &RecordingHandler{Service: s, MaxUploadBytes: maxUploadBytes}
 }
 
 func (h *RecordingHandler) GetByID(c *gin.Context) {
@@ -28,34 +36,142 @@ func (h *RecordingHandler) GetByID(c *gin.Context) {
 	}
 	record, err := h.Service.GetByID(id, c.Request.Context())
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "unable to fetch recording"})
+		writeError(c, err, "recording", "unable to fetch recording")
 		return
 	}
 	c.JSON(http.StatusOK, record)
 }
 
+// ListItems serves a page of recordings. Results are ordered by ?sort= (one
+// of recording_date, date_uploaded, title, duration) and ?order=asc|desc,
+// newest first by default, and can be narrowed by the recording filters.
+// ?tag= may be repeated or comma separated, matching recordings with any of
+// the tags, or all of them with ?tag_match=all.
+// Pages are walked by passing back the returned next_cursor as ?cursor=.
 func (h *RecordingHandler) ListItems(c *gin.Context) {
-	Param := c.Param("limit")
-	limit, err := strconv.Atoi(Param)
+	params, verr := listParamsFromQuery(c)
+	if verr.HasErrors() {
+		validationFailed(c, verr)
+		return
+	}
+	page, err := h.Service.ListPage(params, c.Request.Context())
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "limit must be valid integer",
-		})
+		writeError(c, err, "recording", "Unable to retrieve items")
 		return
 	}
-	recordings, err := h.Service.ListItems(limit, c.Request.Context())
-	fmt.Println(err)
+	c.JSON(http.StatusOK, page)
+}
+
+// Search serves a page of full-text search results for ?q=, using the same
+// ?limit= and ?cursor= paging as ListItems.
+func (h *RecordingHandler) Search(c *gin.Context) {
+	verr := &services.ValidationError{}
+	params := services.RecordingSearchParams{
+		Query:  c.Query("q"),
+		Limit:  services.DefaultPageSize,
+		Cursor: c.Query("cursor"),
+	}
+	if v := c.Query("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil {
+			verr.Add("limit", "must be a valid integer")
+		}
+		params.Limit = limit
+	}
+	if verr.HasErrors() {
+		validationFailed(c, verr)
+		return
+	}
+	page, err := h.Service.Search(params, c.Request.Context())
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "Unable to retrieve items",
-		})
+		writeError(c, err, "recording", "unable to search recordings")
 		return
 	}
-	c.JSON(http.StatusOK, recordings)
+	c.JSON(http.StatusOK, page)
+}
+
+func listParamsFromQuery(c *gin.Context) (services.RecordingListParams, *services.ValidationError) {
+	verr := &services.ValidationError{}
+	params := services.RecordingListParams{
+		Sort:   c.Query("sort"),
+		Limit:  services.DefaultPageSize,
+		Cursor: c.Query("cursor"),
+	}
+	if v := c.Query("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil {
+			verr.Add("limit", "must be a valid integer")
+		}
+		params.Limit = limit
+	}
+	switch c.Query("order") {
+	case "asc":
+	case "desc":
+		params.Desc = true
+	case "":
+		params.Desc = params.Sort == "" || params.Sort == "recording_date" || params.Sort == "date_uploaded"
+	default:
+		verr.Add("order", "must be asc or desc")
+	}
+
+	f := &params.Filter
+	f.LocationID = queryInt(c, verr, "location_id")
+	f.UserID = queryInt(c, verr, "user_id")
+	f.Format = queryString(c, "format")
+	f.License = queryString(c, "license")
+	f.Channels = queryString(c, "channels")
+	f.MinDuration = queryInt(c, verr, "min_duration")
+	f.MaxDuration = queryInt(c, verr, "max_duration")
+	f.RecordedAfter = queryDate(c, verr, "recorded_after")
+	f.RecordedBefore = queryDate(c, verr, "recorded_before")
+	for _, v := range c.QueryArray("tag") {
+		f.Tags = append(f.Tags, strings.Split(v, ",")...)
+	}
+	switch c.Query("tag_match") {
+	case "", "any":
+	case "all":
+		f.AllTags = true
+	default:
+		verr.Add("tag_match", "must be any or all")
+	}
+	return params, verr
+}
+
+func queryString(c *gin.Context, key string) *string {
+	if v, ok := c.GetQuery(key); ok && v != "" {
+		return &v
+	}
+	return nil
+}
+
+func queryInt(c *gin.Context, verr *services.ValidationError, key string) *int {
+	v := c.Query(key)
+	if v == "" {
+		return nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		verr.Add(key, "must be a valid integer")
+		return nil
+	}
+	return &n
+}
+
+func queryDate(c *gin.Context, verr *services.ValidationError, key string) *time.Time {
+	v := c.Query(key)
+	if v == "" {
+		return nil
+	}
+	t, err := parseDate(v)
+	if err != nil {
+		verr.Add(key, "must be an RFC 3339 timestamp or YYYY-MM-DD date")
+		return nil
+	}
+	return &t
 }
 
 func (h *RecordingHandler) GetCount(c *gin.Context) {
-	count, err := h.Service.GetCount(c)
+	count, err := h.Service.GetCount(c.Request.Context())
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "unable to get count",
@@ -64,3 +180,264 @@ func (h *RecordingHandler) GetCount(c *gin.Context) {
 	}
 	c.JSON(http.StatusOK, count)
 }
+
+// Create accepts a multipart form holding an "audio" file, an optional
+// "artwork" file and the recording's metadata fields. The recording is owned
+// by the authenticated user.
+func (h *RecordingHandler) Create(c *gin.Context) {
+	if h.MaxUploadBytes > 0 {
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, h.MaxUploadBytes)
+	}
+	form, err := c.MultipartForm()
+	if err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "upload is too large"})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "request must be a multipart form"})
+		return
+	}
+	defer form.RemoveAll()
+
+	recording, verr := recordingFromForm(c)
+	if user, ok := CurrentUser(c); ok {
+		recording.UserID = user.ID
+	}
+
+	var audio services.Upload
+	audioHeader, err := c.FormFile("audio")
+	if err != nil {
+		verr.Add("audio", "an audio file is required")
+	} else {
+		f, err := audioHeader.Open()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "unable to read audio file"})
+			return
+		}
+		defer f.Close()
+		audio = services.Upload{Filename: audioHeader.Filename, Content: f}
+	}
+
+	var artwork *services.Upload
+	var artworkSize int64
+	if artworkHeader, err := c.FormFile("artwork"); err == nil {
+		f, err := artworkHeader.Open()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "unable to read artwork file"})
+			return
+		}
+		defer f.Close()
+		artwork = &services.Upload{Filename: artworkHeader.Filename, Content: f}
+		artworkSize = artworkHeader.Size
+	} else if !errors.Is(err, http.ErrMissingFile) {
+		verr.Add("artwork", "unable to read artwork file")
+	}
+
+	if verr.HasErrors() {
+		validationFailed(c, verr)
+		return
+	}
+
+	id, err := h.Service.Create(recording, audio, artwork, c.Request.Context())
+	if err != nil {
+		writeError(c, err, "recording", "unable to create recording")
+		return
+	}
+	h.Metrics.Uploaded(metrics.UploadAudio, audioHeader.Size)
+	if artwork != nil {
+		h.Metrics.Uploaded(metrics.UploadArtwork, artworkSize)
+	}
+	c.JSON(http.StatusCreated, gin.H{"id": id})
+}
+
+// recordingRequest is the JSON body accepted by Update and Patch. Fields are
+// pointers so a patch can tell an omitted field from a zero value. An empty
+// embargo_until lifts the embargo.
+type recordingRequest struct {
+	Title         *string `json:"title"`
+	RecordingDate *string `json:"recording_date"`
+	LocationID    *int    `json:"location_id"`
+	UserID        *int    `json:"user_id"`
+	Description   *string `json:"description"`
+	Equipment     *string `json:"equipment"`
+	License       *string `json:"license"`
+	Visibility    *string `json:"visibility"`
+	EmbargoUntil  *string `json:"embargo_until"`
+}
+
+func (r recordingRequest) toPatch() (services.RecordingPatch, *services.ValidationError) {
+	verr := &services.ValidationError{}
+	patch := services.RecordingPatch{
+		Title:       r.Title,
+		LocationID:  r.LocationID,
+		UserID:      r.UserID,
+		Description: r.Description,
+		Equipment:   r.Equipment,
+		License:     r.License,
+		Visibility:  r.Visibility,
+	}
+	if r.RecordingDate != nil {
+		date, err := parseDate(*r.RecordingDate)
+		if err != nil {
+			verr.Add("recording_date", "must be an RFC 3339 timestamp or YYYY-MM-DD date")
+		}
+		patch.RecordingDate = &date
+	}
+	if r.EmbargoUntil != nil {
+		var until time.Time
+		if *r.EmbargoUntil != "" {
+			var err error
+			if until, err = parseDate(*r.EmbargoUntil); err != nil {
+				verr.Add("embargo_until", "must be an RFC 3339 timestamp or YYYY-MM-DD date")
+			}
+		}
+		patch.EmbargoUntil = &until
+	}
+	return patch, verr
+}
+
+// Update replaces a recording's metadata with the JSON body. Omitted fields
+// are cleared, so validation applies as it does on upload, except visibility
+// and embargo_until, which are kept unless given. An empty embargo_until
+// lifts the embargo.
+func (h *RecordingHandler) Update(c *gin.Context) {
+	id, ok := pathID(c)
+	if !ok {
+		return
+	}
+	var body recordingRequest
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "request body must be a valid recording"})
+		return
+	}
+	patch, verr := body.toPatch()
+	if verr.HasErrors() {
+		validationFailed(c, verr)
+		return
+	}
+	recording := entities.Recording{ID: id}
+	patch.Apply(&recording)
+	// Passed as given: nil keeps the embargo, zero lifts it.
+	recording.EmbargoUntil = patch.EmbargoUntil
+
+	updated, err := h.Service.Update(recording, c.Request.Context())
+	if err != nil {
+		writeError(c, err, "recording", "unable to update recording")
+		return
+	}
+	c.JSON(http.StatusOK, updated)
+}
+
+// Patch updates only the fields present in the JSON body.
+func (h *RecordingHandler) Patch(c *gin.Context) {
+	id, ok := pathID(c)
+	if !ok {
+		return
+	}
+	var body recordingRequest
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "request body must be a valid recording"})
+		return
+	}
+	patch, verr := body.toPatch()
+	if verr.HasErrors() {
+		validationFailed(c, verr)
+		return
+	}
+	updated, err := h.Service.Patch(id, patch, c.Request.Context())
+	if err != nil {
+		writeError(c, err, "recording", "unable to update recording")
+		return
+	}
+	c.JSON(http.StatusOK, updated)
+}
+
+// Rescan re-reads the recording's audio file to refresh the properties taken
+// from it.
+func (h *RecordingHandler) Rescan(c *gin.Context) {
+	id, ok := pathID(c)
+	if !ok {
+		return
+	}
+	recording, err := h.Service.Rescan(id, c.Request.Context())
+	if err != nil {
+		writeError(c, err, "recording", "unable to rescan recording")
+		return
+	}
+	c.JSON(http.StatusOK, recording)
+}
+
+func (h *RecordingHandler) Delete(c *gin.Context) {
+	id, ok := pathID(c)
+	if !ok {
+		return
+	}
+	if err := h.Service.Delete(id, c.Request.Context()); err != nil {
+		writeError(c, err, "recording", "unable to delete recording")
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// recordingFromForm reads the metadata fields of a recording out of the
+// request's form values, noting any that can't be parsed.
+func recordingFromForm(c *gin.Context) (entities.Recording, *services.ValidationError) {
+	verr := &services.ValidationError{}
+	recording := entities.Recording{
+		Title:       c.PostForm("title"),
+		Format:      c.PostForm("format"),
+		Description: c.PostForm("description"),
+		Equipment:   c.PostForm("equipment"),
+		Channels:    c.PostForm("channels"),
+		License:     c.PostForm("license"),
+		Visibility:  c.PostForm("visibility"),
+	}
+	if v := c.PostForm("recording_date"); v != "" {
+		date, err := parseDate(v)
+		if err != nil {
+			verr.Add("recording_date", "must be an RFC 3339 timestamp or YYYY-MM-DD date")
+		}
+		recording.RecordingDate = date
+	}
+	if v := c.PostForm("embargo_until"); v != "" {
+		until, err := parseDate(v)
+		if err != nil {
+			verr.Add("embargo_until", "must be an RFC 3339 timestamp or YYYY-MM-DD date")
+		}
+		recording.EmbargoUntil = &until
+	}
+	recording.LocationID = formInt(c, verr, "location_id")
+	recording.Duration = formInt(c, verr, "duration")
+	return recording, verr
+}
+
+func formInt(c *gin.Context, verr *services.ValidationError, field string) int {
+	v := c.PostForm(field)
+	if v == "" {
+		return 0
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		verr.Add(field, "must be a valid integer")
+	}
+	return n
+}
+
+func parseDate(v string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.DateOnly, v)
+}
+
+// GeoJSON writes every recording as an RFC 7946 FeatureCollection.
+func (h *RecordingHandler) GeoJSON(c *gin.Context) {
+	fc, err := h.Service.FeatureCollection(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "unable to build recording features"})
+		return
+	}
+	c.Header("Content-Type", geojson.ContentType)
+	c.JSON(http.StatusOK, fc)
+}
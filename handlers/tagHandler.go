@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"field_archive/server/services"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+const defaultTagSuggestions = 10
+
+type TagHandler struct {
+	Service services.TagService
+}
+
+func NewTagHandler(s services.TagService) *TagHandler {
+	return &TagHandler{Service: s}
+}
+
+type tagRequest struct {
+	Name string `json:"name"`
+}
+
+// Autocomplete suggests tags starting with ?prefix=, most used first, with
+// how many recordings carry each. ?limit= caps the number of suggestions.
+func (h *TagHandler) Autocomplete(c *gin.Context) {
+	limit := defaultTagSuggestions
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			verr := &services.ValidationError{}
+			verr.Add("limit", "must be a valid integer")
+			validationFailed(c, verr)
+			return
+		}
+		limit = n
+	}
+	tags, err := h.Service.Autocomplete(c.Query("prefix"), limit, c.Request.Context())
+	if err != nil {
+		writeError(c, err, "tag", "unable to fetch tags")
+		return
+	}
+	c.JSON(http.StatusOK, tags)
+}
+
+// ListForRecording lists the names of a recording's tags.
+func (h *TagHandler) ListForRecording(c *gin.Context) {
+	id, ok := pathID(c)
+	if !ok {
+		return
+	}
+	tags, err := h.Service.ListForRecording(id, c.Request.Context())
+	if err != nil {
+		writeError(c, err, "recording", "unable to fetch tags")
+		return
+	}
+	c.JSON(http.StatusOK, tags)
+}
+
+// Attach tags a recording with the name in the body and responds with all
+// of the recording's tags.
+func (h *TagHandler) Attach(c *gin.Context) {
+	id, ok := pathID(c)
+	if !ok {
+		return
+	}
+	var body tagRequest
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "request body must contain a tag name"})
+		return
+	}
+	tags, err := h.Service.Attach(id, body.Name, c.Request.Context())
+	if err != nil {
+		writeError(c, err, "recording", "unable to tag recording")
+		return
+	}
+	c.JSON(http.StatusOK, tags)
+}
+
+// Detach removes the tag named in the path from a recording.
+func (h *TagHandler) Detach(c *gin.Context) {
+	id, ok := pathID(c)
+	if !ok {
+		return
+	}
+	if err := h.Service.Detach(id, c.Param("tag"), c.Request.Context()); err != nil {
+		writeError(c, err, "tag", "unable to untag recording")
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
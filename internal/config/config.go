@@ -1,15 +1,40 @@
 package config
 
 import (
+	"time"
+
 	"github.com/caarlos0/env/v6"
 	"github.com/joho/godotenv"
 )
 
 type Config struct {
-	DB_Url    string `env:"DATABASE_URL,required"`
-	Port      string `env:"PORT,required"`
-	Origin    string `env:"CLI_ORIGIN"`
-	JwtSecret string `env:"JWT_SECRET"`
+	DB_Url            string        `env:"DATABASE_URL,required"`
+	Port              string        `env:"PORT,required"`
+	Origin            string        `env:"CLI_ORIGIN"`
+	JwtSecret         string        `env:"JWT_SECRET"`
+	JwtSigningKey     string        `env:"JWT_SIGNING_KEY"`                  // PEM private key file
+	JwtVerifyKeys     []string      `env:"JWT_VERIFY_KEYS" envSeparator:","` // PEM key files still accepted
+	SecureCookies     bool          `env:"SECURE_COOKIES" envDefault:"true"`
+	AccessTTL         time.Duration `env:"ACCESS_TOKEN_TTL" envDefault:"10m"`
+	RefreshTTL        time.Duration `env:"REFRESH_TOKEN_TTL" envDefault:"720h"`    // 30 days
+	StorageDriver     string        `env:"STORAGE_DRIVER" envDefault:"filesystem"` // filesystem or s3
+	StorageRoot       string        `env:"STORAGE_ROOT" envDefault:"./storage"`
+	S3Endpoint        string        `env:"S3_ENDPOINT"`
+	S3Region          string        `env:"S3_REGION"`
+	S3Bucket          string        `env:"S3_BUCKET"`
+	S3AccessKey       string        `env:"S3_ACCESS_KEY"`
+	S3SecretKey       string        `env:"S3_SECRET_KEY"`
+	S3UseSSL          bool          `env:"S3_USE_SSL" envDefault:"true"`
+	MaxUploadBytes    int64         `env:"MAX_UPLOAD_BYTES" envDefault:"1073741824"` // 1 GiB
+	LocationGridLow   float64       `env:"LOCATION_GRID_LOW" envDefault:"1000"`      // metres
+	LocationGridHigh  float64       `env:"LOCATION_GRID_HIGH" envDefault:"10000"`    // metres
+	MigrateOnStart    bool          `env:"MIGRATE_ON_START" envDefault:"false"`      // apply pending migrations before serving
+	ReadHeaderTimeout time.Duration `env:"HTTP_READ_HEADER_TIMEOUT" envDefault:"10s"`
+	ReadTimeout       time.Duration `env:"HTTP_READ_TIMEOUT" envDefault:"15m"`  // long enough for large uploads
+	WriteTimeout      time.Duration `env:"HTTP_WRITE_TIMEOUT" envDefault:"15m"` // long enough to stream large audio
+	IdleTimeout       time.Duration `env:"HTTP_IDLE_TIMEOUT" envDefault:"2m"`
+	ShutdownTimeout   time.Duration `env:"SHUTDOWN_TIMEOUT" envDefault:"30s"` // how long in-flight requests get to finish
+	MetricsToken      string        `env:"METRICS_TOKEN"`                     // bearer token required to scrape /metrics, if set
 }
 
 func LoadConfig() (*Config, error) {
@@ -3,7 +3,6 @@ package database
 import (
 	"context"
 	"field_archive/server/internal/config"
-	"log"
 	"sync"
 
 	"github.com/jackc/pgx/v5"
@@ -15,6 +14,10 @@ type Database interface {
 	Exec(ctx context.Context, query string, args ...any) (pgconn.CommandTag, error)
 	QueryRow(ctx context.Context, query string, args ...any) pgx.Row
 	Query(ctx context.Context, query string, args any) (pgx.Rows, error)
+	// InTx runs fn with a Database whose statements all run in one
+	// transaction, committed if fn returns nil and rolled back otherwise.
+	// Called within a transaction, it uses a savepoint.
+	InTx(ctx context.Context, fn func(tx Database) error) error
 }
 
 type Postgres struct {
@@ -33,20 +36,59 @@ func (p *Postgres) Query(ctx context.Context, query string, args any) (pgx.Rows,
 	return p.DB.Query(ctx, query, args)
 }
 
+func (p *Postgres) InTx(ctx context.Context, fn func(tx Database) error) error {
+	return pgx.BeginFunc(ctx, p.DB, func(tx pgx.Tx) error {
+		return fn(transaction{tx})
+	})
+}
+
+// transaction is the Database InTx hands out.
+type transaction struct {
+	tx pgx.Tx
+}
+
+func (t transaction) Exec(ctx context.Context, query string, args ...any) (pgconn.CommandTag, error) {
+	return t.tx.Exec(ctx, query, args...)
+}
+
+func (t transaction) QueryRow(ctx context.Context, query string, args ...any) pgx.Row {
+	return t.tx.QueryRow(ctx, query, args...)
+}
+
+func (t transaction) Query(ctx context.Context, query string, args any) (pgx.Rows, error) {
+	return t.tx.Query(ctx, query, args)
+}
+
+func (t transaction) InTx(ctx context.Context, fn func(tx Database) error) error {
+	return pgx.BeginFunc(ctx, t.tx, func(tx pgx.Tx) error {
+		return fn(transaction{tx})
+	})
+}
+
 var (
 	pgInstance *Postgres
+	pgErr      error
 	pgOnce     sync.Once
 )
 
+// Connect opens the pool on its first call and pings the database through
+// it. Later calls return the same pool, or the error the first one failed
+// with.
 func Connect(ctx context.Context, cfg *config.Config) (*Postgres, error) {
 	pgOnce.Do(func() {
 		db, err := pgxpool.New(ctx, cfg.DB_Url)
 		if err != nil {
-			log.Fatalf("Error establishing db connection %v", err)
+			pgErr = err
+			return
+		}
+		if err := db.Ping(ctx); err != nil {
+			db.Close()
+			pgErr = err
+			return
 		}
 		pgInstance = &Postgres{db}
 	})
-	return pgInstance, nil
+	return pgInstance, pgErr
 }
 
 func (pg *Postgres) Ping(ctx context.Context) error {
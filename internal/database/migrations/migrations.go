@@ -0,0 +1,199 @@
+// Package migrations keeps the database schema up to date. Migrations are
+// SQL files embedded in the binary, named NNNN_name.up.sql and
+// NNNN_name.down.sql, and applied in version order. Each applied migration
+// is recorded in schema_migrations with a checksum of its up file, so a
+// migration edited after it was applied is noticed rather than skipped.
+package migrations
+
+import (
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+//go:embed sql/*.sql
+var files embed.FS
+
+type Migration struct {
+	Version  int
+	Name     string
+	Up       string
+	Down     string
+	Checksum string // hex SHA-256 of Up
+}
+
+// Applied is a migration recorded in schema_migrations.
+type Applied struct {
+	Version   int
+	Name      string
+	Checksum  string
+	AppliedAt time.Time
+}
+
+// Status is a migration alongside whether it has been applied. Modified is
+// set when the migration was applied from a different up file than the one
+// embedded now. Migrations applied by a newer build, which this one doesn't
+// know, have an empty Up and Down.
+type Status struct {
+	Migration
+	AppliedAt *time.Time
+	Modified  bool
+}
+
+var fileName = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+
+// Embedded returns the migrations built into the binary.
+func Embedded() ([]Migration, error) {
+	return Load(files, "sql")
+}
+
+// Load reads the migrations in dir, ordered by version. Every version needs
+// both an up and a down file.
+func Load(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, fmt.Errorf("migrations: problem reading %s, %w", dir, err)
+	}
+
+	byVersion := map[int]*Migration{}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		match := fileName.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("migrations: %s isn't named NNNN_name.up.sql or NNNN_name.down.sql", entry.Name())
+		}
+		version, _ := strconv.Atoi(match[1])
+		if version == 0 {
+			return nil, fmt.Errorf("migrations: %s has version 0, versions start at 1", entry.Name())
+		}
+		content, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("migrations: problem reading %s, %w", entry.Name(), err)
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		}
+		if m.Name != match[2] {
+			return nil, fmt.Errorf("migrations: version %d is used by both %s and %s", version, m.Name, match[2])
+		}
+		if match[3] == "up" {
+			m.Up = string(content)
+		} else {
+			m.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migrations: %04d_%s needs both an up and a down file", m.Version, m.Name)
+		}
+		m.Checksum = Checksum(m.Up)
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// Checksum is the hex SHA-256 of a migration's up SQL.
+func Checksum(sql string) string {
+	sum := sha256.Sum256([]byte(sql))
+	return hex.EncodeToString(sum[:])
+}
+
+// pending returns the migrations still to apply, in order. It refuses when
+// an applied migration has changed or isn't one of migrations, as the
+// schema is then not the one this build expects.
+func pending(migrations []Migration, applied []Applied) ([]Migration, error) {
+	done, err := verify(migrations, applied)
+	if err != nil {
+		return nil, err
+	}
+	var todo []Migration
+	for _, m := range migrations {
+		if _, ok := done[m.Version]; !ok {
+			todo = append(todo, m)
+		}
+	}
+	return todo, nil
+}
+
+// rollbacks returns the last steps applied migrations, newest first.
+func rollbacks(migrations []Migration, applied []Applied, steps int) ([]Migration, error) {
+	if _, err := verify(migrations, applied); err != nil {
+		return nil, err
+	}
+	byVersion := map[int]Migration{}
+	for _, m := range migrations {
+		byVersion[m.Version] = m
+	}
+
+	sorted := append([]Applied(nil), applied...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Version > sorted[j].Version })
+	if steps > len(sorted) {
+		steps = len(sorted)
+	}
+	todo := make([]Migration, 0, steps)
+	for _, a := range sorted[:steps] {
+		todo = append(todo, byVersion[a.Version])
+	}
+	return todo, nil
+}
+
+func verify(migrations []Migration, applied []Applied) (map[int]Applied, error) {
+	known := map[int]Migration{}
+	for _, m := range migrations {
+		known[m.Version] = m
+	}
+	done := map[int]Applied{}
+	for _, a := range applied {
+		m, ok := known[a.Version]
+		if !ok {
+			return nil, fmt.Errorf("migrations: database has migration %04d_%s applied, which this build doesn't know", a.Version, a.Name)
+		}
+		if m.Checksum != a.Checksum {
+			return nil, fmt.Errorf("migrations: %04d_%s has changed since it was applied", m.Version, m.Name)
+		}
+		done[a.Version] = a
+	}
+	return done, nil
+}
+
+// statuses lists every migration, known or applied, in version order.
+func statuses(migrations []Migration, applied []Applied) []Status {
+	done := map[int]Applied{}
+	for _, a := range applied {
+		done[a.Version] = a
+	}
+
+	var list []Status
+	for _, m := range migrations {
+		s := Status{Migration: m}
+		if a, ok := done[m.Version]; ok {
+			s.AppliedAt = &a.AppliedAt
+			s.Modified = a.Checksum != m.Checksum
+			delete(done, m.Version)
+		}
+		list = append(list, s)
+	}
+	for _, a := range done {
+		list = append(list, Status{
+			Migration: Migration{Version: a.Version, Name: a.Name, Checksum: a.Checksum},
+			AppliedAt: &a.AppliedAt,
+		})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Version < list[j].Version })
+	return list
+}
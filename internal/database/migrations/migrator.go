@@ -0,0 +1,177 @@
+package migrations
+
+import (
+	"context"
+	"field_archive/server/internal/database"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// lockKey identifies the advisory lock held while migrating, so that
+// several servers starting at once apply each migration only once.
+const lockKey int64 = 0x66615f6d69677261 // "fa_migra"
+
+const createTable = `CREATE TABLE IF NOT EXISTS schema_migrations (` +
+	`version INTEGER PRIMARY KEY, ` +
+	`name TEXT NOT NULL, ` +
+	`checksum TEXT NOT NULL, ` +
+	`applied_at TIMESTAMPTZ NOT NULL DEFAULT now())`
+
+type Migrator struct {
+	pool       *pgxpool.Pool
+	migrations []Migration
+}
+
+// New returns a Migrator for the embedded migrations.
+func New(db *database.Postgres) (*Migrator, error) {
+	migrations, err := Embedded()
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{pool: db.DB, migrations: migrations}, nil
+}
+
+// Up applies every pending migration, each in its own transaction, and
+// returns those it applied.
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	var done []Migration
+	err := m.locked(ctx, func(conn *pgxpool.Conn) error {
+		applied, err := appliedMigrations(ctx, conn)
+		if err != nil {
+			return err
+		}
+		todo, err := pending(m.migrations, applied)
+		if err != nil {
+			return err
+		}
+		for _, mig := range todo {
+			err := inTx(ctx, conn, func(tx pgx.Tx) error {
+				if _, err := tx.Exec(ctx, mig.Up); err != nil {
+					return err
+				}
+				_, err := tx.Exec(ctx,
+					`INSERT INTO schema_migrations (version, name, checksum) VALUES (@version, @name, @checksum)`,
+					pgx.NamedArgs{"version": mig.Version, "name": mig.Name, "checksum": mig.Checksum})
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("migrations: problem applying %04d_%s, %w", mig.Version, mig.Name, err)
+			}
+			done = append(done, mig)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Down reverts the last steps applied migrations, newest first, and returns
+// those it reverted.
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	var done []Migration
+	err := m.locked(ctx, func(conn *pgxpool.Conn) error {
+		applied, err := appliedMigrations(ctx, conn)
+		if err != nil {
+			return err
+		}
+		todo, err := rollbacks(m.migrations, applied, steps)
+		if err != nil {
+			return err
+		}
+		for _, mig := range todo {
+			err := inTx(ctx, conn, func(tx pgx.Tx) error {
+				if _, err := tx.Exec(ctx, mig.Down); err != nil {
+					return err
+				}
+				_, err := tx.Exec(ctx, `DELETE FROM schema_migrations WHERE version = @version`,
+					pgx.NamedArgs{"version": mig.Version})
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("migrations: problem reverting %04d_%s, %w", mig.Version, mig.Name, err)
+			}
+			done = append(done, mig)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Status lists every migration and whether it has been applied. It doesn't
+// take the lock or create schema_migrations.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	conn, err := m.pool.Acquire(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("migrations: problem acquiring connection, %w", err)
+	}
+	defer conn.Release()
+
+	var exists bool
+	err = conn.QueryRow(ctx, `SELECT to_regclass('schema_migrations') IS NOT NULL`).Scan(&exists)
+	if err != nil {
+		return nil, fmt.Errorf("migrations: problem checking for schema_migrations, %w", err)
+	}
+	var applied []Applied
+	if exists {
+		if applied, err = appliedMigrations(ctx, conn); err != nil {
+			return nil, err
+		}
+	}
+	return statuses(m.migrations, applied), nil
+}
+
+// locked runs fn on a single connection holding the migration lock, with
+// schema_migrations created. The lock is session level, so it's held across
+// the per-migration transactions.
+func (m *Migrator) locked(ctx context.Context, fn func(conn *pgxpool.Conn) error) error {
+	conn, err := m.pool.Acquire(ctx)
+	if err != nil {
+		return fmt.Errorf("migrations: problem acquiring connection, %w", err)
+	}
+	if _, err := conn.Exec(ctx, `SELECT pg_advisory_lock($1)`, lockKey); err != nil {
+		conn.Release()
+		return fmt.Errorf("migrations: problem taking lock, %w", err)
+	}
+	defer func() {
+		if _, err := conn.Exec(context.Background(), `SELECT pg_advisory_unlock($1)`, lockKey); err != nil {
+			// Ending the session is the only other way to drop the lock.
+			conn.Hijack().Close(context.Background())
+			return
+		}
+		conn.Release()
+	}()
+
+	if _, err := conn.Exec(ctx, createTable); err != nil {
+		return fmt.Errorf("migrations: problem creating schema_migrations, %w", err)
+	}
+	return fn(conn)
+}
+
+func appliedMigrations(ctx context.Context, conn *pgxpool.Conn) ([]Applied, error) {
+	rows, err := conn.Query(ctx, `SELECT version, name, checksum, applied_at FROM schema_migrations ORDER BY version`)
+	if err != nil {
+		return nil, fmt.Errorf("migrations: problem reading schema_migrations, %w", err)
+	}
+	applied, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (Applied, error) {
+		var a Applied
+		err := row.Scan(&a.Version, &a.Name, &a.Checksum, &a.AppliedAt)
+		return a, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("migrations: problem reading schema_migrations, %w", err)
+	}
+	return applied, nil
+}
+
+func inTx(ctx context.Context, conn *pgxpool.Conn, fn func(tx pgx.Tx) error) error {
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
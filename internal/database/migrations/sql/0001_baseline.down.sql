@@ -0,0 +1,5 @@
+-- The postgis extension is left installed; other schemas in the database
+-- may depend on it.
+DROP TABLE IF EXISTS recordings;
+DROP TABLE IF EXISTS locations;
+DROP TABLE IF EXISTS users;
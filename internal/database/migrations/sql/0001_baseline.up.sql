@@ -0,0 +1,42 @@
+CREATE EXTENSION IF NOT EXISTS postgis;
+
+CREATE TABLE IF NOT EXISTS users (
+    id            SERIAL PRIMARY KEY,
+    username      TEXT NOT NULL UNIQUE,
+    email         TEXT NOT NULL UNIQUE,
+    password_hash TEXT NOT NULL,
+    role          TEXT NOT NULL DEFAULT 'contributor'
+                  CHECK (role IN ('viewer', 'contributor', 'curator', 'admin')),
+    date_created  TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS locations (
+    id          SERIAL PRIMARY KEY,
+    name        TEXT                  NOT NULL,
+    description TEXT                  NOT NULL DEFAULT '',
+    geom        geometry(Point, 4326) NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS locations_geom_idx ON locations USING GIST (geom);
+
+CREATE TABLE IF NOT EXISTS recordings (
+    id               SERIAL PRIMARY KEY,
+    title            TEXT             NOT NULL,
+    audio_location   TEXT             NOT NULL,
+    artwork_location TEXT,
+    date_uploaded    TIMESTAMPTZ,
+    recording_date   TIMESTAMPTZ      NOT NULL,
+    location_id      INTEGER          NOT NULL REFERENCES locations (id),
+    user_id          INTEGER          NOT NULL REFERENCES users (id),
+    duration         INTEGER          NOT NULL DEFAULT 0,
+    format           TEXT             NOT NULL DEFAULT '',
+    description      TEXT             NOT NULL DEFAULT '',
+    equipment        TEXT             NOT NULL DEFAULT '',
+    file_size        DOUBLE PRECISION NOT NULL DEFAULT 0,
+    channels         TEXT             NOT NULL DEFAULT '',
+    license          TEXT             NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS recordings_location_id_idx ON recordings (location_id);
+CREATE INDEX IF NOT EXISTS recordings_user_id_idx ON recordings (user_id);
+CREATE INDEX IF NOT EXISTS recordings_recording_date_idx ON recordings (recording_date);
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS recordings_visibility_idx;
+
+ALTER TABLE recordings
+    DROP COLUMN IF EXISTS embargo_until,
+    DROP COLUMN IF EXISTS visibility;
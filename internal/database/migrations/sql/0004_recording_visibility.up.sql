@@ -0,0 +1,6 @@
+ALTER TABLE recordings
+    ADD COLUMN IF NOT EXISTS visibility    TEXT NOT NULL DEFAULT 'public'
+                             CHECK (visibility IN ('public', 'unlisted', 'private')),
+    ADD COLUMN IF NOT EXISTS embargo_until TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS recordings_visibility_idx ON recordings (visibility, embargo_until);
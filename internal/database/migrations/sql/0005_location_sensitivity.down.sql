@@ -0,0 +1,5 @@
+DROP FUNCTION IF EXISTS snap_point(geometry, double precision);
+
+ALTER TABLE locations
+    DROP COLUMN IF EXISTS sensitivity,
+    DROP COLUMN IF EXISTS user_id;
@@ -0,0 +1,17 @@
+ALTER TABLE locations
+    ADD COLUMN IF NOT EXISTS user_id     INTEGER REFERENCES users (id) ON DELETE SET NULL,
+    ADD COLUMN IF NOT EXISTS sensitivity TEXT NOT NULL DEFAULT 'none'
+                             CHECK (sensitivity IN ('none', 'low', 'high'));
+
+-- snap_point moves a point to the centre of the grid cell containing it,
+-- with cells roughly metres on a side. Longitude steps widen towards the
+-- poles so cells stay about as wide as they are tall.
+CREATE OR REPLACE FUNCTION snap_point(geom geometry, metres double precision)
+RETURNS geometry
+LANGUAGE sql IMMUTABLE STRICT PARALLEL SAFE AS $$
+    SELECT ST_SetSRID(ST_MakePoint(
+               (floor(ST_X(geom) / lon_step) + 0.5) * lon_step,
+               lat), 4326)
+    FROM (SELECT least(greatest((floor(ST_Y(geom) / (metres / 111320)) + 0.5) * (metres / 111320), -90), 90) AS lat) AS snapped,
+         LATERAL (SELECT metres / (111320 * greatest(cos(radians(lat)), 0.01)) AS lon_step) AS step
+$$;
@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS tags (
+    id   SERIAL PRIMARY KEY,
+    name TEXT   NOT NULL UNIQUE
+);
+
+-- text_pattern_ops lets prefix searches (name LIKE 'daw%') use the index.
+CREATE INDEX IF NOT EXISTS tags_name_prefix_idx ON tags (name text_pattern_ops);
+
+CREATE TABLE IF NOT EXISTS recording_tags (
+    recording_id INTEGER NOT NULL REFERENCES recordings (id) ON DELETE CASCADE,
+    tag_id       INTEGER NOT NULL REFERENCES tags (id) ON DELETE CASCADE,
+    PRIMARY KEY (recording_id, tag_id)
+);
+
+CREATE INDEX IF NOT EXISTS recording_tags_tag_id_idx ON recording_tags (tag_id);
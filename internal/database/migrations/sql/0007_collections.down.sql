@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS collection_recordings;
+DROP TABLE IF EXISTS collections;
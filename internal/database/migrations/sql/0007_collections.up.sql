@@ -0,0 +1,22 @@
+CREATE TABLE IF NOT EXISTS collections (
+    id             SERIAL PRIMARY KEY,
+    title          TEXT        NOT NULL,
+    description    TEXT        NOT NULL DEFAULT '',
+    cover_location TEXT,
+    user_id        INTEGER     NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    visibility     TEXT        NOT NULL DEFAULT 'public'
+                               CHECK (visibility IN ('public', 'unlisted', 'private')),
+    date_created   TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS collections_user_id_idx ON collections (user_id);
+
+-- position orders a collection's recordings, counting from 1.
+CREATE TABLE IF NOT EXISTS collection_recordings (
+    collection_id INTEGER NOT NULL REFERENCES collections (id) ON DELETE CASCADE,
+    recording_id  INTEGER NOT NULL REFERENCES recordings (id) ON DELETE CASCADE,
+    position      INTEGER NOT NULL,
+    PRIMARY KEY (collection_id, recording_id)
+);
+
+CREATE INDEX IF NOT EXISTS collection_recordings_order_idx ON collection_recordings (collection_id, position);
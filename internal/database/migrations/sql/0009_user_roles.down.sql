@@ -0,0 +1,3 @@
+-- The baseline already allows these roles, so there is nothing to put back.
+-- Users remapped from 'user' to 'contributor' stay contributors.
+ALTER TABLE users ALTER COLUMN role SET DEFAULT 'contributor';
@@ -0,0 +1,11 @@
+-- Databases created before roles were split have no role column, or one
+-- that only allows 'user' and 'admin', which the baseline's IF NOT EXISTS
+-- left in place.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS role TEXT NOT NULL DEFAULT 'contributor';
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_role_check;
+
+UPDATE users SET role = 'contributor' WHERE role = 'user';
+
+ALTER TABLE users
+    ALTER COLUMN role SET DEFAULT 'contributor',
+    ADD CONSTRAINT users_role_check CHECK (role IN ('viewer', 'contributor', 'curator', 'admin'));
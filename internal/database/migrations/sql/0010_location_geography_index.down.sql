@@ -0,0 +1 @@
+DROP INDEX IF EXISTS locations_geog_idx;
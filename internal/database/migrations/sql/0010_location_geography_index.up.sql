@@ -0,0 +1,3 @@
+-- Radius and nearest searches measure along the spheroid on geom::geography,
+-- which locations_geom_idx on the geometry can't serve.
+CREATE INDEX IF NOT EXISTS locations_geog_idx ON locations USING GIST ((geom::geography));
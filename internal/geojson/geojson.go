@@ -0,0 +1,44 @@
+// Package geojson holds the subset of RFC 7946 types used to publish archive
+// data to map clients.
+package geojson
+
+import "encoding/json"
+
+// ContentType is the media type registered for GeoJSON by RFC 7946.
+const ContentType = "application/geo+json"
+
+type FeatureCollection struct {
+	Type     string    `json:"type"`
+	Features []Feature `json:"features"`
+}
+
+type Feature struct {
+	Type       string          `json:"type"`
+	ID         any             `json:"id,omitempty"`
+	Geometry   json.RawMessage `json:"geometry"`
+	Properties map[string]any  `json:"properties"`
+}
+
+// NewFeatureCollection returns an empty collection whose features marshal as
+// [] rather than null.
+func NewFeatureCollection() FeatureCollection {
+	return FeatureCollection{Type: "FeatureCollection", Features: []Feature{}}
+}
+
+// NewFeature builds a feature from a geometry already encoded as GeoJSON, as
+// returned by PostGIS' ST_AsGeoJSON. A nil geometry is encoded as null,
+// which RFC 7946 allows for unlocated features.
+func NewFeature(id any, geometry *string, properties map[string]any) Feature {
+	geom := json.RawMessage("null")
+	if geometry != nil && *geometry != "" {
+		geom = json.RawMessage(*geometry)
+	}
+	if properties == nil {
+		properties = map[string]any{}
+	}
+	return Feature{Type: "Feature", ID: id, Geometry: geom, Properties: properties}
+}
+
+func (fc *FeatureCollection) Add(f Feature) {
+	fc.Features = append(fc.Features, f)
+}
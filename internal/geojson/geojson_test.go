@@ -0,0 +1,31 @@
+package geojson
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEmptyFeatureCollection(t *testing.T) {
+	b, err := json.Marshal(NewFeatureCollection())
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"type": "FeatureCollection", "features": []}`, string(b))
+}
+
+func TestFeatureCollection(t *testing.T) {
+	point := `{"type":"Point","coordinates":[-0.12,51.5]}`
+	fc := NewFeatureCollection()
+	fc.Add(NewFeature(1, &point, map[string]any{"name": "Marsh"}))
+	fc.Add(NewFeature(2, nil, nil))
+
+	b, err := json.Marshal(fc)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{
+  "type": "FeatureCollection",
+  "features": [
+    {"type": "Feature", "id": 1, "geometry": {"type": "Point", "coordinates": [-0.12, 51.5]}, "properties": {"name": "Marsh"}},
+    {"type": "Feature", "id": 2, "geometry": null, "properties": {}}
+  ]
+}`, string(b))
+}
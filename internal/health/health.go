@@ -0,0 +1,163 @@
+// Package health checks the dependencies the server needs before it can
+// serve traffic: the database, PostGIS, the schema and the blob store.
+package health
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"field_archive/server/internal/database"
+	"field_archive/server/internal/database/migrations"
+	"field_archive/server/internal/storage"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// DefaultTimeout bounds each check, so one hanging dependency can't hold up
+// the whole report.
+const DefaultTimeout = 2 * time.Second
+
+const (
+	StatusOK      = "ok"
+	StatusFailing = "failing"
+)
+
+// Check is one dependency, named for the report.
+type Check struct {
+	Name  string
+	Check func(ctx context.Context) error
+}
+
+// Result is the outcome of a check. Error is empty when it passed.
+type Result struct {
+	Status string
+	Error  string `json:",omitempty"`
+}
+
+// Report is the outcome of every check. Status is ok only when all of them
+// passed.
+type Report struct {
+	Status string
+	Checks map[string]Result
+}
+
+type Checker struct {
+	checks  []Check
+	timeout time.Duration
+}
+
+// New returns a Checker running checks, each within DefaultTimeout.
+func New(checks ...Check) *Checker {
+	return &Checker{checks: checks, timeout: DefaultTimeout}
+}
+
+// Run runs every check at once and reports on them all.
+func (c *Checker) Run(ctx context.Context) Report {
+	report := Report{Status: StatusOK, Checks: make(map[string]Result, len(c.checks))}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, check := range c.checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(ctx, c.timeout)
+			defer cancel()
+			err := check.Check(ctx)
+			result := Result{Status: StatusOK}
+			if err != nil {
+				result.Status, result.Error = StatusFailing, err.Error()
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			report.Checks[check.Name] = result
+			if err != nil {
+				report.Status = StatusFailing
+			}
+		}()
+	}
+	wg.Wait()
+	return report
+}
+
+// Pinger is a connection that can be checked, such as *database.Postgres.
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// Database checks the database answers.
+func Database(db Pinger) Check {
+	return Check{Name: "database", Check: db.Ping}
+}
+
+// PostGIS checks the postgis extension is installed, as locations can't be
+// stored or searched without it.
+func PostGIS(db database.Database) Check {
+	return Check{Name: "postgis", Check: func(ctx context.Context) error {
+		var version string
+		err := db.QueryRow(ctx, `SELECT extversion FROM pg_extension WHERE extname = 'postgis'`).Scan(&version)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return errors.New("postgis extension not installed")
+		}
+		return err
+	}}
+}
+
+// MigrationStatus reports on the schema, such as *migrations.Migrator.
+type MigrationStatus interface {
+	Status(ctx context.Context) ([]migrations.Status, error)
+}
+
+// Migrations checks every migration this build knows has been applied,
+// unchanged. Migrations applied by a newer build are fine, so a rollback
+// can still serve.
+func Migrations(m MigrationStatus) Check {
+	return Check{Name: "migrations", Check: func(ctx context.Context) error {
+		list, err := m.Status(ctx)
+		if err != nil {
+			return err
+		}
+		var pending, modified []string
+		for _, s := range list {
+			name := fmt.Sprintf("%04d_%s", s.Version, s.Name)
+			switch {
+			case s.AppliedAt == nil:
+				pending = append(pending, name)
+			case s.Modified:
+				modified = append(modified, name)
+			}
+		}
+		var problems []string
+		if len(pending) > 0 {
+			problems = append(problems, "pending: "+strings.Join(pending, ", "))
+		}
+		if len(modified) > 0 {
+			problems = append(problems, "modified since applied: "+strings.Join(modified, ", "))
+		}
+		if len(problems) > 0 {
+			return errors.New(strings.Join(problems, "; "))
+		}
+		return nil
+	}}
+}
+
+// Storage checks the blob store can be written to, by storing and removing
+// a small object under "health/".
+func Storage(store storage.Blob) Check {
+	return Check{Name: "storage", Check: func(ctx context.Context) error {
+		name := make([]byte, 8)
+		if _, err := rand.Read(name); err != nil {
+			return err
+		}
+		key := "health/" + hex.EncodeToString(name)
+		if _, err := store.Put(ctx, key, strings.NewReader("ok")); err != nil {
+			return fmt.Errorf("not writable: %w", err)
+		}
+		return store.Delete(ctx, key)
+	}}
+}
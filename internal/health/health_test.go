@@ -0,0 +1,115 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"field_archive/server/internal/database"
+	"field_archive/server/internal/database/migrations"
+	"field_archive/server/internal/storage"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeRow struct{ err error }
+
+func (r fakeRow) Scan(dest ...any) error {
+	if r.err != nil {
+		return r.err
+	}
+	*(dest[0].(*string)) = "3.4.2"
+	return nil
+}
+
+type fakeDatabase struct{ err error }
+
+func (d fakeDatabase) Exec(ctx context.Context, query string, args ...any) (pgconn.CommandTag, error) {
+	return pgconn.CommandTag{}, d.err
+}
+
+func (d fakeDatabase) QueryRow(ctx context.Context, query string, args ...any) pgx.Row {
+	return fakeRow{d.err}
+}
+
+func (d fakeDatabase) Query(ctx context.Context, query string, args any) (pgx.Rows, error) {
+	return nil, d.err
+}
+
+func (d fakeDatabase) InTx(ctx context.Context, fn func(tx database.Database) error) error {
+	return fn(d)
+}
+
+type fakeMigrations []migrations.Status
+
+func (m fakeMigrations) Status(ctx context.Context) ([]migrations.Status, error) {
+	return m, nil
+}
+
+func TestRun(t *testing.T) {
+	checker := New(
+		Check{Name: "good", Check: func(ctx context.Context) error { return nil }},
+		Check{Name: "bad", Check: func(ctx context.Context) error { return errors.New("down") }},
+	)
+	assert.Equal(t, Report{Status: StatusFailing, Checks: map[string]Result{
+		"good": {Status: StatusOK},
+		"bad":  {Status: StatusFailing, Error: "down"},
+	}}, checker.Run(context.Background()))
+
+	assert.Equal(t, Report{Status: StatusOK, Checks: map[string]Result{}}, New().Run(context.Background()))
+}
+
+func TestRunTimeout(t *testing.T) {
+	checker := New(Check{Name: "slow", Check: func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}})
+	checker.timeout = 10 * time.Millisecond
+	report := checker.Run(context.Background())
+	assert.Equal(t, StatusFailing, report.Status)
+	assert.Equal(t, context.DeadlineExceeded.Error(), report.Checks["slow"].Error)
+}
+
+func TestPostGIS(t *testing.T) {
+	assert.NoError(t, PostGIS(fakeDatabase{}).Check(context.Background()))
+	assert.EqualError(t, PostGIS(fakeDatabase{pgx.ErrNoRows}).Check(context.Background()), "postgis extension not installed")
+}
+
+func TestMigrations(t *testing.T) {
+	at := time.Now()
+	check := Migrations(fakeMigrations{
+		{Migration: migrations.Migration{Version: 1, Name: "baseline"}, AppliedAt: &at},
+		{Migration: migrations.Migration{Version: 2, Name: "tags"}, AppliedAt: &at, Modified: true},
+		{Migration: migrations.Migration{Version: 3, Name: "collections"}},
+	}).Check
+	assert.EqualError(t, check(context.Background()), "pending: 0003_collections; modified since applied: 0002_tags")
+
+	// Migrations only a newer build knows about don't stop this one serving.
+	check = Migrations(fakeMigrations{
+		{Migration: migrations.Migration{Version: 1, Name: "baseline"}, AppliedAt: &at},
+		{Migration: migrations.Migration{Version: 2, Name: "later"}, AppliedAt: &at},
+	}).Check
+	assert.NoError(t, check(context.Background()))
+}
+
+func TestStorage(t *testing.T) {
+	root := t.TempDir()
+	store, err := storage.NewFilesystem(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(t, Storage(store).Check(context.Background()))
+	objects, err := store.List(context.Background(), "health/")
+	assert.NoError(t, err)
+	assert.Empty(t, objects, "the probe object should be removed")
+
+	// A file in the way of the health directory makes the store unwritable
+	// there, even for root.
+	os.RemoveAll(filepath.Join(root, "health"))
+	os.WriteFile(filepath.Join(root, "health"), []byte("x"), 0o644)
+	assert.ErrorContains(t, Storage(store).Check(context.Background()), "not writable")
+}
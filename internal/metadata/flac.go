@@ -0,0 +1,47 @@
+package metadata
+
+import (
+	"fmt"
+	"io"
+)
+
+const flacStreamInfo = 0
+
+// parseFLAC reads the STREAMINFO block of the FLAC stream whose "fLaC" marker
+// starts at offset start.
+func parseFLAC(r io.ReadSeeker, start int64) (Info, error) {
+	if _, err := r.Seek(start+4, io.SeekStart); err != nil {
+		return Info{}, err
+	}
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return Info{}, fmt.Errorf("%w: missing metadata block", ErrMalformed)
+	}
+	length := int(header[1])<<16 | int(header[2])<<8 | int(header[3])
+	if header[0]&0x7F != flacStreamInfo || length < 34 {
+		return Info{}, fmt.Errorf("%w: first metadata block isn't STREAMINFO", ErrMalformed)
+	}
+	b := make([]byte, 34)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return Info{}, fmt.Errorf("%w: truncated STREAMINFO", ErrMalformed)
+	}
+
+	// Bytes 10-17 pack: sample rate (20 bits), channels - 1 (3 bits),
+	// bits per sample - 1 (5 bits) and total samples (36 bits).
+	packed := be.Uint64(b[10:18])
+	sampleRate := int(packed >> 44)
+	channels := int(packed>>41&0x7) + 1
+	bitDepth := int(packed>>36&0x1F) + 1
+	totalSamples := packed & 0xFFFFFFFFF
+	if sampleRate == 0 {
+		return Info{}, fmt.Errorf("%w: STREAMINFO has a zero sample rate", ErrMalformed)
+	}
+	return Info{
+		Format:     "flac",
+		Codec:      "flac",
+		SampleRate: sampleRate,
+		BitDepth:   bitDepth,
+		Channels:   channels,
+		Duration:   durationOf(totalSamples, sampleRate),
+	}, nil
+}
@@ -0,0 +1,118 @@
+// Package metadata reads the technical properties of an audio file (codec,
+// duration, sample rate, bit depth and channel count) straight from its
+// headers, without decoding any audio. WAV/RF64, FLAC, MP3 and Ogg
+// Vorbis/Opus files are understood.
+package metadata
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+var (
+	// ErrUnsupported is returned for files in a format this package doesn't read.
+	ErrUnsupported = errors.New("unsupported audio format")
+	// ErrMalformed is returned when a file looks like a known format but its
+	// headers are missing or inconsistent.
+	ErrMalformed = errors.New("malformed audio file")
+)
+
+type Info struct {
+	// Format is the archive's name for the file type: wav, flac, mp3, ogg or opus.
+	Format string
+	// Codec names the encoding inside the container, e.g. pcm, flac, mp3, vorbis.
+	Codec      string
+	SampleRate int
+	// BitDepth is the bits per sample of lossless formats, and 0 for lossy ones.
+	BitDepth int
+	Channels int
+	Duration time.Duration
+}
+
+// Seconds returns the duration rounded to the nearest whole second, as it's
+// stored on entities.Recording.
+func (i Info) Seconds() int {
+	return int(i.Duration.Round(time.Second) / time.Second)
+}
+
+// ParseFile opens and parses the audio file at path.
+func ParseFile(path string) (Info, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Info{}, err
+	}
+	defer f.Close()
+	return Parse(f)
+}
+
+// Parse works out the format of r from its leading bytes and reads its
+// properties.
+func Parse(r io.ReadSeeker) (Info, error) {
+	size, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return Info{}, err
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return Info{}, err
+	}
+	head := make([]byte, 12)
+	if _, err := io.ReadFull(r, head); err != nil {
+		return Info{}, fmt.Errorf("%w: file is too short", ErrUnsupported)
+	}
+
+	switch {
+	case bytes.Equal(head[8:12], []byte("WAVE")) &&
+		(bytes.Equal(head[:4], []byte("RIFF")) || bytes.Equal(head[:4], []byte("RF64")) || bytes.Equal(head[:4], []byte("BW64"))):
+		return parseWAV(r, size, string(head[:4]) != "RIFF")
+	case bytes.Equal(head[:4], []byte("fLaC")):
+		return parseFLAC(r, 0)
+	case bytes.Equal(head[:4], []byte("OggS")):
+		return parseOgg(r, size)
+	}
+
+	start := int64(0)
+	if bytes.Equal(head[:3], []byte("ID3")) {
+		start = id3v2Size(head)
+		if _, err := r.Seek(start, io.SeekStart); err != nil {
+			return Info{}, err
+		}
+		magic := make([]byte, 4)
+		if _, err := io.ReadFull(r, magic); err != nil {
+			return Info{}, fmt.Errorf("%w: nothing follows ID3 tag", ErrMalformed)
+		}
+		if bytes.Equal(magic, []byte("fLaC")) {
+			return parseFLAC(r, start)
+		}
+	} else if head[0] != 0xFF || head[1]&0xE0 != 0xE0 {
+		return Info{}, ErrUnsupported
+	}
+	return parseMP3(r, start, size)
+}
+
+// id3v2Size returns the length of the ID3v2 tag whose 10 byte header starts
+// head, including the header and any footer.
+func id3v2Size(head []byte) int64 {
+	size := int64(head[6]&0x7F)<<21 | int64(head[7]&0x7F)<<14 | int64(head[8]&0x7F)<<7 | int64(head[9]&0x7F)
+	size += 10
+	if head[5]&0x10 != 0 {
+		size += 10
+	}
+	return size
+}
+
+func durationOf(samples uint64, sampleRate int) time.Duration {
+	if sampleRate <= 0 {
+		return 0
+	}
+	secs := samples / uint64(sampleRate)
+	rem := samples % uint64(sampleRate)
+	return time.Duration(secs)*time.Second + time.Duration(rem)*time.Second/time.Duration(sampleRate)
+}
+
+var le = binary.LittleEndian
+var be = binary.BigEndian
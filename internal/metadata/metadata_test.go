@@ -0,0 +1,188 @@
+package metadata
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func wavFile(magic string, channels, sampleRate, bitDepth, dataBytes int) []byte {
+	b := &bytes.Buffer{}
+	blockAlign := channels * bitDepth / 8
+	b.WriteString(magic)
+	binary.Write(b, binary.LittleEndian, uint32(0xFFFFFFFF))
+	b.WriteString("WAVE")
+	dataSize := uint32(dataBytes)
+	if magic == "RF64" {
+		b.WriteString("ds64")
+		binary.Write(b, binary.LittleEndian, uint32(28))
+		binary.Write(b, binary.LittleEndian, uint64(0))
+		binary.Write(b, binary.LittleEndian, uint64(dataBytes))
+		binary.Write(b, binary.LittleEndian, uint64(dataBytes/blockAlign))
+		binary.Write(b, binary.LittleEndian, uint32(0))
+		dataSize = 0xFFFFFFFF
+	}
+	b.WriteString("LIST")
+	binary.Write(b, binary.LittleEndian, uint32(3))
+	b.Write([]byte{'a', 'b', 'c', 0}) // odd sized chunk plus pad byte
+	b.WriteString("fmt ")
+	binary.Write(b, binary.LittleEndian, uint32(16))
+	binary.Write(b, binary.LittleEndian, uint16(1))
+	binary.Write(b, binary.LittleEndian, uint16(channels))
+	binary.Write(b, binary.LittleEndian, uint32(sampleRate))
+	binary.Write(b, binary.LittleEndian, uint32(sampleRate*blockAlign))
+	binary.Write(b, binary.LittleEndian, uint16(blockAlign))
+	binary.Write(b, binary.LittleEndian, uint16(bitDepth))
+	b.WriteString("data")
+	binary.Write(b, binary.LittleEndian, dataSize)
+	b.Write(make([]byte, dataBytes))
+	return b.Bytes()
+}
+
+func flacFile(sampleRate, channels, bitDepth int, totalSamples uint64) []byte {
+	b := &bytes.Buffer{}
+	b.WriteString("fLaC")
+	b.Write([]byte{0x80, 0, 0, 34}) // last block, STREAMINFO, 34 bytes
+	b.Write(make([]byte, 10))
+	packed := uint64(sampleRate)<<44 | uint64(channels-1)<<41 | uint64(bitDepth-1)<<36 | totalSamples
+	binary.Write(b, binary.BigEndian, packed)
+	b.Write(make([]byte, 16))
+	return b.Bytes()
+}
+
+// mp3Frames returns n MPEG-1 Layer III frames at 128 kbit/s, 44.1 kHz stereo.
+// If xingFrames is set, the first frame carries a Xing header with that count.
+func mp3Frames(n int, xingFrames uint32) []byte {
+	const frameLength = 417
+	b := &bytes.Buffer{}
+	for i := 0; i < n; i++ {
+		frame := make([]byte, frameLength)
+		copy(frame, []byte{0xFF, 0xFB, 0x90, 0x00})
+		if i == 0 && xingFrames > 0 {
+			copy(frame[36:], "Xing")
+			binary.BigEndian.PutUint32(frame[40:], 0x1)
+			binary.BigEndian.PutUint32(frame[44:], xingFrames)
+		}
+		b.Write(frame)
+	}
+	return b.Bytes()
+}
+
+func oggPage(serial uint32, granule uint64, packet []byte) []byte {
+	b := &bytes.Buffer{}
+	b.WriteString("OggS")
+	b.Write([]byte{0, 0})
+	binary.Write(b, binary.LittleEndian, granule)
+	binary.Write(b, binary.LittleEndian, serial)
+	binary.Write(b, binary.LittleEndian, uint32(0)) // sequence
+	binary.Write(b, binary.LittleEndian, uint32(0)) // checksum
+	b.WriteByte(1)
+	b.WriteByte(byte(len(packet)))
+	b.Write(packet)
+	return b.Bytes()
+}
+
+func TestParseWAV(t *testing.T) {
+	info, err := Parse(bytes.NewReader(wavFile("RIFF", 2, 48000, 24, 48000*6*3)))
+	assert.NoError(t, err)
+	assert.Equal(t, Info{Format: "wav", Codec: "pcm", SampleRate: 48000, BitDepth: 24, Channels: 2, Duration: 3 * time.Second}, info)
+	assert.Equal(t, 3, info.Seconds())
+}
+
+func TestParseRF64(t *testing.T) {
+	info, err := Parse(bytes.NewReader(wavFile("RF64", 1, 96000, 16, 96000*2*2)))
+	assert.NoError(t, err)
+	assert.Equal(t, Info{Format: "wav", Codec: "pcm", SampleRate: 96000, BitDepth: 16, Channels: 1, Duration: 2 * time.Second}, info)
+}
+
+func TestParseTruncatedWAV(t *testing.T) {
+	file := wavFile("RIFF", 1, 8000, 8, 8000*4)
+	info, err := Parse(bytes.NewReader(file[:len(file)-8000*2]))
+	assert.NoError(t, err)
+	assert.Equal(t, 2*time.Second, info.Duration)
+}
+
+func TestParseFLAC(t *testing.T) {
+	info, err := Parse(bytes.NewReader(flacFile(44100, 2, 16, 44100*90+22050)))
+	assert.NoError(t, err)
+	assert.Equal(t, Info{Format: "flac", Codec: "flac", SampleRate: 44100, BitDepth: 16, Channels: 2, Duration: 90500 * time.Millisecond}, info)
+	assert.Equal(t, 91, info.Seconds())
+}
+
+func TestParseFLACWithID3(t *testing.T) {
+	tag := append([]byte("ID3\x04\x00\x00\x00\x00\x00\x05"), make([]byte, 5)...)
+	info, err := Parse(bytes.NewReader(append(tag, flacFile(48000, 1, 24, 48000)...)))
+	assert.NoError(t, err)
+	assert.Equal(t, time.Second, info.Duration)
+	assert.Equal(t, 24, info.BitDepth)
+}
+
+func TestParseMP3CBR(t *testing.T) {
+	file := append([]byte("ID3\x03\x00\x00\x00\x00\x00\x0A"), make([]byte, 10)...)
+	file = append(file, mp3Frames(100, 0)...)
+	info, err := Parse(bytes.NewReader(file))
+	assert.NoError(t, err)
+	assert.Equal(t, "mp3", info.Format)
+	assert.Equal(t, "mp3", info.Codec)
+	assert.Equal(t, 44100, info.SampleRate)
+	assert.Equal(t, 2, info.Channels)
+	assert.Equal(t, 0, info.BitDepth)
+	assert.Equal(t, time.Duration(100*417*8)*time.Second/128000, info.Duration)
+}
+
+func TestParseMP3CBRLarge(t *testing.T) {
+	// Only the first frames are read, so a large file can be claimed by size.
+	info, err := parseMP3(bytes.NewReader(mp3Frames(4, 0)), 0, 2<<30)
+	assert.NoError(t, err)
+	assert.Equal(t, 134217728*time.Millisecond, info.Duration) // 2 GiB at 128 kbit/s
+}
+
+func TestParseMP3Xing(t *testing.T) {
+	info, err := Parse(bytes.NewReader(mp3Frames(3, 1000)))
+	assert.NoError(t, err)
+	assert.Equal(t, durationOf(1000*1152, 44100), info.Duration)
+	assert.Equal(t, 26, info.Seconds())
+}
+
+func TestParseOggVorbis(t *testing.T) {
+	id := make([]byte, 30)
+	id[0] = 0x01
+	copy(id[1:], "vorbis")
+	id[11] = 2
+	binary.LittleEndian.PutUint32(id[12:], 44100)
+	file := oggPage(7, 0, id)
+	file = append(file, oggPage(7, 44100*5, []byte("audio"))...)
+	file = append(file, oggPage(7, 44100*10, []byte("audio"))...)
+	file = append(file, oggPage(8, 44100*60, []byte("other stream"))...)
+
+	info, err := Parse(bytes.NewReader(file))
+	assert.NoError(t, err)
+	assert.Equal(t, Info{Format: "ogg", Codec: "vorbis", SampleRate: 44100, Channels: 2, Duration: 10 * time.Second}, info)
+}
+
+func TestParseOggOpus(t *testing.T) {
+	head := make([]byte, 19)
+	copy(head, "OpusHead")
+	head[8] = 1
+	head[9] = 1
+	binary.LittleEndian.PutUint16(head[10:], 312)
+	binary.LittleEndian.PutUint32(head[12:], 44100)
+	file := oggPage(1, 0, head)
+	file = append(file, oggPage(1, 48000*5+312, []byte("audio"))...)
+
+	info, err := Parse(bytes.NewReader(file))
+	assert.NoError(t, err)
+	assert.Equal(t, Info{Format: "opus", Codec: "opus", SampleRate: 48000, Channels: 1, Duration: 5 * time.Second}, info)
+}
+
+func TestParseUnsupported(t *testing.T) {
+	_, err := Parse(bytes.NewReader([]byte("not an audio file at all")))
+	assert.True(t, errors.Is(err, ErrUnsupported))
+
+	_, err = Parse(bytes.NewReader([]byte("RIFF\x00\x00\x00\x00WAVE")))
+	assert.True(t, errors.Is(err, ErrMalformed))
+}
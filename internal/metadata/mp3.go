@@ -0,0 +1,195 @@
+package metadata
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// mpegVersion values as encoded in bits 19-20 of a frame header.
+const (
+	mpeg25 = 0
+	mpeg2  = 2
+	mpeg1  = 3
+)
+
+var mp3Bitrates = map[bool][3][16]int{
+	// MPEG-1, indexed by layer (I, II, III) then bitrate index, in kbit/s.
+	true: {
+		{0, 32, 64, 96, 128, 160, 192, 224, 256, 288, 320, 352, 384, 416, 448, 0},
+		{0, 32, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 384, 0},
+		{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 0},
+	},
+	// MPEG-2 and 2.5.
+	false: {
+		{0, 32, 48, 56, 64, 80, 96, 112, 128, 144, 160, 176, 192, 224, 256, 0},
+		{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160, 0},
+		{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160, 0},
+	},
+}
+
+var mp3SampleRates = map[int][3]int{
+	mpeg1:  {44100, 48000, 32000},
+	mpeg2:  {22050, 24000, 16000},
+	mpeg25: {11025, 12000, 8000},
+}
+
+// mp3Frame is a decoded MPEG audio frame header.
+type mp3Frame struct {
+	version    int
+	layer      int // 1, 2 or 3
+	bitrate    int // bit/s
+	sampleRate int
+	channels   int
+	length     int // bytes, including the header
+	samples    int // per channel
+}
+
+func parseMP3Header(h []byte) (mp3Frame, bool) {
+	if len(h) < 4 || h[0] != 0xFF || h[1]&0xE0 != 0xE0 {
+		return mp3Frame{}, false
+	}
+	version := int(h[1] >> 3 & 0x3)
+	layerBits := int(h[1] >> 1 & 0x3)
+	bitrateIndex := int(h[2] >> 4)
+	rateIndex := int(h[2] >> 2 & 0x3)
+	padding := int(h[2] >> 1 & 0x1)
+	if version == 1 || layerBits == 0 || bitrateIndex == 0 || bitrateIndex == 15 || rateIndex == 3 {
+		return mp3Frame{}, false
+	}
+	f := mp3Frame{version: version, layer: 4 - layerBits}
+	f.bitrate = mp3Bitrates[version == mpeg1][f.layer-1][bitrateIndex] * 1000
+	f.sampleRate = mp3SampleRates[version][rateIndex]
+	f.channels = 2
+	if h[3]>>6 == 3 {
+		f.channels = 1
+	}
+	switch {
+	case f.layer == 1:
+		f.samples = 384
+		f.length = (12*f.bitrate/f.sampleRate + padding) * 4
+	case f.layer == 3 && version != mpeg1:
+		f.samples = 576
+		f.length = 72*f.bitrate/f.sampleRate + padding
+	default:
+		f.samples = 1152
+		f.length = 144*f.bitrate/f.sampleRate + padding
+	}
+	return f, true
+}
+
+// sideInfoSize is the length of the Layer III side information that sits
+// between the frame header and a Xing/Info header.
+func (f mp3Frame) sideInfoSize() int {
+	switch {
+	case f.version == mpeg1 && f.channels == 1:
+		return 17
+	case f.version == mpeg1:
+		return 32
+	case f.channels == 1:
+		return 9
+	}
+	return 17
+}
+
+func (f mp3Frame) codec() string {
+	return fmt.Sprintf("mp%d", f.layer)
+}
+
+// parseMP3 finds the first MPEG audio frame at or after start. The duration
+// comes from a Xing/Info or VBRI header when the encoder wrote one, and is
+// otherwise estimated from the first frame's bitrate, which is exact for
+// constant bitrate files.
+func parseMP3(r io.ReadSeeker, start, size int64) (Info, error) {
+	const searchLimit = 64 * 1024
+	if _, err := r.Seek(start, io.SeekStart); err != nil {
+		return Info{}, err
+	}
+	buf := make([]byte, searchLimit)
+	n, err := io.ReadFull(r, buf)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return Info{}, fmt.Errorf("%w: %v", ErrMalformed, err)
+	}
+	buf = buf[:n]
+
+	// A frame is only trusted if another one follows it, as 0xFFE can turn
+	// up by chance in leftover tag data.
+	pos, frame := -1, mp3Frame{}
+	for i := 0; i+4 <= len(buf); i++ {
+		f, ok := parseMP3Header(buf[i:])
+		if !ok {
+			continue
+		}
+		next := i + f.length
+		if next+4 <= len(buf) {
+			if nf, ok := parseMP3Header(buf[next:]); !ok || nf.version != f.version || nf.layer != f.layer {
+				continue
+			}
+		} else if start+int64(next) != size {
+			continue
+		}
+		pos, frame = i, f
+		break
+	}
+	if pos < 0 {
+		return Info{}, fmt.Errorf("%w: no MPEG audio frames found", ErrMalformed)
+	}
+
+	info := Info{
+		Format:     "mp3",
+		Codec:      frame.codec(),
+		SampleRate: frame.sampleRate,
+		Channels:   frame.channels,
+	}
+	if frames, ok := vbrFrameCount(buf[pos:], frame); ok {
+		info.Duration = durationOf(uint64(frames)*uint64(frame.samples), frame.sampleRate)
+		return info, nil
+	}
+
+	audioBytes := size - start - int64(pos)
+	if hasID3v1(r, size) {
+		audioBytes -= 128
+	}
+	// Bits over bits per second, like samples over sample rate. Scaling bits
+	// to nanoseconds directly overflows past about 1.15 GB.
+	info.Duration = durationOf(uint64(max(audioBytes, 0))*8, frame.bitrate)
+	return info, nil
+}
+
+// vbrFrameCount reads the frame count from a Xing/Info or VBRI header in the
+// first frame, if it has one.
+func vbrFrameCount(frame []byte, f mp3Frame) (uint32, bool) {
+	if f.layer != 3 {
+		return 0, false
+	}
+	xing := 4 + f.sideInfoSize()
+	if len(frame) >= xing+12 {
+		tag := frame[xing : xing+4]
+		if bytes.Equal(tag, []byte("Xing")) || bytes.Equal(tag, []byte("Info")) {
+			flags := be.Uint32(frame[xing+4:])
+			if flags&0x1 != 0 {
+				return be.Uint32(frame[xing+8:]), true
+			}
+			return 0, false
+		}
+	}
+	const vbri = 4 + 32
+	if len(frame) >= vbri+18 && bytes.Equal(frame[vbri:vbri+4], []byte("VBRI")) {
+		return be.Uint32(frame[vbri+14:]), true
+	}
+	return 0, false
+}
+
+func hasID3v1(r io.ReadSeeker, size int64) bool {
+	if size < 128 {
+		return false
+	}
+	if _, err := r.Seek(size-128, io.SeekStart); err != nil {
+		return false
+	}
+	tag := make([]byte, 3)
+	if _, err := io.ReadFull(r, tag); err != nil {
+		return false
+	}
+	return bytes.Equal(tag, []byte("TAG"))
+}
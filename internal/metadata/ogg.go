@@ -0,0 +1,109 @@
+package metadata
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+)
+
+const (
+	oggHeaderSize = 27
+	opusRate      = 48000
+)
+
+// parseOgg reads the identification header from the first page of an Ogg
+// stream, then takes the duration from the granule position of the last
+// page, which counts samples (or, for Opus, 48 kHz samples including the
+// pre-skip).
+func parseOgg(r io.ReadSeeker, size int64) (Info, error) {
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return Info{}, err
+	}
+	header := make([]byte, oggHeaderSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return Info{}, fmt.Errorf("%w: truncated page header", ErrMalformed)
+	}
+	serial := le.Uint32(header[14:18])
+	segments := make([]byte, header[26])
+	if _, err := io.ReadFull(r, segments); err != nil {
+		return Info{}, fmt.Errorf("%w: truncated segment table", ErrMalformed)
+	}
+	// The identification header is the whole of the first packet, which
+	// ends at the first lacing value below 255.
+	packetSize := 0
+	for _, s := range segments {
+		packetSize += int(s)
+		if s < 255 {
+			break
+		}
+	}
+	packet := make([]byte, packetSize)
+	if _, err := io.ReadFull(r, packet); err != nil {
+		return Info{}, fmt.Errorf("%w: truncated first packet", ErrMalformed)
+	}
+
+	var (
+		info    Info
+		preSkip uint64
+	)
+	switch {
+	case len(packet) >= 30 && packet[0] == 0x01 && bytes.Equal(packet[1:7], []byte("vorbis")):
+		info = Info{
+			Format:     "ogg",
+			Codec:      "vorbis",
+			Channels:   int(packet[11]),
+			SampleRate: int(le.Uint32(packet[12:16])),
+		}
+	case len(packet) >= 19 && bytes.Equal(packet[:8], []byte("OpusHead")):
+		info = Info{
+			Format:     "opus",
+			Codec:      "opus",
+			Channels:   int(packet[9]),
+			SampleRate: opusRate,
+		}
+		preSkip = uint64(le.Uint16(packet[10:12]))
+	default:
+		return Info{}, fmt.Errorf("%w: Ogg stream isn't Vorbis or Opus", ErrUnsupported)
+	}
+	if info.Channels == 0 || info.SampleRate == 0 {
+		return Info{}, fmt.Errorf("%w: identification header has zero channels or sample rate", ErrMalformed)
+	}
+
+	granule, err := lastGranule(r, size, serial)
+	if err != nil {
+		return Info{}, err
+	}
+	if granule > preSkip {
+		info.Duration = durationOf(granule-preSkip, info.SampleRate)
+	}
+	return info, nil
+}
+
+// lastGranule scans backwards from the end of the file for the last page of
+// the stream with a granule position set.
+func lastGranule(r io.ReadSeeker, size int64, serial uint32) (uint64, error) {
+	const maxWindow = 1 << 20
+	for window := int64(64 * 1024); ; window *= 4 {
+		window = min(window, size)
+		if _, err := r.Seek(size-window, io.SeekStart); err != nil {
+			return 0, err
+		}
+		buf := make([]byte, window)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return 0, err
+		}
+		for i := bytes.LastIndex(buf, []byte("OggS")); i >= 0; i = bytes.LastIndex(buf[:i], []byte("OggS")) {
+			if i+oggHeaderSize > len(buf) {
+				continue
+			}
+			page := buf[i:]
+			granule := le.Uint64(page[6:14])
+			if le.Uint32(page[14:18]) == serial && granule != ^uint64(0) {
+				return granule, nil
+			}
+		}
+		if window >= size || window >= maxWindow {
+			return 0, fmt.Errorf("%w: no page with a granule position found", ErrMalformed)
+		}
+	}
+}
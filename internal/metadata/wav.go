@@ -0,0 +1,110 @@
+package metadata
+
+import (
+	"fmt"
+	"io"
+)
+
+const (
+	wavFormatPCM        = 0x0001
+	wavFormatFloat      = 0x0003
+	wavFormatALaw       = 0x0006
+	wavFormatMuLaw      = 0x0007
+	wavFormatExtensible = 0xFFFE
+)
+
+// parseWAV walks the chunks of a RIFF WAVE file, or an RF64/BW64 file when
+// rf64 is set, whose 12 byte header has already been read. RF64 files keep
+// their real sizes in a ds64 chunk as the 32 bit fields can't hold them.
+func parseWAV(r io.ReadSeeker, size int64, rf64 bool) (Info, error) {
+	info := Info{Format: "wav"}
+	var (
+		byteRate   uint32
+		dataSize   int64 = -1
+		ds64Data   int64 = -1
+		haveFormat bool
+	)
+	offset := int64(12)
+	header := make([]byte, 8)
+	for offset+8 <= size {
+		if _, err := r.Seek(offset, io.SeekStart); err != nil {
+			return Info{}, err
+		}
+		if _, err := io.ReadFull(r, header); err != nil {
+			return Info{}, fmt.Errorf("%w: truncated chunk header", ErrMalformed)
+		}
+		id := string(header[:4])
+		chunkSize := int64(le.Uint32(header[4:]))
+		body := offset + 8
+
+		switch id {
+		case "ds64":
+			if !rf64 || chunkSize < 24 {
+				return Info{}, fmt.Errorf("%w: unexpected ds64 chunk", ErrMalformed)
+			}
+			b := make([]byte, 24)
+			if _, err := io.ReadFull(r, b); err != nil {
+				return Info{}, fmt.Errorf("%w: truncated ds64 chunk", ErrMalformed)
+			}
+			ds64Data = int64(le.Uint64(b[8:16]))
+		case "fmt ":
+			if chunkSize < 16 {
+				return Info{}, fmt.Errorf("%w: fmt chunk too short", ErrMalformed)
+			}
+			b := make([]byte, min(chunkSize, 40))
+			if _, err := io.ReadFull(r, b); err != nil {
+				return Info{}, fmt.Errorf("%w: truncated fmt chunk", ErrMalformed)
+			}
+			formatTag := le.Uint16(b[0:2])
+			info.Channels = int(le.Uint16(b[2:4]))
+			info.SampleRate = int(le.Uint32(b[4:8]))
+			byteRate = le.Uint32(b[8:12])
+			info.BitDepth = int(le.Uint16(b[14:16]))
+			if formatTag == wavFormatExtensible && len(b) >= 26 {
+				// The real format is the first two bytes of the SubFormat GUID.
+				formatTag = le.Uint16(b[24:26])
+			}
+			info.Codec = wavCodec(formatTag)
+			haveFormat = true
+		case "data":
+			dataSize = chunkSize
+			if rf64 && chunkSize == 0xFFFFFFFF && ds64Data >= 0 {
+				dataSize = ds64Data
+				chunkSize = ds64Data
+			}
+			// Files written by a recorder that was cut off mid-take often
+			// claim more data than they hold.
+			dataSize = min(dataSize, size-body)
+		}
+		if haveFormat && dataSize >= 0 {
+			break
+		}
+		offset = body + chunkSize + chunkSize%2
+	}
+
+	if !haveFormat {
+		return Info{}, fmt.Errorf("%w: no fmt chunk", ErrMalformed)
+	}
+	if dataSize < 0 {
+		return Info{}, fmt.Errorf("%w: no data chunk", ErrMalformed)
+	}
+	if info.Channels == 0 || info.SampleRate == 0 || byteRate == 0 {
+		return Info{}, fmt.Errorf("%w: fmt chunk has zero channels, sample rate or byte rate", ErrMalformed)
+	}
+	info.Duration = durationOf(uint64(dataSize), int(byteRate))
+	return info, nil
+}
+
+func wavCodec(formatTag uint16) string {
+	switch formatTag {
+	case wavFormatPCM:
+		return "pcm"
+	case wavFormatFloat:
+		return "pcm_float"
+	case wavFormatALaw:
+		return "alaw"
+	case wavFormatMuLaw:
+		return "mulaw"
+	}
+	return fmt.Sprintf("wav_0x%04x", formatTag)
+}
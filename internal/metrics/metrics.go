@@ -0,0 +1,161 @@
+// Package metrics collects Prometheus metrics about HTTP traffic, the
+// database pool, stored files and the archive itself, and serves them for
+// scraping.
+package metrics
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Upload kinds, labelling the upload size histogram.
+const (
+	UploadAudio   = "audio"
+	UploadArtwork = "artwork"
+	UploadCover   = "cover"
+)
+
+// unmatchedRoute labels requests no route matched, so probes for random
+// paths can't add label values without bound.
+const unmatchedRoute = "unmatched"
+
+// Metrics holds the collectors. Its methods do nothing on a nil *Metrics, so
+// handlers built without one, as in tests, needn't check.
+type Metrics struct {
+	registry *prometheus.Registry
+	handler  http.Handler
+
+	requests    *prometheus.CounterVec
+	duration    *prometheus.HistogramVec
+	inFlight    prometheus.Gauge
+	audioServed prometheus.Counter
+	uploads     *prometheus.HistogramVec
+	recordings  prometheus.Gauge
+}
+
+// New returns Metrics registered with a fresh registry, along with the Go
+// runtime and process collectors.
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "http_requests_total",
+			Help: "HTTP requests handled, by method, route template and status code.",
+		}, []string{"method", "route", "status"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name: "http_request_duration_seconds",
+			Help: "Time taken to handle HTTP requests, by method and route template.",
+			// Uploads and audio streams run far longer than API calls.
+			Buckets: []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60, 300},
+		}, []string{"method", "route"}),
+		inFlight: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "http_requests_in_flight",
+			Help: "HTTP requests being handled.",
+		}),
+		audioServed: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "field_archive_audio_served_bytes_total",
+			Help: "Bytes of recording audio sent to clients.",
+		}),
+		uploads: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "field_archive_upload_size_bytes",
+			Help:    "Sizes of accepted uploads, by kind: audio, artwork or cover.",
+			Buckets: prometheus.ExponentialBuckets(64<<10, 4, 8), // 64 KiB to 1 GiB
+		}, []string{"kind"}),
+		recordings: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "field_archive_recordings",
+			Help: "Recordings in the archive, whatever their visibility.",
+		}),
+	}
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.requests, m.duration, m.inFlight, m.audioServed, m.uploads, m.recordings,
+	)
+	// Built once, as it registers a counter of its own errors.
+	m.handler = promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{Registry: m.registry})
+	return m
+}
+
+// Middleware records every request under the route template it matched,
+// such as /recordings/:id, rather than its path. It has to be added before
+// the routes it should measure.
+func (m *Metrics) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if m == nil {
+			c.Next()
+			return
+		}
+		m.inFlight.Inc()
+		start := time.Now()
+		c.Next()
+		m.inFlight.Dec()
+
+		route := c.FullPath()
+		if route == "" {
+			route = unmatchedRoute
+		}
+		method := c.Request.Method
+		m.requests.WithLabelValues(method, route, strconv.Itoa(c.Writer.Status())).Inc()
+		m.duration.WithLabelValues(method, route).Observe(time.Since(start).Seconds())
+	}
+}
+
+// Handler serves the metrics in the Prometheus exposition format.
+func (m *Metrics) Handler() http.Handler {
+	return m.handler
+}
+
+// AudioServed counts n bytes of audio sent to a client. Negative n, as gin
+// reports for responses with no body, is ignored.
+func (m *Metrics) AudioServed(n int) {
+	if m == nil || n <= 0 {
+		return
+	}
+	m.audioServed.Add(float64(n))
+}
+
+// Uploaded records the size of an accepted upload of kind.
+func (m *Metrics) Uploaded(kind string, size int64) {
+	if m == nil {
+		return
+	}
+	m.uploads.WithLabelValues(kind).Observe(float64(size))
+}
+
+// TrackRecordings sets the recordings gauge from count straight away and
+// then every interval until ctx is done. Counting runs in the background
+// rather than on scrape so a slow count can't hold up scraping.
+func (m *Metrics) TrackRecordings(ctx context.Context, interval time.Duration, count func(ctx context.Context) (int, error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		n, err := count(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			log.Printf("unable to count recordings for metrics: %v", err)
+		} else {
+			m.recordings.Set(float64(n))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// WatchPool reports pool's connection statistics, read on each scrape.
+func (m *Metrics) WatchPool(pool *pgxpool.Pool) {
+	m.registry.MustRegister(poolCollector{pool})
+}
@@ -0,0 +1,122 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func scrape(t *testing.T, m *Metrics) string {
+	t.Helper()
+	w := httptest.NewRecorder()
+	m.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	return w.Body.String()
+}
+
+func TestMiddleware(t *testing.T) {
+	m := New()
+	router := gin.New()
+	router.Use(m.Middleware())
+	router.GET("/recordings/:id", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	for _, path := range []string{"/recordings/1", "/recordings/2", "/nowhere"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+
+	assert.Equal(t, 2.0, testutil.ToFloat64(m.requests.WithLabelValues("GET", "/recordings/:id", "200")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.requests.WithLabelValues("GET", unmatchedRoute, "404")))
+	assert.Equal(t, 0.0, testutil.ToFloat64(m.inFlight))
+	body := scrape(t, m)
+	assert.Contains(t, body, `http_request_duration_seconds_count{method="GET",route="/recordings/:id"} 2`)
+	assert.NotContains(t, body, "/recordings/1")
+}
+
+func TestScrapeTwice(t *testing.T) {
+	m := New()
+	scrape(t, m)
+	assert.Contains(t, scrape(t, m), "promhttp_metric_handler_errors_total")
+}
+
+func TestAudioAndUploads(t *testing.T) {
+	m := New()
+	m.AudioServed(1024)
+	m.AudioServed(-1)
+	m.Uploaded(UploadAudio, 5<<20)
+	m.Uploaded(UploadCover, 100<<10)
+
+	assert.Equal(t, 1024.0, testutil.ToFloat64(m.audioServed))
+	body := scrape(t, m)
+	assert.Contains(t, body, `field_archive_upload_size_bytes_count{kind="audio"} 1`)
+	assert.Contains(t, body, `field_archive_upload_size_bytes_count{kind="cover"} 1`)
+}
+
+func TestNilMetrics(t *testing.T) {
+	var m *Metrics
+	m.AudioServed(10)
+	m.Uploaded(UploadArtwork, 10)
+
+	router := gin.New()
+	router.Use(m.Middleware())
+	router.GET("/", func(c *gin.Context) { c.Status(http.StatusNoContent) })
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	assert.Equal(t, http.StatusNoContent, w.Code)
+}
+
+func TestTrackRecordings(t *testing.T) {
+	m := New()
+	ctx, cancel := context.WithCancel(context.Background())
+	counts := make(chan struct{}, 3)
+	calls := 0
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		m.TrackRecordings(ctx, time.Millisecond, func(ctx context.Context) (int, error) {
+			calls++
+			defer func() {
+				select {
+				case counts <- struct{}{}:
+				default:
+				}
+			}()
+			if calls == 2 {
+				return 0, errors.New("database unavailable")
+			}
+			return 40 + calls, nil
+		})
+	}()
+	for range 3 {
+		<-counts
+	}
+	cancel()
+	<-done
+
+	// The failed count leaves the last good value in place until the next.
+	assert.Equal(t, float64(40+calls), testutil.ToFloat64(m.recordings))
+}
+
+func TestWatchPool(t *testing.T) {
+	// The pool connects lazily, so its statistics can be read without a
+	// database.
+	pool, err := pgxpool.New(context.Background(), "postgres://localhost:1/none?pool_max_conns=7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	m := New()
+	m.WatchPool(pool)
+	body := scrape(t, m)
+	assert.Contains(t, body, "pgxpool_max_connections 7")
+	assert.Contains(t, body, "pgxpool_acquired_connections 0")
+	assert.Contains(t, body, "pgxpool_acquires_total 0")
+}
@@ -0,0 +1,63 @@
+package metrics
+
+import (
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	poolAcquired = prometheus.NewDesc("pgxpool_acquired_connections",
+		"Connections currently in use.", nil, nil)
+	poolIdle = prometheus.NewDesc("pgxpool_idle_connections",
+		"Connections open but not in use.", nil, nil)
+	poolConstructing = prometheus.NewDesc("pgxpool_constructing_connections",
+		"Connections being opened.", nil, nil)
+	poolTotal = prometheus.NewDesc("pgxpool_total_connections",
+		"Connections open or being opened.", nil, nil)
+	poolMax = prometheus.NewDesc("pgxpool_max_connections",
+		"The most connections the pool will open.", nil, nil)
+	poolAcquires = prometheus.NewDesc("pgxpool_acquires_total",
+		"Connections acquired from the pool.", nil, nil)
+	poolAcquireSeconds = prometheus.NewDesc("pgxpool_acquire_duration_seconds_total",
+		"Time spent acquiring connections from the pool.", nil, nil)
+	poolEmptyAcquires = prometheus.NewDesc("pgxpool_empty_acquires_total",
+		"Acquires that had to wait for a connection because none were idle.", nil, nil)
+	poolCanceledAcquires = prometheus.NewDesc("pgxpool_canceled_acquires_total",
+		"Acquires given up on before a connection was available.", nil, nil)
+	poolNewConnections = prometheus.NewDesc("pgxpool_new_connections_total",
+		"Connections the pool has opened.", nil, nil)
+)
+
+// poolCollector reads a pgxpool's statistics whenever it's scraped.
+type poolCollector struct {
+	pool *pgxpool.Pool
+}
+
+func (p poolCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, desc := range []*prometheus.Desc{
+		poolAcquired, poolIdle, poolConstructing, poolTotal, poolMax,
+		poolAcquires, poolAcquireSeconds, poolEmptyAcquires, poolCanceledAcquires, poolNewConnections,
+	} {
+		ch <- desc
+	}
+}
+
+func (p poolCollector) Collect(ch chan<- prometheus.Metric) {
+	stat := p.pool.Stat()
+	gauge := func(desc *prometheus.Desc, v float64) {
+		ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, v)
+	}
+	counter := func(desc *prometheus.Desc, v float64) {
+		ch <- prometheus.MustNewConstMetric(desc, prometheus.CounterValue, v)
+	}
+	gauge(poolAcquired, float64(stat.AcquiredConns()))
+	gauge(poolIdle, float64(stat.IdleConns()))
+	gauge(poolConstructing, float64(stat.ConstructingConns()))
+	gauge(poolTotal, float64(stat.TotalConns()))
+	gauge(poolMax, float64(stat.MaxConns()))
+	counter(poolAcquires, float64(stat.AcquireCount()))
+	counter(poolAcquireSeconds, stat.AcquireDuration().Seconds())
+	counter(poolEmptyAcquires, float64(stat.EmptyAcquireCount()))
+	counter(poolCanceledAcquires, float64(stat.CanceledAcquireCount()))
+	counter(poolNewConnections, float64(stat.NewConnsCount()))
+}
@@ -1,25 +1,152 @@
+// Package server runs the HTTP API along with any background workers, and
+// shuts them down in order: in-flight requests are drained first, then
+// workers are stopped, then resources such as the database pool are closed.
 package server
 
 import (
+	"context"
+	"errors"
 	"field_archive/server/handlers"
 	"field_archive/server/internal/config"
 	"log"
+	"net"
 	"net/http"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
-func Start(cfg *config.Config, DefineRoutes func(*gin.Engine, *handlers.RecordingHandler), h *handlers.RecordingHandler) {
-	log.Print("Starting Server...")
+// DefaultShutdownTimeout is how long in-flight requests and workers get to
+// finish when cfg.ShutdownTimeout isn't set.
+const DefaultShutdownTimeout = 30 * time.Second
+
+type Server struct {
+	http            *http.Server
+	shutdownTimeout time.Duration
+
+	workers sync.WaitGroup
+	stop    context.CancelFunc
+	ctx     context.Context
+
+	closers []func()
+}
+
+// New builds the router with the routes defineRoutes adds and the server to
+// run it, with timeouts from cfg.
+func New(cfg *config.Config, defineRoutes func(*gin.Engine)) *Server {
 	router := gin.Default()
 	router.Use(handlers.CORSMiddleware(cfg))
-	DefineRoutes(router, h)
+	defineRoutes(router)
+
+	ctx, stop := context.WithCancel(context.Background())
+	s := &Server{
+		http: &http.Server{
+			Addr:              cfg.Port,
+			Handler:           router,
+			ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+			ReadTimeout:       cfg.ReadTimeout,
+			WriteTimeout:      cfg.WriteTimeout,
+			IdleTimeout:       cfg.IdleTimeout,
+		},
+		shutdownTimeout: cfg.ShutdownTimeout,
+		ctx:             ctx,
+		stop:            stop,
+	}
+	if s.shutdownTimeout <= 0 {
+		s.shutdownTimeout = DefaultShutdownTimeout
+	}
+	return s
+}
+
+// Go runs worker in the background until the server shuts down, when the
+// context it's given is cancelled. Shutdown waits for it to return.
+func (s *Server) Go(worker func(ctx context.Context)) {
+	s.workers.Add(1)
+	go func() {
+		defer s.workers.Done()
+		worker(s.ctx)
+	}()
+}
+
+// OnShutdown registers close to be called once requests have drained and
+// workers have stopped. Closers run in reverse order of registration, so
+// something registered later can still use what was registered before it.
+func (s *Server) OnShutdown(close func()) {
+	s.closers = append(s.closers, close)
+}
 
-	server := &http.Server{
-		Addr:    cfg.Port,
-		Handler: router,
+// Run serves until SIGINT or SIGTERM is received, then shuts down. A second
+// signal kills the process without waiting.
+func (s *Server) Run() error {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	ln, err := net.Listen("tcp", s.http.Addr)
+	if err != nil {
+		s.Shutdown()
+		return err
 	}
-	if err := server.ListenAndServe(); err != nil {
-		log.Fatalf("Error starting Server!\n%v", err)
+	log.Printf("Listening on %s", ln.Addr())
+	return s.Serve(ctx, ln, stop)
+}
+
+// Serve serves on ln until ctx is done, then shuts down. Once ctx is done,
+// release is called so a second signal isn't caught.
+func (s *Server) Serve(ctx context.Context, ln net.Listener, release func()) error {
+	served := make(chan error, 1)
+	go func() {
+		served <- s.http.Serve(ln)
+	}()
+
+	select {
+	case err := <-served:
+		// The listener failed rather than being shut down.
+		s.Shutdown()
+		return err
+	case <-ctx.Done():
+	}
+	release()
+	log.Print("Shutting down...")
+	err := s.Shutdown()
+	if serveErr := <-served; !errors.Is(serveErr, http.ErrServerClosed) {
+		err = errors.Join(err, serveErr)
+	}
+	return err
+}
+
+// Shutdown stops accepting connections and waits up to the shutdown timeout
+// for in-flight requests to finish, closing any still open after it. It then
+// stops the workers, waiting up to the timeout again for them to return, and
+// runs the closers.
+func (s *Server) Shutdown() error {
+	deadline, cancel := context.WithTimeout(context.Background(), s.shutdownTimeout)
+	defer cancel()
+
+	err := s.http.Shutdown(deadline)
+	if err != nil {
+		log.Printf("Requests still in flight after %s, closing their connections", s.shutdownTimeout)
+		err = errors.Join(err, s.http.Close())
+	}
+
+	s.stop()
+	stopped := make(chan struct{})
+	go func() {
+		s.workers.Wait()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(s.shutdownTimeout):
+		log.Printf("Background workers still running after %s", s.shutdownTimeout)
+		err = errors.Join(err, errors.New("server: background workers didn't stop in time"))
+	}
+
+	for i := len(s.closers) - 1; i >= 0; i-- {
+		s.closers[i]()
 	}
+	s.closers = nil
+	return err
 }
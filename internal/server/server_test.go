@@ -0,0 +1,114 @@
+package server
+
+import (
+	"context"
+	"field_archive/server/internal/config"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// start serves s on a local port until the returned cancel is called. The
+// channel receives what Serve returned.
+func start(t *testing.T, s *Server) (string, context.CancelFunc, <-chan error) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- s.Serve(ctx, ln, func() {}) }()
+	return "http://" + ln.Addr().String(), cancel, done
+}
+
+func TestShutdownDrainsRequests(t *testing.T) {
+	entered, release := make(chan struct{}), make(chan struct{})
+	s := New(&config.Config{ShutdownTimeout: 5 * time.Second}, func(router *gin.Engine) {
+		router.GET("/slow", func(c *gin.Context) {
+			close(entered)
+			<-release
+			c.String(http.StatusOK, "done")
+		})
+	})
+
+	var order []string
+	workerStopped := make(chan struct{})
+	s.Go(func(ctx context.Context) {
+		<-ctx.Done()
+		order = append(order, "worker")
+		close(workerStopped)
+	})
+	s.OnShutdown(func() { order = append(order, "first registered") })
+	s.OnShutdown(func() { order = append(order, "last registered") })
+
+	url, stop, done := start(t, s)
+	type result struct {
+		body string
+		err  error
+	}
+	responded := make(chan result, 1)
+	go func() {
+		res, err := http.Get(url + "/slow")
+		if err != nil {
+			responded <- result{err: err}
+			return
+		}
+		defer res.Body.Close()
+		body, err := io.ReadAll(res.Body)
+		responded <- result{string(body), err}
+	}()
+	<-entered
+
+	stop()
+	// New connections are refused while the slow request finishes.
+	assert.Eventually(t, func() bool {
+		_, err := net.Dial("tcp", url[len("http://"):])
+		return err != nil
+	}, time.Second, 10*time.Millisecond)
+	select {
+	case <-workerStopped:
+		t.Fatal("worker stopped before requests drained")
+	default:
+	}
+
+	close(release)
+	r := <-responded
+	assert.NoError(t, r.err)
+	assert.Equal(t, "done", r.body)
+	assert.NoError(t, <-done)
+	assert.Equal(t, []string{"worker", "last registered", "first registered"}, order)
+}
+
+func TestShutdownDeadline(t *testing.T) {
+	entered := make(chan struct{})
+	s := New(&config.Config{ShutdownTimeout: 50 * time.Millisecond}, func(router *gin.Engine) {
+		router.GET("/stuck", func(c *gin.Context) {
+			close(entered)
+			<-c.Request.Context().Done()
+		})
+	})
+	closed := false
+	s.OnShutdown(func() { closed = true })
+
+	url, stop, done := start(t, s)
+	failed := make(chan error, 1)
+	go func() {
+		res, err := http.Get(url + "/stuck")
+		if err == nil {
+			res.Body.Close()
+		}
+		failed <- err
+	}()
+	<-entered
+
+	stop()
+	assert.ErrorIs(t, <-done, context.DeadlineExceeded)
+	assert.Error(t, <-failed, "the stuck request's connection should be closed")
+	assert.True(t, closed)
+}
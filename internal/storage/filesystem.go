@@ -0,0 +1,196 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Filesystem stores objects as files under a root directory.
+type Filesystem struct {
+	root string
+}
+
+func NewFilesystem(root string) (*Filesystem, error) {
+	abs, err := filepath.Abs(root)
+	if err != nil {
+		return nil, fmt.Errorf("storage: problem resolving root, %w", err)
+	}
+	if err := os.MkdirAll(abs, 0o755); err != nil {
+		return nil, fmt.Errorf("storage: problem creating root, %w", err)
+	}
+	return &Filesystem{root: abs}, nil
+}
+
+func (f *Filesystem) Put(ctx context.Context, key string, r io.Reader) (int64, error) {
+	path, err := f.path(key)
+	if err != nil {
+		return 0, err
+	}
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return 0, err
+	}
+	// Write to a temporary file first so a failed upload never leaves a
+	// partial object behind.
+	tmp, err := os.CreateTemp(dir, ".upload-*")
+	if err != nil {
+		return 0, err
+	}
+	size, err := io.Copy(tmp, r)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), 0o644)
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return 0, err
+	}
+	return size, nil
+}
+
+func (f *Filesystem) Get(ctx context.Context, key string) (Object, Info, error) {
+	path, err := f.resolve(key)
+	if err != nil {
+		return nil, Info{}, err
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, Info{}, notFound(err)
+	}
+	stat, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, Info{}, err
+	}
+	if !stat.Mode().IsRegular() {
+		file.Close()
+		return nil, Info{}, ErrNotFound
+	}
+	return file, fileInfo(key, stat), nil
+}
+
+func (f *Filesystem) Stat(ctx context.Context, key string) (Info, error) {
+	path, err := f.resolve(key)
+	if err != nil {
+		return Info{}, err
+	}
+	stat, err := os.Stat(path)
+	if err != nil {
+		return Info{}, notFound(err)
+	}
+	if !stat.Mode().IsRegular() {
+		return Info{}, ErrNotFound
+	}
+	return fileInfo(key, stat), nil
+}
+
+func (f *Filesystem) Delete(ctx context.Context, key string) error {
+	path, err := f.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (f *Filesystem) List(ctx context.Context, prefix string) ([]Info, error) {
+	var infos []Info
+	err := filepath.WalkDir(f.root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() || strings.HasPrefix(d.Name(), ".upload-") {
+			return nil
+		}
+		rel, err := filepath.Rel(f.root, path)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+		stat, err := d.Info()
+		if err != nil {
+			return err
+		}
+		infos = append(infos, fileInfo(key, stat))
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("storage: problem listing objects, %w", err)
+	}
+	return infos, nil
+}
+
+// SignedURL isn't available for files on disk, they are only ever served
+// through the API.
+func (f *Filesystem) SignedURL(ctx context.Context, key string, expiry time.Duration) (string, error) {
+	return "", ErrUnsupported
+}
+
+// path maps key onto a file under the root. Keys are rejected if they are
+// absolute or contain "." or ".." elements.
+func (f *Filesystem) path(key string) (string, error) {
+	if !validKey(key) {
+		return "", fmt.Errorf("%w %q", ErrInvalidKey, key)
+	}
+	return filepath.Join(f.root, filepath.FromSlash(key)), nil
+}
+
+// resolve is path for reads, additionally following symlinks so that a link
+// can't be used to read a file from outside of the root.
+func (f *Filesystem) resolve(key string) (string, error) {
+	path, err := f.path(key)
+	if err != nil {
+		return "", err
+	}
+	root, err := filepath.EvalSymlinks(f.root)
+	if err != nil {
+		return "", err
+	}
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return "", notFound(err)
+	}
+	rel, err := filepath.Rel(root, resolved)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", ErrNotFound
+	}
+	return resolved, nil
+}
+
+func validKey(key string) bool {
+	return key != "" && key != "." && fs.ValidPath(key)
+}
+
+func notFound(err error) error {
+	if errors.Is(err, fs.ErrNotExist) {
+		return ErrNotFound
+	}
+	return err
+}
+
+func fileInfo(key string, stat fs.FileInfo) Info {
+	return Info{
+		Key:         key,
+		Size:        stat.Size(),
+		ModTime:     stat.ModTime(),
+		ETag:        fmt.Sprintf(`"%x-%x"`, stat.ModTime().UnixNano(), stat.Size()),
+		ContentType: ContentType(key),
+	}
+}
@@ -0,0 +1,98 @@
+// Package storage keeps recording audio and artwork in a blob store. Objects
+// are addressed by slash separated keys such as "audio/3f2a.wav" so the same
+// key works whichever driver is configured.
+package storage
+
+import (
+	"context"
+	"errors"
+	"field_archive/server/internal/config"
+	"fmt"
+	"io"
+	"mime"
+	"path"
+	"strings"
+	"time"
+)
+
+var (
+	ErrNotFound    = errors.New("storage: object not found")
+	ErrInvalidKey  = errors.New("storage: invalid key")
+	ErrUnsupported = errors.New("storage: not supported by driver")
+)
+
+// Blob is a store of immutable objects.
+type Blob interface {
+	// Put stores the contents of r under key, replacing any existing object,
+	// and returns the number of bytes written.
+	Put(ctx context.Context, key string, r io.Reader) (int64, error)
+	// Get opens the object stored under key. The returned Object must be
+	// closed by the caller.
+	Get(ctx context.Context, key string) (Object, Info, error)
+	Stat(ctx context.Context, key string) (Info, error)
+	// Delete removes the object under key. Deleting a missing object is not
+	// an error.
+	Delete(ctx context.Context, key string) error
+	// List returns every object whose key starts with prefix.
+	List(ctx context.Context, prefix string) ([]Info, error)
+	// SignedURL returns a URL that grants read access to the object under
+	// key until expiry has passed.
+	SignedURL(ctx context.Context, key string, expiry time.Duration) (string, error)
+}
+
+// Object is an open stored object. Seeking lets callers serve byte ranges.
+type Object interface {
+	io.ReadSeekCloser
+}
+
+type Info struct {
+	Key         string
+	Size        int64
+	ModTime     time.Time
+	ETag        string
+	ContentType string
+}
+
+// New returns the driver selected by cfg.StorageDriver.
+func New(ctx context.Context, cfg *config.Config) (Blob, error) {
+	switch cfg.StorageDriver {
+	case "", "filesystem":
+		return NewFilesystem(cfg.StorageRoot)
+	case "s3":
+		return NewS3(ctx, S3Options{
+			Endpoint:  cfg.S3Endpoint,
+			Region:    cfg.S3Region,
+			Bucket:    cfg.S3Bucket,
+			AccessKey: cfg.S3AccessKey,
+			SecretKey: cfg.S3SecretKey,
+			UseSSL:    cfg.S3UseSSL,
+		})
+	}
+	return nil, fmt.Errorf("storage: unknown driver %q", cfg.StorageDriver)
+}
+
+// contentTypes covers the formats the archive accepts, some of which are
+// missing from the system mime tables.
+var contentTypes = map[string]string{
+	".wav":  "audio/wav",
+	".flac": "audio/flac",
+	".mp3":  "audio/mpeg",
+	".ogg":  "audio/ogg",
+	".opus": "audio/ogg; codecs=opus",
+	".jpg":  "image/jpeg",
+	".jpeg": "image/jpeg",
+	".png":  "image/png",
+	".webp": "image/webp",
+}
+
+// ContentType guesses the media type of key from its extension.
+func ContentType(key string) string {
+	ext := strings.ToLower(path.Ext(key))
+	if ct, ok := contentTypes[ext]; ok {
+		return ct
+	}
+	if ct := mime.TypeByExtension(ext); ct != "" {
+		return ct
+	}
+	return "application/octet-stream"
+}
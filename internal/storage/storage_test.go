@@ -0,0 +1,127 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testBlob runs the behaviour every driver must share against b.
+func testBlob(t *testing.T, b Blob) {
+	ctx := context.Background()
+
+	size, err := b.Put(ctx, "audio/a.flac", strings.NewReader("0123456789"))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(10), size)
+	_, err = b.Put(ctx, "artwork/a.png", strings.NewReader("png"))
+	assert.NoError(t, err)
+
+	info, err := b.Stat(ctx, "audio/a.flac")
+	assert.NoError(t, err)
+	assert.Equal(t, "audio/a.flac", info.Key)
+	assert.Equal(t, int64(10), info.Size)
+	assert.Equal(t, "audio/flac", info.ContentType)
+	assert.NotEmpty(t, info.ETag)
+	assert.False(t, info.ModTime.IsZero())
+
+	obj, info, err := b.Get(ctx, "audio/a.flac")
+	if assert.NoError(t, err) {
+		_, err = obj.Seek(4, io.SeekStart)
+		assert.NoError(t, err)
+		rest, err := io.ReadAll(obj)
+		assert.NoError(t, err)
+		assert.Equal(t, "456789", string(rest))
+		assert.NoError(t, obj.Close())
+		assert.Equal(t, int64(10), info.Size)
+	}
+
+	infos, err := b.List(ctx, "audio/")
+	assert.NoError(t, err)
+	if assert.Len(t, infos, 1) {
+		assert.Equal(t, "audio/a.flac", infos[0].Key)
+	}
+
+	_, err = b.Stat(ctx, "audio/missing.wav")
+	assert.ErrorIs(t, err, ErrNotFound)
+	_, _, err = b.Get(ctx, "audio/missing.wav")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	for _, key := range []string{"", "/etc/passwd", "../secret", "audio/../../secret", "./audio/a.flac"} {
+		_, _, err = b.Get(ctx, key)
+		assert.ErrorIs(t, err, ErrInvalidKey, key)
+		_, err = b.Put(ctx, key, strings.NewReader("x"))
+		assert.ErrorIs(t, err, ErrInvalidKey, key)
+	}
+
+	assert.NoError(t, b.Delete(ctx, "audio/a.flac"))
+	assert.NoError(t, b.Delete(ctx, "audio/a.flac"))
+	_, err = b.Stat(ctx, "audio/a.flac")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestFilesystem(t *testing.T) {
+	f, err := NewFilesystem(t.TempDir())
+	assert.NoError(t, err)
+	testBlob(t, f)
+
+	_, err = f.SignedURL(context.Background(), "artwork/a.png", time.Minute)
+	assert.ErrorIs(t, err, ErrUnsupported)
+}
+
+func TestFilesystemRefusesSymlinksOutOfRoot(t *testing.T) {
+	root := t.TempDir()
+	f, err := NewFilesystem(root)
+	assert.NoError(t, err)
+	outside := filepath.Join(t.TempDir(), "secret.wav")
+	os.WriteFile(outside, []byte("secret"), 0o644)
+	os.Symlink(outside, filepath.Join(root, "link.wav"))
+	os.Symlink(filepath.Dir(outside), filepath.Join(root, "dir"))
+
+	_, _, err = f.Get(context.Background(), "link.wav")
+	assert.ErrorIs(t, err, ErrNotFound)
+	_, _, err = f.Get(context.Background(), "dir/secret.wav")
+	assert.ErrorIs(t, err, ErrNotFound)
+	_, err = f.Stat(context.Background(), "link.wav")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+// TestS3 runs against an S3 compatible server such as a local MinIO, e.g.
+//
+//	docker run -p 9000:9000 minio/minio server /data
+//
+// with S3_TEST_ENDPOINT=localhost:9000 and S3_TEST_BUCKET naming an existing
+// bucket. It is skipped when S3_TEST_ENDPOINT isn't set.
+func TestS3(t *testing.T) {
+	endpoint := os.Getenv("S3_TEST_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("S3_TEST_ENDPOINT not set")
+	}
+	s, err := NewS3(context.Background(), S3Options{
+		Endpoint:  endpoint,
+		Bucket:    os.Getenv("S3_TEST_BUCKET"),
+		AccessKey: os.Getenv("S3_TEST_ACCESS_KEY"),
+		SecretKey: os.Getenv("S3_TEST_SECRET_KEY"),
+		UseSSL:    os.Getenv("S3_TEST_USE_SSL") == "true",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Delete(context.Background(), "artwork/a.png") })
+	testBlob(t, s)
+
+	url, err := s.SignedURL(context.Background(), "artwork/a.png", time.Minute)
+	assert.NoError(t, err)
+	assert.Contains(t, url, "artwork/a.png")
+}
+
+func TestContentType(t *testing.T) {
+	assert.Equal(t, "audio/mpeg", ContentType("audio/a.MP3"))
+	assert.Equal(t, "audio/ogg; codecs=opus", ContentType("audio/a.opus"))
+	assert.Equal(t, "application/octet-stream", ContentType("audio/a"))
+}
@@ -0,0 +1,148 @@
+package repositories
+
+import (
+	"context"
+	"field_archive/server/entities"
+	"field_archive/server/internal/database"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+)
+
+type APIKeyRepository interface {
+	Insert(key entities.APIKey, ctx context.Context) (int, error)
+	GetRowByID(id int, ctx context.Context) (entities.APIKey, error)
+	GetByHash(hash string, ctx context.Context) (entities.APIKey, error)
+	ListByUser(userID int, ctx context.Context) ([]entities.APIKey, error)
+	Revoke(id, userID int, ctx context.Context) error
+	Touch(id int, ctx context.Context) error
+}
+
+const apiKeyColumns = `id, user_id, name, prefix, key_hash, scopes, date_created, last_used_at, revoked_at`
+
+type APIKeyRepoImplement struct {
+	conn database.Database
+}
+
+func NewAPIKeyRepo(db *database.Postgres) *APIKeyRepoImplement {
+	return &APIKeyRepoImplement{conn: db}
+}
+
+func (r *APIKeyRepoImplement) Insert(key entities.APIKey, ctx context.Context) (int, error) {
+	query := `INSERT INTO api_keys ` +
+		`(user_id, name, prefix, key_hash, scopes) ` +
+		`VALUES (@user_id, @name, @prefix, @key_hash, @scopes) ` +
+		`RETURNING id`
+	args := pgx.NamedArgs{
+		"user_id":  key.UserID,
+		"name":     key.Name,
+		"prefix":   key.Prefix,
+		"key_hash": key.KeyHash,
+		"scopes":   key.Scopes,
+	}
+	var id int
+	err := r.conn.QueryRow(ctx, query, args).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("unable to insert row: %w", err)
+	}
+	return id, nil
+}
+
+func (r *APIKeyRepoImplement) GetRowByID(id int, ctx context.Context) (entities.APIKey, error) {
+	query := `SELECT ` + apiKeyColumns + ` FROM api_keys WHERE id = @id`
+	args := pgx.NamedArgs{
+		"id": id,
+	}
+	key, err := scanAPIKey(r.conn.QueryRow(ctx, query, args))
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return entities.APIKey{}, fmt.Errorf("api key with id %d %w", id, ErrNotFound)
+		}
+		return entities.APIKey{}, fmt.Errorf("unable to get row: %w", err)
+	}
+	return key, nil
+}
+
+func (r *APIKeyRepoImplement) GetByHash(hash string, ctx context.Context) (entities.APIKey, error) {
+	query := `SELECT ` + apiKeyColumns + ` FROM api_keys WHERE key_hash = @key_hash`
+	args := pgx.NamedArgs{
+		"key_hash": hash,
+	}
+	key, err := scanAPIKey(r.conn.QueryRow(ctx, query, args))
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return entities.APIKey{}, fmt.Errorf("api key %w", ErrNotFound)
+		}
+		return entities.APIKey{}, fmt.Errorf("unable to get row: %w", err)
+	}
+	return key, nil
+}
+
+// ListByUser returns the user's keys, revoked ones included, newest first.
+func (r *APIKeyRepoImplement) ListByUser(userID int, ctx context.Context) ([]entities.APIKey, error) {
+	res := []entities.APIKey{}
+	query := `SELECT ` + apiKeyColumns + ` FROM api_keys WHERE user_id = @user_id ORDER BY id DESC`
+	args := pgx.NamedArgs{
+		"user_id": userID,
+	}
+	rows, err := r.conn.Query(ctx, query, args)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, fmt.Errorf("unable to scan row: %w", err)
+		}
+		res = append(res, key)
+	}
+	return res, rows.Err()
+}
+
+// Revoke revokes one of the user's keys. Keys that belong to someone else or
+// are already revoked are reported as not found.
+func (r *APIKeyRepoImplement) Revoke(id, userID int, ctx context.Context) error {
+	query := `UPDATE api_keys SET revoked_at = now() ` +
+		`WHERE id = @id AND user_id = @user_id AND revoked_at IS NULL`
+	args := pgx.NamedArgs{
+		"id":      id,
+		"user_id": userID,
+	}
+	tag, err := r.conn.Exec(ctx, query, args)
+	if err != nil {
+		return fmt.Errorf("unable to update row: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("api key with id %d %w", id, ErrNotFound)
+	}
+	return nil
+}
+
+// Touch sets the key's last used time to now.
+func (r *APIKeyRepoImplement) Touch(id int, ctx context.Context) error {
+	query := `UPDATE api_keys SET last_used_at = now() WHERE id = @id`
+	args := pgx.NamedArgs{
+		"id": id,
+	}
+	if _, err := r.conn.Exec(ctx, query, args); err != nil {
+		return fmt.Errorf("unable to update row: %w", err)
+	}
+	return nil
+}
+
+func scanAPIKey(row pgx.Row) (entities.APIKey, error) {
+	var key entities.APIKey
+	err := row.Scan(
+		&key.ID,
+		&key.UserID,
+		&key.Name,
+		&key.Prefix,
+		&key.KeyHash,
+		&key.Scopes,
+		&key.DateCreated,
+		&key.LastUsedAt,
+		&key.RevokedAt)
+	return key, err
+}
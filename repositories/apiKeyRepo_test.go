@@ -0,0 +1,78 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"field_archive/server/entities"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetAPIKeyByHash(t *testing.T) {
+	check := `SELECT id, user_id, name, prefix, key_hash, scopes, date_created, last_used_at, revoked_at ` +
+		`FROM api_keys WHERE key_hash = @key_hash`
+	created := time.Date(2025, 1, 6, 20, 2, 57, 0, time.UTC)
+	mockDB := &MockDatabase{
+		mockQueryRow: func(ctx context.Context, query string, args ...any) pgx.Row {
+			named := args[0].(pgx.NamedArgs)
+			if check != query || named["key_hash"] != "hash" {
+				return &MockRow{mockScan: func(dest ...any) error {
+					return pgx.ErrNoRows
+				}}
+			}
+			return &MockRow{mockScan: func(dest ...any) error {
+				innerSlice, ok := dest[0].([]any)
+				if !ok {
+					return errors.New("Unable to access inner slice")
+				}
+				*(innerSlice[0].(*int)) = 3
+				*(innerSlice[1].(*int)) = 1
+				*(innerSlice[2].(*string)) = "recorder"
+				*(innerSlice[3].(*string)) = "fa_abcdefgh"
+				*(innerSlice[4].(*string)) = "hash"
+				*(innerSlice[5].(*[]string)) = []string{"recordings:write"}
+				*(innerSlice[6].(*time.Time)) = created
+				return nil
+			}}
+		},
+	}
+	repo := &APIKeyRepoImplement{conn: mockDB}
+	key, err := repo.GetByHash("hash", context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, entities.APIKey{
+		ID:          3,
+		UserID:      1,
+		Name:        "recorder",
+		Prefix:      "fa_abcdefgh",
+		KeyHash:     "hash",
+		Scopes:      []string{"recordings:write"},
+		DateCreated: created,
+	}, key)
+
+	_, err = repo.GetByHash("other", context.Background())
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestRevokeAPIKey(t *testing.T) {
+	check := `UPDATE api_keys SET revoked_at = now() ` +
+		`WHERE id = @id AND user_id = @user_id AND revoked_at IS NULL`
+	mockDB := &MockDatabase{
+		mockExec: func(ctx context.Context, query string, args ...any) (pgconn.CommandTag, error) {
+			if check != query {
+				return pgconn.CommandTag{}, errors.New("query did not match check")
+			}
+			named := args[0].(pgx.NamedArgs)
+			if named["id"] == 3 && named["user_id"] == 1 {
+				return pgconn.NewCommandTag("UPDATE 1"), nil
+			}
+			return pgconn.NewCommandTag("UPDATE 0"), nil
+		},
+	}
+	repo := &APIKeyRepoImplement{conn: mockDB}
+	assert.NoError(t, repo.Revoke(3, 1, context.Background()))
+	assert.ErrorIs(t, repo.Revoke(3, 2, context.Background()), ErrNotFound)
+}
@@ -0,0 +1,182 @@
+package repositories
+
+import (
+	"context"
+	"field_archive/server/entities"
+	"field_archive/server/internal/database"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+)
+
+type CollectionRepository interface {
+	Insert(collection entities.Collection, ctx context.Context) (int, error)
+	GetRowByID(id int, viewer Viewer, ctx context.Context) (entities.Collection, error)
+	Update(collection entities.Collection, ctx context.Context) error
+	Delete(id int, ctx context.Context) error
+	List(ctx context.Context, viewer Viewer, limit int) ([]entities.Collection, error)
+	SetRecordings(id int, recordingIDs []int, ctx context.Context) error
+	// InTx runs fn with a repository whose writes all commit together, or
+	// not at all if fn returns an error.
+	InTx(ctx context.Context, fn func(repo CollectionRepository) error) error
+}
+
+const collectionColumns = `c.id, c.title, c.description, c.cover_location, c.user_id, c.visibility, c.date_created`
+
+type CollectionRepoImplement struct {
+	conn database.Database
+}
+
+func NewCollectionRepo(db *database.Postgres) *CollectionRepoImplement {
+	return &CollectionRepoImplement{conn: db}
+}
+
+func (r *CollectionRepoImplement) Insert(collection entities.Collection, ctx context.Context) (int, error) {
+	query := `INSERT INTO collections ` +
+		`(title, description, cover_location, user_id, visibility) ` +
+		`VALUES (@title, @description, @cover_location, @user_id, @visibility) ` +
+		`RETURNING id`
+	args := pgx.NamedArgs{
+		"title":          collection.Title,
+		"description":    collection.Description,
+		"cover_location": collection.CoverLocation,
+		"user_id":        collection.UserID,
+		"visibility":     collection.Visibility,
+	}
+	var id int
+	err := r.conn.QueryRow(ctx, query, args).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("unable to insert row: %w", err)
+	}
+	return id, nil
+}
+
+// GetRowByID returns the collection if viewer is allowed to see it, listing
+// only the recordings in it they can see too. Collections they can't see are
+// reported as not found.
+func (r *CollectionRepoImplement) GetRowByID(id int, viewer Viewer, ctx context.Context) (entities.Collection, error) {
+	args := pgx.NamedArgs{
+		"id": id,
+	}
+	conds := append([]string{`c.id = @id`}, viewer.collectionReadable(args)...)
+	query := `SELECT ` + collectionColumns + `, ` + collectionRecordingIDs(args, viewer) +
+		` FROM collections c` + whereClause(conds)
+	var collection entities.Collection
+	err := scanCollection(r.conn.QueryRow(ctx, query, args), &collection)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return entities.Collection{}, fmt.Errorf("collection with id %d %w", id, ErrNotFound)
+		}
+		return entities.Collection{}, fmt.Errorf("unable to get row: %w", err)
+	}
+	return collection, nil
+}
+
+// Update saves the collection's details. Its recordings are changed with
+// SetRecordings.
+func (r *CollectionRepoImplement) Update(collection entities.Collection, ctx context.Context) error {
+	query := `UPDATE collections SET title = @title, description = @description, ` +
+		`cover_location = @cover_location, visibility = @visibility WHERE id = @id`
+	args := pgx.NamedArgs{
+		"id":             collection.ID,
+		"title":          collection.Title,
+		"description":    collection.Description,
+		"cover_location": collection.CoverLocation,
+		"visibility":     collection.Visibility,
+	}
+	tag, err := r.conn.Exec(ctx, query, args)
+	if err != nil {
+		return fmt.Errorf("unable to update row: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("collection with id %d %w", collection.ID, ErrNotFound)
+	}
+	return nil
+}
+
+func (r *CollectionRepoImplement) Delete(id int, ctx context.Context) error {
+	query := `DELETE FROM collections WHERE id = @id`
+	args := pgx.NamedArgs{
+		"id": id,
+	}
+	tag, err := r.conn.Exec(ctx, query, args)
+	if err != nil {
+		return fmt.Errorf("unable to delete row: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("collection with id %d %w", id, ErrNotFound)
+	}
+	return nil
+}
+
+// List returns the collections viewer can list, oldest first.
+func (r *CollectionRepoImplement) List(ctx context.Context, viewer Viewer, limit int) ([]entities.Collection, error) {
+	res := []entities.Collection{}
+	args := pgx.NamedArgs{"limit": limit}
+	query := `SELECT ` + collectionColumns + `, ` + collectionRecordingIDs(args, viewer) +
+		` FROM collections c` + whereClause(viewer.collectionListable(args)) + ` ORDER BY c.id LIMIT @limit`
+	rows, err := r.conn.Query(ctx, query, args)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		collection := entities.Collection{}
+		if err := scanCollection(rows, &collection); err != nil {
+			return nil, fmt.Errorf("unable to scan row: %w", err)
+		}
+		res = append(res, collection)
+	}
+	return res, rows.Err()
+}
+
+// SetRecordings replaces the collection's recordings with recordingIDs, in
+// that order, in a transaction so readers never see it half changed. The
+// old rows are deleted by a statement of their own, as a DELETE in a WITH
+// clause would only run after the INSERT and clash with any recording kept.
+func (r *CollectionRepoImplement) SetRecordings(id int, recordingIDs []int, ctx context.Context) error {
+	return r.conn.InTx(ctx, func(tx database.Database) error {
+		args := pgx.NamedArgs{
+			"id":            id,
+			"recording_ids": recordingIDs,
+		}
+		if _, err := tx.Exec(ctx, `DELETE FROM collection_recordings WHERE collection_id = @id`, args); err != nil {
+			return fmt.Errorf("unable to clear collection recordings: %w", err)
+		}
+		query := `INSERT INTO collection_recordings (collection_id, recording_id, position) ` +
+			`SELECT @id, m.recording_id, m.position FROM unnest(@recording_ids::int[]) WITH ORDINALITY AS m(recording_id, position)`
+		if _, err := tx.Exec(ctx, query, args); err != nil {
+			return fmt.Errorf("unable to set collection recordings: %w", err)
+		}
+		return nil
+	})
+}
+
+func (r *CollectionRepoImplement) InTx(ctx context.Context, fn func(repo CollectionRepository) error) error {
+	return r.conn.InTx(ctx, func(tx database.Database) error {
+		return fn(&CollectionRepoImplement{conn: tx})
+	})
+}
+
+// collectionRecordingIDs selects the IDs of the recordings in collection c
+// that viewer can fetch, in order.
+func collectionRecordingIDs(args pgx.NamedArgs, viewer Viewer) string {
+	conds := append([]string{`cr.collection_id = c.id`}, viewer.readable(args, "r")...)
+	return `ARRAY(SELECT cr.recording_id FROM collection_recordings cr JOIN recordings r ON r.id = cr.recording_id` +
+		whereClause(conds) + ` ORDER BY cr.position) AS recording_ids`
+}
+
+// scanCollection scans a row selected with collectionColumns followed by
+// collectionRecordingIDs.
+func scanCollection(row pgx.Row, collection *entities.Collection) error {
+	return row.Scan(
+		&collection.ID,
+		&collection.Title,
+		&collection.Description,
+		&collection.CoverLocation,
+		&collection.UserID,
+		&collection.Visibility,
+		&collection.DateCreated,
+		&collection.RecordingIDs)
+}
@@ -0,0 +1,117 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetCollectionByID(t *testing.T) {
+	check := `SELECT c.id, c.title, c.description, c.cover_location, c.user_id, c.visibility, c.date_created, ` +
+		`ARRAY(SELECT cr.recording_id FROM collection_recordings cr JOIN recordings r ON r.id = cr.recording_id ` +
+		`WHERE cr.collection_id = c.id ` +
+		`AND ((r.visibility IN ('public', 'unlisted') AND (r.embargo_until IS NULL OR r.embargo_until <= now())) OR r.user_id = @viewer_id) ` +
+		`ORDER BY cr.position) AS recording_ids ` +
+		`FROM collections c WHERE c.id = @id AND (visibility IN ('public', 'unlisted') OR user_id = @viewer_id)`
+	created := time.Date(2025, 1, 6, 20, 2, 57, 0, time.UTC)
+	mockDB := &MockDatabase{
+		mockQueryRow: func(ctx context.Context, query string, args ...any) pgx.Row {
+			if check != query {
+				return &MockRow{mockScan: func(dest ...any) error {
+					return errors.New("query did not match check")
+				}}
+			}
+			assert.Equal(t, pgx.NamedArgs{"id": 2, "viewer_id": 7}, args[0].(pgx.NamedArgs))
+			return &MockRow{mockScan: func(dest ...any) error {
+				innerSlice := dest[0].([]any)
+				*(innerSlice[0].(*int)) = 2
+				*(innerSlice[1].(*string)) = "Dawn walk"
+				*(innerSlice[4].(*int)) = 7
+				*(innerSlice[5].(*string)) = "private"
+				*(innerSlice[6].(*time.Time)) = created
+				*(innerSlice[7].(*[]int)) = []int{3, 1}
+				return nil
+			}}
+		},
+	}
+	repo := &CollectionRepoImplement{conn: mockDB}
+	collection, err := repo.GetRowByID(2, Viewer{UserID: 7}, context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, "Dawn walk", collection.Title)
+	assert.Equal(t, []int{3, 1}, collection.RecordingIDs)
+}
+
+func TestGetCollectionByIDNotFound(t *testing.T) {
+	mockDB := &MockDatabase{
+		mockQueryRow: func(ctx context.Context, query string, args ...any) pgx.Row {
+			return &MockRow{mockScan: func(dest ...any) error {
+				return pgx.ErrNoRows
+			}}
+		},
+	}
+	repo := &CollectionRepoImplement{conn: mockDB}
+	_, err := repo.GetRowByID(2, Viewer{}, context.Background())
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestListCollections(t *testing.T) {
+	check := `SELECT c.id, c.title, c.description, c.cover_location, c.user_id, c.visibility, c.date_created, ` +
+		`ARRAY(SELECT cr.recording_id FROM collection_recordings cr JOIN recordings r ON r.id = cr.recording_id ` +
+		`WHERE cr.collection_id = c.id ORDER BY cr.position) AS recording_ids ` +
+		`FROM collections c ORDER BY c.id LIMIT @limit`
+	mockDB := &MockDatabase{
+		mockQuery: func(ctx context.Context, query string, args ...any) (pgx.Rows, error) {
+			if check != query {
+				return nil, errors.New("query did not match check")
+			}
+			return &MockRows{
+				mockNext: func() bool { return false },
+				mockErr:  func() error { return nil },
+			}, nil
+		},
+	}
+	repo := &CollectionRepoImplement{conn: mockDB}
+	res, err := repo.List(context.Background(), Viewer{UserID: 9, SeesAll: true}, 10)
+	assert.NoError(t, err)
+	assert.Empty(t, res)
+}
+
+func TestSetCollectionRecordings(t *testing.T) {
+	checks := []string{
+		`DELETE FROM collection_recordings WHERE collection_id = @id`,
+		`INSERT INTO collection_recordings (collection_id, recording_id, position) ` +
+			`SELECT @id, m.recording_id, m.position FROM unnest(@recording_ids::int[]) WITH ORDINALITY AS m(recording_id, position)`,
+	}
+	mockDB := &MockDatabase{
+		mockExec: func(ctx context.Context, query string, args ...any) (pgconn.CommandTag, error) {
+			if len(checks) == 0 || checks[0] != query {
+				return pgconn.CommandTag{}, errors.New("query did not match check")
+			}
+			checks = checks[1:]
+			assert.Equal(t, pgx.NamedArgs{"id": 2, "recording_ids": []int{3, 1}}, args[0].(pgx.NamedArgs))
+			return pgconn.NewCommandTag("INSERT 0 2"), nil
+		},
+	}
+	repo := &CollectionRepoImplement{conn: mockDB}
+	assert.NoError(t, repo.SetRecordings(2, []int{3, 1}, context.Background()))
+	assert.Empty(t, checks, "both statements should run")
+	assert.Equal(t, 1, mockDB.transactions)
+}
+
+func TestDeleteCollection(t *testing.T) {
+	mockDB := &MockDatabase{
+		mockExec: func(ctx context.Context, query string, args ...any) (pgconn.CommandTag, error) {
+			if query != `DELETE FROM collections WHERE id = @id` {
+				return pgconn.CommandTag{}, errors.New("query did not match check")
+			}
+			return pgconn.NewCommandTag("DELETE 0"), nil
+		},
+	}
+	repo := &CollectionRepoImplement{conn: mockDB}
+	assert.ErrorIs(t, repo.Delete(2, context.Background()), ErrNotFound)
+}
@@ -0,0 +1,16 @@
+package repositories
+
+import "errors"
+
+// ErrNotFound is returned (wrapped) when a query targets a row that doesn't exist.
+var ErrNotFound = errors.New("not found")
+
+// ErrConflict is returned (wrapped) when a write would break a unique
+// constraint, or a delete would leave rows referencing one that's gone.
+var ErrConflict = errors.New("already exists")
+
+// Postgres error codes for the constraint violations mapped to ErrConflict.
+const (
+	uniqueViolation     = "23505"
+	foreignKeyViolation = "23503"
+)
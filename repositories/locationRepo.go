@@ -2,40 +2,67 @@ package repositories
 
 import (
 	"context"
+	"errors"
 	"field_archive/server/entities"
 	"field_archive/server/internal/database"
 	"fmt"
+	"math"
 
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 )
 
-// TODO : Build location repository with CRUD functions
 type LocationRepository interface {
 	Insert(recording entities.Location, ctx context.Context) (int, error)
-	GetRowByID(id int, ctx context.Context) (entities.Location, error)
+	GetRowByID(id int, viewer Viewer, ctx context.Context) (entities.Location, error)
 	Update(recording entities.Location, ctx context.Context) error
 	Delete(id int, ctx context.Context) error
-	List(ctx context.Context, limit int) ([]entities.Location, error)
+	List(ctx context.Context, viewer Viewer, limit int) ([]entities.Location, error)
+	ListWithRecordings(ctx context.Context, viewer Viewer) ([]entities.LocationWithRecordings, error)
+	WithinBounds(ctx context.Context, viewer Viewer, minLon, minLat, maxLon, maxLat float64, limit int) ([]entities.NearbyLocation, error)
+	WithinRadius(ctx context.Context, viewer Viewer, lat, lon, radiusMetres float64, limit int) ([]entities.NearbyLocation, error)
+	Nearest(ctx context.Context, viewer Viewer, lat, lon float64, k int) ([]entities.NearbyLocation, error)
 }
 
+// locationColumns are the columns scanned by scanLocation, from a locations
+// table aliased l.
+const locationColumns = `l.id, l.name, l.description, ST_AsGeoJSON(l.geom) AS geom, ` +
+	`ST_X(l.geom) AS longitude, ST_Y(l.geom) AS latitude, COALESCE(l.user_id, 0) AS user_id, l.sensitivity`
+
+// publicRecordingIDs selects the IDs of the public recordings made at l.
+const publicRecordingIDs = `ARRAY(SELECT r.id FROM recordings r WHERE r.location_id = l.id AND ` + publicRecording + ` ORDER BY r.id) AS recording_ids`
+
+// nearbyColumns selects a location, its public recordings and its geodesic
+// distance from the point given by @longitude and @latitude.
+const nearbyColumns = `SELECT ` + locationColumns + `, ` + publicRecordingIDs + `, ` +
+	`ST_Distance(l.geom::geography, ` + searchPoint + `) AS distance_m `
+
+// searchPoint is the point a radius or nearest search is made from.
+const searchPoint = `ST_SetSRID(ST_MakePoint(@longitude, @latitude), 4326)::geography`
+
 type LocationRepoImplement struct {
-	conn database.Database
+	conn  database.Database
+	grids Grids
 }
 
-func NewLocationRepo(db *database.Postgres) *LocationRepoImplement {
-	return &LocationRepoImplement{conn: db}
+// NewLocationRepo returns a repository that shows sensitive locations snapped
+// to grids to viewers who can't see them precisely.
+func NewLocationRepo(db *database.Postgres, grids Grids) *LocationRepoImplement {
+	return &LocationRepoImplement{conn: db, grids: grids}
 }
 
 func (r *LocationRepoImplement) Insert(location entities.Location, ctx context.Context) (int, error) {
 	query := `INSERT INTO locations ` +
-		`(name, description, geom) ` +
-		`VALUES (@name, @description, ST_SetSRID(ST_MakePoint(@longitude, @latitude), 4326)) ` +
+		`(name, description, geom, user_id, sensitivity) ` +
+		`VALUES (@name, @description, ST_SetSRID(ST_MakePoint(@longitude, @latitude), 4326), NULLIF(@user_id, 0), @sensitivity) ` +
 		`RETURNING id`
-	args := map[string]interface{}{
+	args := pgx.NamedArgs{
 		"name":        location.Name,
 		"description": location.Description,
 		"longitude":   location.Longitude,
 		"latitude":    location.Latitude,
+		"user_id":     location.UserID,
+		"sensitivity": location.Sensitivity,
 	}
 	var id int
 	err := r.conn.QueryRow(ctx, query, args).Scan(&id)
@@ -45,36 +72,42 @@ func (r *LocationRepoImplement) Insert(location entities.Location, ctx context.C
 	return id, nil
 }
 
-func (r *LocationRepoImplement) GetRowByID(id int, ctx context.Context) (entities.Location, error) {
-	query := `SELECT id, name, description, ST_AsGeoJSON(geom) AS geom FROM locations WHERE id = @id`
+// GetRowByID returns the location, snapped to its grid if it's sensitive and
+// viewer may not see it precisely.
+func (r *LocationRepoImplement) GetRowByID(id int, viewer Viewer, ctx context.Context) (entities.Location, error) {
 	args := pgx.NamedArgs{
 		"id": id,
 	}
+	query := `SELECT ` + locationColumns + ` FROM ` + viewer.locations(args, r.grids, "") + ` WHERE l.id = @id`
 	var location entities.Location
-	err := r.conn.QueryRow(ctx, query, args).Scan(
-		&location.ID,
-		&location.Name,
-		&location.Description,
-		&location.Geom)
+	err := scanLocation(r.conn.QueryRow(ctx, query, args), &location)
 	if err != nil {
+		if err == pgx.ErrNoRows {
+			return entities.Location{}, fmt.Errorf("location with id %d %w", id, ErrNotFound)
+		}
 		return entities.Location{}, fmt.Errorf("unable to get row: %w", err)
 	}
 	return location, nil
 }
 
 func (r *LocationRepoImplement) Update(location entities.Location, ctx context.Context) error {
-	query := `UPDATE locations SET name = @name, description = @description, geom = ST_SetSRID(ST_MakePoint(@longitude, @latitude), 4326) WHERE id = @id`
+	query := `UPDATE locations SET name = @name, description = @description, ` +
+		`geom = ST_SetSRID(ST_MakePoint(@longitude, @latitude), 4326), sensitivity = @sensitivity WHERE id = @id`
 	args := pgx.NamedArgs{
 		"id":          location.ID,
 		"name":        location.Name,
 		"description": location.Description,
 		"longitude":   location.Longitude,
 		"latitude":    location.Latitude,
+		"sensitivity": location.Sensitivity,
 	}
-	_, err := r.conn.Exec(ctx, query, args)
+	tag, err := r.conn.Exec(ctx, query, args)
 	if err != nil {
 		return fmt.Errorf("unable to update row: %w", err)
 	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("location with id %d %w", location.ID, ErrNotFound)
+	}
 	return nil
 }
 
@@ -83,17 +116,25 @@ func (r *LocationRepoImplement) Delete(id int, ctx context.Context) error {
 	args := pgx.NamedArgs{
 		"id": id,
 	}
-	_, err := r.conn.Exec(ctx, query, args)
+	tag, err := r.conn.Exec(ctx, query, args)
 	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == foreignKeyViolation {
+			return fmt.Errorf("location with id %d is still used by recordings, %w", id, ErrConflict)
+		}
 		return fmt.Errorf("unable to delete row: %w", err)
 	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("location with id %d %w", id, ErrNotFound)
+	}
 	return nil
 }
 
-func (r *LocationRepoImplement) List(ctx context.Context, limit int) ([]entities.Location, error) {
+func (r *LocationRepoImplement) List(ctx context.Context, viewer Viewer, limit int) ([]entities.Location, error) {
 	res := []entities.Location{}
-	query := `SELECT id, name, description, ST_AsGeoJSON(geom) AS geom FROM locations LIMIT $1::int`
-	rows, err := r.conn.Query(ctx, query, limit)
+	args := pgx.NamedArgs{"limit": limit}
+	query := `SELECT ` + locationColumns + ` FROM ` + viewer.locations(args, r.grids, "") + ` ORDER BY l.id LIMIT @limit`
+	rows, err := r.conn.Query(ctx, query, args)
 	if err != nil {
 		return nil, err
 	}
@@ -101,15 +142,146 @@ func (r *LocationRepoImplement) List(ctx context.Context, limit int) ([]entities
 
 	for rows.Next() {
 		location := entities.Location{}
+		if err := scanLocation(rows, &location); err != nil {
+			return nil, fmt.Errorf("unable to scan row: %w", err)
+		}
+		res = append(res, location)
+	}
+	return res, rows.Err()
+}
+
+// ListWithRecordings returns every location with the IDs of the public
+// recordings attached to it through recordings.location_id.
+func (r *LocationRepoImplement) ListWithRecordings(ctx context.Context, viewer Viewer) ([]entities.LocationWithRecordings, error) {
+	res := []entities.LocationWithRecordings{}
+	args := pgx.NamedArgs{}
+	query := `SELECT ` + locationColumns + `, ` + publicRecordingIDs + ` ` +
+		`FROM ` + viewer.locations(args, r.grids, "") + ` ORDER BY l.id`
+	rows, err := r.conn.Query(ctx, query, args)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		location := entities.LocationWithRecordings{}
+		err := rows.Scan(
+			&location.ID,
+			&location.Name,
+			&location.Description,
+			&location.Geom,
+			&location.Longitude,
+			&location.Latitude,
+			&location.UserID,
+			&location.Sensitivity,
+			&location.RecordingIDs)
+		if err != nil {
+			return nil, fmt.Errorf("unable to scan row: %w", err)
+		}
+		res = append(res, location)
+	}
+	return res, rows.Err()
+}
+
+// WithinBounds returns locations inside the box given in SRID 4326 degrees.
+// Distances aren't computed as there's no single point to measure from.
+func (r *LocationRepoImplement) WithinBounds(ctx context.Context, viewer Viewer, minLon, minLat, maxLon, maxLat float64, limit int) ([]entities.NearbyLocation, error) {
+	args := pgx.NamedArgs{
+		"longitude": nil,
+		"latitude":  nil,
+		"min_lon":   minLon,
+		"min_lat":   minLat,
+		"max_lon":   maxLon,
+		"max_lat":   maxLat,
+		"limit":     limit,
+	}
+	args["reach_lon"], args["reach_lat"] = r.grids.reachDegrees(math.Max(math.Abs(minLat), math.Abs(maxLat)))
+	near := `l.geom && ST_Expand(ST_MakeEnvelope(@min_lon, @min_lat, @max_lon, @max_lat, 4326), @reach_lon, @reach_lat)`
+	query := nearbyColumns +
+		`FROM ` + viewer.locations(args, r.grids, near) + ` ` +
+		`WHERE l.geom && ST_MakeEnvelope(@min_lon, @min_lat, @max_lon, @max_lat, 4326) ` +
+		`ORDER BY l.id LIMIT @limit`
+	return r.queryNearby(ctx, query, args)
+}
+
+// WithinRadius returns locations within radiusMetres of the point, nearest
+// first, measuring along the spheroid rather than in degrees.
+func (r *LocationRepoImplement) WithinRadius(ctx context.Context, viewer Viewer, lat, lon, radiusMetres float64, limit int) ([]entities.NearbyLocation, error) {
+	args := pgx.NamedArgs{
+		"longitude": lon,
+		"latitude":  lat,
+		"radius":    radiusMetres,
+		"limit":     limit,
+		"reach":     r.grids.reach(),
+	}
+	near := `ST_DWithin(l.geom::geography, ` + searchPoint + `, @radius + @reach)`
+	query := nearbyColumns +
+		`FROM ` + viewer.locations(args, r.grids, near) + ` ` +
+		`WHERE ST_DWithin(l.geom::geography, ` + searchPoint + `, @radius) ` +
+		`ORDER BY distance_m LIMIT @limit`
+	return r.queryNearby(ctx, query, args)
+}
+
+// Nearest returns the k locations closest to the point, nearest first.
+func (r *LocationRepoImplement) Nearest(ctx context.Context, viewer Viewer, lat, lon float64, k int) ([]entities.NearbyLocation, error) {
+	args := pgx.NamedArgs{
+		"longitude": lon,
+		"latitude":  lat,
+		"limit":     k,
+		"reach":     r.grids.reach(),
+	}
+	// At least k snapped points lie within the kth nearest stored point's
+	// distance plus one reach, so the k nearest snapped points were stored
+	// within that plus another reach. With fewer than k locations, all of
+	// them are candidates: no two points on Earth are 21,000 km apart.
+	// Both sides measure on the sphere, as <-> does.
+	near := `ST_DWithin(l.geom::geography, ` + searchPoint + `, ` +
+		`COALESCE((SELECT n.geom::geography <-> ` + searchPoint + ` FROM locations n ` +
+		`ORDER BY n.geom::geography <-> ` + searchPoint + ` OFFSET @limit - 1 LIMIT 1) + 2 * @reach, 21000000), false)`
+	query := nearbyColumns +
+		`FROM ` + viewer.locations(args, r.grids, near) + ` ` +
+		`ORDER BY l.geom::geography <-> ` + searchPoint + ` LIMIT @limit`
+	return r.queryNearby(ctx, query, args)
+}
+
+func (r *LocationRepoImplement) queryNearby(ctx context.Context, query string, args pgx.NamedArgs) ([]entities.NearbyLocation, error) {
+	res := []entities.NearbyLocation{}
+	rows, err := r.conn.Query(ctx, query, args)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		location := entities.NearbyLocation{}
 		err := rows.Scan(
 			&location.ID,
 			&location.Name,
 			&location.Description,
-			&location.Geom)
+			&location.Geom,
+			&location.Longitude,
+			&location.Latitude,
+			&location.UserID,
+			&location.Sensitivity,
+			&location.RecordingIDs,
+			&location.DistanceMetres)
 		if err != nil {
 			return nil, fmt.Errorf("unable to scan row: %w", err)
 		}
 		res = append(res, location)
 	}
-	return res, nil
+	return res, rows.Err()
+}
+
+// scanLocation scans a row selected with locationColumns.
+func scanLocation(row pgx.Row, location *entities.Location) error {
+	return row.Scan(
+		&location.ID,
+		&location.Name,
+		&location.Description,
+		&location.Geom,
+		&location.Longitude,
+		&location.Latitude,
+		&location.UserID,
+		&location.Sensitivity)
 }
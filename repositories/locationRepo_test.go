@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"field_archive/server/entities"
+	"math"
 	"slices"
 	"testing"
 
@@ -14,8 +15,8 @@ import (
 
 func TestInsertLocation(t *testing.T) {
 	check := `INSERT INTO locations ` +
-		`(name, description, geom) ` +
-		`VALUES (@name, @description, ST_SetSRID(ST_MakePoint(@longitude, @latitude), 4326)) ` +
+		`(name, description, geom, user_id, sensitivity) ` +
+		`VALUES (@name, @description, ST_SetSRID(ST_MakePoint(@longitude, @latitude), 4326), NULLIF(@user_id, 0), @sensitivity) ` +
 		`RETURNING id`
 
 	mockDB := &MockDatabase{
@@ -37,8 +38,8 @@ func TestInsertLocation(t *testing.T) {
 		},
 	}
 	repo := &LocationRepoImplement{conn: mockDB}
-	longitude := "1.00"
-	latitude := "2.00"
+	longitude := 1.00
+	latitude := 2.00
 	location := entities.Location{
 		Name:        "Test Location",
 		Description: "Test Description",
@@ -53,7 +54,9 @@ func TestInsertLocation(t *testing.T) {
 }
 
 func TestGetLocationByID(t *testing.T) {
-	check := `SELECT id, name, description, ST_AsGeoJSON(geom) AS geom FROM locations WHERE id = @id`
+	check := `SELECT l.id, l.name, l.description, ST_AsGeoJSON(l.geom) AS geom, ` +
+		`ST_X(l.geom) AS longitude, ST_Y(l.geom) AS latitude, COALESCE(l.user_id, 0) AS user_id, l.sensitivity ` +
+		`FROM locations l WHERE l.id = @id`
 	mockDB := &MockDatabase{
 		mockQueryRow: func(ctx context.Context, query string, args ...any) pgx.Row {
 			if check == query {
@@ -66,6 +69,11 @@ func TestGetLocationByID(t *testing.T) {
 					*(innerSlice[1].(*string)) = "Test Location"
 					*(innerSlice[2].(*string)) = "Test Description"
 					*(innerSlice[3].(*string)) = "Test Geom"
+					longitude, latitude := 1.5, 2.5
+					*(innerSlice[4].(**float64)) = &longitude
+					*(innerSlice[5].(**float64)) = &latitude
+					*(innerSlice[6].(*int)) = 4
+					*(innerSlice[7].(*string)) = entities.SensitivityHigh
 					return nil
 				}}
 			}
@@ -76,26 +84,46 @@ func TestGetLocationByID(t *testing.T) {
 		},
 	}
 	repo := &LocationRepoImplement{conn: mockDB}
-	location, err := repo.GetRowByID(1, context.Background())
+	location, err := repo.GetRowByID(1, Viewer{UserID: 2, SeesAll: true}, context.Background())
 	assert.NoError(t, err)
+	assert.Equal(t, 4, location.UserID)
+	assert.Equal(t, entities.SensitivityHigh, location.Sensitivity)
 	if location.ID != 1 {
 		t.Fatalf("GET ERROR: returning ids not equal")
 	}
+	if assert.NotNil(t, location.Longitude) && assert.NotNil(t, location.Latitude) {
+		assert.Equal(t, 1.5, *location.Longitude)
+		assert.Equal(t, 2.5, *location.Latitude)
+	}
+}
+
+func TestGetLocationByIDNotFound(t *testing.T) {
+	mockDB := &MockDatabase{
+		mockQueryRow: func(ctx context.Context, query string, args ...any) pgx.Row {
+			return &MockRow{mockScan: func(dest ...any) error {
+				return pgx.ErrNoRows
+			}}
+		},
+	}
+	repo := &LocationRepoImplement{conn: mockDB}
+	_, err := repo.GetRowByID(1, Viewer{}, context.Background())
+	assert.ErrorIs(t, err, ErrNotFound)
 }
 
 func TestUpdateLocation(t *testing.T) {
-	check := `UPDATE locations SET name = @name, description = @description, geom = ST_SetSRID(ST_MakePoint(@longitude, @latitude), 4326) WHERE id = @id`
+	check := `UPDATE locations SET name = @name, description = @description, ` +
+		`geom = ST_SetSRID(ST_MakePoint(@longitude, @latitude), 4326), sensitivity = @sensitivity WHERE id = @id`
 	mockDB := &MockDatabase{
 		mockExec: func(ctx context.Context, query string, args ...any) (pgconn.CommandTag, error) {
 			if check == query {
-				return pgconn.CommandTag{}, nil
+				return pgconn.NewCommandTag("UPDATE 1"), nil
 			}
 			return pgconn.CommandTag{}, errors.New("Row not found")
 		},
 	}
 	repo := &LocationRepoImplement{conn: mockDB}
-	longitude := "1.00"
-	latitude := "2.00"
+	longitude := 1.00
+	latitude := 2.00
 	location := entities.Location{
 		ID:          1,
 		Name:        "Test Location",
@@ -111,7 +139,7 @@ func TestDeleteLocation(t *testing.T) {
 	check := `DELETE FROM locations WHERE id = @id`
 	mockDB := MockDatabase{mockExec: func(ctx context.Context, query string, args ...any) (pgconn.CommandTag, error) {
 		if check == query {
-			return pgconn.CommandTag{}, nil
+			return pgconn.NewCommandTag("DELETE 1"), nil
 		} else {
 			return pgconn.CommandTag{}, errors.New("DELETE ERROR: Query did not match check")
 		}
@@ -121,8 +149,26 @@ func TestDeleteLocation(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+func TestDeleteLocationInUse(t *testing.T) {
+	mockDB := MockDatabase{mockExec: func(ctx context.Context, query string, args ...any) (pgconn.CommandTag, error) {
+		return pgconn.CommandTag{}, &pgconn.PgError{Code: "23503", ConstraintName: "recordings_location_id_fkey"}
+	}}
+	repo := &LocationRepoImplement{conn: &mockDB}
+	err := repo.Delete(1, context.Background())
+	assert.ErrorIs(t, err, ErrConflict)
+}
+
+// obscuredLocations is the FROM item an anonymous viewer reads locations
+// through, snapping sensitive ones to their grid.
+const obscuredLocations = `(SELECT l.id, l.name, l.description, l.user_id, l.sensitivity, ` +
+	`CASE WHEN l.sensitivity = 'none' THEN l.geom ` +
+	`ELSE snap_point(l.geom, CASE l.sensitivity WHEN 'low' THEN @grid_low ELSE @grid_high END) ` +
+	`END AS geom FROM locations l) l`
+
 func TestListLocations(t *testing.T) {
-	check := `SELECT id, name, description, ST_AsGeoJSON(geom) AS geom FROM locations LIMIT $1::int`
+	check := `SELECT l.id, l.name, l.description, ST_AsGeoJSON(l.geom) AS geom, ` +
+		`ST_X(l.geom) AS longitude, ST_Y(l.geom) AS latitude, COALESCE(l.user_id, 0) AS user_id, l.sensitivity ` +
+		`FROM ` + obscuredLocations + ` ORDER BY l.id LIMIT @limit`
 
 	expectedLocations := []entities.Location{
 		{Name: "Test Location", Description: "Test Description", Geom: "Test Geom"},
@@ -131,6 +177,10 @@ func TestListLocations(t *testing.T) {
 	mockDB := MockDatabase{
 		mockQuery: func(ctx context.Context, query string, args ...any) (pgx.Rows, error) {
 			if check == query {
+				named := args[0].(pgx.NamedArgs)
+				assert.Equal(t, 1000.0, named["grid_low"])
+				assert.Equal(t, 10000.0, named["grid_high"])
+				assert.NotContains(t, named, "viewer_id")
 				return &MockRows{
 					mockNext: func() bool {
 						return len(expectedLocations) > 0
@@ -147,13 +197,14 @@ func TestListLocations(t *testing.T) {
 						expectedLocations = expectedLocations[1:]
 						return nil
 					},
+					mockErr: func() error { return nil },
 				}, nil
 			}
 			return nil, errors.New("query did not match check")
 		},
 	}
-	repo := &LocationRepoImplement{conn: &mockDB}
-	res, err := repo.List(context.Background(), 1)
+	repo := &LocationRepoImplement{conn: &mockDB, grids: Grids{Low: 1000, High: 10000}}
+	res, err := repo.List(context.Background(), Viewer{}, 1)
 	if err != nil {
 		t.Errorf("Error listing locations: %v", err)
 	}
@@ -161,3 +212,142 @@ func TestListLocations(t *testing.T) {
 		t.Errorf("Error listing recordings!\nreceived: %v\nBut expected: %v", res, expectedLocations)
 	}
 }
+
+func TestListLocationsWithRecordings(t *testing.T) {
+	check := `SELECT l.id, l.name, l.description, ST_AsGeoJSON(l.geom) AS geom, ` +
+		`ST_X(l.geom) AS longitude, ST_Y(l.geom) AS latitude, COALESCE(l.user_id, 0) AS user_id, l.sensitivity, ` +
+		`ARRAY(SELECT r.id FROM recordings r WHERE r.location_id = l.id ` +
+		`AND (r.visibility = 'public' AND (r.embargo_until IS NULL OR r.embargo_until <= now())) ORDER BY r.id) AS recording_ids ` +
+		`FROM ` + obscuredLocations + ` ORDER BY l.id`
+	served := false
+	mockDB := MockDatabase{
+		mockQuery: func(ctx context.Context, query string, args ...any) (pgx.Rows, error) {
+			if check != query {
+				return nil, errors.New("query did not match check")
+			}
+			return &MockRows{
+				mockNext: func() bool {
+					return !served
+				},
+				mockScan: func(dest ...any) error {
+					served = true
+					*(dest[0].(*int)) = 1
+					*(dest[1].(*string)) = "Marsh"
+					*(dest[2].(*string)) = "Reed beds"
+					*(dest[3].(*string)) = "Test Geom"
+					*(dest[8].(*[]int)) = []int{3, 4}
+					return nil
+				},
+				mockErr: func() error { return nil },
+			}, nil
+		},
+	}
+	repo := &LocationRepoImplement{conn: &mockDB}
+	res, err := repo.ListWithRecordings(context.Background(), Viewer{})
+	assert.NoError(t, err)
+	if assert.Len(t, res, 1) {
+		assert.Equal(t, "Marsh", res[0].Name)
+		assert.Equal(t, []int{3, 4}, res[0].RecordingIDs)
+	}
+}
+
+func TestNearestLocations(t *testing.T) {
+	check := `SELECT l.id, l.name, l.description, ST_AsGeoJSON(l.geom) AS geom, ` +
+		`ST_X(l.geom) AS longitude, ST_Y(l.geom) AS latitude, COALESCE(l.user_id, 0) AS user_id, l.sensitivity, ` +
+		`ARRAY(SELECT r.id FROM recordings r WHERE r.location_id = l.id ` +
+		`AND (r.visibility = 'public' AND (r.embargo_until IS NULL OR r.embargo_until <= now())) ORDER BY r.id) AS recording_ids, ` +
+		`ST_Distance(l.geom::geography, ST_SetSRID(ST_MakePoint(@longitude, @latitude), 4326)::geography) AS distance_m ` +
+		`FROM (SELECT l.id, l.name, l.description, l.user_id, l.sensitivity, ` +
+		`CASE WHEN l.sensitivity = 'none' OR l.user_id = @viewer_id THEN l.geom ` +
+		`ELSE snap_point(l.geom, CASE l.sensitivity WHEN 'low' THEN @grid_low ELSE @grid_high END) ` +
+		`END AS geom FROM locations l ` +
+		`WHERE ST_DWithin(l.geom::geography, ST_SetSRID(ST_MakePoint(@longitude, @latitude), 4326)::geography, ` +
+		`COALESCE((SELECT n.geom::geography <-> ST_SetSRID(ST_MakePoint(@longitude, @latitude), 4326)::geography FROM locations n ` +
+		`ORDER BY n.geom::geography <-> ST_SetSRID(ST_MakePoint(@longitude, @latitude), 4326)::geography OFFSET @limit - 1 LIMIT 1) ` +
+		`+ 2 * @reach, 21000000), false)) l ` +
+		`ORDER BY l.geom::geography <-> ST_SetSRID(ST_MakePoint(@longitude, @latitude), 4326)::geography LIMIT @limit`
+	served := false
+	mockDB := MockDatabase{
+		mockQuery: func(ctx context.Context, query string, args ...any) (pgx.Rows, error) {
+			if check != query {
+				return nil, errors.New("query did not match check")
+			}
+			named := args[0].(pgx.NamedArgs)
+			assert.Equal(t, -0.12, named["longitude"])
+			assert.Equal(t, 51.5, named["latitude"])
+			assert.Equal(t, 3, named["limit"])
+			assert.Equal(t, 7, named["viewer_id"])
+			assert.Equal(t, 5000.0, named["reach"])
+			return &MockRows{
+				mockNext: func() bool {
+					return !served
+				},
+				mockScan: func(dest ...any) error {
+					served = true
+					distance := 42.0
+					*(dest[0].(*int)) = 1
+					*(dest[1].(*string)) = "Marsh"
+					*(dest[8].(*[]int)) = []int{3}
+					*(dest[9].(**float64)) = &distance
+					return nil
+				},
+				mockErr: func() error { return nil },
+			}, nil
+		},
+	}
+	repo := &LocationRepoImplement{conn: &mockDB, grids: Grids{Low: 1000, High: 5000}}
+	res, err := repo.Nearest(context.Background(), Viewer{UserID: 7}, 51.5, -0.12, 3)
+	assert.NoError(t, err)
+	if assert.Len(t, res, 1) && assert.NotNil(t, res[0].DistanceMetres) {
+		assert.Equal(t, 42.0, *res[0].DistanceMetres)
+		assert.Equal(t, []int{3}, res[0].RecordingIDs)
+	}
+}
+
+func TestObscuredSearchesPrefilter(t *testing.T) {
+	var query string
+	var named pgx.NamedArgs
+	mockDB := MockDatabase{
+		mockQuery: func(ctx context.Context, q string, args ...any) (pgx.Rows, error) {
+			query = q
+			named = args[0].(pgx.NamedArgs)
+			return &MockRows{
+				mockNext: func() bool { return false },
+				mockErr:  func() error { return nil },
+			}, nil
+		},
+	}
+	repo := &LocationRepoImplement{conn: &mockDB, grids: Grids{Low: 1000, High: 11132}}
+	snapped := `END AS geom FROM locations l WHERE `
+
+	_, err := repo.WithinBounds(context.Background(), Viewer{}, -1, 50, 1, 60, 10)
+	assert.NoError(t, err)
+	assert.Contains(t, query, snapped+`l.geom && ST_Expand(ST_MakeEnvelope(@min_lon, @min_lat, @max_lon, @max_lat, 4326), @reach_lon, @reach_lat)) l `)
+	assert.Contains(t, query, `) l WHERE l.geom && ST_MakeEnvelope(@min_lon, @min_lat, @max_lon, @max_lat, 4326) `)
+	assert.InDelta(t, 0.1, named["reach_lat"], 1e-9)
+	assert.InDelta(t, 0.1/math.Cos(60.1*math.Pi/180), named["reach_lon"], 1e-9)
+
+	_, err = repo.WithinRadius(context.Background(), Viewer{}, 51.5, -0.12, 2000, 10)
+	assert.NoError(t, err)
+	assert.Contains(t, query, snapped+`ST_DWithin(l.geom::geography, ST_SetSRID(ST_MakePoint(@longitude, @latitude), 4326)::geography, @radius + @reach)) l `)
+	assert.Contains(t, query, `) l WHERE ST_DWithin(l.geom::geography, ST_SetSRID(ST_MakePoint(@longitude, @latitude), 4326)::geography, @radius) `)
+	assert.Equal(t, 11132.0, named["reach"])
+
+	_, err = repo.Nearest(context.Background(), Viewer{}, 51.5, -0.12, 3)
+	assert.NoError(t, err)
+	assert.Contains(t, query, snapped+`ST_DWithin(l.geom::geography, `)
+	assert.Contains(t, query, `) l ORDER BY l.geom::geography <-> ST_SetSRID(ST_MakePoint(@longitude, @latitude), 4326)::geography LIMIT @limit`)
+
+	_, err = repo.WithinRadius(context.Background(), Viewer{SeesAll: true}, 51.5, -0.12, 2000, 10)
+	assert.NoError(t, err)
+	assert.Contains(t, query, `FROM locations l WHERE ST_DWithin(l.geom::geography, ST_SetSRID(ST_MakePoint(@longitude, @latitude), 4326)::geography, @radius) `)
+	assert.NotContains(t, query, `@reach`)
+}
+
+func TestGridsValidate(t *testing.T) {
+	assert.NoError(t, Grids{Low: 1000, High: 10000}.Validate())
+	assert.EqualError(t, Grids{Low: 0, High: 10000}.Validate(), "low sensitivity grid must be a positive number of metres, got 0")
+	assert.Error(t, Grids{Low: 1000, High: -5}.Validate())
+	assert.Error(t, Grids{Low: math.NaN(), High: 10000}.Validate())
+	assert.Error(t, Grids{Low: 1000, High: math.Inf(1)}.Validate())
+}
@@ -0,0 +1,198 @@
+package repositories
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"field_archive/server/entities"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// recordingColumns lists the recordings columns in the order they're scanned
+// into entities.Recording.
+const recordingColumns = `id, title, audio_location, artwork_location, date_uploaded, recording_date, location_id, user_id, ` +
+	`duration, format, description, equipment, file_size, channels, license, visibility, embargo_until`
+
+// RecordingSorts maps the sort names accepted from clients onto the SQL they
+// order by. date_uploaded is nullable, so NULLs are treated as the earliest
+// upload to keep keyset comparisons total.
+var RecordingSorts = map[string]string{
+	"recording_date": "recording_date",
+	"date_uploaded":  "COALESCE(date_uploaded, '-infinity'::timestamptz)",
+	"title":          "title",
+	"duration":       "duration",
+}
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// RecordingFilter narrows a recording query. Nil fields don't filter, but
+// results are always limited to the recordings Viewer can list.
+type RecordingFilter struct {
+	Viewer         Viewer
+	LocationID     *int
+	UserID         *int
+	Format         *string
+	License        *string
+	Channels       *string
+	MinDuration    *int
+	MaxDuration    *int
+	RecordedAfter  *time.Time
+	RecordedBefore *time.Time
+	// Tags matches recordings with any of the tags, or with every one of
+	// them when AllTags is set.
+	Tags    []string
+	AllTags bool
+}
+
+// conditions returns the SQL conditions for the filter, adding their
+// arguments to args.
+func (f RecordingFilter) conditions(args pgx.NamedArgs) []string {
+	conds := []string{}
+	add := func(cond, name string, value any) {
+		conds = append(conds, cond)
+		args[name] = value
+	}
+	if f.LocationID != nil {
+		add("location_id = @location_id", "location_id", *f.LocationID)
+	}
+	if f.UserID != nil {
+		add("user_id = @user_id", "user_id", *f.UserID)
+	}
+	if f.Format != nil {
+		add("format = @format", "format", *f.Format)
+	}
+	if f.License != nil {
+		add("license = @license", "license", *f.License)
+	}
+	if f.Channels != nil {
+		add("channels = @channels", "channels", *f.Channels)
+	}
+	if f.MinDuration != nil {
+		add("duration >= @min_duration", "min_duration", *f.MinDuration)
+	}
+	if f.MaxDuration != nil {
+		add("duration <= @max_duration", "max_duration", *f.MaxDuration)
+	}
+	if f.RecordedAfter != nil {
+		add("recording_date >= @recorded_after", "recorded_after", *f.RecordedAfter)
+	}
+	if f.RecordedBefore != nil {
+		add("recording_date <= @recorded_before", "recorded_before", *f.RecordedBefore)
+	}
+	if len(f.Tags) > 0 {
+		tagged := `SELECT rt.recording_id FROM recording_tags rt JOIN tags t ON t.id = rt.tag_id WHERE t.name = ANY(@tags)`
+		if f.AllTags {
+			tagged += ` GROUP BY rt.recording_id HAVING COUNT(*) = @tag_count`
+			args["tag_count"] = len(f.Tags)
+		}
+		add("id IN ("+tagged+")", "tags", f.Tags)
+	}
+	return append(conds, f.Viewer.listable(args, "")...)
+}
+
+func whereClause(conds []string) string {
+	if len(conds) == 0 {
+		return ""
+	}
+	return ` WHERE ` + strings.Join(conds, ` AND `)
+}
+
+// RecordingQuery describes one page of a recording listing.
+type RecordingQuery struct {
+	Filter RecordingFilter
+	Sort   string
+	Desc   bool
+	Limit  int
+	After  *RecordingCursor
+}
+
+// RecordingCursor marks the last row of a page by its sort key and ID, so the
+// next page can carry on from it even if rows are added in between.
+type RecordingCursor struct {
+	Sort  string
+	Desc  bool
+	Value any
+	ID    int
+}
+
+type encodedCursor struct {
+	Sort  string          `json:"s"`
+	Desc  bool            `json:"d,omitempty"`
+	Value json.RawMessage `json:"v"`
+	ID    int             `json:"i"`
+}
+
+// CursorAfter returns the cursor pointing just past recording.
+func CursorAfter(recording entities.Recording, sort string, desc bool) RecordingCursor {
+	cursor := RecordingCursor{Sort: sort, Desc: desc, ID: recording.ID}
+	switch sort {
+	case "recording_date":
+		cursor.Value = recording.RecordingDate
+	case "date_uploaded":
+		if recording.DateUploaded != nil {
+			cursor.Value = *recording.DateUploaded
+		}
+	case "title":
+		cursor.Value = recording.Title
+	case "duration":
+		cursor.Value = recording.Duration
+	}
+	return cursor
+}
+
+// Encode returns the cursor as an opaque, URL safe string.
+func (c RecordingCursor) Encode() string {
+	value, _ := json.Marshal(c.Value)
+	b, _ := json.Marshal(encodedCursor{Sort: c.Sort, Desc: c.Desc, Value: value, ID: c.ID})
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// DecodeRecordingCursor parses a cursor from Encode, checking it was made for
+// the same ordering as the query it's being used with.
+func DecodeRecordingCursor(s, sort string, desc bool) (RecordingCursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return RecordingCursor{}, ErrInvalidCursor
+	}
+	var enc encodedCursor
+	if err := json.Unmarshal(b, &enc); err != nil {
+		return RecordingCursor{}, ErrInvalidCursor
+	}
+	if enc.Sort != sort || enc.Desc != desc {
+		return RecordingCursor{}, fmt.Errorf("%w: cursor was made for a different sort order", ErrInvalidCursor)
+	}
+	cursor := RecordingCursor{Sort: enc.Sort, Desc: enc.Desc, ID: enc.ID}
+	switch sort {
+	case "recording_date", "date_uploaded":
+		var t *time.Time
+		err = json.Unmarshal(enc.Value, &t)
+		if t != nil {
+			cursor.Value = *t
+		} else {
+			cursor.Value = pgtype.Timestamptz{InfinityModifier: pgtype.NegativeInfinity, Valid: true}
+		}
+	case "title":
+		var title string
+		err = json.Unmarshal(enc.Value, &title)
+		cursor.Value = title
+	case "duration":
+		var duration int
+		err = json.Unmarshal(enc.Value, &duration)
+		cursor.Value = duration
+	case "rank":
+		var rank float32
+		err = json.Unmarshal(enc.Value, &rank)
+		cursor.Value = rank
+	default:
+		return RecordingCursor{}, ErrInvalidCursor
+	}
+	if err != nil {
+		return RecordingCursor{}, ErrInvalidCursor
+	}
+	return cursor, nil
+}
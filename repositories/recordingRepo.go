@@ -11,44 +11,54 @@ import (
 
 type RecordingRepository interface {
 	Insert(recording entities.Recording, ctx context.Context) (int, error)
-	GetRowByID(id int, ctx context.Context) (entities.Recording, error)
+	GetRowByID(id int, viewer Viewer, ctx context.Context) (entities.Recording, error)
 	Update(recording entities.Recording, ctx context.Context) error
 	Delete(id int, ctx context.Context) error
-	List(ctx context.Context, limit int) ([]entities.Recording, error)
-	Count(ctx context.Context) (int, error)
+	Count(ctx context.Context, filter RecordingFilter) (int, error)
+	ListPage(ctx context.Context, q RecordingQuery) ([]entities.Recording, error)
+	Search(ctx context.Context, q RecordingSearch) ([]entities.RecordingSearchResult, error)
+	CountSearch(ctx context.Context, query string, viewer Viewer) (int, error)
+	ListPoints(ctx context.Context, viewer Viewer) ([]entities.RecordingPoint, error)
+	Summaries(ctx context.Context, viewer Viewer, ids []int) ([]entities.RecordingSummary, error)
 }
 
 type RecordingRepoImplement struct {
-	conn database.Database
+	conn  database.Database
+	grids Grids
 }
 
-func NewRecordingRepo(db *database.Postgres) *RecordingRepoImplement {
-	return &RecordingRepoImplement{conn: db}
+// NewRecordingRepo returns a repository that places recordings at sensitive
+// locations on their location's grid for viewers who can't see it precisely.
+func NewRecordingRepo(db *database.Postgres, grids Grids) *RecordingRepoImplement {
+	return &RecordingRepoImplement{conn: db, grids: grids}
 }
 
 func (r *RecordingRepoImplement) Insert(recording entities.Recording, ctx context.Context) (int, error) {
 
 	query := `INSERT INTO recordings` +
 		`(title, audio_location, artwork_location, date_uploaded, recording_date, location_id, user_id, ` +
-		`duration, format, description, equipment, file_size, channels, license) ` +
+		`duration, format, description, equipment, file_size, channels, license, visibility, embargo_until) ` +
 		`VALUES ` +
-		`(@title, @audio_location, @date_uploaded, @recording_date, @location_id, @user_id, @duration, ` +
-		`@format, @description, @equipment, @file_Size, @channels, @license) ` +
+		`(@title, @audio_location, @artwork_location, @date_uploaded, @recording_date, @location_id, @user_id, ` +
+		`@duration, @format, @description, @equipment, @file_size, @channels, @license, @visibility, @embargo_until) ` +
 		`RETURNING id`
 	args := pgx.NamedArgs{
-		"title":          recording.Title,
-		"audio_location": recording.AudioLocation,
-		"date_uploaded":  recording.DateUploaded,
-		"recording_date": recording.RecordingDate,
-		"location_id":    recording.LocationID,
-		"user_id":        recording.UserID,
-		"duration":       recording.Duration,
-		"format":         recording.Format,
-		"description":    recording.Description,
-		"equipment":      recording.Equipment,
-		"file_size":      recording.Size,
-		"channels":       recording.Channels,
-		"license":        recording.License,
+		"title":            recording.Title,
+		"audio_location":   recording.AudioLocation,
+		"artwork_location": recording.ArtworkLocation,
+		"date_uploaded":    recording.DateUploaded,
+		"recording_date":   recording.RecordingDate,
+		"location_id":      recording.LocationID,
+		"user_id":          recording.UserID,
+		"duration":         recording.Duration,
+		"format":           recording.Format,
+		"description":      recording.Description,
+		"equipment":        recording.Equipment,
+		"file_size":        recording.Size,
+		"channels":         recording.Channels,
+		"license":          recording.License,
+		"visibility":       recording.Visibility,
+		"embargo_until":    recording.EmbargoUntil,
 	}
 	var id int
 	err := r.conn.QueryRow(ctx, query, args).Scan(&id)
@@ -58,33 +68,20 @@ func (r *RecordingRepoImplement) Insert(recording entities.Recording, ctx contex
 	return id, nil
 }
 
-func (r *RecordingRepoImplement) GetRowByID(id int, ctx context.Context) (entities.Recording, error) {
-	query := `SELECT * FROM recordings WHERE id=@id`
+// GetRowByID returns the recording if viewer is allowed to see it. Those it
+// isn't are reported as not found, so their existence isn't given away.
+func (r *RecordingRepoImplement) GetRowByID(id int, viewer Viewer, ctx context.Context) (entities.Recording, error) {
 	args := pgx.NamedArgs{
 		"id": id,
 	}
+	conds := append([]string{`id = @id`}, viewer.readable(args, "")...)
+	query := `SELECT ` + recordingColumns + ` FROM recordings` + whereClause(conds)
 	var recording entities.Recording
-	err := r.conn.QueryRow(ctx, query, args).Scan(
-		&recording.ID,
-		&recording.Title,
-		&recording.AudioLocation,
-		&recording.ArtworkLocation,
-		&recording.DateUploaded,
-		&recording.RecordingDate,
-		&recording.LocationID,
-		&recording.UserID,
-		&recording.Duration,
-		&recording.Format,
-		&recording.Description,
-		&recording.Equipment,
-		&recording.Size,
-		&recording.Channels,
-		&recording.License,
-	)
+	err := scanRecording(r.conn.QueryRow(ctx, query, args), &recording)
 	if err != nil {
 		if err == pgx.ErrNoRows {
 			// No rows found for the given ID
-			return entities.Recording{}, fmt.Errorf("recording with id %d not found", id)
+			return entities.Recording{}, fmt.Errorf("recording with id %d %w", id, ErrNotFound)
 		}
 		return entities.Recording{}, fmt.Errorf("unable to fetch recording %w", err)
 	}
@@ -97,27 +94,33 @@ func (r *RecordingRepoImplement) Update(recording entities.Recording, ctx contex
 		`artwork_location = @artwork_location, date_uploaded = @date_uploaded, ` +
 		`recording_date = @recording_date, location_id = @location_id, user_id = @user_id, duration = @duration, ` +
 		`format = @format, description = @description, equipment = @equipment, file_size = @file_size, ` +
-		`channels = @channels, license = @license ` +
+		`channels = @channels, license = @license, visibility = @visibility, embargo_until = @embargo_until ` +
 		`WHERE id = @id`
 	args := pgx.NamedArgs{
-		"title":          recording.Title,
-		"audio_location": recording.AudioLocation,
-		"date_uploaded":  recording.DateUploaded,
-		"recording_date": recording.RecordingDate,
-		"location_id":    recording.LocationID,
-		"user_id":        recording.UserID,
-		"duration":       recording.Duration,
-		"format":         recording.Format,
-		"description":    recording.Description,
-		"equipment":      recording.Equipment,
-		"file_size":      recording.Size,
-		"channels":       recording.Channels,
-		"license":        recording.License,
-		"id":             recording.ID,
-	}
-	_, err := r.conn.Exec(ctx, query, args)
+		"title":            recording.Title,
+		"audio_location":   recording.AudioLocation,
+		"artwork_location": recording.ArtworkLocation,
+		"date_uploaded":    recording.DateUploaded,
+		"recording_date":   recording.RecordingDate,
+		"location_id":      recording.LocationID,
+		"user_id":          recording.UserID,
+		"duration":         recording.Duration,
+		"format":           recording.Format,
+		"description":      recording.Description,
+		"equipment":        recording.Equipment,
+		"file_size":        recording.Size,
+		"channels":         recording.Channels,
+		"license":          recording.License,
+		"visibility":       recording.Visibility,
+		"embargo_until":    recording.EmbargoUntil,
+		"id":               recording.ID,
+	}
+	tag, err := r.conn.Exec(ctx, query, args)
 	if err != nil {
-		return fmt.Errorf("unable to insert row: %w", err)
+		return fmt.Errorf("unable to update row: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("recording with id %d %w", recording.ID, ErrNotFound)
 	}
 	return nil
 }
@@ -127,57 +130,154 @@ func (r *RecordingRepoImplement) Delete(id int, ctx context.Context) error {
 	args := pgx.NamedArgs{
 		"id": id,
 	}
-	_, err := r.conn.Exec(ctx, query, args)
+	tag, err := r.conn.Exec(ctx, query, args)
 
 	if err != nil {
 		return fmt.Errorf("unable to Delete Row: %v", err)
 	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("recording with id %d %w", id, ErrNotFound)
+	}
 	return nil
 }
 
-func (r *RecordingRepoImplement) List(ctx context.Context, limit int) ([]entities.Recording, error) {
-	res := []entities.Recording{}
-	query := `SELECT * FROM recordings LIMIT $1::int`
-	rows, err := r.conn.Query(ctx, query, limit)
+// Count returns the number of recordings matching filter.
+func (r *RecordingRepoImplement) Count(ctx context.Context, filter RecordingFilter) (int, error) {
+	args := pgx.NamedArgs{}
+	query := `SELECT COUNT(id) FROM recordings` + whereClause(filter.conditions(args))
+	var count int
+	err := r.conn.QueryRow(ctx, query, args).Scan(&count)
+	if err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// ListPoints returns a summary of every recording viewer can list along with
+// the GeoJSON geometry of its location, snapped to a grid if the location is
+// sensitive and viewer may not see it precisely.
+func (r *RecordingRepoImplement) ListPoints(ctx context.Context, viewer Viewer) ([]entities.RecordingPoint, error) {
+	res := []entities.RecordingPoint{}
+	args := pgx.NamedArgs{}
+	query := `SELECT r.id, r.title, r.recording_date, r.duration, r.format, r.location_id, l.name, ST_AsGeoJSON(l.geom) AS geom ` +
+		`FROM recordings r JOIN ` + viewer.locations(args, r.grids, "") + ` ON l.id = r.location_id` + whereClause(viewer.listable(args, "r")) + ` ORDER BY r.id`
+	rows, err := r.conn.Query(ctx, query, args)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
 	for rows.Next() {
-		recording := entities.Recording{}
+		point := entities.RecordingPoint{}
 		err := rows.Scan(
-			&recording.ID,
-			&recording.Title,
-			&recording.AudioLocation,
-			&recording.ArtworkLocation,
-			&recording.DateUploaded,
-			&recording.RecordingDate,
-			&recording.LocationID,
-			&recording.UserID,
-			&recording.Duration,
-			&recording.Format,
-			&recording.Description,
-			&recording.Equipment,
-			&recording.Size,
-			&recording.Channels,
-			&recording.License,
+			&point.ID,
+			&point.Title,
+			&point.RecordingDate,
+			&point.Duration,
+			&point.Format,
+			&point.LocationID,
+			&point.LocationName,
+			&point.Geom,
 		)
 		if err != nil {
 			return nil, err
 		}
-		res = append(res, recording)
+		res = append(res, point)
 	}
+	return res, rows.Err()
+}
 
-	return res, nil
+// Summaries returns summaries of the recordings with the given IDs that
+// viewer can fetch, in the order of ids.
+func (r *RecordingRepoImplement) Summaries(ctx context.Context, viewer Viewer, ids []int) ([]entities.RecordingSummary, error) {
+	res := []entities.RecordingSummary{}
+	args := pgx.NamedArgs{"ids": ids}
+	conds := append([]string{`id = ANY(@ids::int[])`}, viewer.readable(args, "")...)
+	query := `SELECT id, title, recording_date, duration, format, location_id, user_id FROM recordings` +
+		whereClause(conds) + ` ORDER BY array_position(@ids::int[], id)`
+	rows, err := r.conn.Query(ctx, query, args)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		summary := entities.RecordingSummary{}
+		err := rows.Scan(
+			&summary.ID,
+			&summary.Title,
+			&summary.RecordingDate,
+			&summary.Duration,
+			&summary.Format,
+			&summary.LocationID,
+			&summary.UserID,
+		)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, summary)
+	}
+	return res, rows.Err()
 }
 
-func (r *RecordingRepoImplement) Count(ctx context.Context) (int, error) {
-	query := `SELECT COUNT(id) FROM recordings`
-	var count int
-	err := r.conn.QueryRow(ctx, query).Scan(&count)
+// ListPage returns up to q.Limit recordings matching q.Filter in the order
+// given by q.Sort, starting after q.After when it's set. Ties are broken by
+// ID so every row has a unique position for cursors.
+func (r *RecordingRepoImplement) ListPage(ctx context.Context, q RecordingQuery) ([]entities.Recording, error) {
+	sortExpr, ok := RecordingSorts[q.Sort]
+	if !ok {
+		return nil, fmt.Errorf("unknown sort %q", q.Sort)
+	}
+	direction, comparison := `ASC`, `>`
+	if q.Desc {
+		direction, comparison = `DESC`, `<`
+	}
+	args := pgx.NamedArgs{"limit": q.Limit}
+	conds := q.Filter.conditions(args)
+	if q.After != nil {
+		conds = append(conds, fmt.Sprintf(`(%s, id) %s (@cursor_value, @cursor_id)`, sortExpr, comparison))
+		args["cursor_value"] = q.After.Value
+		args["cursor_id"] = q.After.ID
+	}
+	query := `SELECT ` + recordingColumns + ` FROM recordings` + whereClause(conds) +
+		fmt.Sprintf(` ORDER BY %s %s, id %s LIMIT @limit`, sortExpr, direction, direction)
+
+	res := []entities.Recording{}
+	rows, err := r.conn.Query(ctx, query, args)
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
-	return count, nil
+	defer rows.Close()
+
+	for rows.Next() {
+		recording := entities.Recording{}
+		if err := scanRecording(rows, &recording); err != nil {
+			return nil, err
+		}
+		res = append(res, recording)
+	}
+	return res, rows.Err()
+}
+
+// scanRecording scans a row selected with recordingColumns.
+func scanRecording(row pgx.Row, recording *entities.Recording) error {
+	return row.Scan(
+		&recording.ID,
+		&recording.Title,
+		&recording.AudioLocation,
+		&recording.ArtworkLocation,
+		&recording.DateUploaded,
+		&recording.RecordingDate,
+		&recording.LocationID,
+		&recording.UserID,
+		&recording.Duration,
+		&recording.Format,
+		&recording.Description,
+		&recording.Equipment,
+		&recording.Size,
+		&recording.Channels,
+		&recording.License,
+		&recording.Visibility,
+		&recording.EmbargoUntil,
+	)
 }
@@ -4,13 +4,14 @@ import (
 	"context"
 	"errors"
 	"field_archive/server/entities"
+	"field_archive/server/internal/database"
 	"fmt"
-	"slices"
 	"testing"
 	"time"
 
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -83,6 +84,8 @@ type MockDatabase struct {
 	mockExec     func(ctx context.Context, query string, args ...any) (pgconn.CommandTag, error)
 	mockQueryRow func(ctx context.Context, query string, args ...any) pgx.Row
 	mockQuery    func(ctx context.Context, query string, args ...interface{}) (pgx.Rows, error)
+	// transactions counts the calls to InTx.
+	transactions int
 }
 
 func (m *MockDatabase) Exec(ctx context.Context, query string, args ...any) (pgconn.CommandTag, error) {
@@ -96,6 +99,11 @@ func (m *MockDatabase) Query(ctx context.Context, query string, args any) (pgx.R
 	return m.mockQuery(ctx, query, args)
 }
 
+func (m *MockDatabase) InTx(ctx context.Context, fn func(tx database.Database) error) error {
+	m.transactions++
+	return fn(m)
+}
+
 // --------------------------------------------
 
 // REPOSITORY METHOD TESTS START HERE
@@ -103,9 +111,10 @@ func (m *MockDatabase) Query(ctx context.Context, query string, args any) (pgx.R
 func TestInsert(t *testing.T) {
 	check := `INSERT INTO recordings` +
 		`(title, audio_location, artwork_location, date_uploaded, recording_date, location_id, user_id, ` +
-		`duration, format, description, equipment, file_size, channels, license) ` +
+		`duration, format, description, equipment, file_size, channels, license, visibility, embargo_until) ` +
 		`VALUES ` +
-		`(@title, @audio_location, @date_uploaded, @recording_date, @location_id, @user_id, @duration, @format, @description, @equipment, @file_Size, @channels, @license) ` +
+		`(@title, @audio_location, @artwork_location, @date_uploaded, @recording_date, @location_id, @user_id, ` +
+		`@duration, @format, @description, @equipment, @file_size, @channels, @license, @visibility, @embargo_until) ` +
 		`RETURNING id`
 
 	mockDB := &MockDatabase{
@@ -150,7 +159,10 @@ func TestInsert(t *testing.T) {
 }
 
 func TestGetRowByID(t *testing.T) {
-	check := `SELECT * FROM recordings WHERE id=@id`
+	check := `SELECT id, title, audio_location, artwork_location, date_uploaded, recording_date, location_id, user_id, ` +
+		`duration, format, description, equipment, file_size, channels, license, visibility, embargo_until FROM recordings ` +
+		`WHERE id = @id AND ((visibility IN ('public', 'unlisted') AND (embargo_until IS NULL OR embargo_until <= now())) ` +
+		`OR user_id = @viewer_id)`
 	expectedRecording := entities.Recording{
 		ID:              1,
 		Title:           "Test Title",
@@ -167,10 +179,11 @@ func TestGetRowByID(t *testing.T) {
 		Size:            2048,
 		Channels:        "2",
 		License:         "Creative Commons",
+		Visibility:      "private",
 	}
 	mockDB := &MockDatabase{
 		mockQueryRow: func(ctx context.Context, query string, args ...any) pgx.Row {
-			if check == query {
+			if check == query && args[0].(pgx.NamedArgs)["viewer_id"] == 1 {
 				return &MockRow{mockScan: func(dest ...any) error {
 					innerSlice, ok := dest[0].([]any)
 					if !ok {
@@ -191,6 +204,8 @@ func TestGetRowByID(t *testing.T) {
 					*(innerSlice[12].(*float64)) = 2048
 					*(innerSlice[13].(*string)) = "2"
 					*(innerSlice[14].(*string)) = "Creative Commons"
+					*(innerSlice[15].(*string)) = "private"
+					*(innerSlice[16].(**time.Time)) = nil
 					return nil
 				}}
 			}
@@ -200,7 +215,7 @@ func TestGetRowByID(t *testing.T) {
 		},
 	}
 	repo := &RecordingRepoImplement{conn: mockDB}
-	test, err := repo.GetRowByID(1, context.Background())
+	test, err := repo.GetRowByID(1, Viewer{UserID: 1}, context.Background())
 	if test != expectedRecording {
 		t.Errorf("GetRowByID failed: return = %v, but expected %v", test, expectedRecording)
 	}
@@ -216,12 +231,12 @@ func TestUpdate(t *testing.T) {
 		`artwork_location = @artwork_location, date_uploaded = @date_uploaded, ` +
 		`recording_date = @recording_date, location_id = @location_id, user_id = @user_id, duration = @duration, ` +
 		`format = @format, description = @description, equipment = @equipment, file_size = @file_size, ` +
-		`channels = @channels, license = @license ` +
+		`channels = @channels, license = @license, visibility = @visibility, embargo_until = @embargo_until ` +
 		`WHERE id = @id`
 	mockDB := MockDatabase{mockExec: func(ctx context.Context,
 		query string, args ...any) (pgconn.CommandTag, error) {
 		if check == query {
-			return pgconn.CommandTag{}, nil
+			return pgconn.NewCommandTag("UPDATE 1"), nil
 		} else {
 			return pgconn.CommandTag{}, errors.New("Query mismatch")
 		}
@@ -255,7 +270,7 @@ func TestDelete(t *testing.T) {
 	check := `DELETE FROM recordings WHERE id = @id`
 	mockDB := MockDatabase{mockExec: func(ctx context.Context, query string, args ...any) (pgconn.CommandTag, error) {
 		if check == query {
-			return pgconn.CommandTag{}, nil
+			return pgconn.NewCommandTag("DELETE 1"), nil
 		} else {
 			return pgconn.CommandTag{}, errors.New("DELETE ERROR: Query did not match check")
 		}
@@ -265,99 +280,19 @@ func TestDelete(t *testing.T) {
 	assert.NoError(t, err)
 }
 
-func TestList(t *testing.T) {
-	ctx := context.Background()
-	check := `SELECT * FROM recordings LIMIT $1::int`
-
-	expectedRecordings := []entities.Recording{
-		{
-			ID:              1,
-			Title:           "Recording 1",
-			AudioLocation:   "audio/location1.mp3",
-			ArtworkLocation: nil,
-			DateUploaded:    nil,
-			RecordingDate:   time.Date(2025, 1, 6, 20, 0, 0, 0, time.UTC),
-			LocationID:      1,
-			UserID:          1,
-			Duration:        180,
-			Format:          "mp3",
-			Description:     "Description 1",
-			Equipment:       "Equipment 1",
-			Size:            2048,
-			Channels:        "2",
-			License:         "Creative Commons",
-		},
-		{
-			ID:              2,
-			Title:           "Recording 2",
-			AudioLocation:   "audio/location2.mp3",
-			ArtworkLocation: nil,
-			DateUploaded:    nil,
-			RecordingDate:   time.Date(2025, 1, 7, 20, 0, 0, 0, time.UTC),
-			LocationID:      2,
-			UserID:          1,
-			Duration:        200,
-			Format:          "wav",
-			Description:     "Description 2",
-			Equipment:       "Equipment 2",
-			Size:            4096,
-			Channels:        "2",
-			License:         "Creative Commons",
-		},
-	}
-
-	mockDB := MockDatabase{mockQuery: func(ctx context.Context, query string, args ...interface{}) (pgx.Rows, error) {
-		if check == query {
-			return &MockRows{
-				mockNext: func() bool {
-					return len(expectedRecordings) > 0
-				},
-				mockScan: func(dest ...any) error {
-					if len(expectedRecordings) == 0 {
-						return errors.New("No recordings left!")
-					}
-					recording := expectedRecordings[0]
-					*(dest[0].(*int)) = recording.ID
-					*(dest[1].(*string)) = recording.Title
-					*(dest[2].(*string)) = recording.AudioLocation
-					*(dest[3].(**string)) = recording.ArtworkLocation
-					*(dest[4].(**time.Time)) = recording.DateUploaded
-					*(dest[5].(*time.Time)) = recording.RecordingDate
-					*(dest[6].(*int)) = recording.LocationID
-					*(dest[7].(*int)) = recording.UserID
-					*(dest[8].(*int)) = recording.Duration
-					*(dest[9].(*string)) = recording.Format
-					*(dest[10].(*string)) = recording.Description
-					*(dest[11].(*string)) = recording.Equipment
-					*(dest[12].(*float64)) = recording.Size
-					*(dest[13].(*string)) = recording.Channels
-					*(dest[14].(*string)) = recording.License
-					expectedRecordings = expectedRecordings[1:]
-					return nil
-				},
-			}, nil
-		}
-		fmt.Println(query)
-		fmt.Println(check)
-		return nil, errors.New("Query did not match Check")
+func TestDeleteMissingRow(t *testing.T) {
+	mockDB := MockDatabase{mockExec: func(ctx context.Context, query string, args ...any) (pgconn.CommandTag, error) {
+		return pgconn.NewCommandTag("DELETE 0"), nil
 	}}
 	repo := &RecordingRepoImplement{conn: &mockDB}
-
-	res, err := repo.List(ctx, 2)
-
-	if err != nil {
-		t.Errorf("Error listing recordings: %v", err)
-	}
-
-	if slices.Equal(res, expectedRecordings) {
-		t.Errorf("Error listing recordings!\nreceived: %v\nBut expected: %v", res, expectedRecordings)
-	}
-
+	err := repo.Delete(1, context.Background())
+	assert.ErrorIs(t, err, ErrNotFound)
 }
 
 func TestCount(t *testing.T) {
 	ctx := context.Background()
-	check := `SELECT COUNT(id) FROM recordings`
+	check := `SELECT COUNT(id) FROM recordings ` +
+		`WHERE (visibility = 'public' AND (embargo_until IS NULL OR embargo_until <= now()))`
 	expectedReturn := 1
 
 	mockDB := MockDatabase{mockQueryRow: func(ctx context.Context, query string, args ...any) pgx.Row {
@@ -379,10 +314,173 @@ func TestCount(t *testing.T) {
 	},
 	}
 	repo := &RecordingRepoImplement{conn: &mockDB}
-	id, err := repo.Count(ctx)
+	id, err := repo.Count(ctx, RecordingFilter{})
 	assert.Equal(t, id, expectedReturn)
 	if err != nil {
 		t.Errorf("Error testing Count method %v", err)
 	}
 
 }
+
+func TestListPoints(t *testing.T) {
+	check := `SELECT r.id, r.title, r.recording_date, r.duration, r.format, r.location_id, l.name, ST_AsGeoJSON(l.geom) AS geom ` +
+		`FROM recordings r JOIN ` + obscuredLocations + ` ON l.id = r.location_id ` +
+		`WHERE (r.visibility = 'public' AND (r.embargo_until IS NULL OR r.embargo_until <= now())) ORDER BY r.id`
+	served := false
+	mockDB := MockDatabase{
+		mockQuery: func(ctx context.Context, query string, args ...any) (pgx.Rows, error) {
+			if check != query {
+				return nil, errors.New("query did not match check")
+			}
+			named := args[0].(pgx.NamedArgs)
+			assert.Equal(t, 1000.0, named["grid_low"])
+			assert.Equal(t, 10000.0, named["grid_high"])
+			return &MockRows{
+				mockNext: func() bool {
+					return !served
+				},
+				mockScan: func(dest ...any) error {
+					served = true
+					*(dest[0].(*int)) = 3
+					return nil
+				},
+				mockErr: func() error { return nil },
+			}, nil
+		},
+	}
+	repo := &RecordingRepoImplement{conn: &mockDB, grids: Grids{Low: 1000, High: 10000}}
+	res, err := repo.ListPoints(context.Background(), Viewer{})
+	assert.NoError(t, err)
+	if assert.Len(t, res, 1) {
+		assert.Equal(t, 3, res[0].ID)
+	}
+}
+
+func TestSummaries(t *testing.T) {
+	check := `SELECT id, title, recording_date, duration, format, location_id, user_id FROM recordings ` +
+		`WHERE id = ANY(@ids::int[]) ` +
+		`AND ((visibility IN ('public', 'unlisted') AND (embargo_until IS NULL OR embargo_until <= now())) OR user_id = @viewer_id) ` +
+		`ORDER BY array_position(@ids::int[], id)`
+	served := false
+	mockDB := MockDatabase{
+		mockQuery: func(ctx context.Context, query string, args ...any) (pgx.Rows, error) {
+			if check != query {
+				return nil, errors.New("query did not match check")
+			}
+			assert.Equal(t, pgx.NamedArgs{"ids": []int{3, 1}, "viewer_id": 7}, args[0].(pgx.NamedArgs))
+			return &MockRows{
+				mockNext: func() bool {
+					return !served
+				},
+				mockScan: func(dest ...any) error {
+					served = true
+					*(dest[0].(*int)) = 3
+					*(dest[1].(*string)) = "Dawn chorus"
+					return nil
+				},
+				mockErr: func() error { return nil },
+			}, nil
+		},
+	}
+	repo := &RecordingRepoImplement{conn: &mockDB}
+	res, err := repo.Summaries(context.Background(), Viewer{UserID: 7}, []int{3, 1})
+	assert.NoError(t, err)
+	assert.Equal(t, []entities.RecordingSummary{{ID: 3, Title: "Dawn chorus"}}, res)
+}
+
+func TestListPage(t *testing.T) {
+	check := `SELECT id, title, audio_location, artwork_location, date_uploaded, recording_date, location_id, user_id, ` +
+		`duration, format, description, equipment, file_size, channels, license, visibility, embargo_until FROM recordings ` +
+		`WHERE location_id = @location_id AND duration >= @min_duration ` +
+		`AND ((visibility = 'public' AND (embargo_until IS NULL OR embargo_until <= now())) OR user_id = @viewer_id) ` +
+		`AND (title, id) < (@cursor_value, @cursor_id) ` +
+		`ORDER BY title DESC, id DESC LIMIT @limit`
+	mockDB := MockDatabase{mockQuery: func(ctx context.Context, query string, args ...any) (pgx.Rows, error) {
+		if check != query {
+			return nil, fmt.Errorf("query did not match check: %s", query)
+		}
+		named := args[0].(pgx.NamedArgs)
+		assert.Equal(t, pgx.NamedArgs{
+			"location_id":  2,
+			"min_duration": 60,
+			"viewer_id":    5,
+			"cursor_value": "M",
+			"cursor_id":    9,
+			"limit":        11,
+		}, named)
+		return &MockRows{
+			mockNext: func() bool { return false },
+			mockErr:  func() error { return nil },
+		}, nil
+	}}
+	repo := &RecordingRepoImplement{conn: &mockDB}
+	locationID, minDuration := 2, 60
+	res, err := repo.ListPage(context.Background(), RecordingQuery{
+		Filter: RecordingFilter{LocationID: &locationID, MinDuration: &minDuration, Viewer: Viewer{UserID: 5}},
+		Sort:   "title",
+		Desc:   true,
+		Limit:  11,
+		After:  &RecordingCursor{Sort: "title", Desc: true, Value: "M", ID: 9},
+	})
+	assert.NoError(t, err)
+	assert.Empty(t, res)
+}
+
+func TestCountTagFilter(t *testing.T) {
+	tagged := `id IN (SELECT rt.recording_id FROM recording_tags rt JOIN tags t ON t.id = rt.tag_id WHERE t.name = ANY(@tags)`
+	public := `(visibility = 'public' AND (embargo_until IS NULL OR embargo_until <= now()))`
+	tests := []struct {
+		name   string
+		filter RecordingFilter
+		check  string
+		args   pgx.NamedArgs
+	}{
+		{
+			name:   "any",
+			filter: RecordingFilter{Tags: []string{"dawn chorus", "hydrophone"}},
+			check:  `SELECT COUNT(id) FROM recordings WHERE ` + tagged + `) AND ` + public,
+			args:   pgx.NamedArgs{"tags": []string{"dawn chorus", "hydrophone"}},
+		},
+		{
+			name:   "all",
+			filter: RecordingFilter{Tags: []string{"dawn chorus", "hydrophone"}, AllTags: true},
+			check: `SELECT COUNT(id) FROM recordings WHERE ` + tagged +
+				` GROUP BY rt.recording_id HAVING COUNT(*) = @tag_count) AND ` + public,
+			args: pgx.NamedArgs{"tags": []string{"dawn chorus", "hydrophone"}, "tag_count": 2},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockDB := MockDatabase{mockQueryRow: func(ctx context.Context, query string, args ...any) pgx.Row {
+				assert.Equal(t, tt.check, query)
+				assert.Equal(t, tt.args, args[0].(pgx.NamedArgs))
+				return &MockRow{mockScan: func(dest ...any) error {
+					*(dest[0].([]any)[0].(*int)) = 4
+					return nil
+				}}
+			}}
+			repo := &RecordingRepoImplement{conn: &mockDB}
+			count, err := repo.Count(context.Background(), tt.filter)
+			assert.NoError(t, err)
+			assert.Equal(t, 4, count)
+		})
+	}
+}
+
+func TestRecordingCursorRoundTrip(t *testing.T) {
+	recorded := time.Date(2025, 1, 6, 20, 2, 57, 0, time.UTC)
+	cursor := CursorAfter(entities.Recording{ID: 4, RecordingDate: recorded}, "recording_date", true)
+	decoded, err := DecodeRecordingCursor(cursor.Encode(), "recording_date", true)
+	assert.NoError(t, err)
+	assert.Equal(t, cursor, decoded)
+
+	cursor = CursorAfter(entities.Recording{ID: 4}, "date_uploaded", false)
+	decoded, err = DecodeRecordingCursor(cursor.Encode(), "date_uploaded", false)
+	assert.NoError(t, err)
+	assert.Equal(t, pgtype.Timestamptz{InfinityModifier: pgtype.NegativeInfinity, Valid: true}, decoded.Value)
+
+	_, err = DecodeRecordingCursor(cursor.Encode(), "date_uploaded", true)
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+	_, err = DecodeRecordingCursor("not a cursor", "title", false)
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+}
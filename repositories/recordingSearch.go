@@ -0,0 +1,136 @@
+package repositories
+
+import (
+	"context"
+	"field_archive/server/entities"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// searchDocument is the weighted text searched for each recording: title
+// first, then where it was made, then its description and equipment.
+const searchDocument = `setweight(to_tsvector('english', coalesce(r.title, '')), 'A') || ` +
+	`setweight(to_tsvector('english', coalesce(l.name, '')), 'B') || ` +
+	`setweight(to_tsvector('english', coalesce(r.description, '')), 'C') || ` +
+	`setweight(to_tsvector('english', coalesce(r.equipment, '')), 'D')`
+
+// snippetSource is the text snippets are cut from, HTML escaped so that the
+// <mark> tags added by ts_headline are the only markup in the result.
+const snippetSource = `replace(replace(replace(` +
+	`r.title || ' ' || coalesce(r.description, '') || ' ' || coalesce(r.equipment, ''), ` +
+	`'&', '&amp;'), '<', '&lt;'), '>', '&gt;')`
+
+// RecordingSearch describes one page of full-text search results. Query is a
+// tsquery as built by PrefixQuery. Only recordings Viewer can list match.
+type RecordingSearch struct {
+	Query  string
+	Limit  int
+	After  *RecordingCursor
+	Viewer Viewer
+}
+
+// PrefixQuery turns free text typed by a user into a tsquery that matches
+// every word, treating each as a prefix so partial words match while typing.
+// Punctuation is dropped so the input can't inject tsquery operators. The
+// result is empty if there are no words to search for.
+func PrefixQuery(text string) string {
+	words := strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	terms := make([]string, 0, len(words))
+	for _, w := range words {
+		terms = append(terms, strings.ToLower(w)+":*")
+	}
+	return strings.Join(terms, " & ")
+}
+
+// SearchCursorAfter returns the cursor pointing just past result in a
+// relevance ordered search.
+func SearchCursorAfter(result entities.RecordingSearchResult) RecordingCursor {
+	return RecordingCursor{Sort: "rank", Desc: true, Value: result.Rank, ID: result.ID}
+}
+
+// Search returns recordings matching q.Query, most relevant first.
+func (r *RecordingRepoImplement) Search(ctx context.Context, q RecordingSearch) ([]entities.RecordingSearchResult, error) {
+	args := pgx.NamedArgs{"query": q.Query, "limit": q.Limit}
+	after := ``
+	if q.After != nil {
+		after = `WHERE (m.rank, m.id) < (@cursor_value, @cursor_id) `
+		args["cursor_value"] = q.After.Value
+		args["cursor_id"] = q.After.ID
+	}
+	query := `WITH matches AS (` +
+		`SELECT r.id, ts_rank(` + searchDocument + `, q.query) AS rank ` +
+		`FROM recordings r LEFT JOIN locations l ON l.id = r.location_id, to_tsquery('english', @query) AS q(query) ` +
+		`WHERE ` + strings.Join(append([]string{searchDocument + ` @@ q.query`}, q.Viewer.listable(args, "r")...), ` AND `) + `) ` +
+		`SELECT ` + prefixColumns("r", recordingColumns) + `, m.rank, ` +
+		`ts_headline('english', ` + snippetSource + `, ` +
+		`to_tsquery('english', @query), 'StartSel=<mark>, StopSel=</mark>, MaxFragments=2, MaxWords=20, MinWords=5') AS snippet ` +
+		`FROM matches m JOIN recordings r ON r.id = m.id ` +
+		after +
+		`ORDER BY m.rank DESC, m.id DESC LIMIT @limit`
+
+	res := []entities.RecordingSearchResult{}
+	rows, err := r.conn.Query(ctx, query, args)
+	if err != nil {
+		return nil, fmt.Errorf("unable to search recordings: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		result := entities.RecordingSearchResult{}
+		rec := &result.Recording
+		err := rows.Scan(
+			&rec.ID,
+			&rec.Title,
+			&rec.AudioLocation,
+			&rec.ArtworkLocation,
+			&rec.DateUploaded,
+			&rec.RecordingDate,
+			&rec.LocationID,
+			&rec.UserID,
+			&rec.Duration,
+			&rec.Format,
+			&rec.Description,
+			&rec.Equipment,
+			&rec.Size,
+			&rec.Channels,
+			&rec.License,
+			&rec.Visibility,
+			&rec.EmbargoUntil,
+			&result.Rank,
+			&result.Snippet,
+		)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, result)
+	}
+	return res, rows.Err()
+}
+
+// CountSearch returns the number of recordings viewer can list matching the
+// tsquery.
+func (r *RecordingRepoImplement) CountSearch(ctx context.Context, query string, viewer Viewer) (int, error) {
+	args := pgx.NamedArgs{"query": query}
+	conds := append([]string{searchDocument + ` @@ to_tsquery('english', @query)`}, viewer.listable(args, "r")...)
+	sql := `SELECT COUNT(r.id) FROM recordings r LEFT JOIN locations l ON l.id = r.location_id` + whereClause(conds)
+	var count int
+	err := r.conn.QueryRow(ctx, sql, args).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("unable to count search results: %w", err)
+	}
+	return count, nil
+}
+
+// prefixColumns qualifies each column in a comma separated list with table.
+func prefixColumns(table, columns string) string {
+	cols := strings.Split(columns, ", ")
+	for i, c := range cols {
+		cols[i] = table + "." + c
+	}
+	return strings.Join(cols, ", ")
+}
@@ -0,0 +1,75 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"field_archive/server/entities"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrefixQuery(t *testing.T) {
+	assert.Equal(t, "dawn:* & chor:*", PrefixQuery("Dawn chor"))
+	assert.Equal(t, "hydrophone:* & río:*", PrefixQuery("  hydrophone!! | río "))
+	assert.Equal(t, "a:* & b:*", PrefixQuery("a:*&!b"))
+	assert.Equal(t, "", PrefixQuery("&|!():*"))
+}
+
+func TestSearch(t *testing.T) {
+	served := false
+	mockDB := MockDatabase{mockQuery: func(ctx context.Context, query string, args ...any) (pgx.Rows, error) {
+		named := args[0].(pgx.NamedArgs)
+		assert.Equal(t, "dawn:*", named["query"])
+		assert.Equal(t, float32(0.5), named["cursor_value"])
+		assert.Equal(t, 8, named["cursor_id"])
+		assert.Contains(t, query, `AND (r.visibility = 'public' AND (r.embargo_until IS NULL OR r.embargo_until <= now()))) `)
+		assert.Contains(t, query, `WHERE (m.rank, m.id) < (@cursor_value, @cursor_id) ORDER BY m.rank DESC, m.id DESC LIMIT @limit`)
+		return &MockRows{
+			mockNext: func() bool { return !served },
+			mockScan: func(dest ...any) error {
+				served = true
+				*(dest[0].(*int)) = 3
+				*(dest[1].(*string)) = "Dawn Chorus"
+				*(dest[17].(*float32)) = 0.4
+				*(dest[18].(*string)) = "<mark>Dawn</mark> Chorus"
+				return nil
+			},
+			mockErr: func() error { return nil },
+		}, nil
+	}}
+	repo := &RecordingRepoImplement{conn: &mockDB}
+	cursor := SearchCursorAfter(entities.RecordingSearchResult{Recording: entities.Recording{ID: 8}, Rank: 0.5})
+	res, err := repo.Search(context.Background(), RecordingSearch{Query: "dawn:*", Limit: 5, After: &cursor})
+	assert.NoError(t, err)
+	if assert.Len(t, res, 1) {
+		assert.Equal(t, "Dawn Chorus", res[0].Title)
+		assert.Equal(t, float32(0.4), res[0].Rank)
+		assert.Equal(t, "<mark>Dawn</mark> Chorus", res[0].Snippet)
+	}
+}
+
+func TestSearchCursorRoundTrip(t *testing.T) {
+	cursor := SearchCursorAfter(entities.RecordingSearchResult{Recording: entities.Recording{ID: 8}, Rank: 0.0607927})
+	decoded, err := DecodeRecordingCursor(cursor.Encode(), "rank", true)
+	assert.NoError(t, err)
+	assert.Equal(t, cursor, decoded)
+}
+
+func TestCountSearch(t *testing.T) {
+	mockDB := MockDatabase{mockQueryRow: func(ctx context.Context, query string, args ...any) pgx.Row {
+		return &MockRow{mockScan: func(dest ...any) error {
+			innerSlice, ok := dest[0].([]any)
+			if !ok {
+				return errors.New("Can't access inner slice")
+			}
+			*(innerSlice[0].(*int)) = 12
+			return nil
+		}}
+	}}
+	repo := &RecordingRepoImplement{conn: &mockDB}
+	count, err := repo.CountSearch(context.Background(), "dawn:*", Viewer{})
+	assert.NoError(t, err)
+	assert.Equal(t, 12, count)
+}
@@ -0,0 +1,112 @@
+package repositories
+
+import (
+	"context"
+	"field_archive/server/entities"
+	"field_archive/server/internal/database"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+)
+
+type RefreshTokenRepository interface {
+	Insert(token entities.RefreshToken, ctx context.Context) (int, error)
+	GetByHash(hash string, ctx context.Context) (entities.RefreshToken, error)
+	MarkUsed(id int, ctx context.Context) (bool, error)
+	RevokeFamily(familyID string, ctx context.Context) error
+	RevokeUser(userID int, ctx context.Context) error
+}
+
+type RefreshTokenRepoImplement struct {
+	conn database.Database
+}
+
+func NewRefreshTokenRepo(db *database.Postgres) *RefreshTokenRepoImplement {
+	return &RefreshTokenRepoImplement{conn: db}
+}
+
+func (r *RefreshTokenRepoImplement) Insert(token entities.RefreshToken, ctx context.Context) (int, error) {
+	query := `INSERT INTO refresh_tokens ` +
+		`(user_id, family_id, token_hash, expires_at) ` +
+		`VALUES (@user_id, @family_id, @token_hash, @expires_at) ` +
+		`RETURNING id`
+	args := pgx.NamedArgs{
+		"user_id":    token.UserID,
+		"family_id":  token.FamilyID,
+		"token_hash": token.TokenHash,
+		"expires_at": token.ExpiresAt,
+	}
+	var id int
+	err := r.conn.QueryRow(ctx, query, args).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("unable to insert row: %w", err)
+	}
+	return id, nil
+}
+
+func (r *RefreshTokenRepoImplement) GetByHash(hash string, ctx context.Context) (entities.RefreshToken, error) {
+	query := `SELECT id, user_id, family_id, token_hash, created_at, expires_at, used_at, revoked_at ` +
+		`FROM refresh_tokens WHERE token_hash = @token_hash`
+	args := pgx.NamedArgs{
+		"token_hash": hash,
+	}
+	var token entities.RefreshToken
+	err := r.conn.QueryRow(ctx, query, args).Scan(
+		&token.ID,
+		&token.UserID,
+		&token.FamilyID,
+		&token.TokenHash,
+		&token.CreatedAt,
+		&token.ExpiresAt,
+		&token.UsedAt,
+		&token.RevokedAt)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return entities.RefreshToken{}, fmt.Errorf("refresh token %w", ErrNotFound)
+		}
+		return entities.RefreshToken{}, fmt.Errorf("unable to get row: %w", err)
+	}
+	return token, nil
+}
+
+// MarkUsed records that the token has been exchanged. It reports false if
+// the token was already used or revoked, so of two concurrent refreshes with
+// the same token only one succeeds.
+func (r *RefreshTokenRepoImplement) MarkUsed(id int, ctx context.Context) (bool, error) {
+	query := `UPDATE refresh_tokens SET used_at = now() ` +
+		`WHERE id = @id AND used_at IS NULL AND revoked_at IS NULL`
+	args := pgx.NamedArgs{
+		"id": id,
+	}
+	tag, err := r.conn.Exec(ctx, query, args)
+	if err != nil {
+		return false, fmt.Errorf("unable to update row: %w", err)
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// RevokeFamily revokes every token descended from the same login.
+func (r *RefreshTokenRepoImplement) RevokeFamily(familyID string, ctx context.Context) error {
+	query := `UPDATE refresh_tokens SET revoked_at = now() ` +
+		`WHERE family_id = @family_id AND revoked_at IS NULL`
+	args := pgx.NamedArgs{
+		"family_id": familyID,
+	}
+	if _, err := r.conn.Exec(ctx, query, args); err != nil {
+		return fmt.Errorf("unable to update rows: %w", err)
+	}
+	return nil
+}
+
+// RevokeUser revokes every token issued to the user.
+func (r *RefreshTokenRepoImplement) RevokeUser(userID int, ctx context.Context) error {
+	query := `UPDATE refresh_tokens SET revoked_at = now() ` +
+		`WHERE user_id = @user_id AND revoked_at IS NULL`
+	args := pgx.NamedArgs{
+		"user_id": userID,
+	}
+	if _, err := r.conn.Exec(ctx, query, args); err != nil {
+		return fmt.Errorf("unable to update rows: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMarkRefreshTokenUsed(t *testing.T) {
+	check := `UPDATE refresh_tokens SET used_at = now() ` +
+		`WHERE id = @id AND used_at IS NULL AND revoked_at IS NULL`
+	rows := "UPDATE 1"
+	mockDB := &MockDatabase{
+		mockExec: func(ctx context.Context, query string, args ...any) (pgconn.CommandTag, error) {
+			if check != query {
+				return pgconn.CommandTag{}, errors.New("query did not match check")
+			}
+			return pgconn.NewCommandTag(rows), nil
+		},
+	}
+	repo := &RefreshTokenRepoImplement{conn: mockDB}
+	ok, err := repo.MarkUsed(1, context.Background())
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	rows = "UPDATE 0"
+	ok, err = repo.MarkUsed(1, context.Background())
+	assert.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestRevokeRefreshTokenFamily(t *testing.T) {
+	check := `UPDATE refresh_tokens SET revoked_at = now() ` +
+		`WHERE family_id = @family_id AND revoked_at IS NULL`
+	mockDB := &MockDatabase{
+		mockExec: func(ctx context.Context, query string, args ...any) (pgconn.CommandTag, error) {
+			if check != query {
+				return pgconn.CommandTag{}, errors.New("query did not match check")
+			}
+			return pgconn.NewCommandTag("UPDATE 3"), nil
+		},
+	}
+	repo := &RefreshTokenRepoImplement{conn: mockDB}
+	assert.NoError(t, repo.RevokeFamily("family", context.Background()))
+}
+
+func TestRevokeUserRefreshTokens(t *testing.T) {
+	check := `UPDATE refresh_tokens SET revoked_at = now() ` +
+		`WHERE user_id = @user_id AND revoked_at IS NULL`
+	mockDB := &MockDatabase{
+		mockExec: func(ctx context.Context, query string, args ...any) (pgconn.CommandTag, error) {
+			if check != query || args[0].(pgx.NamedArgs)["user_id"] != 5 {
+				return pgconn.CommandTag{}, errors.New("query did not match check")
+			}
+			return pgconn.NewCommandTag("UPDATE 2"), nil
+		},
+	}
+	repo := &RefreshTokenRepoImplement{conn: mockDB}
+	assert.NoError(t, repo.RevokeUser(5, context.Background()))
+}
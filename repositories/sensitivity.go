@@ -0,0 +1,83 @@
+package repositories
+
+import (
+	"field_archive/server/entities"
+	"fmt"
+	"math"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Grids are the sizes, in metres, of the grid cells that low and high
+// sensitivity locations are snapped to for viewers who can't see them
+// precisely.
+type Grids struct {
+	Low  float64
+	High float64
+}
+
+// Validate checks both grid sizes are positive, finite numbers of metres.
+// snap_point divides by them, so a zero grid would fail every query that
+// obscures a location.
+func (g Grids) Validate() error {
+	for _, grid := range []struct {
+		name string
+		size float64
+	}{{"low", g.Low}, {"high", g.High}} {
+		if !(grid.size > 0) || math.IsInf(grid.size, 0) {
+			return fmt.Errorf("%s sensitivity grid must be a positive number of metres, got %v", grid.name, grid.size)
+		}
+	}
+	return nil
+}
+
+// metresPerDegree is the length of a degree of latitude, as snap_point
+// takes it.
+const metresPerDegree = 111320
+
+// reach is the farthest, in metres, snapping can move a point, whichever
+// grid it's on.
+func (g Grids) reach() float64 {
+	return math.Max(g.Low, g.High)
+}
+
+// reachDegrees is reach in degrees of longitude and latitude, for points no
+// farther from the equator than maxAbsLat. Longitude degrees shrink towards
+// the poles, as snap_point's do, until it stops widening its cells.
+func (g Grids) reachDegrees(maxAbsLat float64) (lon, lat float64) {
+	lat = g.reach() / metresPerDegree
+	widest := math.Min(maxAbsLat+lat, 90)
+	lon = g.reach() / (metresPerDegree * math.Max(math.Cos(widest*math.Pi/180), 0.01))
+	return lon, lat
+}
+
+// locations returns a FROM item, aliased l, for the locations table as v
+// sees it. Owners, curators and admins see every geom as stored; anyone else
+// sees sensitive locations snapped to their grid, so filters, distances and
+// ordering on l.geom can't be used to narrow down the true point either.
+//
+// A spatial condition on the snapped geom can't use an index, so near, if
+// given, is a condition on the stored geom that holds for every point the
+// caller's own condition could match once snapped, widening it by the grid's
+// reach. It's applied to the stored points before they're snapped, where
+// the indexes can serve it; the caller's condition then applies as usual.
+func (v Viewer) locations(args pgx.NamedArgs, grids Grids, near string) string {
+	if v.SeesAll {
+		return `locations l`
+	}
+	precise := `l.sensitivity = '` + entities.SensitivityNone + `'`
+	if v.UserID > 0 {
+		precise += ` OR l.user_id = @viewer_id`
+		args["viewer_id"] = v.UserID
+	}
+	args["grid_low"] = grids.Low
+	args["grid_high"] = grids.High
+	var conds []string
+	if near != "" {
+		conds = append(conds, near)
+	}
+	return `(SELECT l.id, l.name, l.description, l.user_id, l.sensitivity, ` +
+		`CASE WHEN ` + precise + ` THEN l.geom ` +
+		`ELSE snap_point(l.geom, CASE l.sensitivity WHEN '` + entities.SensitivityLow + `' THEN @grid_low ELSE @grid_high END) ` +
+		`END AS geom FROM locations l` + whereClause(conds) + `) l`
+}
@@ -0,0 +1,122 @@
+package repositories
+
+import (
+	"context"
+	"field_archive/server/entities"
+	"field_archive/server/internal/database"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+)
+
+type TagRepository interface {
+	Attach(recordingID int, name string, ctx context.Context) error
+	Detach(recordingID int, name string, ctx context.Context) error
+	ListByRecording(recordingID int, ctx context.Context) ([]string, error)
+	Search(ctx context.Context, viewer Viewer, prefix string, limit int) ([]entities.Tag, error)
+}
+
+type TagRepoImplement struct {
+	conn database.Database
+}
+
+func NewTagRepo(db *database.Postgres) *TagRepoImplement {
+	return &TagRepoImplement{conn: db}
+}
+
+// Attach tags the recording with name, creating the tag if it's new.
+// Attaching a tag the recording already has does nothing.
+func (r *TagRepoImplement) Attach(recordingID int, name string, ctx context.Context) error {
+	query := `WITH tag AS (` +
+		`INSERT INTO tags (name) VALUES (@name) ` +
+		`ON CONFLICT (name) DO UPDATE SET name = EXCLUDED.name RETURNING id) ` +
+		`INSERT INTO recording_tags (recording_id, tag_id) SELECT @recording_id, id FROM tag ` +
+		`ON CONFLICT DO NOTHING`
+	args := pgx.NamedArgs{
+		"recording_id": recordingID,
+		"name":         name,
+	}
+	if _, err := r.conn.Exec(ctx, query, args); err != nil {
+		return fmt.Errorf("unable to attach tag: %w", err)
+	}
+	return nil
+}
+
+// Detach removes the tag from the recording. Tags left on no recordings are
+// kept, and simply drop out of autocomplete results.
+func (r *TagRepoImplement) Detach(recordingID int, name string, ctx context.Context) error {
+	query := `DELETE FROM recording_tags rt USING tags t ` +
+		`WHERE rt.tag_id = t.id AND rt.recording_id = @recording_id AND t.name = @name`
+	args := pgx.NamedArgs{
+		"recording_id": recordingID,
+		"name":         name,
+	}
+	tag, err := r.conn.Exec(ctx, query, args)
+	if err != nil {
+		return fmt.Errorf("unable to detach tag: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("tag %q on recording with id %d %w", name, recordingID, ErrNotFound)
+	}
+	return nil
+}
+
+// ListByRecording returns the names of the recording's tags in alphabetical
+// order.
+func (r *TagRepoImplement) ListByRecording(recordingID int, ctx context.Context) ([]string, error) {
+	res := []string{}
+	query := `SELECT t.name FROM tags t JOIN recording_tags rt ON rt.tag_id = t.id ` +
+		`WHERE rt.recording_id = @recording_id ORDER BY t.name`
+	args := pgx.NamedArgs{
+		"recording_id": recordingID,
+	}
+	rows, err := r.conn.Query(ctx, query, args)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("unable to scan row: %w", err)
+		}
+		res = append(res, name)
+	}
+	return res, rows.Err()
+}
+
+// Search returns up to limit tags starting with prefix, most used first.
+// Only the recordings viewer can list are counted, so tags used solely on
+// recordings hidden from them aren't suggested.
+func (r *TagRepoImplement) Search(ctx context.Context, viewer Viewer, prefix string, limit int) ([]entities.Tag, error) {
+	res := []entities.Tag{}
+	args := pgx.NamedArgs{
+		"prefix": escapeLike(prefix) + "%",
+		"limit":  limit,
+	}
+	conds := append([]string{`t.name LIKE @prefix`}, viewer.listable(args, "r")...)
+	query := `SELECT t.name, COUNT(r.id) AS uses FROM tags t ` +
+		`JOIN recording_tags rt ON rt.tag_id = t.id JOIN recordings r ON r.id = rt.recording_id` +
+		whereClause(conds) + ` GROUP BY t.name ORDER BY uses DESC, t.name LIMIT @limit`
+	rows, err := r.conn.Query(ctx, query, args)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		tag := entities.Tag{}
+		if err := rows.Scan(&tag.Name, &tag.Count); err != nil {
+			return nil, fmt.Errorf("unable to scan row: %w", err)
+		}
+		res = append(res, tag)
+	}
+	return res, rows.Err()
+}
+
+// escapeLike escapes the LIKE wildcards in s so it matches literally.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
@@ -0,0 +1,83 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"field_archive/server/entities"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAttachTag(t *testing.T) {
+	check := `WITH tag AS (` +
+		`INSERT INTO tags (name) VALUES (@name) ` +
+		`ON CONFLICT (name) DO UPDATE SET name = EXCLUDED.name RETURNING id) ` +
+		`INSERT INTO recording_tags (recording_id, tag_id) SELECT @recording_id, id FROM tag ` +
+		`ON CONFLICT DO NOTHING`
+	mockDB := &MockDatabase{
+		mockExec: func(ctx context.Context, query string, args ...any) (pgconn.CommandTag, error) {
+			if check != query {
+				return pgconn.CommandTag{}, errors.New("query did not match check")
+			}
+			assert.Equal(t, pgx.NamedArgs{"recording_id": 2, "name": "dawn chorus"}, args[0].(pgx.NamedArgs))
+			return pgconn.NewCommandTag("INSERT 0 1"), nil
+		},
+	}
+	repo := &TagRepoImplement{conn: mockDB}
+	assert.NoError(t, repo.Attach(2, "dawn chorus", context.Background()))
+}
+
+func TestDetachTag(t *testing.T) {
+	check := `DELETE FROM recording_tags rt USING tags t ` +
+		`WHERE rt.tag_id = t.id AND rt.recording_id = @recording_id AND t.name = @name`
+	mockDB := &MockDatabase{
+		mockExec: func(ctx context.Context, query string, args ...any) (pgconn.CommandTag, error) {
+			if check != query {
+				return pgconn.CommandTag{}, errors.New("query did not match check")
+			}
+			if args[0].(pgx.NamedArgs)["name"] == "hydrophone" {
+				return pgconn.NewCommandTag("DELETE 1"), nil
+			}
+			return pgconn.NewCommandTag("DELETE 0"), nil
+		},
+	}
+	repo := &TagRepoImplement{conn: mockDB}
+	assert.NoError(t, repo.Detach(2, "hydrophone", context.Background()))
+	assert.ErrorIs(t, repo.Detach(2, "dawn chorus", context.Background()), ErrNotFound)
+}
+
+func TestSearchTags(t *testing.T) {
+	check := `SELECT t.name, COUNT(r.id) AS uses FROM tags t ` +
+		`JOIN recording_tags rt ON rt.tag_id = t.id JOIN recordings r ON r.id = rt.recording_id ` +
+		`WHERE t.name LIKE @prefix ` +
+		`AND ((r.visibility = 'public' AND (r.embargo_until IS NULL OR r.embargo_until <= now())) OR r.user_id = @viewer_id) ` +
+		`GROUP BY t.name ORDER BY uses DESC, t.name LIMIT @limit`
+	served := false
+	mockDB := &MockDatabase{
+		mockQuery: func(ctx context.Context, query string, args ...any) (pgx.Rows, error) {
+			if check != query {
+				return nil, errors.New("query did not match check")
+			}
+			assert.Equal(t, pgx.NamedArgs{"prefix": `50\%\_%`, "limit": 5, "viewer_id": 3}, args[0].(pgx.NamedArgs))
+			return &MockRows{
+				mockNext: func() bool {
+					return !served
+				},
+				mockScan: func(dest ...any) error {
+					served = true
+					*(dest[0].(*string)) = "50%_wet"
+					*(dest[1].(*int)) = 2
+					return nil
+				},
+				mockErr: func() error { return nil },
+			}, nil
+		},
+	}
+	repo := &TagRepoImplement{conn: mockDB}
+	res, err := repo.Search(context.Background(), Viewer{UserID: 3}, "50%_", 5)
+	assert.NoError(t, err)
+	assert.Equal(t, []entities.Tag{{Name: "50%_wet", Count: 2}}, res)
+}
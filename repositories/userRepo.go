@@ -0,0 +1,130 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"field_archive/server/entities"
+	"field_archive/server/internal/database"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// uniqueViolation is the Postgres error code for a broken unique constraint.
+type UserRepository interface {
+	Insert(user entities.User, ctx context.Context) (int, error)
+	GetRowByID(id int, ctx context.Context) (entities.User, error)
+	GetByUsername(username string, ctx context.Context) (entities.User, error)
+	UpdateRole(id int, role string, ctx context.Context) error
+	Disable(id int, ctx context.Context) error
+}
+
+const userColumns = `id, username, email, password_hash, role, date_created, disabled_at`
+
+type UserRepoImplement struct {
+	conn database.Database
+}
+
+func NewUserRepo(db *database.Postgres) *UserRepoImplement {
+	return &UserRepoImplement{conn: db}
+}
+
+func (r *UserRepoImplement) Insert(user entities.User, ctx context.Context) (int, error) {
+	query := `INSERT INTO users ` +
+		`(username, email, password_hash, role) ` +
+		`VALUES (@username, @email, @password_hash, @role) ` +
+		`RETURNING id`
+	args := pgx.NamedArgs{
+		"username":      user.Username,
+		"email":         user.Email,
+		"password_hash": user.PasswordHash,
+		"role":          user.Role,
+	}
+	var id int
+	err := r.conn.QueryRow(ctx, query, args).Scan(&id)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation {
+			return 0, fmt.Errorf("user %w", ErrConflict)
+		}
+		return 0, fmt.Errorf("unable to insert row: %w", err)
+	}
+	return id, nil
+}
+
+func (r *UserRepoImplement) GetRowByID(id int, ctx context.Context) (entities.User, error) {
+	query := `SELECT ` + userColumns + ` FROM users WHERE id = @id`
+	args := pgx.NamedArgs{
+		"id": id,
+	}
+	user, err := scanUser(r.conn.QueryRow(ctx, query, args))
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return entities.User{}, fmt.Errorf("user with id %d %w", id, ErrNotFound)
+		}
+		return entities.User{}, fmt.Errorf("unable to get row: %w", err)
+	}
+	return user, nil
+}
+
+func (r *UserRepoImplement) GetByUsername(username string, ctx context.Context) (entities.User, error) {
+	query := `SELECT ` + userColumns + ` FROM users WHERE username = @username`
+	args := pgx.NamedArgs{
+		"username": username,
+	}
+	user, err := scanUser(r.conn.QueryRow(ctx, query, args))
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return entities.User{}, fmt.Errorf("user %q %w", username, ErrNotFound)
+		}
+		return entities.User{}, fmt.Errorf("unable to get row: %w", err)
+	}
+	return user, nil
+}
+
+func (r *UserRepoImplement) UpdateRole(id int, role string, ctx context.Context) error {
+	query := `UPDATE users SET role = @role WHERE id = @id`
+	args := pgx.NamedArgs{
+		"id":   id,
+		"role": role,
+	}
+	tag, err := r.conn.Exec(ctx, query, args)
+	if err != nil {
+		return fmt.Errorf("unable to update row: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("user with id %d %w", id, ErrNotFound)
+	}
+	return nil
+}
+
+// Disable marks the user disabled. Disabling a disabled user keeps the
+// original time.
+func (r *UserRepoImplement) Disable(id int, ctx context.Context) error {
+	query := `UPDATE users SET disabled_at = COALESCE(disabled_at, now()) WHERE id = @id`
+	args := pgx.NamedArgs{
+		"id": id,
+	}
+	tag, err := r.conn.Exec(ctx, query, args)
+	if err != nil {
+		return fmt.Errorf("unable to update row: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("user with id %d %w", id, ErrNotFound)
+	}
+	return nil
+}
+
+func scanUser(row pgx.Row) (entities.User, error) {
+	var user entities.User
+	err := row.Scan(
+		&user.ID,
+		&user.Username,
+		&user.Email,
+		&user.PasswordHash,
+		&user.Role,
+		&user.DateCreated,
+		&user.DisabledAt)
+	return user, err
+}
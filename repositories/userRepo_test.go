@@ -0,0 +1,121 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"field_archive/server/entities"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInsertUser(t *testing.T) {
+	check := `INSERT INTO users ` +
+		`(username, email, password_hash, role) ` +
+		`VALUES (@username, @email, @password_hash, @role) ` +
+		`RETURNING id`
+
+	mockDB := &MockDatabase{
+		mockQueryRow: func(ctx context.Context, query string, args ...any) pgx.Row {
+			if check != query {
+				return &MockRow{mockScan: func(dest ...any) error {
+					return errors.New("query did not match check")
+				}}
+			}
+			named := args[0].(pgx.NamedArgs)
+			return &MockRow{mockScan: func(dest ...any) error {
+				if named["username"] == "taken" {
+					return &pgconn.PgError{Code: "23505", ConstraintName: "users_username_key"}
+				}
+				innerSlice, ok := dest[0].([]any)
+				if !ok {
+					return errors.New("Unable to access inner slice")
+				}
+				*(innerSlice[0].(*int)) = 5
+				return nil
+			}}
+		},
+	}
+	repo := &UserRepoImplement{conn: mockDB}
+	id, err := repo.Insert(entities.User{Username: "wren", Email: "wren@example.com", PasswordHash: "hash"}, context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 5, id)
+
+	_, err = repo.Insert(entities.User{Username: "taken"}, context.Background())
+	assert.ErrorIs(t, err, ErrConflict)
+}
+
+func TestGetUserByUsername(t *testing.T) {
+	check := `SELECT id, username, email, password_hash, role, date_created, disabled_at FROM users WHERE username = @username`
+	created := time.Date(2025, 1, 6, 20, 2, 57, 0, time.UTC)
+	mockDB := &MockDatabase{
+		mockQueryRow: func(ctx context.Context, query string, args ...any) pgx.Row {
+			named := args[0].(pgx.NamedArgs)
+			if check != query || named["username"] != "wren" {
+				return &MockRow{mockScan: func(dest ...any) error {
+					return pgx.ErrNoRows
+				}}
+			}
+			return &MockRow{mockScan: func(dest ...any) error {
+				innerSlice, ok := dest[0].([]any)
+				if !ok {
+					return errors.New("Unable to access inner slice")
+				}
+				*(innerSlice[0].(*int)) = 5
+				*(innerSlice[1].(*string)) = "wren"
+				*(innerSlice[2].(*string)) = "wren@example.com"
+				*(innerSlice[3].(*string)) = "hash"
+				*(innerSlice[4].(*string)) = entities.RoleContributor
+				*(innerSlice[5].(*time.Time)) = created
+				return nil
+			}}
+		},
+	}
+	repo := &UserRepoImplement{conn: mockDB}
+	user, err := repo.GetByUsername("wren", context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, entities.User{ID: 5, Username: "wren", Email: "wren@example.com", PasswordHash: "hash", Role: entities.RoleContributor, DateCreated: created}, user)
+
+	_, err = repo.GetByUsername("nobody", context.Background())
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestDisableUser(t *testing.T) {
+	check := `UPDATE users SET disabled_at = COALESCE(disabled_at, now()) WHERE id = @id`
+	mockDB := &MockDatabase{
+		mockExec: func(ctx context.Context, query string, args ...any) (pgconn.CommandTag, error) {
+			if check != query {
+				return pgconn.CommandTag{}, errors.New("query did not match check")
+			}
+			if args[0].(pgx.NamedArgs)["id"] != 5 {
+				return pgconn.NewCommandTag("UPDATE 0"), nil
+			}
+			return pgconn.NewCommandTag("UPDATE 1"), nil
+		},
+	}
+	repo := &UserRepoImplement{conn: mockDB}
+	assert.NoError(t, repo.Disable(5, context.Background()))
+	assert.ErrorIs(t, repo.Disable(6, context.Background()), ErrNotFound)
+}
+
+func TestUpdateUserRole(t *testing.T) {
+	check := `UPDATE users SET role = @role WHERE id = @id`
+	mockDB := &MockDatabase{
+		mockExec: func(ctx context.Context, query string, args ...any) (pgconn.CommandTag, error) {
+			named := args[0].(pgx.NamedArgs)
+			if check != query || named["role"] != entities.RoleCurator {
+				return pgconn.CommandTag{}, errors.New("query did not match check")
+			}
+			if named["id"] != 5 {
+				return pgconn.NewCommandTag("UPDATE 0"), nil
+			}
+			return pgconn.NewCommandTag("UPDATE 1"), nil
+		},
+	}
+	repo := &UserRepoImplement{conn: mockDB}
+	assert.NoError(t, repo.UpdateRole(5, entities.RoleCurator, context.Background()))
+	assert.ErrorIs(t, repo.UpdateRole(6, entities.RoleCurator, context.Background()), ErrNotFound)
+}
@@ -0,0 +1,80 @@
+package repositories
+
+import (
+	"field_archive/server/entities"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Viewer is who a recording query runs for, deciding which recordings it can
+// see. The zero Viewer is an anonymous user.
+type Viewer struct {
+	UserID int
+	// SeesAll is set for curators and admins, who can see every recording.
+	SeesAll bool
+}
+
+// publicRecording matches the recordings anyone may list, for queries that
+// are the same for every viewer. It expects recordings to be aliased r.
+const publicRecording = `(r.visibility = '` + entities.VisibilityPublic + `' AND ` +
+	`(r.embargo_until IS NULL OR r.embargo_until <= now()))`
+
+// released is true for recordings whose embargo, if any, has passed.
+const released = `(%[1]sembargo_until IS NULL OR %[1]sembargo_until <= now())`
+
+// listable returns the condition for recordings v may find in listings,
+// counts and searches: released public recordings and their own. table
+// qualifies the columns when the query joins other tables, and may be "".
+func (v Viewer) listable(args pgx.NamedArgs, table string) []string {
+	return v.condition(args, table, fmt.Sprintf(`%svisibility = '%s'`, prefix(table), entities.VisibilityPublic))
+}
+
+// readable returns the condition for recordings v may fetch by ID, which
+// adds released unlisted recordings to those that are listable.
+func (v Viewer) readable(args pgx.NamedArgs, table string) []string {
+	return v.condition(args, table, fmt.Sprintf(`%svisibility IN ('%s', '%s')`,
+		prefix(table), entities.VisibilityPublic, entities.VisibilityUnlisted))
+}
+
+func (v Viewer) condition(args pgx.NamedArgs, table, visible string) []string {
+	if v.SeesAll {
+		return nil
+	}
+	cond := `(` + visible + ` AND ` + fmt.Sprintf(released, prefix(table)) + `)`
+	if v.UserID > 0 {
+		cond = `(` + cond + ` OR ` + prefix(table) + `user_id = @viewer_id)`
+		args["viewer_id"] = v.UserID
+	}
+	return []string{cond}
+}
+
+func prefix(table string) string {
+	if table == "" {
+		return ""
+	}
+	return table + "."
+}
+
+// collectionListable returns the condition for collections v may find in
+// listings: public ones and their own. Collections have no embargoes.
+func (v Viewer) collectionListable(args pgx.NamedArgs) []string {
+	return v.ownedOr(args, fmt.Sprintf(`visibility = '%s'`, entities.VisibilityPublic))
+}
+
+// collectionReadable returns the condition for collections v may fetch by
+// ID, which adds unlisted collections to those that are listable.
+func (v Viewer) collectionReadable(args pgx.NamedArgs) []string {
+	return v.ownedOr(args, fmt.Sprintf(`visibility IN ('%s', '%s')`, entities.VisibilityPublic, entities.VisibilityUnlisted))
+}
+
+func (v Viewer) ownedOr(args pgx.NamedArgs, visible string) []string {
+	if v.SeesAll {
+		return nil
+	}
+	if v.UserID > 0 {
+		args["viewer_id"] = v.UserID
+		return []string{`(` + visible + ` OR user_id = @viewer_id)`}
+	}
+	return []string{visible}
+}
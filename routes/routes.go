@@ -3,12 +3,15 @@ package routes
 import (
 	"field_archive/server/handlers"
 	"net/http"
-	"os"
 
 	"github.com/gin-gonic/gin"
 )
 
-func DefineRoutes(router *gin.Engine, h *handlers.RecordingHandler) {
+// Routes are split into groups by who may call them: public routes are open
+// to anyone, authenticated routes need a valid token and admin routes need
+// an admin's token.
+
+func DefineRoutes(router *gin.Engine, h *handlers.RecordingHandler, auth *handlers.AuthMiddleware) {
 
 	router.GET("/test", func(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{
@@ -16,28 +19,217 @@ func DefineRoutes(router *gin.Engine, h *handlers.RecordingHandler) {
 		})
 	})
 
-	router.GET("/recordings/:id", func(c *gin.Context) {
+	public := router.Group("", auth.Public())
+
+	public.GET("/recordings/:id", func(c *gin.Context) {
 		h.GetByID(c)
 	})
 
-	router.GET("/recordings/list/:limit", func(c *gin.Context) {
+	public.GET("/recordings", func(c *gin.Context) {
 		h.ListItems(c)
 	})
 
-	router.GET("/recordings/count", func(c *gin.Context) {
+	public.GET("/recordings/count", func(c *gin.Context) {
 		h.GetCount(c)
 	})
 
-	router.GET("/audio/*filepath", func(c *gin.Context) {
+	public.GET("/recordings/search", func(c *gin.Context) {
+		h.Search(c)
+	})
+
+	public.GET("/recordings.geojson", func(c *gin.Context) {
+		h.GeoJSON(c)
+	})
+
+	authenticated := router.Group("", auth.Authenticated())
+
+	authenticated.POST("/recordings", func(c *gin.Context) {
+		h.Create(c)
+	})
+
+	authenticated.PUT("/recordings/:id", func(c *gin.Context) {
+		h.Update(c)
+	})
+
+	authenticated.PATCH("/recordings/:id", func(c *gin.Context) {
+		h.Patch(c)
+	})
+
+	authenticated.DELETE("/recordings/:id", func(c *gin.Context) {
+		h.Delete(c)
+	})
+
+	admin := router.Group("", auth.Admin())
+
+	admin.POST("/recordings/:id/rescan", func(c *gin.Context) {
+		h.Rescan(c)
+	})
+}
+
+func DefineMediaRoutes(router *gin.Engine, h *handlers.MediaHandler, auth *handlers.AuthMiddleware) {
+
+	public := router.Group("", auth.Public())
+
+	public.GET("/recordings/:id/audio", func(c *gin.Context) {
+		h.Audio(c)
+	})
+
+	public.HEAD("/recordings/:id/audio", func(c *gin.Context) {
+		h.Audio(c)
+	})
+
+	public.GET("/recordings/:id/artwork", func(c *gin.Context) {
+		h.Artwork(c)
+	})
+}
+
+func DefineLocationRoutes(router *gin.Engine, h *handlers.LocationHandler, auth *handlers.AuthMiddleware) {
+
+	public := router.Group("", auth.Public())
+
+	public.GET("/locations", func(c *gin.Context) {
+		h.ListItems(c)
+	})
+
+	public.GET("/locations.geojson", func(c *gin.Context) {
+		h.GeoJSON(c)
+	})
+
+	public.GET("/locations/:id", func(c *gin.Context) {
+		h.GetByID(c)
+	})
+
+	authenticated := router.Group("", auth.Authenticated())
+
+	authenticated.POST("/locations", func(c *gin.Context) {
+		h.Create(c)
+	})
+
+	authenticated.PUT("/locations/:id", func(c *gin.Context) {
+		h.Update(c)
+	})
+
+	authenticated.DELETE("/locations/:id", func(c *gin.Context) {
+		h.Delete(c)
+	})
+}
+
+func DefineAuthRoutes(router *gin.Engine, h *handlers.AuthHandler) {
+
+	router.POST("/auth/register", func(c *gin.Context) {
+		h.Register(c)
+	})
+
+	router.POST("/auth/login", func(c *gin.Context) {
+		h.Login(c)
+	})
+
+	router.POST("/auth/refresh", func(c *gin.Context) {
+		h.Refresh(c)
+	})
+
+	router.POST("/auth/logout", func(c *gin.Context) {
+		h.Logout(c)
+	})
+
+	router.GET("/.well-known/jwks.json", func(c *gin.Context) {
+		h.JWKS(c)
+	})
+}
+
+func DefineAPIKeyRoutes(router *gin.Engine, h *handlers.APIKeyHandler, auth *handlers.AuthMiddleware) {
+
+	authenticated := router.Group("", auth.Authenticated())
+
+	authenticated.GET("/api-keys", func(c *gin.Context) {
+		h.ListItems(c)
+	})
+
+	authenticated.POST("/api-keys", func(c *gin.Context) {
+		h.Create(c)
+	})
+
+	authenticated.DELETE("/api-keys/:id", func(c *gin.Context) {
+		h.Revoke(c)
+	})
+}
+
+func DefineTagRoutes(router *gin.Engine, h *handlers.TagHandler, auth *handlers.AuthMiddleware) {
+
+	public := router.Group("", auth.Public())
+
+	public.GET("/tags", func(c *gin.Context) {
+		h.Autocomplete(c)
+	})
+
+	public.GET("/recordings/:id/tags", func(c *gin.Context) {
+		h.ListForRecording(c)
+	})
+
+	authenticated := router.Group("", auth.Authenticated())
+
+	authenticated.POST("/recordings/:id/tags", func(c *gin.Context) {
+		h.Attach(c)
+	})
+
+	authenticated.DELETE("/recordings/:id/tags/:tag", func(c *gin.Context) {
+		h.Detach(c)
+	})
+}
+
+func DefineCollectionRoutes(router *gin.Engine, h *handlers.CollectionHandler, auth *handlers.AuthMiddleware) {
+
+	public := router.Group("", auth.Public())
+
+	public.GET("/collections", func(c *gin.Context) {
+		h.ListItems(c)
+	})
+
+	public.GET("/collections/:id", func(c *gin.Context) {
+		h.GetByID(c)
+	})
+
+	public.GET("/collections/:id/cover", func(c *gin.Context) {
+		h.Cover(c)
+	})
+
+	authenticated := router.Group("", auth.Authenticated())
+
+	authenticated.POST("/collections", func(c *gin.Context) {
+		h.Create(c)
+	})
+
+	authenticated.PUT("/collections/:id", func(c *gin.Context) {
+		h.Update(c)
+	})
 
-		// TODO shift this code to handlers package
-		path := c.Param("filepath")
+	authenticated.DELETE("/collections/:id", func(c *gin.Context) {
+		h.Delete(c)
+	})
 
-		if _, err := os.Stat(path); os.IsNotExist(err) {
-			c.JSON(http.StatusNotFound, gin.H{"error": "file not found"})
-			return
-		}
-		c.File(path)
+	authenticated.PUT("/collections/:id/cover", func(c *gin.Context) {
+		h.SetCover(c)
 	})
+}
+
+// DefineHealthRoutes adds the probes for container orchestration. They need
+// no authentication.
+func DefineHealthRoutes(router *gin.Engine, h *handlers.HealthHandler) {
 
+	router.GET("/healthz", func(c *gin.Context) {
+		h.Live(c)
+	})
+
+	router.GET("/readyz", func(c *gin.Context) {
+		h.Ready(c)
+	})
+}
+
+// DefineMetricsRoutes adds the Prometheus scrape endpoint, guarded by the
+// handler's token rather than user authentication.
+func DefineMetricsRoutes(router *gin.Engine, h *handlers.MetricsHandler) {
+
+	router.GET("/metrics", func(c *gin.Context) {
+		h.Scrape(c)
+	})
 }
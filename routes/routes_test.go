@@ -1,11 +1,29 @@
 package routes
 
 import (
+	"bytes"
 	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"field_archive/server/entities"
 	"field_archive/server/handlers"
+	"field_archive/server/internal/geojson"
+	"field_archive/server/internal/health"
+	"field_archive/server/internal/metrics"
+	"field_archive/server/internal/storage"
+	"field_archive/server/repositories"
+	"field_archive/server/services"
+	"fmt"
+	"io"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -14,28 +32,188 @@ import (
 )
 
 type mockService struct {
-	mockGetByID   func(id int) (entities.Recording, error)
-	mockListItems func(limit int, ctx context.Context) ([]entities.Recording, error)
-	mockGetCount  func(ctx context.Context) (int, error)
+	mockGetByID  func(id int) (entities.Recording, error)
+	mockListPage func(params services.RecordingListParams) (services.Page[entities.Recording], error)
+	mockSearch   func(params services.RecordingSearchParams) (services.Page[entities.RecordingSearchResult], error)
+	mockGetCount func(ctx context.Context) (int, error)
+	mockCreate   func(recording entities.Recording, audio services.Upload, artwork *services.Upload) (int, error)
+	mockUpdate   func(recording entities.Recording) (entities.Recording, error)
+	mockPatch    func(id int, patch services.RecordingPatch) (entities.Recording, error)
+	mockDelete   func(id int) error
+	mockRescan   func(id int) (entities.Recording, error)
+	mockFeatures func() (geojson.FeatureCollection, error)
+}
+
+func (m *mockService) Rescan(id int, ctx context.Context) (entities.Recording, error) {
+	return m.mockRescan(id)
+}
+
+func (m *mockService) FeatureCollection(ctx context.Context) (geojson.FeatureCollection, error) {
+	return m.mockFeatures()
 }
 
 func (m *mockService) GetByID(id int, ctx context.Context) (entities.Recording, error) {
 	return m.mockGetByID(id)
 }
 
-func (m *mockService) ListItems(limit int, ctx context.Context) ([]entities.Recording, error) {
-	return m.mockListItems(limit, ctx)
+func (m *mockService) ListPage(params services.RecordingListParams, ctx context.Context) (services.Page[entities.Recording], error) {
+	return m.mockListPage(params)
+}
+
+func (m *mockService) Search(params services.RecordingSearchParams, ctx context.Context) (services.Page[entities.RecordingSearchResult], error) {
+	return m.mockSearch(params)
 }
 
 func (m *mockService) GetCount(ctx context.Context) (int, error) {
 	return m.mockGetCount(ctx)
 }
 
+func (m *mockService) Create(recording entities.Recording, audio services.Upload, artwork *services.Upload, ctx context.Context) (int, error) {
+	return m.mockCreate(recording, audio, artwork)
+}
+
+func (m *mockService) Update(recording entities.Recording, ctx context.Context) (entities.Recording, error) {
+	return m.mockUpdate(recording)
+}
+
+func (m *mockService) Patch(id int, patch services.RecordingPatch, ctx context.Context) (entities.Recording, error) {
+	return m.mockPatch(id, patch)
+}
+
+func (m *mockService) Delete(id int, ctx context.Context) error {
+	return m.mockDelete(id)
+}
+
+type mockUserService struct {
+	mockRegister func(registration services.Registration) (entities.User, error)
+	mockLogin    func(username, password string) (services.TokenPair, error)
+	mockRefresh  func(refreshToken string) (services.TokenPair, error)
+	mockLogout   func(refreshToken string) error
+}
+
+func (m *mockUserService) Refresh(refreshToken string, ctx context.Context) (services.TokenPair, error) {
+	return m.mockRefresh(refreshToken)
+}
+
+func (m *mockUserService) Logout(refreshToken string, ctx context.Context) error {
+	return m.mockLogout(refreshToken)
+}
+
+func (m *mockUserService) Authenticate(token string, ctx context.Context) (entities.User, error) {
+	switch token {
+	case "user-token":
+		return entities.User{ID: 1, Username: "wren", Role: entities.RoleContributor}, nil
+	case "admin-token":
+		return entities.User{ID: 2, Username: "heron", Role: entities.RoleAdmin}, nil
+	}
+	return entities.User{}, services.ErrInvalidCredentials
+}
+
+func (m *mockUserService) Create(registration services.Registration, role string, ctx context.Context) (entities.User, error) {
+	return entities.User{}, errors.New("not implemented")
+}
+
+func (m *mockUserService) SetRole(username, role string, ctx context.Context) (entities.User, error) {
+	return entities.User{}, errors.New("not implemented")
+}
+
+func (m *mockUserService) Disable(username string, ctx context.Context) (entities.User, error) {
+	return entities.User{}, errors.New("not implemented")
+}
+
+type mockAPIKeyService struct {
+	mockCreate func(name string, scopes []string) (services.NewAPIKey, error)
+	mockList   func() ([]entities.APIKey, error)
+	mockRevoke func(id int) error
+}
+
+func (m *mockAPIKeyService) Create(name string, scopes []string, ctx context.Context) (services.NewAPIKey, error) {
+	return m.mockCreate(name, scopes)
+}
+
+func (m *mockAPIKeyService) List(ctx context.Context) ([]entities.APIKey, error) {
+	return m.mockList()
+}
+
+func (m *mockAPIKeyService) Revoke(id int, ctx context.Context) error {
+	return m.mockRevoke(id)
+}
+
+func (m *mockAPIKeyService) Authenticate(key string, ctx context.Context) (entities.User, entities.APIKey, error) {
+	if key == "fa_device" {
+		return entities.User{ID: 1, Username: "wren", Role: entities.RoleContributor},
+			entities.APIKey{ID: 3, UserID: 1, Scopes: []string{services.ScopeRecordingsWrite}}, nil
+	}
+	return entities.User{}, entities.APIKey{}, services.ErrInvalidCredentials
+}
+
+// testAuth accepts "user-token" for an ordinary user and "admin-token" for an
+// admin, and the API key "fa_device" for the ordinary user.
+func testAuth() *handlers.AuthMiddleware {
+	return handlers.NewAuthMiddleware(&mockUserService{}, &mockAPIKeyService{})
+}
+
+func (m *mockUserService) Register(registration services.Registration, ctx context.Context) (entities.User, error) {
+	return m.mockRegister(registration)
+}
+
+func (m *mockUserService) Login(username, password string, ctx context.Context) (services.TokenPair, error) {
+	return m.mockLogin(username, password)
+}
+
+type mockLocationService struct {
+	mockGetByID   func(id int) (entities.Location, error)
+	mockListItems func(limit int) ([]entities.Location, error)
+	mockCreate    func(location entities.Location) (int, error)
+	mockUpdate    func(location entities.Location) (entities.Location, error)
+	mockDelete    func(id int) error
+	mockFeatures  func() (geojson.FeatureCollection, error)
+	mockBounds    func(minLon, minLat, maxLon, maxLat float64, limit int) ([]entities.NearbyLocation, error)
+	mockRadius    func(lat, lon, radius float64, limit int) ([]entities.NearbyLocation, error)
+	mockNearest   func(lat, lon float64, k int) ([]entities.NearbyLocation, error)
+}
+
+func (m *mockLocationService) WithinBounds(ctx context.Context, minLon, minLat, maxLon, maxLat float64, limit int) ([]entities.NearbyLocation, error) {
+	return m.mockBounds(minLon, minLat, maxLon, maxLat, limit)
+}
+
+func (m *mockLocationService) WithinRadius(ctx context.Context, lat, lon, radius float64, limit int) ([]entities.NearbyLocation, error) {
+	return m.mockRadius(lat, lon, radius, limit)
+}
+
+func (m *mockLocationService) Nearest(ctx context.Context, lat, lon float64, k int) ([]entities.NearbyLocation, error) {
+	return m.mockNearest(lat, lon, k)
+}
+
+func (m *mockLocationService) FeatureCollection(ctx context.Context) (geojson.FeatureCollection, error) {
+	return m.mockFeatures()
+}
+
+func (m *mockLocationService) GetByID(id int, ctx context.Context) (entities.Location, error) {
+	return m.mockGetByID(id)
+}
+
+func (m *mockLocationService) ListItems(limit int, ctx context.Context) ([]entities.Location, error) {
+	return m.mockListItems(limit)
+}
+
+func (m *mockLocationService) Create(location entities.Location, ctx context.Context) (int, error) {
+	return m.mockCreate(location)
+}
+
+func (m *mockLocationService) Update(location entities.Location, ctx context.Context) (entities.Location, error) {
+	return m.mockUpdate(location)
+}
+
+func (m *mockLocationService) Delete(id int, ctx context.Context) error {
+	return m.mockDelete(id)
+}
+
 func TestTestRoute(t *testing.T) {
 	router := gin.Default()
 
 	h := handlers.RecordingHandler{}
-	DefineRoutes(router, &h)
+	DefineRoutes(router, &h, testAuth())
 
 	w := httptest.NewRecorder()
 	req, _ := http.NewRequest("GET", "/test", nil)
@@ -64,6 +242,7 @@ func TestRecordingsGetByIDRoute(t *testing.T) {
 		Size:            2048,
 		Channels:        "2",
 		License:         "Creative Commons",
+		Visibility:      entities.VisibilityPublic,
 	}
 	mockService := &mockService{
 		mockGetByID: func(id int) (entities.Recording, error) {
@@ -71,7 +250,7 @@ func TestRecordingsGetByIDRoute(t *testing.T) {
 		},
 	}
 	h := handlers.RecordingHandler{Service: mockService}
-	DefineRoutes(router, &h)
+	DefineRoutes(router, &h, testAuth())
 
 	w := httptest.NewRecorder()
 	req, _ := http.NewRequest("GET", "/recordings/1", nil)
@@ -93,7 +272,9 @@ func TestRecordingsGetByIDRoute(t *testing.T) {
   "Equipment": "test equipment",
   "Size": 2048,
   "Channels": "2",
-  "License": "Creative Commons"
+  "License": "Creative Commons",
+  "Visibility": "public",
+  "EmbargoUntil": null
 }`, w.Body.String())
 }
 
@@ -117,22 +298,24 @@ func TestListGETRoute(t *testing.T) {
 			Size:            2048,
 			Channels:        "2",
 			License:         "Creative Commons",
+			Visibility:      entities.VisibilityPublic,
 		},
 	}
 	mockService := &mockService{
-		mockListItems: func(limit int, ctx context.Context) ([]entities.Recording, error) {
-			return mockResponse, nil
+		mockListPage: func(params services.RecordingListParams) (services.Page[entities.Recording], error) {
+			assert.Equal(t, 1, params.Limit)
+			return services.Page[entities.Recording]{Items: mockResponse, Total: 1}, nil
 		},
 	}
 	h := handlers.RecordingHandler{Service: mockService}
-	DefineRoutes(router, &h)
+	DefineRoutes(router, &h, testAuth())
 
 	w := httptest.NewRecorder()
-	req, _ := http.NewRequest("GET", "/recordings/list/1", nil)
+	req, _ := http.NewRequest("GET", "/recordings?limit=1", nil)
 	router.ServeHTTP(w, req)
 
 	assert.Equal(t, 200, w.Code)
-	assert.JSONEq(t, `[{
+	assert.JSONEq(t, `{"next_cursor": null, "total": 1, "items": [{
   "ID": 1,
   "Title": "Test Title",
   "AudioLocation": "test/audio/location.mp3",
@@ -147,6 +330,1192 @@ func TestListGETRoute(t *testing.T) {
   "Equipment": "test equipment",
   "Size": 2048,
   "Channels": "2",
-  "License": "Creative Commons"
-}]`, w.Body.String())
+  "License": "Creative Commons",
+  "Visibility": "public",
+  "EmbargoUntil": null
+}]}`, w.Body.String())
+}
+
+func TestListGETRouteParams(t *testing.T) {
+	router := gin.Default()
+
+	mockService := &mockService{
+		mockListPage: func(params services.RecordingListParams) (services.Page[entities.Recording], error) {
+			assert.Equal(t, "title", params.Sort)
+			assert.False(t, params.Desc)
+			assert.Equal(t, services.DefaultPageSize, params.Limit)
+			assert.Equal(t, "abc", params.Cursor)
+			assert.Equal(t, 2, *params.Filter.LocationID)
+			assert.Equal(t, "wav", *params.Filter.Format)
+			assert.Equal(t, 60, *params.Filter.MinDuration)
+			assert.Equal(t, time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC), *params.Filter.RecordedAfter)
+			assert.Nil(t, params.Filter.UserID)
+			assert.Equal(t, []string{"dawn chorus", "hydrophone", "wind"}, params.Filter.Tags)
+			assert.True(t, params.Filter.AllTags)
+			next := "def"
+			return services.Page[entities.Recording]{Items: []entities.Recording{}, NextCursor: &next, Total: 0}, nil
+		},
+	}
+	DefineRoutes(router, &handlers.RecordingHandler{Service: mockService}, testAuth())
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/recordings?sort=title&cursor=abc&location_id=2&format=wav&min_duration=60&recorded_after=2024-05-01"+
+		"&tag=dawn+chorus,hydrophone&tag=wind&tag_match=all", nil)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, 200, w.Code)
+	assert.JSONEq(t, `{"items": [], "next_cursor": "def", "total": 0}`, w.Body.String())
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/recordings?order=up&user_id=me&tag_match=some", nil)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.JSONEq(t, `{"error": "validation failed", "fields": {"order": "must be asc or desc", "user_id": "must be a valid integer", "tag_match": "must be any or all"}}`, w.Body.String())
+}
+
+func multipartBody(t *testing.T, fields map[string]string, files map[string]string) (*bytes.Buffer, string) {
+	body := &bytes.Buffer{}
+	w := multipart.NewWriter(body)
+	for k, v := range fields {
+		if err := w.WriteField(k, v); err != nil {
+			t.Fatalf("error writing field %v", err)
+		}
+	}
+	for field, name := range files {
+		part, err := w.CreateFormFile(field, name)
+		if err != nil {
+			t.Fatalf("error creating form file %v", err)
+		}
+		part.Write([]byte("file contents"))
+	}
+	w.Close()
+	return body, w.FormDataContentType()
+}
+
+func TestRecordingsCreateRoute(t *testing.T) {
+	router := gin.Default()
+
+	var received entities.Recording
+	var audioContents []byte
+	mockService := &mockService{
+		mockCreate: func(recording entities.Recording, audio services.Upload, artwork *services.Upload) (int, error) {
+			received = recording
+			audioContents, _ = io.ReadAll(audio.Content)
+			assert.Equal(t, "dawn.wav", audio.Filename)
+			assert.Nil(t, artwork)
+			return 7, nil
+		},
+	}
+	h := handlers.RecordingHandler{Service: mockService}
+	DefineRoutes(router, &h, testAuth())
+
+	body, contentType := multipartBody(t, map[string]string{
+		"title":          "Dawn Chorus",
+		"recording_date": "2025-01-06",
+		"location_id":    "1",
+		"user_id":        "2",
+		"duration":       "300",
+		"channels":       "2",
+	}, map[string]string{"audio": "dawn.wav"})
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/recordings", body)
+	req.Header.Set("Authorization", "Bearer user-token")
+	req.Header.Set("Content-Type", contentType)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.JSONEq(t, `{"id": 7}`, w.Body.String())
+	assert.Equal(t, "Dawn Chorus", received.Title)
+	assert.Equal(t, time.Date(2025, 1, 6, 0, 0, 0, 0, time.UTC), received.RecordingDate)
+	// The uploader owns the recording, whatever user_id the form claims.
+	assert.Equal(t, 1, received.UserID)
+	assert.Equal(t, 300, received.Duration)
+	assert.Equal(t, "file contents", string(audioContents))
+}
+
+func TestRecordingsCreateRouteValidation(t *testing.T) {
+	router := gin.Default()
+
+	h := handlers.RecordingHandler{Service: &mockService{}}
+	DefineRoutes(router, &h, testAuth())
+
+	body, contentType := multipartBody(t, map[string]string{
+		"title":       "Dawn Chorus",
+		"location_id": "one",
+	}, nil)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/recordings", body)
+	req.Header.Set("Authorization", "Bearer user-token")
+	req.Header.Set("Content-Type", contentType)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.JSONEq(t, `{
+  "error": "validation failed",
+  "fields": {
+    "audio": "an audio file is required",
+    "location_id": "must be a valid integer"
+  }
+}`, w.Body.String())
+}
+
+func TestRecordingsCreateRouteServiceValidation(t *testing.T) {
+	router := gin.Default()
+
+	mockService := &mockService{
+		mockCreate: func(recording entities.Recording, audio services.Upload, artwork *services.Upload) (int, error) {
+			return 0, &services.ValidationError{Fields: map[string]string{"title": "is required"}}
+		},
+	}
+	h := handlers.RecordingHandler{Service: mockService}
+	DefineRoutes(router, &h, testAuth())
+
+	body, contentType := multipartBody(t, nil, map[string]string{"audio": "dawn.wav"})
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/recordings", body)
+	req.Header.Set("Authorization", "Bearer user-token")
+	req.Header.Set("Content-Type", contentType)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.JSONEq(t, `{"error": "validation failed", "fields": {"title": "is required"}}`, w.Body.String())
+}
+
+func TestRecordingsPutRoute(t *testing.T) {
+	router := gin.Default()
+
+	mockService := &mockService{
+		mockUpdate: func(recording entities.Recording) (entities.Recording, error) {
+			assert.Equal(t, 3, recording.ID)
+			assert.Equal(t, "New Title", recording.Title)
+			assert.Equal(t, "", recording.Description)
+			return recording, nil
+		},
+	}
+	h := handlers.RecordingHandler{Service: mockService}
+	DefineRoutes(router, &h, testAuth())
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("PUT", "/recordings/3", strings.NewReader(`{"title": "New Title", "recording_date": "2025-01-06"}`))
+	req.Header.Set("Authorization", "Bearer user-token")
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestRecordingsPatchRoute(t *testing.T) {
+	router := gin.Default()
+
+	mockService := &mockService{
+		mockPatch: func(id int, patch services.RecordingPatch) (entities.Recording, error) {
+			assert.Equal(t, 3, id)
+			assert.Nil(t, patch.Title)
+			if assert.NotNil(t, patch.License) {
+				assert.Equal(t, "CC0", *patch.License)
+			}
+			return entities.Recording{ID: id, License: *patch.License}, nil
+		},
+	}
+	h := handlers.RecordingHandler{Service: mockService}
+	DefineRoutes(router, &h, testAuth())
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("PATCH", "/recordings/3", strings.NewReader(`{"license": "CC0"}`))
+	req.Header.Set("Authorization", "Bearer user-token")
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestRecordingsDeleteRoute(t *testing.T) {
+	router := gin.Default()
+
+	mockService := &mockService{
+		mockDelete: func(id int) error {
+			switch id {
+			case 404:
+				return fmt.Errorf("service: %w", repositories.ErrNotFound)
+			case 403:
+				return fmt.Errorf("%w: delete recording", services.ErrForbidden)
+			}
+			return nil
+		},
+	}
+	h := handlers.RecordingHandler{Service: mockService}
+	DefineRoutes(router, &h, testAuth())
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("DELETE", "/recordings/1", nil)
+	req.Header.Set("Authorization", "Bearer user-token")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("DELETE", "/recordings/404", nil)
+	req.Header.Set("Authorization", "Bearer user-token")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.JSONEq(t, `{"error": "recording not found"}`, w.Body.String())
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("DELETE", "/recordings/403", nil)
+	req.Header.Set("Authorization", "Bearer user-token")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.JSONEq(t, `{"error": "not allowed to change this recording"}`, w.Body.String())
+}
+
+func TestLocationsGetByIDRoute(t *testing.T) {
+	router := gin.Default()
+
+	lon, lat := -0.12, 51.5
+	mockService := &mockLocationService{
+		mockGetByID: func(id int) (entities.Location, error) {
+			return entities.Location{
+				ID:          id,
+				Name:        "Marsh",
+				Description: "Reed beds",
+				Geom:        `{"type":"Point","coordinates":[-0.12,51.5]}`,
+				Longitude:   &lon,
+				Latitude:    &lat,
+				UserID:      1,
+				Sensitivity: entities.SensitivityLow,
+			}, nil
+		},
+	}
+	DefineLocationRoutes(router, &handlers.LocationHandler{Service: mockService}, testAuth())
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/locations/1", nil)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, 200, w.Code)
+	assert.JSONEq(t, `{
+  "ID": 1,
+  "Name": "Marsh",
+  "Description": "Reed beds",
+  "Geom": "{\"type\":\"Point\",\"coordinates\":[-0.12,51.5]}",
+  "Longitude": -0.12,
+  "Latitude": 51.5,
+  "UserID": 1,
+  "Sensitivity": "low"
+}`, w.Body.String())
+}
+
+func TestLocationsListRoute(t *testing.T) {
+	router := gin.Default()
+
+	var gotLimit int
+	mockService := &mockLocationService{
+		mockListItems: func(limit int) ([]entities.Location, error) {
+			gotLimit = limit
+			return []entities.Location{}, nil
+		},
+	}
+	DefineLocationRoutes(router, &handlers.LocationHandler{Service: mockService}, testAuth())
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/locations?limit=5", nil)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, 5, gotLimit)
+	assert.JSONEq(t, `[]`, w.Body.String())
+
+	mockService.mockListItems = func(limit int) ([]entities.Location, error) {
+		verr := &services.ValidationError{}
+		verr.Add("limit", "can't be less than 1")
+		return nil, verr
+	}
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/locations?limit=0", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestLocationsCreateRoute(t *testing.T) {
+	router := gin.Default()
+
+	mockService := &mockLocationService{
+		mockCreate: func(location entities.Location) (int, error) {
+			assert.Equal(t, "Marsh", location.Name)
+			if assert.NotNil(t, location.Latitude) {
+				assert.Equal(t, 51.5, *location.Latitude)
+			}
+			return 9, nil
+		},
+	}
+	DefineLocationRoutes(router, &handlers.LocationHandler{Service: mockService}, testAuth())
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/locations", strings.NewReader(`{"name": "Marsh", "latitude": 51.5, "longitude": -0.12}`))
+	req.Header.Set("Authorization", "Bearer user-token")
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.JSONEq(t, `{"id": 9}`, w.Body.String())
+}
+
+func TestLocationsDeleteRouteNotFound(t *testing.T) {
+	router := gin.Default()
+
+	mockService := &mockLocationService{
+		mockDelete: func(id int) error {
+			return fmt.Errorf("service: %w", repositories.ErrNotFound)
+		},
+	}
+	DefineLocationRoutes(router, &handlers.LocationHandler{Service: mockService}, testAuth())
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("DELETE", "/locations/3", nil)
+	req.Header.Set("Authorization", "Bearer admin-token")
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.JSONEq(t, `{"error": "location not found"}`, w.Body.String())
+}
+
+func TestLocationsDeleteRouteInUse(t *testing.T) {
+	router := gin.Default()
+
+	mockService := &mockLocationService{
+		mockDelete: func(id int) error {
+			return fmt.Errorf("service: %w", repositories.ErrConflict)
+		},
+	}
+	DefineLocationRoutes(router, &handlers.LocationHandler{Service: mockService}, testAuth())
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("DELETE", "/locations/3", nil)
+	req.Header.Set("Authorization", "Bearer admin-token")
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.JSONEq(t, `{"error": "location is still used by recordings"}`, w.Body.String())
+}
+
+func TestLocationsGeoJSONRoute(t *testing.T) {
+	router := gin.Default()
+
+	geom := `{"type":"Point","coordinates":[-0.12,51.5]}`
+	mockService := &mockLocationService{
+		mockFeatures: func() (geojson.FeatureCollection, error) {
+			fc := geojson.NewFeatureCollection()
+			fc.Add(geojson.NewFeature(1, &geom, map[string]any{"name": "Marsh"}))
+			return fc, nil
+		},
+	}
+	DefineLocationRoutes(router, &handlers.LocationHandler{Service: mockService}, testAuth())
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/locations.geojson", nil)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "application/geo+json", w.Header().Get("Content-Type"))
+	assert.JSONEq(t, `{
+  "type": "FeatureCollection",
+  "features": [{"type": "Feature", "id": 1, "geometry": {"type": "Point", "coordinates": [-0.12, 51.5]}, "properties": {"name": "Marsh"}}]
+}`, w.Body.String())
+}
+
+func TestRecordingsGeoJSONRoute(t *testing.T) {
+	router := gin.Default()
+
+	mockService := &mockService{
+		mockFeatures: func() (geojson.FeatureCollection, error) {
+			return geojson.NewFeatureCollection(), nil
+		},
+	}
+	DefineRoutes(router, &handlers.RecordingHandler{Service: mockService}, testAuth())
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/recordings.geojson", nil)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, 200, w.Code)
+	assert.JSONEq(t, `{"type": "FeatureCollection", "features": []}`, w.Body.String())
+}
+
+func TestLocationsSpatialRoutes(t *testing.T) {
+	router := gin.Default()
+
+	distance := 250.0
+	mockService := &mockLocationService{
+		mockBounds: func(minLon, minLat, maxLon, maxLat float64, limit int) ([]entities.NearbyLocation, error) {
+			assert.Equal(t, []float64{-1, 51, 0.5, 52}, []float64{minLon, minLat, maxLon, maxLat})
+			return []entities.NearbyLocation{}, nil
+		},
+		mockRadius: func(lat, lon, radius float64, limit int) ([]entities.NearbyLocation, error) {
+			assert.Equal(t, []float64{51.5, -0.12, 1000}, []float64{lat, lon, radius})
+			return []entities.NearbyLocation{{
+				Location:       entities.Location{ID: 1, Name: "Marsh"},
+				RecordingIDs:   []int{3},
+				DistanceMetres: &distance,
+			}}, nil
+		},
+		mockNearest: func(lat, lon float64, k int) ([]entities.NearbyLocation, error) {
+			assert.Equal(t, 5, k)
+			return []entities.NearbyLocation{}, nil
+		},
+	}
+	DefineLocationRoutes(router, &handlers.LocationHandler{Service: mockService}, testAuth())
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/locations?bbox=-1,51,0.5,52", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/locations?near=51.5,-0.12&radius_m=1000", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+	assert.JSONEq(t, `[{
+  "ID": 1,
+  "Name": "Marsh",
+  "Description": "",
+  "Geom": "",
+  "Longitude": null,
+  "Latitude": null,
+  "UserID": 0,
+  "Sensitivity": "",
+  "RecordingIDs": [3],
+  "DistanceMetres": 250
+}]`, w.Body.String())
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/locations?nearest=51.5,-0.12&k=5", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/locations?near=51.5", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.JSONEq(t, `{
+  "error": "validation failed",
+  "fields": {
+    "near": "must be two comma separated numbers: lat,lon",
+    "radius_m": "is required with near and must be a number"
+  }
+}`, w.Body.String())
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/locations?bbox=-1,51,0.5,52&nearest=51.5,-0.12", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestRecordingsSearchRoute(t *testing.T) {
+	router := gin.Default()
+
+	mockService := &mockService{
+		mockSearch: func(params services.RecordingSearchParams) (services.Page[entities.RecordingSearchResult], error) {
+			assert.Equal(t, "dawn chorus", params.Query)
+			assert.Equal(t, 5, params.Limit)
+			return services.Page[entities.RecordingSearchResult]{
+				Items: []entities.RecordingSearchResult{{
+					Recording: entities.Recording{ID: 3, Title: "Dawn Chorus"},
+					Rank:      0.5,
+					Snippet:   "<mark>Dawn</mark> <mark>Chorus</mark>",
+				}},
+				Total: 1,
+			}, nil
+		},
+	}
+	DefineRoutes(router, &handlers.RecordingHandler{Service: mockService}, testAuth())
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/recordings/search?q=dawn+chorus&limit=5", nil)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, 200, w.Code)
+	assert.Contains(t, w.Body.String(), `"Snippet":"\u003cmark\u003eDawn\u003c/mark\u003e \u003cmark\u003eChorus\u003c/mark\u003e"`)
+	assert.Contains(t, w.Body.String(), `"total":1`)
+}
+
+func TestRecordingsRescanRoute(t *testing.T) {
+	router := gin.Default()
+
+	mockService := &mockService{
+		mockRescan: func(id int) (entities.Recording, error) {
+			return entities.Recording{ID: id, Format: "flac", Duration: 61, Channels: "2"}, nil
+		},
+	}
+	DefineRoutes(router, &handlers.RecordingHandler{Service: mockService}, testAuth())
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/recordings/4/rescan", nil)
+	req.Header.Set("Authorization", "Bearer admin-token")
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, 200, w.Code)
+	assert.Contains(t, w.Body.String(), `"Format":"flac"`)
+	assert.Contains(t, w.Body.String(), `"Duration":61`)
+}
+
+func TestMediaAudioRoute(t *testing.T) {
+	root := t.TempDir()
+	store, _ := storage.NewFilesystem(root)
+	store.Put(context.Background(), "audio/a.flac", strings.NewReader("0123456789"))
+	outside := filepath.Join(t.TempDir(), "secret.wav")
+	os.WriteFile(outside, []byte("secret"), 0o644)
+	os.Symlink(outside, filepath.Join(root, "audio", "link.wav"))
+
+	router := gin.Default()
+	mockService := &mockService{
+		mockGetByID: func(id int) (entities.Recording, error) {
+			switch id {
+			case 1:
+				return entities.Recording{ID: 1, AudioLocation: "audio/a.flac"}, nil
+			case 2:
+				return entities.Recording{ID: 2, AudioLocation: "../" + filepath.Base(filepath.Dir(outside)) + "/secret.wav"}, nil
+			case 3:
+				return entities.Recording{ID: 3, AudioLocation: "audio/link.wav"}, nil
+			case 4:
+				return entities.Recording{ID: 4, AudioLocation: outside}, nil
+			case 6:
+				return entities.Recording{ID: 6, AudioLocation: "audio/a.flac", Visibility: entities.VisibilityPrivate}, nil
+			}
+			return entities.Recording{}, fmt.Errorf("service: %w", repositories.ErrNotFound)
+		},
+	}
+	DefineMediaRoutes(router, handlers.NewMediaHandler(mockService, store), testAuth())
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/recordings/1/audio", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "audio/flac", w.Header().Get("Content-Type"))
+	assert.Equal(t, "bytes", w.Header().Get("Accept-Ranges"))
+	assert.Equal(t, "0123456789", w.Body.String())
+	assert.Equal(t, "no-cache", w.Header().Get("Cache-Control"))
+	etag := w.Header().Get("ETag")
+	assert.NotEmpty(t, etag)
+
+	// Shared caches mustn't keep private recordings.
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/recordings/6/audio", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "private, no-cache", w.Header().Get("Cache-Control"))
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/recordings/1/audio", nil)
+	req.Header.Set("Range", "bytes=2-5")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusPartialContent, w.Code)
+	assert.Equal(t, "bytes 2-5/10", w.Header().Get("Content-Range"))
+	assert.Equal(t, "2345", w.Body.String())
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/recordings/1/audio", nil)
+	req.Header.Set("If-None-Match", etag)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotModified, w.Code)
+
+	for _, path := range []string{"/recordings/2/audio", "/recordings/3/audio", "/recordings/4/audio", "/recordings/5/audio"} {
+		w = httptest.NewRecorder()
+		req, _ = http.NewRequest("GET", path, nil)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusNotFound, w.Code, path)
+		assert.NotContains(t, w.Body.String(), "secret", path)
+	}
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/audio/etc/passwd", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestAuthRoutes(t *testing.T) {
+	router := gin.Default()
+
+	mockService := &mockUserService{
+		mockRegister: func(registration services.Registration) (entities.User, error) {
+			if registration.Username == "taken" {
+				return entities.User{}, fmt.Errorf("service: user %w", repositories.ErrConflict)
+			}
+			return entities.User{
+				ID:           1,
+				Username:     registration.Username,
+				Email:        registration.Email,
+				PasswordHash: "secret hash",
+				Role:         entities.RoleContributor,
+				DateCreated:  time.Date(2025, 1, 6, 20, 2, 57, 0, time.UTC),
+			}, nil
+		},
+		mockLogin: func(username, password string) (services.TokenPair, error) {
+			if password != "correct horse" {
+				return services.TokenPair{}, services.ErrInvalidCredentials
+			}
+			return services.TokenPair{
+				AccessToken:      "a.b.c",
+				AccessExpiresIn:  10 * time.Minute,
+				RefreshToken:     "refresh",
+				RefreshExpiresIn: time.Hour,
+			}, nil
+		},
+	}
+	DefineAuthRoutes(router, handlers.NewAuthHandler(mockService, nil, true))
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/auth/register", strings.NewReader(`{"username": "wren", "email": "wren@example.com", "password": "correct horse"}`))
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.JSONEq(t, `{"ID": 1, "Username": "wren", "Email": "wren@example.com", "Role": "contributor", "DateCreated": "2025-01-06T20:02:57Z", "DisabledAt": null}`, w.Body.String())
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/auth/register", strings.NewReader(`{"username": "taken", "email": "a@example.com", "password": "correct horse"}`))
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.JSONEq(t, `{"error": "user already exists"}`, w.Body.String())
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/auth/login", strings.NewReader(`{"username": "wren", "password": "correct horse"}`))
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"token": "a.b.c", "expires_in": 600, "refresh_token": "refresh", "refresh_expires_in": 3600}`, w.Body.String())
+	cookies := w.Result().Cookies()
+	if assert.Len(t, cookies, 2) {
+		assert.Equal(t, handlers.TokenCookie, cookies[0].Name)
+		assert.Equal(t, "a.b.c", cookies[0].Value)
+		assert.True(t, cookies[0].HttpOnly)
+		assert.True(t, cookies[0].Secure)
+		assert.Equal(t, handlers.RefreshCookie, cookies[1].Name)
+		assert.Equal(t, "/auth", cookies[1].Path)
+	}
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/auth/login", strings.NewReader(`{"username": "wren", "password": "nope"}`))
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/auth/login", strings.NewReader(`not json`))
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestAuthMiddleware(t *testing.T) {
+	router := gin.Default()
+
+	mockService := &mockService{
+		mockGetByID: func(id int) (entities.Recording, error) {
+			return entities.Recording{ID: id}, nil
+		},
+		mockDelete: func(id int) error {
+			return nil
+		},
+		mockRescan: func(id int) (entities.Recording, error) {
+			return entities.Recording{ID: id}, nil
+		},
+	}
+	DefineRoutes(router, &handlers.RecordingHandler{Service: mockService}, testAuth())
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		header string
+		cookie string
+		code   int
+		body   string
+	}{
+		{"public without token", "GET", "/recordings/1", "", "", http.StatusOK, ""},
+		{"public ignores bad token", "GET", "/recordings/1", "Bearer stale", "", http.StatusOK, ""},
+		{"no token", "DELETE", "/recordings/1", "", "", http.StatusUnauthorized, `{"error": "authentication required"}`},
+		{"bad token", "DELETE", "/recordings/1", "Bearer stale", "", http.StatusUnauthorized, `{"error": "invalid or expired token"}`},
+		{"wrong scheme", "DELETE", "/recordings/1", "Basic user-token", "", http.StatusUnauthorized, `{"error": "invalid or expired token"}`},
+		{"bearer token", "DELETE", "/recordings/1", "Bearer user-token", "", http.StatusNoContent, ""},
+		{"cookie", "DELETE", "/recordings/1", "", "user-token", http.StatusNoContent, ""},
+		{"admin route as user", "POST", "/recordings/1/rescan", "Bearer user-token", "", http.StatusForbidden, `{"error": "admin access required"}`},
+		{"admin route without token", "POST", "/recordings/1/rescan", "", "", http.StatusUnauthorized, `{"error": "authentication required"}`},
+		{"admin route as admin", "POST", "/recordings/1/rescan", "Bearer admin-token", "", http.StatusOK, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest(tt.method, tt.path, nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			if tt.cookie != "" {
+				req.AddCookie(&http.Cookie{Name: handlers.TokenCookie, Value: tt.cookie})
+			}
+			router.ServeHTTP(w, req)
+			assert.Equal(t, tt.code, w.Code)
+			if tt.body != "" {
+				assert.JSONEq(t, tt.body, w.Body.String())
+			}
+			if tt.code == http.StatusUnauthorized {
+				assert.NotEmpty(t, w.Header().Get("WWW-Authenticate"))
+			}
+		})
+	}
+}
+
+func TestAPIKeyAuth(t *testing.T) {
+	router := gin.Default()
+
+	mockService := &mockService{
+		mockDelete: func(id int) error {
+			return nil
+		},
+	}
+	DefineRoutes(router, &handlers.RecordingHandler{Service: mockService}, testAuth())
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("DELETE", "/recordings/1", nil)
+	req.Header.Set(handlers.APIKeyHeader, "fa_device")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	// The key is used even if a token is sent too.
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("DELETE", "/recordings/1", nil)
+	req.Header.Set(handlers.APIKeyHeader, "fa_revoked")
+	req.Header.Set("Authorization", "Bearer user-token")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.JSONEq(t, `{"error": "invalid or revoked api key"}`, w.Body.String())
+}
+
+func TestAPIKeyRoutes(t *testing.T) {
+	router := gin.Default()
+
+	created := time.Date(2025, 1, 6, 20, 2, 57, 0, time.UTC)
+	mockKeys := &mockAPIKeyService{
+		mockCreate: func(name string, scopes []string) (services.NewAPIKey, error) {
+			if name == "" {
+				verr := &services.ValidationError{}
+				verr.Add("name", "is required")
+				return services.NewAPIKey{}, verr
+			}
+			return services.NewAPIKey{
+				APIKey: entities.APIKey{ID: 3, UserID: 1, Name: name, Prefix: "fa_abcdefgh", KeyHash: "hash", Scopes: scopes, DateCreated: created},
+				Key:    "fa_abcdefghsecret",
+			}, nil
+		},
+		mockList: func() ([]entities.APIKey, error) {
+			return []entities.APIKey{{ID: 3, UserID: 1, Name: "recorder", Prefix: "fa_abcdefgh", KeyHash: "hash", Scopes: []string{}, DateCreated: created}}, nil
+		},
+		mockRevoke: func(id int) error {
+			if id != 3 {
+				return fmt.Errorf("service: %w", repositories.ErrNotFound)
+			}
+			return nil
+		},
+	}
+	DefineAPIKeyRoutes(router, handlers.NewAPIKeyHandler(mockKeys), testAuth())
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/api-keys", strings.NewReader(`{"name": "recorder", "scopes": ["recordings:write"]}`))
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/api-keys", strings.NewReader(`{"name": "recorder", "scopes": ["recordings:write"]}`))
+	req.Header.Set("Authorization", "Bearer user-token")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.JSONEq(t, `{"ID": 3, "UserID": 1, "Name": "recorder", "Prefix": "fa_abcdefgh", "Scopes": ["recordings:write"],
+		"DateCreated": "2025-01-06T20:02:57Z", "LastUsedAt": null, "RevokedAt": null, "Key": "fa_abcdefghsecret"}`, w.Body.String())
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/api-keys", strings.NewReader(`{"scopes": []}`))
+	req.Header.Set("Authorization", "Bearer user-token")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/api-keys", nil)
+	req.Header.Set("Authorization", "Bearer user-token")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), "hash")
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("DELETE", "/api-keys/3", nil)
+	req.Header.Set("Authorization", "Bearer user-token")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("DELETE", "/api-keys/4", nil)
+	req.Header.Set("Authorization", "Bearer user-token")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.JSONEq(t, `{"error": "api key not found"}`, w.Body.String())
+}
+
+func TestAuthRefreshAndLogoutRoutes(t *testing.T) {
+	router := gin.Default()
+
+	var loggedOut []string
+	mockService := &mockUserService{
+		mockRefresh: func(refreshToken string) (services.TokenPair, error) {
+			if refreshToken != "refresh" {
+				return services.TokenPair{}, services.ErrInvalidCredentials
+			}
+			return services.TokenPair{AccessToken: "d.e.f", AccessExpiresIn: time.Minute, RefreshToken: "next", RefreshExpiresIn: time.Hour}, nil
+		},
+		mockLogout: func(refreshToken string) error {
+			loggedOut = append(loggedOut, refreshToken)
+			return nil
+		},
+	}
+	DefineAuthRoutes(router, handlers.NewAuthHandler(mockService, nil, false))
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/auth/refresh", strings.NewReader(`{"refresh_token": "refresh"}`))
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"token": "d.e.f", "expires_in": 60, "refresh_token": "next", "refresh_expires_in": 3600}`, w.Body.String())
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/auth/refresh", nil)
+	req.AddCookie(&http.Cookie{Name: handlers.RefreshCookie, Value: "refresh"})
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/auth/refresh", strings.NewReader(`{"refresh_token": "reused"}`))
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/auth/refresh", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/auth/logout", nil)
+	req.AddCookie(&http.Cookie{Name: handlers.RefreshCookie, Value: "next"})
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, []string{"next"}, loggedOut)
+	for _, cookie := range w.Result().Cookies() {
+		assert.Empty(t, cookie.Value)
+		assert.Negative(t, cookie.MaxAge)
+	}
+}
+
+func TestJWKSRoute(t *testing.T) {
+	router := gin.Default()
+
+	_, key, _ := ed25519.GenerateKey(rand.Reader)
+	keys, _ := services.NewSigningKeys(key)
+	DefineAuthRoutes(router, handlers.NewAuthHandler(&mockUserService{}, keys, true))
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/.well-known/jwks.json", nil)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var set services.JWKSet
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &set))
+	if assert.Len(t, set.Keys, 1) {
+		assert.Equal(t, "OKP", set.Keys[0].Kty)
+		assert.Equal(t, "EdDSA", set.Keys[0].Alg)
+		assert.Equal(t, base64.RawURLEncoding.EncodeToString(key.Public().(ed25519.PublicKey)), set.Keys[0].X)
+	}
+}
+
+type mockTagService struct {
+	mockListForRecording func(recordingID int) ([]string, error)
+	mockAttach           func(recordingID int, name string) ([]string, error)
+	mockDetach           func(recordingID int, name string) error
+	mockAutocomplete     func(prefix string, limit int) ([]entities.Tag, error)
+}
+
+func (m *mockTagService) ListForRecording(recordingID int, ctx context.Context) ([]string, error) {
+	return m.mockListForRecording(recordingID)
+}
+
+func (m *mockTagService) Attach(recordingID int, name string, ctx context.Context) ([]string, error) {
+	return m.mockAttach(recordingID, name)
+}
+
+func (m *mockTagService) Detach(recordingID int, name string, ctx context.Context) error {
+	return m.mockDetach(recordingID, name)
+}
+
+func (m *mockTagService) Autocomplete(prefix string, limit int, ctx context.Context) ([]entities.Tag, error) {
+	return m.mockAutocomplete(prefix, limit)
+}
+
+func TestTagRoutes(t *testing.T) {
+	router := gin.Default()
+
+	mockTags := &mockTagService{
+		mockAutocomplete: func(prefix string, limit int) ([]entities.Tag, error) {
+			assert.Equal(t, "da", prefix)
+			assert.Equal(t, 10, limit)
+			return []entities.Tag{{Name: "dawn chorus", Count: 4}}, nil
+		},
+		mockListForRecording: func(recordingID int) ([]string, error) {
+			return []string{"dawn chorus"}, nil
+		},
+		mockAttach: func(recordingID int, name string) ([]string, error) {
+			assert.Equal(t, 2, recordingID)
+			return []string{"dawn chorus", name}, nil
+		},
+		mockDetach: func(recordingID int, name string) error {
+			if name != "dawn chorus" {
+				return fmt.Errorf("tag %q %w", name, repositories.ErrNotFound)
+			}
+			return nil
+		},
+	}
+	DefineTagRoutes(router, &handlers.TagHandler{Service: mockTags}, testAuth())
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/tags?prefix=da", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+	assert.JSONEq(t, `[{"Name": "dawn chorus", "Count": 4}]`, w.Body.String())
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/recordings/2/tags", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+	assert.JSONEq(t, `["dawn chorus"]`, w.Body.String())
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/recordings/2/tags", strings.NewReader(`{"name": "hydrophone"}`))
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/recordings/2/tags", strings.NewReader(`{"name": "hydrophone"}`))
+	req.Header.Set("Authorization", "Bearer user-token")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+	assert.JSONEq(t, `["dawn chorus", "hydrophone"]`, w.Body.String())
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("DELETE", "/recordings/2/tags/dawn%20chorus", nil)
+	req.Header.Set("Authorization", "Bearer user-token")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("DELETE", "/recordings/2/tags/wind", nil)
+	req.Header.Set("Authorization", "Bearer user-token")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.JSONEq(t, `{"error": "tag not found"}`, w.Body.String())
+}
+
+type mockCollectionService struct {
+	mockGetByID   func(id int) (entities.CollectionWithRecordings, error)
+	mockListItems func(limit int) ([]entities.Collection, error)
+	mockCreate    func(collection entities.Collection) (int, error)
+	mockUpdate    func(collection entities.Collection) (entities.CollectionWithRecordings, error)
+	mockDelete    func(id int) error
+	mockSetCover  func(id int, cover services.Upload) (entities.Collection, error)
+}
+
+func (m *mockCollectionService) GetByID(id int, ctx context.Context) (entities.CollectionWithRecordings, error) {
+	return m.mockGetByID(id)
+}
+
+func (m *mockCollectionService) ListItems(limit int, ctx context.Context) ([]entities.Collection, error) {
+	return m.mockListItems(limit)
+}
+
+func (m *mockCollectionService) Create(collection entities.Collection, ctx context.Context) (int, error) {
+	return m.mockCreate(collection)
+}
+
+func (m *mockCollectionService) Update(collection entities.Collection, ctx context.Context) (entities.CollectionWithRecordings, error) {
+	return m.mockUpdate(collection)
+}
+
+func (m *mockCollectionService) Delete(id int, ctx context.Context) error {
+	return m.mockDelete(id)
+}
+
+func (m *mockCollectionService) SetCover(id int, cover services.Upload, ctx context.Context) (entities.Collection, error) {
+	return m.mockSetCover(id, cover)
+}
+
+func TestCollectionRoutes(t *testing.T) {
+	store, _ := storage.NewFilesystem(t.TempDir())
+	store.Put(context.Background(), "covers/a.png", strings.NewReader("png"))
+	created := time.Date(2025, 1, 6, 20, 2, 57, 0, time.UTC)
+	cover := "covers/a.png"
+	collection := entities.CollectionWithRecordings{
+		Collection: entities.Collection{
+			ID:            2,
+			Title:         "Dawn walk",
+			CoverLocation: &cover,
+			UserID:        1,
+			Visibility:    entities.VisibilityPrivate,
+			DateCreated:   created,
+			RecordingIDs:  []int{3},
+		},
+		Recordings: []entities.RecordingSummary{{ID: 3, Title: "Blackbird", RecordingDate: created, Duration: 60, Format: "wav", LocationID: 1, UserID: 1}},
+	}
+	mockCollections := &mockCollectionService{
+		mockGetByID: func(id int) (entities.CollectionWithRecordings, error) {
+			if id != 2 {
+				return entities.CollectionWithRecordings{}, fmt.Errorf("collection with id %d %w", id, repositories.ErrNotFound)
+			}
+			return collection, nil
+		},
+		mockCreate: func(c entities.Collection) (int, error) {
+			assert.Equal(t, []int{3, 1}, c.RecordingIDs)
+			return 2, nil
+		},
+		mockUpdate: func(c entities.Collection) (entities.CollectionWithRecordings, error) {
+			assert.Nil(t, c.RecordingIDs)
+			return entities.CollectionWithRecordings{}, fmt.Errorf("%w: update collection", services.ErrForbidden)
+		},
+		mockSetCover: func(id int, cover services.Upload) (entities.Collection, error) {
+			assert.Equal(t, "cover.png", cover.Filename)
+			return collection.Collection, nil
+		},
+	}
+	router := gin.Default()
+	DefineCollectionRoutes(router, handlers.NewCollectionHandler(mockCollections, store, 0), testAuth())
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/collections/2", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+	assert.JSONEq(t, `{
+  "ID": 2,
+  "Title": "Dawn walk",
+  "Description": "",
+  "CoverLocation": "covers/a.png",
+  "UserID": 1,
+  "Visibility": "private",
+  "DateCreated": "2025-01-06T20:02:57Z",
+  "RecordingIDs": [3],
+  "Recordings": [{"ID": 3, "Title": "Blackbird", "RecordingDate": "2025-01-06T20:02:57Z", "Duration": 60, "Format": "wav", "LocationID": 1, "UserID": 1}]
+}`, w.Body.String())
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/collections/5", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.JSONEq(t, `{"error": "collection not found"}`, w.Body.String())
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/collections/2/cover", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "png", w.Body.String())
+	assert.Equal(t, "private, no-cache", w.Header().Get("Cache-Control"))
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/collections", strings.NewReader(`{"title": "Dawn walk", "recording_ids": [3, 1]}`))
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/collections", strings.NewReader(`{"title": "Dawn walk", "recording_ids": [3, 1]}`))
+	req.Header.Set("Authorization", "Bearer user-token")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.JSONEq(t, `{"id": 2}`, w.Body.String())
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("PUT", "/collections/2", strings.NewReader(`{"title": "Mine now"}`))
+	req.Header.Set("Authorization", "Bearer user-token")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.JSONEq(t, `{"error": "not allowed to change this collection"}`, w.Body.String())
+
+	body, contentType := multipartBody(t, nil, map[string]string{"cover": "cover.png"})
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("PUT", "/collections/2/cover", body)
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("Authorization", "Bearer user-token")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+
+	body, contentType = multipartBody(t, map[string]string{"title": "x"}, nil)
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("PUT", "/collections/2/cover", body)
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("Authorization", "Bearer user-token")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.JSONEq(t, `{"error": "validation failed", "fields": {"cover": "a cover image is required"}}`, w.Body.String())
+}
+
+func TestHealthRoutes(t *testing.T) {
+	router := gin.Default()
+	failing := errors.New("connection refused")
+	checks := []health.Check{
+		{Name: "database", Check: func(ctx context.Context) error { return nil }},
+		{Name: "storage", Check: func(ctx context.Context) error { return failing }},
+	}
+	DefineHealthRoutes(router, handlers.NewHealthHandler(health.New(checks...)))
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/healthz", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"Status": "ok"}`, w.Body.String())
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/readyz", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+	assert.JSONEq(t, `{"Status": "failing", "Checks": {
+		"database": {"Status": "ok"},
+		"storage": {"Status": "failing"}
+	}}`, w.Body.String())
+
+	checks[1].Check = func(ctx context.Context) error { return nil }
+	router = gin.Default()
+	DefineHealthRoutes(router, handlers.NewHealthHandler(health.New(checks...)))
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/readyz", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"Status": "ok", "Checks": {"database": {"Status": "ok"}, "storage": {"Status": "ok"}}}`, w.Body.String())
+}
+
+func TestMetricsRoutes(t *testing.T) {
+	m := metrics.New()
+	router := gin.Default()
+	router.Use(m.Middleware())
+	DefineHealthRoutes(router, handlers.NewHealthHandler(health.New()))
+	DefineMetricsRoutes(router, handlers.NewMetricsHandler(m, "scrape-secret"))
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/healthz", nil)
+	router.ServeHTTP(w, req)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/metrics", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/metrics", nil)
+	req.Header.Set("Authorization", "Bearer wrong")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/metrics", nil)
+	req.Header.Set("Authorization", "Bearer scrape-secret")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `http_requests_total{method="GET",route="/healthz",status="200"} 1`)
+	assert.Contains(t, w.Body.String(), `http_requests_total{method="GET",route="/metrics",status="401"} 2`)
 }
@@ -0,0 +1,180 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"field_archive/server/entities"
+	"field_archive/server/repositories"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"time"
+)
+
+type APIKeyService interface {
+	Create(name string, scopes []string, ctx context.Context) (NewAPIKey, error)
+	List(ctx context.Context) ([]entities.APIKey, error)
+	Revoke(id int, ctx context.Context) error
+	Authenticate(key string, ctx context.Context) (entities.User, entities.APIKey, error)
+}
+
+// NewAPIKey is a key that has just been created. Key is the only time the
+// key itself is available; afterwards only its hash is kept.
+type NewAPIKey struct {
+	entities.APIKey
+	Key string
+}
+
+// Scopes an API key can be limited to. A key with no scopes can do anything
+// its owner can.
+const (
+	ScopeRecordingsWrite  = "recordings:write"
+	ScopeLocationsWrite   = "locations:write"
+	ScopeCollectionsWrite = "collections:write"
+	ScopeKeysWrite        = "keys:write"
+)
+
+var apiKeyScopes = []string{ScopeRecordingsWrite, ScopeLocationsWrite, ScopeCollectionsWrite, ScopeKeysWrite}
+
+const (
+	// apiKeyPrefix marks API keys so they're recognisable in config files
+	// and secret scanners.
+	apiKeyPrefix = "fa_"
+	// apiKeyShownPrefix is how much of a key is kept to tell keys apart.
+	apiKeyShownPrefix = len(apiKeyPrefix) + 8
+	maxAPIKeyName     = 100
+	// apiKeyTouchInterval limits how often a key's last used time is
+	// written, so a busy device doesn't update its row on every request.
+	apiKeyTouchInterval = time.Minute
+)
+
+type apiKeyService struct {
+	repo  repositories.APIKeyRepository
+	users repositories.UserRepository
+}
+
+func NewAPIKeyService(repo repositories.APIKeyRepository, users repositories.UserRepository) *apiKeyService {
+	return &apiKeyService{repo: repo, users: users}
+}
+
+// Create makes a new key for the acting user. Made with a scoped key, the
+// new key must be scoped to some of the same scopes, as an unscoped one
+// could do anything its owner can.
+func (s *apiKeyService) Create(name string, scopes []string, ctx context.Context) (NewAPIKey, error) {
+	user := UserFrom(ctx)
+	if err := requireScope(ctx, ScopeKeysWrite); err != nil {
+		return NewAPIKey{}, err
+	}
+	if user.ID < 1 {
+		return NewAPIKey{}, fmt.Errorf("%w: create api key", ErrForbidden)
+	}
+	name = strings.TrimSpace(name)
+	verr := &ValidationError{}
+	if name == "" {
+		verr.Add("name", "is required")
+	} else if len(name) > maxAPIKeyName {
+		verr.Add("name", fmt.Sprintf("can't be longer than %d characters", maxAPIKeyName))
+	}
+	cleaned := []string{}
+	for _, scope := range scopes {
+		if !slices.Contains(apiKeyScopes, scope) {
+			verr.Add("scopes", fmt.Sprintf("unknown scope %q, expected one of %s", scope, strings.Join(apiKeyScopes, ", ")))
+		} else if !slices.Contains(cleaned, scope) {
+			cleaned = append(cleaned, scope)
+		}
+	}
+	if verr.HasErrors() {
+		return NewAPIKey{}, verr
+	}
+	if caller, ok := ctx.Value(apiKeyContextKey{}).(entities.APIKey); ok && len(caller.Scopes) > 0 {
+		if len(cleaned) == 0 {
+			return NewAPIKey{}, fmt.Errorf("%w: a scoped api key can't create an unscoped one", ErrForbidden)
+		}
+		for _, scope := range cleaned {
+			if !slices.Contains(caller.Scopes, scope) {
+				return NewAPIKey{}, fmt.Errorf("%w: api key lacks the %s scope to grant it", ErrForbidden, scope)
+			}
+		}
+	}
+
+	secret, err := randomToken(32)
+	if err != nil {
+		return NewAPIKey{}, fmt.Errorf("service: problem creating api key, %w", err)
+	}
+	key := apiKeyPrefix + secret
+	stored := entities.APIKey{
+		UserID:  user.ID,
+		Name:    name,
+		Prefix:  key[:apiKeyShownPrefix],
+		KeyHash: hashToken(key),
+		Scopes:  cleaned,
+	}
+	id, err := s.repo.Insert(stored, ctx)
+	if err != nil {
+		return NewAPIKey{}, fmt.Errorf("service: problem inserting api key, %w", err)
+	}
+	stored, err = s.repo.GetRowByID(id, ctx)
+	if err != nil {
+		return NewAPIKey{}, fmt.Errorf("service: problem retrieving api key, %w", err)
+	}
+	return NewAPIKey{APIKey: stored, Key: key}, nil
+}
+
+// List returns the acting user's keys.
+func (s *apiKeyService) List(ctx context.Context) ([]entities.APIKey, error) {
+	keys, err := s.repo.ListByUser(UserFrom(ctx).ID, ctx)
+	if err != nil {
+		return nil, fmt.Errorf("service: problem retrieving api keys, %w", err)
+	}
+	return keys, nil
+}
+
+// Revoke revokes one of the acting user's keys.
+func (s *apiKeyService) Revoke(id int, ctx context.Context) error {
+	if err := requireScope(ctx, ScopeKeysWrite); err != nil {
+		return err
+	}
+	if err := s.repo.Revoke(id, UserFrom(ctx).ID, ctx); err != nil {
+		return fmt.Errorf("service: problem revoking api key, %w", err)
+	}
+	return nil
+}
+
+// Authenticate returns the user key belongs to along with the key itself,
+// whose scopes limit what the request may do. Unknown and revoked keys, and
+// keys of disabled users, give ErrInvalidCredentials.
+func (s *apiKeyService) Authenticate(key string, ctx context.Context) (entities.User, entities.APIKey, error) {
+	if !strings.HasPrefix(key, apiKeyPrefix) {
+		return entities.User{}, entities.APIKey{}, ErrInvalidCredentials
+	}
+	stored, err := s.repo.GetByHash(hashToken(key), ctx)
+	if errors.Is(err, repositories.ErrNotFound) {
+		return entities.User{}, entities.APIKey{}, ErrInvalidCredentials
+	}
+	if err != nil {
+		return entities.User{}, entities.APIKey{}, fmt.Errorf("service: problem retrieving api key, %w", err)
+	}
+	if stored.RevokedAt != nil {
+		return entities.User{}, entities.APIKey{}, fmt.Errorf("%w: api key revoked", ErrInvalidCredentials)
+	}
+	user, err := s.users.GetRowByID(stored.UserID, ctx)
+	if errors.Is(err, repositories.ErrNotFound) {
+		return entities.User{}, entities.APIKey{}, ErrInvalidCredentials
+	}
+	if err != nil {
+		return entities.User{}, entities.APIKey{}, fmt.Errorf("service: problem retrieving user, %w", err)
+	}
+	if user.DisabledAt != nil {
+		return entities.User{}, entities.APIKey{}, fmt.Errorf("%w: user disabled", ErrInvalidCredentials)
+	}
+	now := time.Now()
+	if stored.LastUsedAt == nil || now.Sub(*stored.LastUsedAt) > apiKeyTouchInterval {
+		if err := s.repo.Touch(stored.ID, ctx); err != nil {
+			log.Printf("unable to record use of api key %d: %v", stored.ID, err)
+		} else {
+			stored.LastUsedAt = &now
+		}
+	}
+	return user, stored, nil
+}
@@ -0,0 +1,161 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"field_archive/server/entities"
+	"field_archive/server/repositories"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type mockAPIKeyRepo struct {
+	keys    []entities.APIKey
+	touched int
+}
+
+func (m *mockAPIKeyRepo) Insert(key entities.APIKey, ctx context.Context) (int, error) {
+	key.ID = len(m.keys) + 1
+	key.DateCreated = time.Now()
+	m.keys = append(m.keys, key)
+	return key.ID, nil
+}
+
+func (m *mockAPIKeyRepo) GetRowByID(id int, ctx context.Context) (entities.APIKey, error) {
+	if id < 1 || id > len(m.keys) {
+		return entities.APIKey{}, fmt.Errorf("api key with id %d %w", id, repositories.ErrNotFound)
+	}
+	return m.keys[id-1], nil
+}
+
+func (m *mockAPIKeyRepo) GetByHash(hash string, ctx context.Context) (entities.APIKey, error) {
+	for _, key := range m.keys {
+		if key.KeyHash == hash {
+			return key, nil
+		}
+	}
+	return entities.APIKey{}, fmt.Errorf("api key %w", repositories.ErrNotFound)
+}
+
+func (m *mockAPIKeyRepo) ListByUser(userID int, ctx context.Context) ([]entities.APIKey, error) {
+	res := []entities.APIKey{}
+	for _, key := range m.keys {
+		if key.UserID == userID {
+			res = append(res, key)
+		}
+	}
+	return res, nil
+}
+
+func (m *mockAPIKeyRepo) Revoke(id, userID int, ctx context.Context) error {
+	if id < 1 || id > len(m.keys) || m.keys[id-1].UserID != userID || m.keys[id-1].RevokedAt != nil {
+		return fmt.Errorf("api key with id %d %w", id, repositories.ErrNotFound)
+	}
+	now := time.Now()
+	m.keys[id-1].RevokedAt = &now
+	return nil
+}
+
+func (m *mockAPIKeyRepo) Touch(id int, ctx context.Context) error {
+	now := time.Now()
+	m.keys[id-1].LastUsedAt = &now
+	m.touched++
+	return nil
+}
+
+func TestAPIKeyLifecycle(t *testing.T) {
+	users := &mockUserRepo{}
+	users.Insert(entities.User{Username: "wren", Role: entities.RoleContributor}, context.Background())
+	users.Insert(entities.User{Username: "heron", Role: entities.RoleContributor}, context.Background())
+	repo := &mockAPIKeyRepo{}
+	s := NewAPIKeyService(repo, users)
+	ctx := actingAs(1, entities.RoleContributor)
+
+	created, err := s.Create(" recorder ", []string{ScopeRecordingsWrite, ScopeRecordingsWrite}, ctx)
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(created.Key, "fa_"))
+	assert.Equal(t, created.Key[:len(created.Prefix)], created.Prefix)
+	assert.Equal(t, "recorder", created.Name)
+	assert.Equal(t, []string{ScopeRecordingsWrite}, created.Scopes)
+	assert.NotContains(t, created.KeyHash, created.Key)
+
+	user, key, err := s.Authenticate(created.Key, context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, "wren", user.Username)
+	assert.Equal(t, created.ID, key.ID)
+	assert.NotNil(t, key.LastUsedAt)
+
+	// Uses within a minute of each other are only recorded once.
+	_, _, err = s.Authenticate(created.Key, context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, repo.touched)
+
+	// Keys stop working while their owner is disabled.
+	users.Disable(1, context.Background())
+	_, _, err = s.Authenticate(created.Key, context.Background())
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+	wren := users.users["wren"]
+	wren.DisabledAt = nil
+	users.users["wren"] = wren
+
+	keys, err := s.List(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, keys, 1)
+	keys, err = s.List(actingAs(2, entities.RoleContributor))
+	assert.NoError(t, err)
+	assert.Empty(t, keys)
+
+	// Only the owner can revoke a key.
+	assert.ErrorIs(t, s.Revoke(created.ID, actingAs(2, entities.RoleContributor)), repositories.ErrNotFound)
+	assert.NoError(t, s.Revoke(created.ID, ctx))
+	_, _, err = s.Authenticate(created.Key, context.Background())
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+
+	_, _, err = s.Authenticate("fa_unknown", context.Background())
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+	_, _, err = s.Authenticate("not a key", context.Background())
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+}
+
+func TestCreateAPIKeyValidation(t *testing.T) {
+	s := NewAPIKeyService(&mockAPIKeyRepo{}, &mockUserRepo{})
+
+	_, err := s.Create("", []string{"everything"}, actingAs(1, entities.RoleContributor))
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("expected a validation error, got %v", err)
+	}
+	assert.Contains(t, verr.Fields, "name")
+	assert.Contains(t, verr.Fields, "scopes")
+
+	_, err = s.Create("recorder", nil, context.Background())
+	assert.ErrorIs(t, err, ErrForbidden)
+}
+
+func TestAPIKeyScopes(t *testing.T) {
+	scoped := WithAPIKey(actingAs(1, entities.RoleCurator), entities.APIKey{Scopes: []string{ScopeRecordingsWrite}})
+	unscoped := WithAPIKey(actingAs(1, entities.RoleCurator), entities.APIKey{Scopes: []string{}})
+
+	assert.NoError(t, authorizeRecording(scoped, ActionDelete, entities.Recording{}))
+	assert.ErrorIs(t, authorizeLocation(scoped, ActionDelete), ErrForbidden)
+	assert.NoError(t, authorizeLocation(unscoped, ActionDelete))
+
+	// A key can't be used to mint keys wider than itself.
+	s := NewAPIKeyService(&mockAPIKeyRepo{}, &mockUserRepo{})
+	_, err := s.Create("more", nil, scoped)
+	assert.ErrorIs(t, err, ErrForbidden)
+	_, err = s.Create("more", nil, unscoped)
+	assert.NoError(t, err)
+
+	keysOnly := WithAPIKey(actingAs(1, entities.RoleCurator), entities.APIKey{Scopes: []string{ScopeKeysWrite}})
+	_, err = s.Create("everything", []string{}, keysOnly)
+	assert.ErrorIs(t, err, ErrForbidden)
+	_, err = s.Create("recordings", []string{ScopeRecordingsWrite}, keysOnly)
+	assert.ErrorIs(t, err, ErrForbidden)
+	_, err = s.Create("keys", []string{ScopeKeysWrite}, keysOnly)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,231 @@
+package services
+
+import (
+	"context"
+	"field_archive/server/entities"
+	"field_archive/server/internal/storage"
+	"field_archive/server/repositories"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+type CollectionService interface {
+	GetByID(id int, ctx context.Context) (entities.CollectionWithRecordings, error)
+	ListItems(limit int, ctx context.Context) ([]entities.Collection, error)
+	Create(collection entities.Collection, ctx context.Context) (int, error)
+	Update(collection entities.Collection, ctx context.Context) (entities.CollectionWithRecordings, error)
+	Delete(id int, ctx context.Context) error
+	SetCover(id int, cover Upload, ctx context.Context) (entities.Collection, error)
+}
+
+// MaxCollectionSize caps the number of recordings in a collection.
+const MaxCollectionSize = 500
+
+type collectionService struct {
+	repo       repositories.CollectionRepository
+	recordings repositories.RecordingRepository
+	store      storage.Blob
+}
+
+func NewCollectionService(repo repositories.CollectionRepository, recordings repositories.RecordingRepository, store storage.Blob) *collectionService {
+	return &collectionService{repo: repo, recordings: recordings, store: store}
+}
+
+// GetByID returns the collection with summaries of the recordings in it that
+// the acting user can see.
+func (s *collectionService) GetByID(id int, ctx context.Context) (entities.CollectionWithRecordings, error) {
+	collection, err := s.get(id, ctx)
+	if err != nil {
+		return entities.CollectionWithRecordings{}, err
+	}
+	summaries, err := s.recordings.Summaries(ctx, viewerFrom(ctx), collection.RecordingIDs)
+	if err != nil {
+		return entities.CollectionWithRecordings{}, fmt.Errorf("service: problem retrieving collection recordings, %w", err)
+	}
+	return entities.CollectionWithRecordings{Collection: collection, Recordings: summaries}, nil
+}
+
+func (s *collectionService) ListItems(limit int, ctx context.Context) ([]entities.Collection, error) {
+	if limit < 1 {
+		verr := &ValidationError{}
+		verr.Add("limit", "can't be less than 1")
+		return []entities.Collection{}, verr
+	}
+	collections, err := s.repo.List(ctx, viewerFrom(ctx), limit)
+	if err != nil {
+		return []entities.Collection{}, fmt.Errorf("service: problem retrieving list, %w", err)
+	}
+	return collections, nil
+}
+
+// Create adds a collection owned by the acting user, public unless another
+// visibility is given. Its cover is uploaded separately with SetCover.
+func (s *collectionService) Create(collection entities.Collection, ctx context.Context) (int, error) {
+	if err := authorizeCollection(ctx, ActionCreate, collection); err != nil {
+		return 0, err
+	}
+	collection.UserID = UserFrom(ctx).ID
+	collection.CoverLocation = nil
+	if collection.Visibility == "" {
+		collection.Visibility = entities.VisibilityPublic
+	}
+	verr, err := s.validate(collection, ctx)
+	if err != nil {
+		return 0, err
+	}
+	if verr.HasErrors() {
+		return 0, verr
+	}
+	var id int
+	err = s.repo.InTx(ctx, func(repo repositories.CollectionRepository) error {
+		var err error
+		if id, err = repo.Insert(collection, ctx); err != nil {
+			return fmt.Errorf("service: problem inserting collection, %w", err)
+		}
+		if len(collection.RecordingIDs) > 0 {
+			if err := repo.SetRecordings(id, collection.RecordingIDs, ctx); err != nil {
+				return fmt.Errorf("service: problem adding collection recordings, %w", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+// Update replaces the collection's title, description and visibility, and
+// its recordings when RecordingIDs isn't nil. An empty visibility keeps the
+// current one; the owner and cover are kept.
+func (s *collectionService) Update(collection entities.Collection, ctx context.Context) (entities.CollectionWithRecordings, error) {
+	existing, err := s.get(collection.ID, ctx)
+	if err != nil {
+		return entities.CollectionWithRecordings{}, err
+	}
+	if err := authorizeCollection(ctx, ActionUpdate, existing); err != nil {
+		return entities.CollectionWithRecordings{}, err
+	}
+	collection.UserID = existing.UserID
+	collection.CoverLocation = existing.CoverLocation
+	if collection.Visibility == "" {
+		collection.Visibility = existing.Visibility
+	}
+	verr, err := s.validate(collection, ctx)
+	if err != nil {
+		return entities.CollectionWithRecordings{}, err
+	}
+	if verr.HasErrors() {
+		return entities.CollectionWithRecordings{}, verr
+	}
+	err = s.repo.InTx(ctx, func(repo repositories.CollectionRepository) error {
+		if err := repo.Update(collection, ctx); err != nil {
+			return fmt.Errorf("service: problem updating collection, %w", err)
+		}
+		if collection.RecordingIDs != nil {
+			if err := repo.SetRecordings(collection.ID, collection.RecordingIDs, ctx); err != nil {
+				return fmt.Errorf("service: problem updating collection recordings, %w", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return entities.CollectionWithRecordings{}, err
+	}
+	return s.GetByID(collection.ID, ctx)
+}
+
+// Delete removes the collection and its cover. The recordings in it are
+// left alone.
+func (s *collectionService) Delete(id int, ctx context.Context) error {
+	collection, err := s.get(id, ctx)
+	if err != nil {
+		return err
+	}
+	if err := authorizeCollection(ctx, ActionDelete, collection); err != nil {
+		return err
+	}
+	if err := s.repo.Delete(id, ctx); err != nil {
+		return fmt.Errorf("service: problem deleting collection, %w", err)
+	}
+	if collection.CoverLocation != nil {
+		removeStoredFile(ctx, s.store, *collection.CoverLocation)
+	}
+	return nil
+}
+
+// SetCover stores a new cover image for the collection, removing the old
+// one.
+func (s *collectionService) SetCover(id int, cover Upload, ctx context.Context) (entities.Collection, error) {
+	collection, err := s.get(id, ctx)
+	if err != nil {
+		return entities.Collection{}, err
+	}
+	if err := authorizeCollection(ctx, ActionUpdate, collection); err != nil {
+		return entities.Collection{}, err
+	}
+	ext := fileExtension(cover.Filename)
+	if !slices.Contains(artworkExtensions, ext) {
+		verr := &ValidationError{}
+		verr.Add("cover", fmt.Sprintf("unsupported image type %q, expected one of %s", ext, strings.Join(artworkExtensions, ", ")))
+		return entities.Collection{}, verr
+	}
+	key, _, err := storeFile(ctx, s.store, "covers", ext, cover.Content)
+	if err != nil {
+		return entities.Collection{}, fmt.Errorf("service: problem storing cover, %w", err)
+	}
+	old := collection.CoverLocation
+	collection.CoverLocation = &key
+	if err := s.repo.Update(collection, ctx); err != nil {
+		removeStoredFile(ctx, s.store, key)
+		return entities.Collection{}, fmt.Errorf("service: problem updating collection, %w", err)
+	}
+	if old != nil {
+		removeStoredFile(ctx, s.store, *old)
+	}
+	return collection, nil
+}
+
+func (s *collectionService) get(id int, ctx context.Context) (entities.Collection, error) {
+	if id < 1 {
+		return entities.Collection{}, fmt.Errorf("id must be no less than 1")
+	}
+	collection, err := s.repo.GetRowByID(id, viewerFrom(ctx), ctx)
+	if err != nil {
+		return entities.Collection{}, fmt.Errorf("service: problem retrieving collection by ID, %w", err)
+	}
+	return collection, nil
+}
+
+// validate checks the collection's fields, and that every recording in it
+// exists and can be seen by the acting user, so a collection can't be used
+// to probe for hidden recordings.
+func (s *collectionService) validate(collection entities.Collection, ctx context.Context) (*ValidationError, error) {
+	verr := &ValidationError{}
+	if strings.TrimSpace(collection.Title) == "" {
+		verr.Add("title", "is required")
+	}
+	if !slices.Contains(visibilities, collection.Visibility) {
+		verr.Add("visibility", fmt.Sprintf("must be one of %s", strings.Join(visibilities, ", ")))
+	}
+	ids := collection.RecordingIDs
+	switch {
+	case len(ids) > MaxCollectionSize:
+		verr.Add("recording_ids", fmt.Sprintf("can't hold more than %d recordings", MaxCollectionSize))
+	case len(slices.Compact(slices.Sorted(slices.Values(ids)))) != len(ids):
+		verr.Add("recording_ids", "can't contain a recording more than once")
+	case len(ids) > 0:
+		found, err := s.recordings.Summaries(ctx, viewerFrom(ctx), ids)
+		if err != nil {
+			return nil, fmt.Errorf("service: problem checking collection recordings, %w", err)
+		}
+		for _, id := range ids {
+			if !slices.ContainsFunc(found, func(r entities.RecordingSummary) bool { return r.ID == id }) {
+				verr.Add("recording_ids", fmt.Sprintf("recording %d not found", id))
+				break
+			}
+		}
+	}
+	return verr, nil
+}
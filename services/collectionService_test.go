@@ -0,0 +1,197 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"field_archive/server/entities"
+	"field_archive/server/internal/storage"
+	"field_archive/server/repositories"
+	"fmt"
+	"maps"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// mockCollectionRepo keeps collections in memory. Visibility isn't applied,
+// as the repository does that in SQL.
+type mockCollectionRepo struct {
+	collections map[int]entities.Collection
+	nextID      int
+	// setErr, if set, fails SetRecordings.
+	setErr error
+}
+
+func (m *mockCollectionRepo) Insert(collection entities.Collection, ctx context.Context) (int, error) {
+	m.nextID++
+	collection.ID = m.nextID
+	collection.RecordingIDs = []int{}
+	m.collections[collection.ID] = collection
+	return collection.ID, nil
+}
+
+func (m *mockCollectionRepo) GetRowByID(id int, viewer repositories.Viewer, ctx context.Context) (entities.Collection, error) {
+	collection, ok := m.collections[id]
+	if !ok {
+		return entities.Collection{}, fmt.Errorf("collection with id %d %w", id, repositories.ErrNotFound)
+	}
+	return collection, nil
+}
+
+func (m *mockCollectionRepo) Update(collection entities.Collection, ctx context.Context) error {
+	existing, ok := m.collections[collection.ID]
+	if !ok {
+		return fmt.Errorf("collection with id %d %w", collection.ID, repositories.ErrNotFound)
+	}
+	collection.RecordingIDs = existing.RecordingIDs
+	m.collections[collection.ID] = collection
+	return nil
+}
+
+func (m *mockCollectionRepo) Delete(id int, ctx context.Context) error {
+	delete(m.collections, id)
+	return nil
+}
+
+func (m *mockCollectionRepo) List(ctx context.Context, viewer repositories.Viewer, limit int) ([]entities.Collection, error) {
+	res := []entities.Collection{}
+	for _, collection := range m.collections {
+		res = append(res, collection)
+	}
+	return res, nil
+}
+
+// InTx puts the collections back as they were if fn fails.
+func (m *mockCollectionRepo) InTx(ctx context.Context, fn func(repo repositories.CollectionRepository) error) error {
+	saved := maps.Clone(m.collections)
+	if err := fn(m); err != nil {
+		m.collections = saved
+		return err
+	}
+	return nil
+}
+
+func (m *mockCollectionRepo) SetRecordings(id int, recordingIDs []int, ctx context.Context) error {
+	if m.setErr != nil {
+		return m.setErr
+	}
+	collection := m.collections[id]
+	collection.RecordingIDs = recordingIDs
+	m.collections[id] = collection
+	return nil
+}
+
+// summariesOf returns a mockRepo in which recordings 1 to 5 exist and can be
+// seen by everyone.
+func summariesOf() *mockRepo {
+	return &mockRepo{
+		mockSummaries: func(ctx context.Context, ids []int) ([]entities.RecordingSummary, error) {
+			res := []entities.RecordingSummary{}
+			for _, id := range ids {
+				if id >= 1 && id <= 5 {
+					res = append(res, entities.RecordingSummary{ID: id, Title: fmt.Sprintf("Recording %d", id)})
+				}
+			}
+			return res, nil
+		},
+	}
+}
+
+func TestCollectionLifecycle(t *testing.T) {
+	store, _ := newStore(t)
+	repo := &mockCollectionRepo{collections: map[int]entities.Collection{}}
+	s := NewCollectionService(repo, summariesOf(), store)
+	owner := actingAs(7, entities.RoleContributor)
+
+	id, err := s.Create(entities.Collection{Title: "Dawn walk", RecordingIDs: []int{3, 1, 2}, UserID: 99}, owner)
+	assert.NoError(t, err)
+	created, err := s.GetByID(id, context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 7, created.UserID)
+	assert.Equal(t, entities.VisibilityPublic, created.Visibility)
+	assert.Equal(t, []int{3, 1, 2}, created.RecordingIDs)
+	if assert.Len(t, created.Recordings, 3) {
+		assert.Equal(t, "Recording 3", created.Recordings[0].Title)
+	}
+
+	// Leaving recording_ids out keeps the recordings; giving them reorders.
+	updated, err := s.Update(entities.Collection{ID: id, Title: "Dusk walk"}, owner)
+	assert.NoError(t, err)
+	assert.Equal(t, "Dusk walk", updated.Title)
+	assert.Equal(t, []int{3, 1, 2}, updated.RecordingIDs)
+	updated, err = s.Update(entities.Collection{ID: id, Title: "Dusk walk", RecordingIDs: []int{2, 3}}, owner)
+	assert.NoError(t, err)
+	assert.Equal(t, []int{2, 3}, updated.RecordingIDs)
+
+	_, err = s.Update(entities.Collection{ID: id, Title: "Mine now"}, actingAs(8, entities.RoleContributor))
+	assert.ErrorIs(t, err, ErrForbidden)
+	_, err = s.Update(entities.Collection{ID: id, Title: "Curated"}, actingAs(9, entities.RoleCurator))
+	assert.NoError(t, err)
+
+	withCover, err := s.SetCover(id, Upload{Filename: "cover.png", Content: strings.NewReader("png")}, owner)
+	assert.NoError(t, err)
+	if assert.NotNil(t, withCover.CoverLocation) {
+		_, err := store.Stat(context.Background(), *withCover.CoverLocation)
+		assert.NoError(t, err)
+	}
+	_, err = s.SetCover(id, Upload{Filename: "cover.gif", Content: strings.NewReader("gif")}, owner)
+	var verr *ValidationError
+	assert.ErrorAs(t, err, &verr)
+
+	assert.ErrorIs(t, s.Delete(id, actingAs(8, entities.RoleContributor)), ErrForbidden)
+	assert.NoError(t, s.Delete(id, owner))
+	_, err = store.Stat(context.Background(), *withCover.CoverLocation)
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+}
+
+func TestCollectionWritesAreAtomic(t *testing.T) {
+	repo := &mockCollectionRepo{collections: map[int]entities.Collection{}}
+	s := NewCollectionService(repo, summariesOf(), nil)
+	owner := actingAs(7, entities.RoleContributor)
+	id, err := s.Create(entities.Collection{Title: "Dawn walk", RecordingIDs: []int{1, 2}}, owner)
+	assert.NoError(t, err)
+
+	repo.setErr = errors.New("connection reset")
+	_, err = s.Create(entities.Collection{Title: "Half made", RecordingIDs: []int{3}}, owner)
+	assert.Error(t, err)
+	assert.Len(t, repo.collections, 1, "the collection shouldn't be left without its recordings")
+
+	_, err = s.Update(entities.Collection{ID: id, Title: "Half renamed", RecordingIDs: []int{2, 1}}, owner)
+	assert.Error(t, err)
+	assert.Equal(t, "Dawn walk", repo.collections[id].Title)
+	assert.Equal(t, []int{1, 2}, repo.collections[id].RecordingIDs)
+
+	_, err = s.ListItems(0, owner)
+	var verr *ValidationError
+	assert.ErrorAs(t, err, &verr)
+}
+
+func TestCreateCollectionValidation(t *testing.T) {
+	s := NewCollectionService(&mockCollectionRepo{collections: map[int]entities.Collection{}}, summariesOf(), nil)
+	owner := actingAs(7, entities.RoleContributor)
+
+	_, err := s.Create(entities.Collection{Visibility: "secret", RecordingIDs: []int{1, 1}}, owner)
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("expected a validation error, got %v", err)
+	}
+	assert.Equal(t, map[string]string{
+		"title":         "is required",
+		"visibility":    "must be one of public, unlisted, private",
+		"recording_ids": "can't contain a recording more than once",
+	}, verr.Fields)
+
+	// Recordings the user can't see are treated as missing.
+	_, err = s.Create(entities.Collection{Title: "Walk", RecordingIDs: []int{1, 6}}, owner)
+	if !errors.As(err, &verr) {
+		t.Fatalf("expected a validation error, got %v", err)
+	}
+	assert.Equal(t, "recording 6 not found", verr.Fields["recording_ids"])
+
+	_, err = s.Create(entities.Collection{Title: "Walk"}, actingAs(1, entities.RoleViewer))
+	assert.ErrorIs(t, err, ErrForbidden)
+	scoped := WithAPIKey(owner, entities.APIKey{Scopes: []string{ScopeRecordingsWrite}})
+	_, err = s.Create(entities.Collection{Title: "Walk"}, scoped)
+	assert.ErrorIs(t, err, ErrForbidden)
+}
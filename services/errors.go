@@ -0,0 +1,37 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ValidationError collects per-field problems with a request so handlers can
+// report them back to the client as a 400 rather than a generic failure.
+type ValidationError struct {
+	Fields map[string]string
+}
+
+func (e *ValidationError) Add(field, msg string) {
+	if e.Fields == nil {
+		e.Fields = map[string]string{}
+	}
+	e.Fields[field] = msg
+}
+
+func (e *ValidationError) HasErrors() bool {
+	return len(e.Fields) > 0
+}
+
+func (e *ValidationError) Error() string {
+	fields := make([]string, 0, len(e.Fields))
+	for f := range e.Fields {
+		fields = append(fields, f)
+	}
+	sort.Strings(fields)
+	msgs := make([]string, 0, len(fields))
+	for _, f := range fields {
+		msgs = append(msgs, fmt.Sprintf("%s: %s", f, e.Fields[f]))
+	}
+	return "validation failed: " + strings.Join(msgs, ", ")
+}
@@ -0,0 +1,225 @@
+package services
+
+import (
+	"context"
+	"field_archive/server/entities"
+	"field_archive/server/internal/geojson"
+	"field_archive/server/repositories"
+	"fmt"
+	"math"
+	"strings"
+)
+
+type LocationService interface {
+	GetByID(id int, ctx context.Context) (entities.Location, error)
+	ListItems(limit int, ctx context.Context) ([]entities.Location, error)
+	Create(location entities.Location, ctx context.Context) (int, error)
+	Update(location entities.Location, ctx context.Context) (entities.Location, error)
+	Delete(id int, ctx context.Context) error
+	FeatureCollection(ctx context.Context) (geojson.FeatureCollection, error)
+	WithinBounds(ctx context.Context, minLon, minLat, maxLon, maxLat float64, limit int) ([]entities.NearbyLocation, error)
+	WithinRadius(ctx context.Context, lat, lon, radiusMetres float64, limit int) ([]entities.NearbyLocation, error)
+	Nearest(ctx context.Context, lat, lon float64, k int) ([]entities.NearbyLocation, error)
+}
+
+// MaxNearest caps k for nearest-neighbour searches.
+const MaxNearest = 100
+
+type locationService struct {
+	repo repositories.LocationRepository
+}
+
+func NewLocationService(repo repositories.LocationRepository) *locationService {
+	return &locationService{repo: repo}
+}
+
+func (s *locationService) GetByID(id int, ctx context.Context) (entities.Location, error) {
+	if id < 1 {
+		return entities.Location{}, fmt.Errorf("id must be no less than 1")
+	}
+	location, err := s.repo.GetRowByID(id, viewerFrom(ctx), ctx)
+	if err != nil {
+		return entities.Location{}, fmt.Errorf("service: problem retrieving location by ID, %w", err)
+	}
+	return location, nil
+}
+
+func (s *locationService) ListItems(limit int, ctx context.Context) ([]entities.Location, error) {
+	if limit < 1 {
+		verr := &ValidationError{}
+		verr.Add("limit", "can't be less than 1")
+		return []entities.Location{}, verr
+	}
+	locations, err := s.repo.List(ctx, viewerFrom(ctx), limit)
+	if err != nil {
+		return []entities.Location{}, fmt.Errorf("service: problem retrieving list, %w", err)
+	}
+	return locations, nil
+}
+
+// Create adds a location owned by the acting user. Sensitivity defaults to
+// none.
+func (s *locationService) Create(location entities.Location, ctx context.Context) (int, error) {
+	if err := authorizeLocation(ctx, ActionCreate); err != nil {
+		return 0, err
+	}
+	location.UserID = UserFrom(ctx).ID
+	if location.Sensitivity == "" {
+		location.Sensitivity = entities.SensitivityNone
+	}
+	if verr := validateLocation(location); verr.HasErrors() {
+		return 0, verr
+	}
+	id, err := s.repo.Insert(location, ctx)
+	if err != nil {
+		return 0, fmt.Errorf("service: problem inserting location, %w", err)
+	}
+	return id, nil
+}
+
+// Update replaces the location's details, keeping its sensitivity when none
+// is given. The owner can't be changed.
+func (s *locationService) Update(location entities.Location, ctx context.Context) (entities.Location, error) {
+	if err := authorizeLocation(ctx, ActionUpdate); err != nil {
+		return entities.Location{}, err
+	}
+	if location.Sensitivity == "" {
+		existing, err := s.GetByID(location.ID, ctx)
+		if err != nil {
+			return entities.Location{}, err
+		}
+		location.Sensitivity = existing.Sensitivity
+	}
+	if verr := validateLocation(location); verr.HasErrors() {
+		return entities.Location{}, verr
+	}
+	if err := s.repo.Update(location, ctx); err != nil {
+		return entities.Location{}, fmt.Errorf("service: problem updating location, %w", err)
+	}
+	return s.GetByID(location.ID, ctx)
+}
+
+func (s *locationService) Delete(id int, ctx context.Context) error {
+	if err := authorizeLocation(ctx, ActionDelete); err != nil {
+		return err
+	}
+	if err := s.repo.Delete(id, ctx); err != nil {
+		return fmt.Errorf("service: problem deleting location, %w", err)
+	}
+	return nil
+}
+
+// FeatureCollection returns every location as a GeoJSON point feature, with
+// the recordings made there listed in its properties.
+func (s *locationService) FeatureCollection(ctx context.Context) (geojson.FeatureCollection, error) {
+	locations, err := s.repo.ListWithRecordings(ctx, viewerFrom(ctx))
+	if err != nil {
+		return geojson.FeatureCollection{}, fmt.Errorf("service: problem retrieving locations, %w", err)
+	}
+	fc := geojson.NewFeatureCollection()
+	for _, l := range locations {
+		fc.Add(geojson.NewFeature(l.ID, &l.Geom, map[string]any{
+			"name":            l.Name,
+			"description":     l.Description,
+			"recording_count": len(l.RecordingIDs),
+			"recording_ids":   l.RecordingIDs,
+		}))
+	}
+	return fc, nil
+}
+
+func (s *locationService) WithinBounds(ctx context.Context, minLon, minLat, maxLon, maxLat float64, limit int) ([]entities.NearbyLocation, error) {
+	verr := &ValidationError{}
+	if !validLongitude(minLon) || !validLatitude(minLat) || !validLongitude(maxLon) || !validLatitude(maxLat) {
+		verr.Add("bbox", "coordinates must be within -180,-90,180,90")
+	} else if minLon > maxLon || minLat > maxLat {
+		verr.Add("bbox", "must be given as minLon,minLat,maxLon,maxLat")
+	}
+	if limit < 1 {
+		verr.Add("limit", "can't be less than 1")
+	}
+	if verr.HasErrors() {
+		return nil, verr
+	}
+	locations, err := s.repo.WithinBounds(ctx, viewerFrom(ctx), minLon, minLat, maxLon, maxLat, limit)
+	if err != nil {
+		return nil, fmt.Errorf("service: problem searching bounding box, %w", err)
+	}
+	return locations, nil
+}
+
+func (s *locationService) WithinRadius(ctx context.Context, lat, lon, radiusMetres float64, limit int) ([]entities.NearbyLocation, error) {
+	verr := validatePoint("near", lat, lon)
+	// ParseFloat accepts NaN and Inf, which would reach ST_DWithin as an
+	// error or a search of everything.
+	if math.IsNaN(radiusMetres) || math.IsInf(radiusMetres, 0) || radiusMetres <= 0 {
+		verr.Add("radius_m", "must be a finite number greater than 0")
+	}
+	if limit < 1 {
+		verr.Add("limit", "can't be less than 1")
+	}
+	if verr.HasErrors() {
+		return nil, verr
+	}
+	locations, err := s.repo.WithinRadius(ctx, viewerFrom(ctx), lat, lon, radiusMetres, limit)
+	if err != nil {
+		return nil, fmt.Errorf("service: problem searching radius, %w", err)
+	}
+	return locations, nil
+}
+
+func (s *locationService) Nearest(ctx context.Context, lat, lon float64, k int) ([]entities.NearbyLocation, error) {
+	verr := validatePoint("nearest", lat, lon)
+	if k < 1 || k > MaxNearest {
+		verr.Add("k", fmt.Sprintf("must be between 1 and %d", MaxNearest))
+	}
+	if verr.HasErrors() {
+		return nil, verr
+	}
+	locations, err := s.repo.Nearest(ctx, viewerFrom(ctx), lat, lon, k)
+	if err != nil {
+		return nil, fmt.Errorf("service: problem searching nearest locations, %w", err)
+	}
+	return locations, nil
+}
+
+func validLatitude(lat float64) bool {
+	return lat >= -90 && lat <= 90
+}
+
+func validLongitude(lon float64) bool {
+	return lon >= -180 && lon <= 180
+}
+
+func validatePoint(field string, lat, lon float64) *ValidationError {
+	verr := &ValidationError{}
+	if !validLatitude(lat) || !validLongitude(lon) {
+		verr.Add(field, "must be a lat,lon pair within -90..90 and -180..180")
+	}
+	return verr
+}
+
+// validateLocation checks the coordinates are present and in range before
+// they reach ST_MakePoint, which would otherwise accept any pair of numbers.
+func validateLocation(location entities.Location) *ValidationError {
+	verr := &ValidationError{}
+	if strings.TrimSpace(location.Name) == "" {
+		verr.Add("name", "is required")
+	}
+	if location.Latitude == nil {
+		verr.Add("latitude", "is required")
+	} else if !validLatitude(*location.Latitude) {
+		verr.Add("latitude", "must be between -90 and 90")
+	}
+	if location.Longitude == nil {
+		verr.Add("longitude", "is required")
+	} else if !validLongitude(*location.Longitude) {
+		verr.Add("longitude", "must be between -180 and 180")
+	}
+	switch location.Sensitivity {
+	case entities.SensitivityNone, entities.SensitivityLow, entities.SensitivityHigh:
+	default:
+		verr.Add("sensitivity", "must be none, low or high")
+	}
+	return verr
+}
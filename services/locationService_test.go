@@ -0,0 +1,234 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"field_archive/server/entities"
+	"field_archive/server/internal/database"
+	"field_archive/server/repositories"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type mockLocationRepo struct {
+	mockInsert     func(location entities.Location, ctx context.Context) (int, error)
+	mockGetRowByID func(id int, ctx context.Context) (entities.Location, error)
+	mockUpdate     func(location entities.Location, ctx context.Context) error
+	mockDelete     func(id int, ctx context.Context) error
+	mockList       func(ctx context.Context, limit int) ([]entities.Location, error)
+	mockListWith   func(ctx context.Context) ([]entities.LocationWithRecordings, error)
+	mockBounds     func(minLon, minLat, maxLon, maxLat float64, limit int) ([]entities.NearbyLocation, error)
+	mockRadius     func(lat, lon, radius float64, limit int) ([]entities.NearbyLocation, error)
+	mockNearest    func(lat, lon float64, k int) ([]entities.NearbyLocation, error)
+	viewer         repositories.Viewer
+}
+
+func (r *mockLocationRepo) Insert(location entities.Location, ctx context.Context) (int, error) {
+	return r.mockInsert(location, ctx)
+}
+
+func (r *mockLocationRepo) GetRowByID(id int, viewer repositories.Viewer, ctx context.Context) (entities.Location, error) {
+	r.viewer = viewer
+	return r.mockGetRowByID(id, ctx)
+}
+
+func (r *mockLocationRepo) Update(location entities.Location, ctx context.Context) error {
+	return r.mockUpdate(location, ctx)
+}
+
+func (r *mockLocationRepo) Delete(id int, ctx context.Context) error {
+	return r.mockDelete(id, ctx)
+}
+
+func (r *mockLocationRepo) List(ctx context.Context, viewer repositories.Viewer, limit int) ([]entities.Location, error) {
+	r.viewer = viewer
+	return r.mockList(ctx, limit)
+}
+
+func (r *mockLocationRepo) ListWithRecordings(ctx context.Context, viewer repositories.Viewer) ([]entities.LocationWithRecordings, error) {
+	r.viewer = viewer
+	return r.mockListWith(ctx)
+}
+
+func (r *mockLocationRepo) WithinBounds(ctx context.Context, viewer repositories.Viewer, minLon, minLat, maxLon, maxLat float64, limit int) ([]entities.NearbyLocation, error) {
+	return r.mockBounds(minLon, minLat, maxLon, maxLat, limit)
+}
+
+func (r *mockLocationRepo) WithinRadius(ctx context.Context, viewer repositories.Viewer, lat, lon, radius float64, limit int) ([]entities.NearbyLocation, error) {
+	return r.mockRadius(lat, lon, radius, limit)
+}
+
+func (r *mockLocationRepo) Nearest(ctx context.Context, viewer repositories.Viewer, lat, lon float64, k int) ([]entities.NearbyLocation, error) {
+	return r.mockNearest(lat, lon, k)
+}
+
+func TestNewLocationService(t *testing.T) {
+	r := repositories.NewLocationRepo(&database.Postgres{}, repositories.Grids{Low: 1000, High: 10000})
+	s := NewLocationService(r)
+	check := &locationService{repo: r}
+	assert.Equal(t, s, check)
+}
+
+func TestCreateLocation(t *testing.T) {
+	lat, lon := 51.5, -0.12
+	mockRepo := &mockLocationRepo{
+		mockInsert: func(location entities.Location, ctx context.Context) (int, error) {
+			assert.Equal(t, 1, location.UserID)
+			assert.Equal(t, entities.SensitivityNone, location.Sensitivity)
+			return 5, nil
+		},
+	}
+	s := &locationService{repo: mockRepo}
+	id, err := s.Create(entities.Location{Name: "Marsh", Latitude: &lat, Longitude: &lon}, actingAs(1, entities.RoleContributor))
+	assert.NoError(t, err)
+	assert.Equal(t, 5, id)
+}
+
+func TestCreateLocationValidation(t *testing.T) {
+	lat, lon := 91.0, -181.0
+	s := &locationService{repo: &mockLocationRepo{}}
+
+	_, err := s.Create(entities.Location{Latitude: &lat, Longitude: &lon, Sensitivity: "secret"}, actingAs(1, entities.RoleContributor))
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("expected a validation error, got %v", err)
+	}
+	assert.Equal(t, map[string]string{
+		"name":        "is required",
+		"latitude":    "must be between -90 and 90",
+		"longitude":   "must be between -180 and 180",
+		"sensitivity": "must be none, low or high",
+	}, verr.Fields)
+
+	_, err = s.Create(entities.Location{Name: "Marsh"}, actingAs(1, entities.RoleContributor))
+	if !errors.As(err, &verr) {
+		t.Fatalf("expected a validation error, got %v", err)
+	}
+	assert.Contains(t, verr.Fields, "latitude")
+	assert.Contains(t, verr.Fields, "longitude")
+}
+
+func TestUpdateLocation(t *testing.T) {
+	lat, lon := 51.5, -0.12
+	location := entities.Location{ID: 2, Name: "Marsh", Latitude: &lat, Longitude: &lon, Sensitivity: entities.SensitivityHigh}
+	mockRepo := &mockLocationRepo{
+		mockUpdate: func(l entities.Location, ctx context.Context) error {
+			// The sensitivity is kept when the update doesn't give one.
+			assert.Equal(t, entities.SensitivityHigh, l.Sensitivity)
+			return nil
+		},
+		mockGetRowByID: func(id int, ctx context.Context) (entities.Location, error) {
+			return location, nil
+		},
+	}
+	s := &locationService{repo: mockRepo}
+	update := location
+	update.Sensitivity = ""
+	res, err := s.Update(update, actingAs(1, entities.RoleCurator))
+	assert.NoError(t, err)
+	assert.Equal(t, location, res)
+}
+
+func TestLocationViewer(t *testing.T) {
+	mockRepo := &mockLocationRepo{
+		mockGetRowByID: func(id int, ctx context.Context) (entities.Location, error) {
+			return entities.Location{ID: id}, nil
+		},
+	}
+	s := &locationService{repo: mockRepo}
+
+	// Only curators and admins see every sensitive location precisely; the
+	// repository shows owners their own.
+	_, err := s.GetByID(1, context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, repositories.Viewer{}, mockRepo.viewer)
+	_, err = s.GetByID(1, actingAs(7, entities.RoleContributor))
+	assert.NoError(t, err)
+	assert.Equal(t, repositories.Viewer{UserID: 7}, mockRepo.viewer)
+	_, err = s.GetByID(1, actingAs(9, entities.RoleCurator))
+	assert.NoError(t, err)
+	assert.Equal(t, repositories.Viewer{UserID: 9, SeesAll: true}, mockRepo.viewer)
+}
+
+func TestLocationFeatureCollection(t *testing.T) {
+	mockRepo := &mockLocationRepo{
+		mockListWith: func(ctx context.Context) ([]entities.LocationWithRecordings, error) {
+			return []entities.LocationWithRecordings{
+				{
+					Location: entities.Location{
+						ID:          1,
+						Name:        "Marsh",
+						Description: "Reed beds",
+						Geom:        `{"type":"Point","coordinates":[-0.12,51.5]}`,
+					},
+					RecordingIDs: []int{3, 4},
+				},
+			}, nil
+		},
+	}
+	s := &locationService{repo: mockRepo}
+	fc, err := s.FeatureCollection(context.Background())
+	assert.NoError(t, err)
+	b, _ := json.Marshal(fc)
+	assert.JSONEq(t, `{
+  "type": "FeatureCollection",
+  "features": [{
+    "type": "Feature",
+    "id": 1,
+    "geometry": {"type": "Point", "coordinates": [-0.12, 51.5]},
+    "properties": {"name": "Marsh", "description": "Reed beds", "recording_count": 2, "recording_ids": [3, 4]}
+  }]
+}`, string(b))
+}
+
+func TestSpatialSearchValidation(t *testing.T) {
+	s := &locationService{repo: &mockLocationRepo{}}
+	ctx := context.Background()
+	var verr *ValidationError
+
+	_, err := s.WithinBounds(ctx, 10, 0, -10, 5, 10)
+	assert.ErrorAs(t, err, &verr)
+	assert.Contains(t, verr.Fields, "bbox")
+
+	_, err = s.WithinBounds(ctx, -200, 0, 10, 5, 10)
+	assert.ErrorAs(t, err, &verr)
+	assert.Contains(t, verr.Fields, "bbox")
+
+	_, err = s.WithinRadius(ctx, 95, 0, 0, 10)
+	assert.ErrorAs(t, err, &verr)
+	assert.Contains(t, verr.Fields, "near")
+	assert.Contains(t, verr.Fields, "radius_m")
+
+	_, err = s.Nearest(ctx, 51.5, -0.12, MaxNearest+1)
+	assert.ErrorAs(t, err, &verr)
+	assert.Contains(t, verr.Fields, "k")
+
+	for _, radius := range []float64{math.NaN(), math.Inf(1), math.Inf(-1)} {
+		_, err = s.WithinRadius(ctx, 51.5, -0.12, radius, 10)
+		assert.ErrorAs(t, err, &verr)
+		assert.Contains(t, verr.Fields, "radius_m")
+	}
+
+	_, err = s.ListItems(0, ctx)
+	assert.ErrorAs(t, err, &verr)
+	assert.Contains(t, verr.Fields, "limit")
+}
+
+func TestWithinRadius(t *testing.T) {
+	distance := 120.5
+	mockRepo := &mockLocationRepo{
+		mockRadius: func(lat, lon, radius float64, limit int) ([]entities.NearbyLocation, error) {
+			assert.Equal(t, 51.5, lat)
+			assert.Equal(t, -0.12, lon)
+			assert.Equal(t, 500.0, radius)
+			return []entities.NearbyLocation{{Location: entities.Location{ID: 1}, DistanceMetres: &distance}}, nil
+		},
+	}
+	s := &locationService{repo: mockRepo}
+	res, err := s.WithinRadius(context.Background(), 51.5, -0.12, 500, 10)
+	assert.NoError(t, err)
+	assert.Len(t, res, 1)
+}
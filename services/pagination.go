@@ -0,0 +1,14 @@
+package services
+
+const (
+	DefaultPageSize = 20
+	MaxPageSize     = 100
+)
+
+// Page is one page of a listing, with the cursor for the page after it (nil
+// on the last page) and the total number of items matching the query.
+type Page[T any] struct {
+	Items      []T     `json:"items"`
+	NextCursor *string `json:"next_cursor"`
+	Total      int     `json:"total"`
+}
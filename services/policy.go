@@ -0,0 +1,145 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"field_archive/server/entities"
+	"field_archive/server/repositories"
+	"fmt"
+	"math"
+	"slices"
+)
+
+// ErrForbidden is returned (wrapped) when the acting user isn't allowed to do
+// what they asked.
+var ErrForbidden = errors.New("forbidden")
+
+type Action string
+
+const (
+	ActionCreate Action = "create"
+	ActionUpdate Action = "update"
+	ActionDelete Action = "delete"
+)
+
+var roleRanks = map[string]int{
+	entities.RoleViewer:      1,
+	entities.RoleContributor: 2,
+	entities.RoleCurator:     3,
+	entities.RoleAdmin:       4,
+}
+
+// HasRole reports whether user holds role or a more privileged one. The
+// anonymous zero User holds no role.
+func HasRole(user entities.User, role string) bool {
+	return user.ID > 0 && roleRanks[user.Role] >= roleRanks[role] && roleRanks[role] > 0
+}
+
+// AuthorizeRecording decides whether user may perform action on recording.
+// Contributors may add recordings and change or remove their own; curators
+// and admins may change or remove anyone's.
+func AuthorizeRecording(user entities.User, action Action, recording entities.Recording) error {
+	return authorizeOwned(user, action, recording.UserID, "recording")
+}
+
+// AuthorizeCollection decides whether user may perform action on collection,
+// by the same rules as recordings.
+func AuthorizeCollection(user entities.User, action Action, collection entities.Collection) error {
+	return authorizeOwned(user, action, collection.UserID, "collection")
+}
+
+func authorizeOwned(user entities.User, action Action, ownerID int, resource string) error {
+	switch {
+	case HasRole(user, entities.RoleCurator):
+		return nil
+	case !HasRole(user, entities.RoleContributor):
+	case action == ActionCreate:
+		return nil
+	case ownerID == user.ID:
+		return nil
+	}
+	return fmt.Errorf("%w: %s %s", ErrForbidden, action, resource)
+}
+
+// AuthorizeLocation decides whether user may perform action on a location.
+// Contributors may add locations to record at; only curators and admins may
+// change or remove them, as they are shared by everyone's recordings.
+func AuthorizeLocation(user entities.User, action Action) error {
+	if HasRole(user, entities.RoleCurator) || action == ActionCreate && HasRole(user, entities.RoleContributor) {
+		return nil
+	}
+	return fmt.Errorf("%w: %s location", ErrForbidden, action)
+}
+
+// authorizeRecording applies AuthorizeRecording to the user ctx was made
+// for, first checking any API key they used is scoped to write recordings.
+func authorizeRecording(ctx context.Context, action Action, recording entities.Recording) error {
+	if err := requireScope(ctx, ScopeRecordingsWrite); err != nil {
+		return err
+	}
+	return AuthorizeRecording(UserFrom(ctx), action, recording)
+}
+
+// authorizeLocation is authorizeRecording for locations.
+func authorizeLocation(ctx context.Context, action Action) error {
+	if err := requireScope(ctx, ScopeLocationsWrite); err != nil {
+		return err
+	}
+	return AuthorizeLocation(UserFrom(ctx), action)
+}
+
+// authorizeCollection is authorizeRecording for collections.
+func authorizeCollection(ctx context.Context, action Action, collection entities.Collection) error {
+	if err := requireScope(ctx, ScopeCollectionsWrite); err != nil {
+		return err
+	}
+	return AuthorizeCollection(UserFrom(ctx), action, collection)
+}
+
+// viewerFrom returns who recording, location and collection queries made for
+// ctx run as. Curators and admins see everything, and every location
+// precisely; anyone else sees released public and unlisted recordings,
+// public and unlisted collections and their own, and sensitive locations
+// they don't own only on a grid.
+func viewerFrom(ctx context.Context) repositories.Viewer {
+	user := UserFrom(ctx)
+	return repositories.Viewer{UserID: user.ID, SeesAll: HasRole(user, entities.RoleCurator)}
+}
+
+// requireScope checks that a request made with an API key is allowed scope.
+// Requests made with a login token, and unscoped keys, may do anything.
+func requireScope(ctx context.Context, scope string) error {
+	key, ok := ctx.Value(apiKeyContextKey{}).(entities.APIKey)
+	if !ok || len(key.Scopes) == 0 || slices.Contains(key.Scopes, scope) {
+		return nil
+	}
+	return fmt.Errorf("%w: api key lacks the %s scope", ErrForbidden, scope)
+}
+
+type (
+	userContextKey   struct{}
+	apiKeyContextKey struct{}
+)
+
+// WithUser returns a copy of ctx carrying the user a request is made by, for
+// services to authorize against.
+func WithUser(ctx context.Context, user entities.User) context.Context {
+	return context.WithValue(ctx, userContextKey{}, user)
+}
+
+// Operator is who maintenance commands, such as those of the admin CLI, act
+// as. It's an admin whose ID no stored user has, so it can read and change
+// anything but shouldn't be made the owner of anything.
+var Operator = entities.User{ID: math.MaxInt32, Username: "operator", Role: entities.RoleAdmin}
+
+// UserFrom returns the user ctx was made for, or the anonymous zero User.
+func UserFrom(ctx context.Context) entities.User {
+	user, _ := ctx.Value(userContextKey{}).(entities.User)
+	return user
+}
+
+// WithAPIKey returns a copy of ctx recording that the request was made with
+// key, whose scopes limit what it may do.
+func WithAPIKey(ctx context.Context, key entities.APIKey) context.Context {
+	return context.WithValue(ctx, apiKeyContextKey{}, key)
+}
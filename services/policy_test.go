@@ -0,0 +1,114 @@
+package services
+
+import (
+	"context"
+	"field_archive/server/entities"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// actingAs returns a context carrying a user with the given id and role.
+func actingAs(id int, role string) context.Context {
+	return WithUser(context.Background(), entities.User{ID: id, Role: role})
+}
+
+func TestAuthorizeRecording(t *testing.T) {
+	owned := entities.Recording{ID: 1, UserID: 7}
+	tests := []struct {
+		name   string
+		user   entities.User
+		action Action
+		allow  bool
+	}{
+		{"anonymous create", entities.User{}, ActionCreate, false},
+		{"viewer create", entities.User{ID: 7, Role: entities.RoleViewer}, ActionCreate, false},
+		{"viewer update own", entities.User{ID: 7, Role: entities.RoleViewer}, ActionUpdate, false},
+		{"contributor create", entities.User{ID: 8, Role: entities.RoleContributor}, ActionCreate, true},
+		{"contributor update own", entities.User{ID: 7, Role: entities.RoleContributor}, ActionUpdate, true},
+		{"contributor delete own", entities.User{ID: 7, Role: entities.RoleContributor}, ActionDelete, true},
+		{"contributor update other", entities.User{ID: 8, Role: entities.RoleContributor}, ActionUpdate, false},
+		{"contributor delete other", entities.User{ID: 8, Role: entities.RoleContributor}, ActionDelete, false},
+		{"curator update other", entities.User{ID: 9, Role: entities.RoleCurator}, ActionUpdate, true},
+		{"curator delete other", entities.User{ID: 9, Role: entities.RoleCurator}, ActionDelete, true},
+		{"admin delete other", entities.User{ID: 10, Role: entities.RoleAdmin}, ActionDelete, true},
+		{"unknown role", entities.User{ID: 7, Role: "owner"}, ActionUpdate, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := AuthorizeRecording(tt.user, tt.action, owned)
+			if tt.allow {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, ErrForbidden)
+			}
+		})
+	}
+}
+
+func TestAuthorizeLocation(t *testing.T) {
+	tests := []struct {
+		role   string
+		action Action
+		allow  bool
+	}{
+		{entities.RoleViewer, ActionCreate, false},
+		{entities.RoleContributor, ActionCreate, true},
+		{entities.RoleContributor, ActionUpdate, false},
+		{entities.RoleContributor, ActionDelete, false},
+		{entities.RoleCurator, ActionUpdate, true},
+		{entities.RoleCurator, ActionDelete, true},
+		{entities.RoleAdmin, ActionDelete, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.role+" "+string(tt.action), func(t *testing.T) {
+			err := AuthorizeLocation(entities.User{ID: 1, Role: tt.role}, tt.action)
+			if tt.allow {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, ErrForbidden)
+			}
+		})
+	}
+}
+
+func TestRecordingOwnership(t *testing.T) {
+	existing := entities.Recording{
+		ID:            2,
+		Title:         "Title",
+		RecordingDate: time.Date(2025, 1, 6, 20, 2, 57, 0, time.UTC),
+		LocationID:    1,
+		UserID:        7,
+		Visibility:    entities.VisibilityPublic,
+	}
+	deleted := false
+	mockRepo := &mockRepo{
+		mockGetRowByID: func(id int, ctx context.Context) (entities.Recording, error) {
+			return existing, nil
+		},
+		mockUpdate: func(recording entities.Recording, ctx context.Context) error {
+			return nil
+		},
+		mockDelete: func(id int, ctx context.Context) error {
+			deleted = true
+			return nil
+		},
+	}
+	s := &recordingService{repo: mockRepo}
+
+	_, err := s.Update(existing, actingAs(8, entities.RoleContributor))
+	assert.ErrorIs(t, err, ErrForbidden)
+	assert.ErrorIs(t, s.Delete(2, actingAs(8, entities.RoleContributor)), ErrForbidden)
+	assert.ErrorIs(t, s.Delete(2, context.Background()), ErrForbidden)
+	assert.False(t, deleted)
+
+	// The owner can't give the recording away, but a curator can.
+	other := 8
+	res, err := s.Patch(2, RecordingPatch{UserID: &other}, actingAs(7, entities.RoleContributor))
+	assert.NoError(t, err)
+	assert.Equal(t, 7, res.UserID)
+	res, err = s.Patch(2, RecordingPatch{UserID: &other}, actingAs(9, entities.RoleCurator))
+	assert.NoError(t, err)
+	assert.Equal(t, 8, res.UserID)
+}
@@ -2,52 +2,529 @@ package services
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
 	"field_archive/server/entities"
+	"field_archive/server/internal/geojson"
+	"field_archive/server/internal/metadata"
+	"field_archive/server/internal/storage"
 	"field_archive/server/repositories"
 	"fmt"
+	"io"
+	"log"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type RecordingService interface {
 	GetByID(id int, ctx context.Context) (entities.Recording, error)
-	ListItems(limit int, ctx context.Context) ([]entities.Recording, error)
 	GetCount(ctx context.Context) (int, error)
+	ListPage(params RecordingListParams, ctx context.Context) (Page[entities.Recording], error)
+	Search(params RecordingSearchParams, ctx context.Context) (Page[entities.RecordingSearchResult], error)
+	Create(recording entities.Recording, audio Upload, artwork *Upload, ctx context.Context) (int, error)
+	Update(recording entities.Recording, ctx context.Context) (entities.Recording, error)
+	Patch(id int, patch RecordingPatch, ctx context.Context) (entities.Recording, error)
+	Delete(id int, ctx context.Context) error
+	Rescan(id int, ctx context.Context) (entities.Recording, error)
+	FeatureCollection(ctx context.Context) (geojson.FeatureCollection, error)
 }
 
+// Upload is a file received from a client, along with the name it was sent under.
+type Upload struct {
+	Filename string
+	Content  io.Reader
+}
+
+// RecordingListParams describes a page of GET /recordings. Cursor is the
+// opaque next_cursor from the previous page, if any.
+type RecordingListParams struct {
+	Filter repositories.RecordingFilter
+	Sort   string
+	Desc   bool
+	Limit  int
+	Cursor string
+}
+
+// RecordingSearchParams describes a page of GET /recordings/search. Query is
+// the text typed by the user.
+type RecordingSearchParams struct {
+	Query  string
+	Limit  int
+	Cursor string
+}
+
+// RecordingPatch holds the metadata fields of a partial update; nil fields are
+// left as they are. A zero EmbargoUntil lifts the embargo.
+type RecordingPatch struct {
+	Title         *string
+	RecordingDate *time.Time
+	LocationID    *int
+	UserID        *int
+	Description   *string
+	Equipment     *string
+	License       *string
+	Visibility    *string
+	EmbargoUntil  *time.Time
+}
+
+// Apply copies the fields present in the patch onto recording.
+func (p RecordingPatch) Apply(recording *entities.Recording) {
+	setIfPresent(&recording.Title, p.Title)
+	setIfPresent(&recording.RecordingDate, p.RecordingDate)
+	setIfPresent(&recording.LocationID, p.LocationID)
+	setIfPresent(&recording.UserID, p.UserID)
+	setIfPresent(&recording.Description, p.Description)
+	setIfPresent(&recording.Equipment, p.Equipment)
+	setIfPresent(&recording.License, p.License)
+	setIfPresent(&recording.Visibility, p.Visibility)
+	if p.EmbargoUntil != nil {
+		recording.EmbargoUntil = nil
+		if !p.EmbargoUntil.IsZero() {
+			until := *p.EmbargoUntil
+			recording.EmbargoUntil = &until
+		}
+	}
+}
+
+var (
+	audioExtensions   = []string{"wav", "flac", "mp3", "ogg", "opus"}
+	artworkExtensions = []string{"jpg", "jpeg", "png", "webp"}
+	visibilities      = []string{entities.VisibilityPublic, entities.VisibilityUnlisted, entities.VisibilityPrivate}
+)
+
 type recordingService struct {
-	repo repositories.RecordingRepository
+	repo  repositories.RecordingRepository
+	store storage.Blob
 }
 
-func NewRecordingService(repo repositories.RecordingRepository) *recordingService {
-	return &recordingService{repo: repo}
+func NewRecordingService(repo repositories.RecordingRepository, store storage.Blob) *recordingService {
+	return &recordingService{repo: repo, store: store}
 }
 
 func (s *recordingService) GetByID(id int, ctx context.Context) (entities.Recording, error) {
 	if id < 1 {
 		return entities.Recording{}, fmt.Errorf("id must be no less than 1")
 	}
-	recording, err := s.repo.GetRowByID(id, ctx)
+	recording, err := s.repo.GetRowByID(id, viewerFrom(ctx), ctx)
 	if err != nil {
 		return entities.Recording{}, fmt.Errorf("service: problem retrieving recording by ID, %w", err)
 	}
 	return recording, nil
 }
 
-func (s *recordingService) ListItems(limit int, ctx context.Context) ([]entities.Recording, error) {
-	if limit < 1 {
-		return []entities.Recording{}, fmt.Errorf("limit can't be less than 1")
+func (s *recordingService) GetCount(ctx context.Context) (int, error) {
+	count, err := s.repo.Count(ctx, repositories.RecordingFilter{Viewer: viewerFrom(ctx)})
+	if err != nil {
+		return 0, fmt.Errorf("service: problem retrieving count, %w", err)
+	}
+	return count, nil
+
+}
+
+// ListPage returns a page of recordings along with the number matching the
+// filter. One extra row is fetched to tell whether there's a next page.
+func (s *recordingService) ListPage(params RecordingListParams, ctx context.Context) (Page[entities.Recording], error) {
+	verr := &ValidationError{}
+	if params.Sort == "" {
+		params.Sort = "recording_date"
+	}
+	if _, ok := repositories.RecordingSorts[params.Sort]; !ok {
+		verr.Add("sort", "must be one of recording_date, date_uploaded, title, duration")
+	}
+	if params.Limit < 1 || params.Limit > MaxPageSize {
+		verr.Add("limit", fmt.Sprintf("must be between 1 and %d", MaxPageSize))
+	}
+	params.Filter.Viewer = viewerFrom(ctx)
+	params.Filter.Tags = normalizeTags(params.Filter.Tags)
+	f := params.Filter
+	if f.MinDuration != nil && f.MaxDuration != nil && *f.MinDuration > *f.MaxDuration {
+		verr.Add("min_duration", "can't be greater than max_duration")
+	}
+	if f.RecordedAfter != nil && f.RecordedBefore != nil && f.RecordedAfter.After(*f.RecordedBefore) {
+		verr.Add("recorded_after", "can't be later than recorded_before")
+	}
+	query := repositories.RecordingQuery{
+		Filter: params.Filter,
+		Sort:   params.Sort,
+		Desc:   params.Desc,
+		Limit:  params.Limit + 1,
 	}
-	recordings, err := s.repo.List(ctx, limit)
+	if params.Cursor != "" && !verr.HasErrors() {
+		cursor, err := repositories.DecodeRecordingCursor(params.Cursor, params.Sort, params.Desc)
+		if err != nil {
+			verr.Add("cursor", err.Error())
+		}
+		query.After = &cursor
+	}
+	if verr.HasErrors() {
+		return Page[entities.Recording]{}, verr
+	}
+
+	recordings, err := s.repo.ListPage(ctx, query)
+	if err != nil {
+		return Page[entities.Recording]{}, fmt.Errorf("service: problem retrieving page, %w", err)
+	}
+	total, err := s.repo.Count(ctx, params.Filter)
 	if err != nil {
-		return []entities.Recording{}, fmt.Errorf("service: problem retrieving list, %w", err)
+		return Page[entities.Recording]{}, fmt.Errorf("service: problem retrieving count, %w", err)
+	}
+	page := Page[entities.Recording]{Items: recordings, Total: total}
+	if len(recordings) > params.Limit {
+		page.Items = recordings[:params.Limit]
+		next := repositories.CursorAfter(page.Items[params.Limit-1], params.Sort, params.Desc).Encode()
+		page.NextCursor = &next
 	}
-	return recordings, nil
+	return page, nil
 }
 
-func (s *recordingService) GetCount(ctx context.Context) (int, error) {
-	count, err := s.repo.Count(ctx)
+// Search runs a full-text search over recordings, most relevant first.
+func (s *recordingService) Search(params RecordingSearchParams, ctx context.Context) (Page[entities.RecordingSearchResult], error) {
+	verr := &ValidationError{}
+	tsquery := repositories.PrefixQuery(params.Query)
+	if tsquery == "" {
+		verr.Add("q", "must contain at least one word")
+	}
+	if params.Limit < 1 || params.Limit > MaxPageSize {
+		verr.Add("limit", fmt.Sprintf("must be between 1 and %d", MaxPageSize))
+	}
+	search := repositories.RecordingSearch{Query: tsquery, Limit: params.Limit + 1, Viewer: viewerFrom(ctx)}
+	if params.Cursor != "" {
+		cursor, err := repositories.DecodeRecordingCursor(params.Cursor, "rank", true)
+		if err != nil {
+			verr.Add("cursor", err.Error())
+		}
+		search.After = &cursor
+	}
+	if verr.HasErrors() {
+		return Page[entities.RecordingSearchResult]{}, verr
+	}
+
+	results, err := s.repo.Search(ctx, search)
 	if err != nil {
-		return 0, fmt.Errorf("service: problem retrieving count, %w", err)
+		return Page[entities.RecordingSearchResult]{}, fmt.Errorf("service: problem searching recordings, %w", err)
 	}
-	return count, nil
+	total, err := s.repo.CountSearch(ctx, tsquery, search.Viewer)
+	if err != nil {
+		return Page[entities.RecordingSearchResult]{}, fmt.Errorf("service: problem counting search results, %w", err)
+	}
+	page := Page[entities.RecordingSearchResult]{Items: results, Total: total}
+	if len(results) > params.Limit {
+		page.Items = results[:params.Limit]
+		next := repositories.SearchCursorAfter(page.Items[params.Limit-1]).Encode()
+		page.NextCursor = &next
+	}
+	return page, nil
+}
+
+// Create validates the recording metadata, writes the audio (and artwork, if
+// any) to the blob store and inserts the row. File locations, size and
+// upload date are always set here rather than trusted from the caller, and
+// the format, duration and channels are read from the audio itself. Values
+// the caller sent for those are checked against what was read. The
+// recording is owned by the user creating it.
+func (s *recordingService) Create(recording entities.Recording, audio Upload, artwork *Upload, ctx context.Context) (int, error) {
+	if err := authorizeRecording(ctx, ActionCreate, recording); err != nil {
+		return 0, err
+	}
+	recording.UserID = UserFrom(ctx).ID
+	if recording.Visibility == "" {
+		recording.Visibility = entities.VisibilityPublic
+	}
+	verr := validateRecording(recording)
+	audioExt := fileExtension(audio.Filename)
+	if audio.Content == nil {
+		verr.Add("audio", "an audio file is required")
+	} else if !slices.Contains(audioExtensions, audioExt) {
+		verr.Add("audio", fmt.Sprintf("unsupported audio type %q, expected one of %s", audioExt, strings.Join(audioExtensions, ", ")))
+	}
+	var artworkExt string
+	if artwork != nil {
+		artworkExt = fileExtension(artwork.Filename)
+		if !slices.Contains(artworkExtensions, artworkExt) {
+			verr.Add("artwork", fmt.Sprintf("unsupported image type %q, expected one of %s", artworkExt, strings.Join(artworkExtensions, ", ")))
+		}
+	}
+	if verr.HasErrors() {
+		return 0, verr
+	}
+
+	audioKey, size, err := storeFile(ctx, s.store, "audio", audioExt, audio.Content)
+	if err != nil {
+		return 0, fmt.Errorf("service: problem storing audio, %w", err)
+	}
+	recording.AudioLocation = audioKey
+	recording.Size = float64(size)
+	recording.ArtworkLocation = nil
+
+	info, err := s.readMetadata(ctx, audioKey)
+	if err == nil {
+		verr = applyMetadata(&recording, info)
+	} else if errors.Is(err, metadata.ErrUnsupported) || errors.Is(err, metadata.ErrMalformed) {
+		verr.Add("audio", fmt.Sprintf("unable to read audio file: %v", err))
+	} else {
+		removeStoredFile(ctx, s.store, audioKey)
+		return 0, fmt.Errorf("service: problem reading audio metadata, %w", err)
+	}
+	if verr.HasErrors() {
+		removeStoredFile(ctx, s.store, audioKey)
+		return 0, verr
+	}
+
+	if artwork != nil {
+		artworkKey, _, err := storeFile(ctx, s.store, "artwork", artworkExt, artwork.Content)
+		if err != nil {
+			removeStoredFile(ctx, s.store, audioKey)
+			return 0, fmt.Errorf("service: problem storing artwork, %w", err)
+		}
+		recording.ArtworkLocation = &artworkKey
+	}
+
+	now := time.Now().UTC()
+	recording.DateUploaded = &now
+
+	id, err := s.repo.Insert(recording, ctx)
+	if err != nil {
+		removeStoredFile(ctx, s.store, audioKey)
+		if recording.ArtworkLocation != nil {
+			removeStoredFile(ctx, s.store, *recording.ArtworkLocation)
+		}
+		return 0, fmt.Errorf("service: problem inserting recording, %w", err)
+	}
+	return id, nil
+}
+
+// Update replaces the metadata of an existing recording. The stored files,
+// the properties read from them and the upload date can't be changed this
+// way; see Rescan. A nil embargo keeps the existing one, so an unrelated
+// edit can't lift it; a zero one lifts it.
+func (s *recordingService) Update(recording entities.Recording, ctx context.Context) (entities.Recording, error) {
+	existing, err := s.GetByID(recording.ID, ctx)
+	if err != nil {
+		return entities.Recording{}, err
+	}
+	if err := authorizeRecording(ctx, ActionUpdate, existing); err != nil {
+		return entities.Recording{}, err
+	}
+	switch {
+	case recording.EmbargoUntil == nil:
+		recording.EmbargoUntil = existing.EmbargoUntil
+	case recording.EmbargoUntil.IsZero():
+		recording.EmbargoUntil = nil
+	}
+	return s.save(existing, recording, ctx)
+}
+
+func (s *recordingService) Patch(id int, patch RecordingPatch, ctx context.Context) (entities.Recording, error) {
+	existing, err := s.GetByID(id, ctx)
+	if err != nil {
+		return entities.Recording{}, err
+	}
+	if err := authorizeRecording(ctx, ActionUpdate, existing); err != nil {
+		return entities.Recording{}, err
+	}
+	recording := existing
+	patch.Apply(&recording)
+	return s.save(existing, recording, ctx)
+}
+
+// save validates recording and writes it over existing, keeping the fields
+// that are managed by the server. Only curators may hand a recording to
+// another user; anyone else's changes keep the existing owner. An empty
+// visibility keeps the existing one.
+func (s *recordingService) save(existing, recording entities.Recording, ctx context.Context) (entities.Recording, error) {
+	if recording.UserID == 0 || !HasRole(UserFrom(ctx), entities.RoleCurator) {
+		recording.UserID = existing.UserID
+	}
+	if recording.Visibility == "" {
+		recording.Visibility = existing.Visibility
+	}
+	recording.ID = existing.ID
+	recording.AudioLocation = existing.AudioLocation
+	recording.ArtworkLocation = existing.ArtworkLocation
+	recording.Size = existing.Size
+	recording.DateUploaded = existing.DateUploaded
+	recording.Format = existing.Format
+	recording.Duration = existing.Duration
+	recording.Channels = existing.Channels
+	if verr := validateRecording(recording); verr.HasErrors() {
+		return entities.Recording{}, verr
+	}
+	if err := s.repo.Update(recording, ctx); err != nil {
+		return entities.Recording{}, fmt.Errorf("service: problem updating recording, %w", err)
+	}
+	return recording, nil
+}
+
+// Rescan re-reads a recording's audio file and overwrites its size, format,
+// duration and channels with what's found there.
+func (s *recordingService) Rescan(id int, ctx context.Context) (entities.Recording, error) {
+	if err := requireScope(ctx, ScopeRecordingsWrite); err != nil {
+		return entities.Recording{}, err
+	}
+	recording, err := s.GetByID(id, ctx)
+	if err != nil {
+		return entities.Recording{}, err
+	}
+	stat, err := s.store.Stat(ctx, recording.AudioLocation)
+	if err != nil {
+		return entities.Recording{}, fmt.Errorf("service: problem reading audio file, %w", err)
+	}
+	info, err := s.readMetadata(ctx, recording.AudioLocation)
+	if errors.Is(err, metadata.ErrUnsupported) || errors.Is(err, metadata.ErrMalformed) {
+		verr := &ValidationError{}
+		verr.Add("audio", fmt.Sprintf("unable to read audio file: %v", err))
+		return entities.Recording{}, verr
+	} else if err != nil {
+		return entities.Recording{}, fmt.Errorf("service: problem reading audio metadata, %w", err)
+	}
+	recording.Size = float64(stat.Size)
+	recording.Format = info.Format
+	recording.Duration = info.Seconds()
+	recording.Channels = strconv.Itoa(info.Channels)
+	if err := s.repo.Update(recording, ctx); err != nil {
+		return entities.Recording{}, fmt.Errorf("service: problem updating recording, %w", err)
+	}
+	return recording, nil
+}
+
+// Delete removes the recording and then its audio and artwork files.
+func (s *recordingService) Delete(id int, ctx context.Context) error {
+	recording, err := s.GetByID(id, ctx)
+	if err != nil {
+		return err
+	}
+	if err := authorizeRecording(ctx, ActionDelete, recording); err != nil {
+		return err
+	}
+	if err := s.repo.Delete(id, ctx); err != nil {
+		return fmt.Errorf("service: problem deleting recording, %w", err)
+	}
+	removeStoredFile(ctx, s.store, recording.AudioLocation)
+	if recording.ArtworkLocation != nil {
+		removeStoredFile(ctx, s.store, *recording.ArtworkLocation)
+	}
+	return nil
+}
+
+// removeStoredFile deletes a stored object on a best effort basis; a file
+// left behind is logged rather than failing the request.
+func removeStoredFile(ctx context.Context, store storage.Blob, key string) {
+	if err := store.Delete(ctx, key); err != nil {
+		log.Printf("unable to remove %q: %v", key, err)
+	}
+}
+
+// FeatureCollection returns every recording as a GeoJSON feature placed at
+// its location.
+func (s *recordingService) FeatureCollection(ctx context.Context) (geojson.FeatureCollection, error) {
+	points, err := s.repo.ListPoints(ctx, viewerFrom(ctx))
+	if err != nil {
+		return geojson.FeatureCollection{}, fmt.Errorf("service: problem retrieving recordings, %w", err)
+	}
+	fc := geojson.NewFeatureCollection()
+	for _, p := range points {
+		fc.Add(geojson.NewFeature(p.ID, p.Geom, map[string]any{
+			"title":          p.Title,
+			"recording_date": p.RecordingDate,
+			"duration":       p.Duration,
+			"format":         p.Format,
+			"location_id":    p.LocationID,
+			"location_name":  p.LocationName,
+		}))
+	}
+	return fc, nil
+}
+
+func setIfPresent[T any](dst *T, v *T) {
+	if v != nil {
+		*dst = *v
+	}
+}
+
+// applyMetadata fills the format, duration and channels of recording from
+// info, reporting any the caller had set to something else. Durations within
+// a second are taken to agree, and an Ogg format claim covers Opus in Ogg.
+func applyMetadata(recording *entities.Recording, info metadata.Info) *ValidationError {
+	verr := &ValidationError{}
+	if claimed := strings.ToLower(recording.Format); claimed != "" && claimed != info.Format &&
+		!(claimed == "ogg" && info.Format == "opus") {
+		verr.Add("format", fmt.Sprintf("audio file is %s", info.Format))
+	}
+	if recording.Duration > 0 && abs(recording.Duration-info.Seconds()) > 1 {
+		verr.Add("duration", fmt.Sprintf("audio file is %d seconds long", info.Seconds()))
+	}
+	if claimed, err := strconv.Atoi(recording.Channels); err == nil && claimed != info.Channels {
+		verr.Add("channels", fmt.Sprintf("audio file has %d channels", info.Channels))
+	}
+	recording.Format = info.Format
+	recording.Duration = info.Seconds()
+	recording.Channels = strconv.Itoa(info.Channels)
+	return verr
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+func validateRecording(recording entities.Recording) *ValidationError {
+	verr := &ValidationError{}
+	if strings.TrimSpace(recording.Title) == "" {
+		verr.Add("title", "is required")
+	}
+	if recording.RecordingDate.IsZero() {
+		verr.Add("recording_date", "is required")
+	} else if recording.RecordingDate.After(time.Now()) {
+		verr.Add("recording_date", "can't be in the future")
+	}
+	if recording.LocationID < 1 {
+		verr.Add("location_id", "must be no less than 1")
+	}
+	if recording.UserID < 1 {
+		verr.Add("user_id", "must be no less than 1")
+	}
+	if recording.Duration < 0 {
+		verr.Add("duration", "can't be negative")
+	}
+	if recording.Format != "" && !slices.Contains(audioExtensions, strings.ToLower(recording.Format)) {
+		verr.Add("format", fmt.Sprintf("must be one of %s", strings.Join(audioExtensions, ", ")))
+	}
+	if !slices.Contains(visibilities, recording.Visibility) {
+		verr.Add("visibility", fmt.Sprintf("must be one of %s", strings.Join(visibilities, ", ")))
+	}
+	return verr
+}
+
+// storeFile copies content into a new, randomly named object in dir and
+// returns its key and size in bytes.
+func storeFile(ctx context.Context, store storage.Blob, dir, ext string, content io.Reader) (string, int64, error) {
+	name := make([]byte, 16)
+	if _, err := rand.Read(name); err != nil {
+		return "", 0, err
+	}
+	key := dir + "/" + hex.EncodeToString(name) + "." + ext
+	size, err := store.Put(ctx, key, content)
+	if err != nil {
+		return "", 0, err
+	}
+	return key, size, nil
+}
+
+func (s *recordingService) readMetadata(ctx context.Context, key string) (metadata.Info, error) {
+	obj, _, err := s.store.Get(ctx, key)
+	if err != nil {
+		return metadata.Info{}, err
+	}
+	defer obj.Close()
+	return metadata.Parse(obj)
+}
 
+func fileExtension(filename string) string {
+	return strings.ToLower(strings.TrimPrefix(filepath.Ext(filename), "."))
 }
@@ -1,10 +1,19 @@
 package services
 
 import (
+	"bytes"
 	"context"
+	"encoding/binary"
+	"errors"
 	"field_archive/server/entities"
 	"field_archive/server/internal/database"
+	"field_archive/server/internal/storage"
 	"field_archive/server/repositories"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -16,15 +25,22 @@ type mockRepo struct {
 	mockGetRowByID func(id int, ctx context.Context) (entities.Recording, error)
 	mockUpdate     func(recording entities.Recording, ctx context.Context) error
 	mockDelete     func(id int, ctx context.Context) error
-	mockList       func(ctx context.Context, limit int) ([]entities.Recording, error)
-	mockCount      func(ctw context.Context) (int, error)
+	mockCount      func(ctw context.Context, filter repositories.RecordingFilter) (int, error)
+	mockListPage   func(ctx context.Context, q repositories.RecordingQuery) ([]entities.Recording, error)
+	mockSearch     func(ctx context.Context, q repositories.RecordingSearch) ([]entities.RecordingSearchResult, error)
+	mockCountSrch  func(ctx context.Context, query string) (int, error)
+	mockListPoints func(ctx context.Context) ([]entities.RecordingPoint, error)
+	mockSummaries  func(ctx context.Context, ids []int) ([]entities.RecordingSummary, error)
+	// viewer is the Viewer of the last query that took one.
+	viewer repositories.Viewer
 }
 
 func (r *mockRepo) Insert(recording entities.Recording, ctx context.Context) (int, error) {
 	return r.mockInsert(recording, ctx)
 }
 
-func (r *mockRepo) GetRowByID(id int, ctx context.Context) (entities.Recording, error) {
+func (r *mockRepo) GetRowByID(id int, viewer repositories.Viewer, ctx context.Context) (entities.Recording, error) {
+	r.viewer = viewer
 	return r.mockGetRowByID(id, ctx)
 }
 
@@ -36,18 +52,66 @@ func (r *mockRepo) Delete(id int, ctx context.Context) error {
 	return r.mockDelete(id, ctx)
 }
 
-func (r *mockRepo) List(ctx context.Context, limit int) ([]entities.Recording, error) {
-	return r.mockList(ctx, limit)
+func (r *mockRepo) Count(ctx context.Context, filter repositories.RecordingFilter) (int, error) {
+	return r.mockCount(ctx, filter)
 }
 
-func (r *mockRepo) Count(ctx context.Context) (int, error) {
-	return r.mockCount(ctx)
+func (r *mockRepo) ListPage(ctx context.Context, q repositories.RecordingQuery) ([]entities.Recording, error) {
+	return r.mockListPage(ctx, q)
+}
+
+func (r *mockRepo) ListPoints(ctx context.Context, viewer repositories.Viewer) ([]entities.RecordingPoint, error) {
+	r.viewer = viewer
+	return r.mockListPoints(ctx)
+}
+
+func (r *mockRepo) Summaries(ctx context.Context, viewer repositories.Viewer, ids []int) ([]entities.RecordingSummary, error) {
+	r.viewer = viewer
+	return r.mockSummaries(ctx, ids)
+}
+
+func (r *mockRepo) Search(ctx context.Context, q repositories.RecordingSearch) ([]entities.RecordingSearchResult, error) {
+	return r.mockSearch(ctx, q)
+}
+
+func (r *mockRepo) CountSearch(ctx context.Context, query string, viewer repositories.Viewer) (int, error) {
+	r.viewer = viewer
+	return r.mockCountSrch(ctx, query)
+}
+
+// wavFile returns a 16 bit PCM WAV file of silence.
+func wavFile(channels, sampleRate, seconds int) []byte {
+	b := &bytes.Buffer{}
+	dataSize := channels * 2 * sampleRate * seconds
+	b.WriteString("RIFF")
+	binary.Write(b, binary.LittleEndian, uint32(36+dataSize))
+	b.WriteString("WAVEfmt ")
+	binary.Write(b, binary.LittleEndian, []uint32{16})
+	binary.Write(b, binary.LittleEndian, []uint16{1, uint16(channels)})
+	binary.Write(b, binary.LittleEndian, []uint32{uint32(sampleRate), uint32(sampleRate * channels * 2)})
+	binary.Write(b, binary.LittleEndian, []uint16{uint16(channels * 2), 16})
+	b.WriteString("data")
+	binary.Write(b, binary.LittleEndian, uint32(dataSize))
+	b.Write(make([]byte, dataSize))
+	return b.Bytes()
+}
+
+// newStore returns a filesystem store in a temporary directory along with
+// the directory.
+func newStore(t *testing.T) (*storage.Filesystem, string) {
+	root := t.TempDir()
+	store, err := storage.NewFilesystem(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store, root
 }
 
 func TestNewRecordingService(t *testing.T) {
-	r := repositories.NewRecordingRepo(&database.Postgres{})
-	s := NewRecordingService(r)
-	check := &recordingService{repo: r}
+	r := repositories.NewRecordingRepo(&database.Postgres{}, repositories.Grids{Low: 1000, High: 10000})
+	store := &storage.Filesystem{}
+	s := NewRecordingService(r, store)
+	check := &recordingService{repo: r, store: store}
 	assert.Equal(t, s, check)
 }
 
@@ -80,30 +144,464 @@ func TestGetByID(t *testing.T) {
 	}
 }
 
-func TestListItems(t *testing.T) {
-	check := []entities.Recording{
-		{Title: "Test Title",
-			AudioLocation: "test/audio/location.mp3",
-			DateUploaded:  nil,
-			RecordingDate: time.Now(),
-			LocationID:    1,
-			Duration:      120,
-			Format:        "mp3",
-			Description:   "Test description",
-			Equipment:     "Test equipment",
-			Size:          2048,
-			Channels:      "2",
-			License:       "Creative Commons"},
+func TestCreate(t *testing.T) {
+	store, root := newStore(t)
+	var inserted entities.Recording
+	mockRepo := &mockRepo{
+		mockInsert: func(recording entities.Recording, ctx context.Context) (int, error) {
+			inserted = recording
+			return 4, nil
+		},
+	}
+	s := &recordingService{repo: mockRepo, store: store}
+	recording := entities.Recording{
+		Title:         "Test Title",
+		AudioLocation: "/etc/passwd",
+		RecordingDate: time.Date(2025, 1, 6, 20, 2, 57, 0, time.UTC),
+		LocationID:    1,
+		UserID:        1,
+		Size:          1,
+	}
+	wav := wavFile(2, 8000, 3)
+	audio := Upload{Filename: "field.WAV", Content: bytes.NewReader(wav)}
+	artwork := &Upload{Filename: "cover.png", Content: strings.NewReader("png")}
+
+	id, err := s.Create(recording, audio, artwork, actingAs(1, entities.RoleContributor))
+	assert.NoError(t, err)
+	assert.Equal(t, 4, id)
+	assert.Equal(t, "audio", path.Dir(inserted.AudioLocation))
+	assert.Equal(t, "wav", inserted.Format)
+	assert.Equal(t, float64(len(wav)), inserted.Size)
+	assert.Equal(t, 3, inserted.Duration)
+	assert.Equal(t, "2", inserted.Channels)
+	assert.NotNil(t, inserted.DateUploaded)
+	stored, err := os.ReadFile(filepath.Join(root, inserted.AudioLocation))
+	assert.NoError(t, err)
+	assert.Equal(t, wav, stored)
+	if assert.NotNil(t, inserted.ArtworkLocation) {
+		assert.Equal(t, "artwork", path.Dir(*inserted.ArtworkLocation))
+		assert.FileExists(t, filepath.Join(root, *inserted.ArtworkLocation))
+	}
+}
+
+func TestCreateValidation(t *testing.T) {
+	store, _ := newStore(t)
+	s := &recordingService{repo: &mockRepo{}, store: store}
+	recording := entities.Recording{
+		RecordingDate: time.Now().Add(time.Hour),
+		Duration:      -1,
 	}
+	audio := Upload{Filename: "notes.txt", Content: strings.NewReader("text")}
+
+	_, err := s.Create(recording, audio, nil, actingAs(1, entities.RoleContributor))
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("expected a validation error, got %v", err)
+	}
+	for _, field := range []string{"title", "recording_date", "location_id", "duration", "audio"} {
+		assert.Contains(t, verr.Fields, field)
+	}
+}
+
+func TestCreateRemovesFilesOnInsertFailure(t *testing.T) {
+	store, root := newStore(t)
 	mockRepo := &mockRepo{
-		mockList: func(ctx context.Context, limit int) ([]entities.Recording, error) {
-			return check, nil
+		mockInsert: func(recording entities.Recording, ctx context.Context) (int, error) {
+			return 0, errors.New("insert failed")
+		},
+	}
+	s := &recordingService{repo: mockRepo, store: store}
+	recording := entities.Recording{
+		Title:         "Test Title",
+		RecordingDate: time.Date(2025, 1, 6, 20, 2, 57, 0, time.UTC),
+		LocationID:    1,
+		UserID:        1,
+	}
+	_, err := s.Create(recording, Upload{Filename: "a.wav", Content: bytes.NewReader(wavFile(1, 8000, 1))}, nil, actingAs(1, entities.RoleContributor))
+	assert.Error(t, err)
+	entries, _ := os.ReadDir(filepath.Join(root, "audio"))
+	assert.Empty(t, entries)
+}
+
+func TestPatch(t *testing.T) {
+	existing := entities.Recording{
+		ID:            2,
+		Title:         "Old Title",
+		AudioLocation: "audio/a.wav",
+		RecordingDate: time.Date(2025, 1, 6, 20, 2, 57, 0, time.UTC),
+		LocationID:    1,
+		UserID:        1,
+		Format:        "wav",
+		Size:          2048,
+		Visibility:    entities.VisibilityPublic,
+	}
+	var updated entities.Recording
+	mockRepo := &mockRepo{
+		mockGetRowByID: func(id int, ctx context.Context) (entities.Recording, error) {
+			return existing, nil
+		},
+		mockUpdate: func(recording entities.Recording, ctx context.Context) error {
+			updated = recording
+			return nil
 		},
 	}
 	s := &recordingService{repo: mockRepo}
-	res, err := s.ListItems(1, context.Background())
-	assert.Equal(t, res, check)
-	if err != nil {
-		t.Errorf("Error listing items %v", err)
+	title := "New Title"
+	res, err := s.Patch(2, RecordingPatch{Title: &title}, actingAs(1, entities.RoleContributor))
+	assert.NoError(t, err)
+	want := existing
+	want.Title = title
+	assert.Equal(t, want, res)
+	assert.Equal(t, want, updated)
+}
+
+func TestUpdateKeepsServerManagedFields(t *testing.T) {
+	existing := entities.Recording{
+		ID:            2,
+		AudioLocation: "audio/a.wav",
+		Format:        "wav",
+		Size:          2048,
+		Visibility:    entities.VisibilityPublic,
 	}
+	mockRepo := &mockRepo{
+		mockGetRowByID: func(id int, ctx context.Context) (entities.Recording, error) {
+			return existing, nil
+		},
+		mockUpdate: func(recording entities.Recording, ctx context.Context) error {
+			return nil
+		},
+	}
+	s := &recordingService{repo: mockRepo}
+	res, err := s.Update(entities.Recording{
+		ID:            2,
+		Title:         "Title",
+		AudioLocation: "/etc/passwd",
+		RecordingDate: time.Date(2025, 1, 6, 20, 2, 57, 0, time.UTC),
+		LocationID:    1,
+		UserID:        1,
+	}, actingAs(1, entities.RoleCurator))
+	assert.NoError(t, err)
+	assert.Equal(t, "audio/a.wav", res.AudioLocation)
+	assert.Equal(t, float64(2048), res.Size)
+	assert.Equal(t, "wav", res.Format)
+}
+
+func TestUpdateNotFound(t *testing.T) {
+	mockRepo := &mockRepo{
+		mockGetRowByID: func(id int, ctx context.Context) (entities.Recording, error) {
+			return entities.Recording{}, fmt.Errorf("recording with id %d %w", id, repositories.ErrNotFound)
+		},
+	}
+	s := &recordingService{repo: mockRepo}
+	_, err := s.Update(entities.Recording{ID: 9}, actingAs(1, entities.RoleContributor))
+	assert.ErrorIs(t, err, repositories.ErrNotFound)
+}
+
+func TestDeleteRemovesFiles(t *testing.T) {
+	store, root := newStore(t)
+	audioPath := filepath.Join(root, "audio", "a.wav")
+	artworkPath := filepath.Join(root, "artwork", "a.png")
+	outside := filepath.Join(t.TempDir(), "keep.wav")
+	for _, p := range []string{audioPath, artworkPath, outside} {
+		os.MkdirAll(filepath.Dir(p), 0o755)
+		os.WriteFile(p, []byte("data"), 0o644)
+	}
+	artworkKey := "artwork/a.png"
+	outsideKey, _ := filepath.Rel(root, outside)
+	rows := map[int]entities.Recording{
+		1: {ID: 1, AudioLocation: "audio/a.wav", ArtworkLocation: &artworkKey},
+		2: {ID: 2, AudioLocation: filepath.ToSlash(outsideKey)},
+	}
+	mockRepo := &mockRepo{
+		mockGetRowByID: func(id int, ctx context.Context) (entities.Recording, error) {
+			return rows[id], nil
+		},
+		mockDelete: func(id int, ctx context.Context) error {
+			return nil
+		},
+	}
+	s := &recordingService{repo: mockRepo, store: store}
+
+	assert.NoError(t, s.Delete(1, actingAs(1, entities.RoleCurator)))
+	assert.NoFileExists(t, audioPath)
+	assert.NoFileExists(t, artworkPath)
+
+	assert.NoError(t, s.Delete(2, actingAs(1, entities.RoleCurator)))
+	assert.FileExists(t, outside)
+}
+
+func TestRecordingFeatureCollection(t *testing.T) {
+	geom := `{"type":"Point","coordinates":[-0.12,51.5]}`
+	mockRepo := &mockRepo{
+		mockListPoints: func(ctx context.Context) ([]entities.RecordingPoint, error) {
+			return []entities.RecordingPoint{{
+				ID:            3,
+				Title:         "Dawn Chorus",
+				RecordingDate: time.Date(2025, 1, 6, 5, 0, 0, 0, time.UTC),
+				Duration:      300,
+				Format:        "wav",
+				LocationID:    1,
+				LocationName:  "Marsh",
+				Geom:          &geom,
+			}}, nil
+		},
+	}
+	s := &recordingService{repo: mockRepo}
+	fc, err := s.FeatureCollection(context.Background())
+	assert.NoError(t, err)
+	if assert.Len(t, fc.Features, 1) {
+		assert.Equal(t, 3, fc.Features[0].ID)
+		assert.JSONEq(t, geom, string(fc.Features[0].Geometry))
+		assert.Equal(t, "Marsh", fc.Features[0].Properties["location_name"])
+	}
+}
+
+func TestListPage(t *testing.T) {
+	rows := []entities.Recording{
+		{ID: 5, Title: "A", Duration: 10},
+		{ID: 6, Title: "B", Duration: 20},
+		{ID: 7, Title: "C", Duration: 30},
+	}
+	format := "wav"
+	var queries []repositories.RecordingQuery
+	mockRepo := &mockRepo{
+		mockListPage: func(ctx context.Context, q repositories.RecordingQuery) ([]entities.Recording, error) {
+			queries = append(queries, q)
+			start := 0
+			if q.After != nil {
+				start = 2
+			}
+			end := min(start+q.Limit, len(rows))
+			return rows[start:end], nil
+		},
+		mockCount: func(ctx context.Context, filter repositories.RecordingFilter) (int, error) {
+			assert.Equal(t, &format, filter.Format)
+			assert.Equal(t, []string{"dawn chorus", "hydrophone"}, filter.Tags)
+			return len(rows), nil
+		},
+	}
+	s := &recordingService{repo: mockRepo}
+	params := RecordingListParams{
+		Filter: repositories.RecordingFilter{Format: &format, Tags: []string{"Dawn Chorus", "hydrophone", " ", "dawn chorus"}},
+		Sort:   "title",
+		Limit:  2,
+	}
+
+	page, err := s.ListPage(params, context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, rows[:2], page.Items)
+	assert.Equal(t, 3, page.Total)
+	assert.Equal(t, 3, queries[0].Limit)
+	if assert.NotNil(t, page.NextCursor) {
+		params.Cursor = *page.NextCursor
+	}
+
+	page, err = s.ListPage(params, context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, rows[2:], page.Items)
+	assert.Nil(t, page.NextCursor)
+	if assert.NotNil(t, queries[1].After) {
+		assert.Equal(t, "B", queries[1].After.Value)
+		assert.Equal(t, 6, queries[1].After.ID)
+	}
+}
+
+func TestListPageValidation(t *testing.T) {
+	s := &recordingService{repo: &mockRepo{}}
+	minDuration, maxDuration := 30, 10
+	_, err := s.ListPage(RecordingListParams{
+		Filter: repositories.RecordingFilter{MinDuration: &minDuration, MaxDuration: &maxDuration},
+		Sort:   "size",
+		Limit:  MaxPageSize + 1,
+	}, context.Background())
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("expected a validation error, got %v", err)
+	}
+	assert.Contains(t, verr.Fields, "sort")
+	assert.Contains(t, verr.Fields, "limit")
+	assert.Contains(t, verr.Fields, "min_duration")
+
+	cursor := repositories.CursorAfter(entities.Recording{ID: 1, Title: "A"}, "title", false).Encode()
+	_, err = s.ListPage(RecordingListParams{Sort: "duration", Limit: 10, Cursor: cursor}, context.Background())
+	if !errors.As(err, &verr) {
+		t.Fatalf("expected a validation error, got %v", err)
+	}
+	assert.Contains(t, verr.Fields, "cursor")
+}
+
+func TestSearch(t *testing.T) {
+	results := []entities.RecordingSearchResult{
+		{Recording: entities.Recording{ID: 3}, Rank: 0.9},
+		{Recording: entities.Recording{ID: 1}, Rank: 0.5},
+	}
+	mockRepo := &mockRepo{
+		mockSearch: func(ctx context.Context, q repositories.RecordingSearch) ([]entities.RecordingSearchResult, error) {
+			assert.Equal(t, "dawn:* & chor:*", q.Query)
+			assert.Equal(t, 2, q.Limit)
+			return results, nil
+		},
+		mockCountSrch: func(ctx context.Context, query string) (int, error) {
+			return 2, nil
+		},
+	}
+	s := &recordingService{repo: mockRepo}
+	page, err := s.Search(RecordingSearchParams{Query: "dawn chor", Limit: 1}, context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, results[:1], page.Items)
+	assert.Equal(t, 2, page.Total)
+	assert.NotNil(t, page.NextCursor)
+
+	_, err = s.Search(RecordingSearchParams{Query: "!!", Limit: 1}, context.Background())
+	var verr *ValidationError
+	assert.ErrorAs(t, err, &verr)
+	assert.Contains(t, verr.Fields, "q")
+}
+
+func TestCreateChecksClaimedMetadata(t *testing.T) {
+	store, root := newStore(t)
+	s := &recordingService{repo: &mockRepo{}, store: store}
+	recording := entities.Recording{
+		Title:         "Test Title",
+		RecordingDate: time.Date(2025, 1, 6, 20, 2, 57, 0, time.UTC),
+		LocationID:    1,
+		UserID:        1,
+		Duration:      600,
+		Format:        "mp3",
+		Channels:      "1",
+	}
+	_, err := s.Create(recording, Upload{Filename: "a.wav", Content: bytes.NewReader(wavFile(2, 8000, 2))}, nil, actingAs(1, entities.RoleContributor))
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("expected a validation error, got %v", err)
+	}
+	assert.Equal(t, map[string]string{
+		"format":   "audio file is wav",
+		"duration": "audio file is 2 seconds long",
+		"channels": "audio file has 2 channels",
+	}, verr.Fields)
+	entries, _ := os.ReadDir(filepath.Join(root, "audio"))
+	assert.Empty(t, entries)
+
+	_, err = s.Create(recording, Upload{Filename: "a.wav", Content: strings.NewReader("not really a wav")}, nil, actingAs(1, entities.RoleContributor))
+	if !errors.As(err, &verr) {
+		t.Fatalf("expected a validation error, got %v", err)
+	}
+	assert.Contains(t, verr.Fields, "audio")
+}
+
+func TestRescan(t *testing.T) {
+	store, _ := newStore(t)
+	wav := wavFile(1, 8000, 4)
+	store.Put(context.Background(), "audio/a.wav", bytes.NewReader(wav))
+	var updated entities.Recording
+	mockRepo := &mockRepo{
+		mockGetRowByID: func(id int, ctx context.Context) (entities.Recording, error) {
+			return entities.Recording{ID: id, AudioLocation: "audio/a.wav", Format: "mp3", Duration: 99, Channels: "2"}, nil
+		},
+		mockUpdate: func(recording entities.Recording, ctx context.Context) error {
+			updated = recording
+			return nil
+		},
+	}
+	s := &recordingService{repo: mockRepo, store: store}
+	res, err := s.Rescan(1, context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, res, updated)
+	assert.Equal(t, "wav", res.Format)
+	assert.Equal(t, 4, res.Duration)
+	assert.Equal(t, "1", res.Channels)
+	assert.Equal(t, float64(len(wav)), res.Size)
+
+	store.Put(context.Background(), "audio/a.wav", strings.NewReader("not audio"))
+	_, err = s.Rescan(1, context.Background())
+	var verr *ValidationError
+	assert.ErrorAs(t, err, &verr)
+	assert.Contains(t, verr.Fields, "audio")
+}
+
+func TestRecordingViewer(t *testing.T) {
+	mockRepo := &mockRepo{
+		mockGetRowByID: func(id int, ctx context.Context) (entities.Recording, error) {
+			return entities.Recording{ID: id}, nil
+		},
+		mockCount: func(ctx context.Context, filter repositories.RecordingFilter) (int, error) {
+			assert.Equal(t, repositories.Viewer{UserID: 3}, filter.Viewer)
+			return 0, nil
+		},
+	}
+	s := &recordingService{repo: mockRepo}
+
+	s.GetByID(1, context.Background())
+	assert.Equal(t, repositories.Viewer{}, mockRepo.viewer)
+	s.GetByID(1, actingAs(3, entities.RoleContributor))
+	assert.Equal(t, repositories.Viewer{UserID: 3}, mockRepo.viewer)
+	s.GetByID(1, actingAs(4, entities.RoleCurator))
+	assert.Equal(t, repositories.Viewer{UserID: 4, SeesAll: true}, mockRepo.viewer)
+
+	_, err := s.GetCount(actingAs(3, entities.RoleContributor))
+	assert.NoError(t, err)
+}
+
+func TestRecordingVisibility(t *testing.T) {
+	store, _ := newStore(t)
+	var inserted entities.Recording
+	mockRepo := &mockRepo{
+		mockInsert: func(recording entities.Recording, ctx context.Context) (int, error) {
+			inserted = recording
+			return 1, nil
+		},
+	}
+	s := &recordingService{repo: mockRepo, store: store}
+	recording := entities.Recording{
+		Title:         "Nightjar",
+		RecordingDate: time.Date(2025, 1, 6, 20, 2, 57, 0, time.UTC),
+		LocationID:    1,
+	}
+	upload := func() Upload {
+		return Upload{Filename: "a.wav", Content: bytes.NewReader(wavFile(1, 8000, 1))}
+	}
+	_, err := s.Create(recording, upload(), nil, actingAs(1, entities.RoleContributor))
+	assert.NoError(t, err)
+	assert.Equal(t, entities.VisibilityPublic, inserted.Visibility)
+
+	recording.Visibility = "secret"
+	_, err = s.Create(recording, upload(), nil, actingAs(1, entities.RoleContributor))
+	var verr *ValidationError
+	if assert.ErrorAs(t, err, &verr) {
+		assert.Contains(t, verr.Fields, "visibility")
+	}
+
+	until := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	existing := entities.Recording{ID: 2, Title: "Nightjar", RecordingDate: recording.RecordingDate, LocationID: 1, UserID: 1,
+		Visibility: entities.VisibilityUnlisted, EmbargoUntil: &until}
+	mockRepo.mockGetRowByID = func(id int, ctx context.Context) (entities.Recording, error) {
+		return existing, nil
+	}
+	mockRepo.mockUpdate = func(recording entities.Recording, ctx context.Context) error {
+		return nil
+	}
+	private := entities.VisibilityPrivate
+	res, err := s.Patch(2, RecordingPatch{Visibility: &private}, actingAs(1, entities.RoleContributor))
+	assert.NoError(t, err)
+	assert.Equal(t, entities.VisibilityPrivate, res.Visibility)
+	assert.Equal(t, &until, res.EmbargoUntil)
+
+	// A zero embargo lifts it.
+	res, err = s.Patch(2, RecordingPatch{EmbargoUntil: &time.Time{}}, actingAs(1, entities.RoleContributor))
+	assert.NoError(t, err)
+	assert.Nil(t, res.EmbargoUntil)
+	assert.Equal(t, entities.VisibilityUnlisted, res.Visibility)
+
+	// Replacing the metadata without mentioning the embargo keeps it.
+	replacement := entities.Recording{ID: 2, Title: "Nightjar at dusk", RecordingDate: recording.RecordingDate, LocationID: 1}
+	res, err = s.Update(replacement, actingAs(1, entities.RoleContributor))
+	assert.NoError(t, err)
+	assert.Equal(t, &until, res.EmbargoUntil)
+	assert.Equal(t, entities.VisibilityUnlisted, res.Visibility)
+
+	replacement.EmbargoUntil = &time.Time{}
+	res, err = s.Update(replacement, actingAs(1, entities.RoleContributor))
+	assert.NoError(t, err)
+	assert.Nil(t, res.EmbargoUntil)
 }
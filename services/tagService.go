@@ -0,0 +1,136 @@
+package services
+
+import (
+	"context"
+	"field_archive/server/entities"
+	"field_archive/server/repositories"
+	"fmt"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+type TagService interface {
+	ListForRecording(recordingID int, ctx context.Context) ([]string, error)
+	Attach(recordingID int, name string, ctx context.Context) ([]string, error)
+	Detach(recordingID int, name string, ctx context.Context) error
+	Autocomplete(prefix string, limit int, ctx context.Context) ([]entities.Tag, error)
+}
+
+const (
+	// MaxTagLength caps the length of a tag name in characters.
+	MaxTagLength = 50
+	// MaxTagSuggestions caps the number of tags returned by Autocomplete.
+	MaxTagSuggestions = 50
+)
+
+type tagService struct {
+	repo       repositories.TagRepository
+	recordings repositories.RecordingRepository
+}
+
+func NewTagService(repo repositories.TagRepository, recordings repositories.RecordingRepository) *tagService {
+	return &tagService{repo: repo, recordings: recordings}
+}
+
+// ListForRecording returns the tags on a recording the acting user can see.
+func (s *tagService) ListForRecording(recordingID int, ctx context.Context) ([]string, error) {
+	if _, err := s.recording(recordingID, ctx); err != nil {
+		return nil, err
+	}
+	tags, err := s.repo.ListByRecording(recordingID, ctx)
+	if err != nil {
+		return nil, fmt.Errorf("service: problem retrieving tags, %w", err)
+	}
+	return tags, nil
+}
+
+// Attach tags a recording, returning all of its tags. Tagging is an edit, so
+// only those who may update the recording can do it.
+func (s *tagService) Attach(recordingID int, name string, ctx context.Context) ([]string, error) {
+	name = NormalizeTag(name)
+	if verr := validateTag("name", name); verr.HasErrors() {
+		return nil, verr
+	}
+	recording, err := s.recording(recordingID, ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := authorizeRecording(ctx, ActionUpdate, recording); err != nil {
+		return nil, err
+	}
+	if err := s.repo.Attach(recordingID, name, ctx); err != nil {
+		return nil, fmt.Errorf("service: problem attaching tag, %w", err)
+	}
+	return s.ListForRecording(recordingID, ctx)
+}
+
+func (s *tagService) Detach(recordingID int, name string, ctx context.Context) error {
+	recording, err := s.recording(recordingID, ctx)
+	if err != nil {
+		return err
+	}
+	if err := authorizeRecording(ctx, ActionUpdate, recording); err != nil {
+		return err
+	}
+	if err := s.repo.Detach(recordingID, NormalizeTag(name), ctx); err != nil {
+		return fmt.Errorf("service: problem detaching tag, %w", err)
+	}
+	return nil
+}
+
+// Autocomplete suggests up to limit tags starting with prefix, most used
+// first, with the number of recordings the acting user can see carrying each.
+func (s *tagService) Autocomplete(prefix string, limit int, ctx context.Context) ([]entities.Tag, error) {
+	if limit < 1 || limit > MaxTagSuggestions {
+		verr := &ValidationError{}
+		verr.Add("limit", fmt.Sprintf("must be between 1 and %d", MaxTagSuggestions))
+		return nil, verr
+	}
+	tags, err := s.repo.Search(ctx, viewerFrom(ctx), NormalizeTag(prefix), limit)
+	if err != nil {
+		return nil, fmt.Errorf("service: problem searching tags, %w", err)
+	}
+	return tags, nil
+}
+
+func (s *tagService) recording(id int, ctx context.Context) (entities.Recording, error) {
+	recording, err := s.recordings.GetRowByID(id, viewerFrom(ctx), ctx)
+	if err != nil {
+		return entities.Recording{}, fmt.Errorf("service: problem retrieving recording by ID, %w", err)
+	}
+	return recording, nil
+}
+
+// NormalizeTag lower-cases a tag name and collapses its whitespace, so
+// "Dawn  Chorus " and "dawn chorus" are the same tag.
+func NormalizeTag(name string) string {
+	return strings.Join(strings.Fields(strings.ToLower(name)), " ")
+}
+
+// normalizeTags normalizes names, dropping blanks and duplicates.
+func normalizeTags(names []string) []string {
+	res := []string{}
+	for _, name := range names {
+		name = NormalizeTag(name)
+		if name != "" && !slices.Contains(res, name) {
+			res = append(res, name)
+		}
+	}
+	return res
+}
+
+// validateTag checks a normalized tag name. Commas are kept out as the
+// recording list takes several tags as one comma separated ?tag=.
+func validateTag(field, name string) *ValidationError {
+	verr := &ValidationError{}
+	switch {
+	case name == "":
+		verr.Add(field, "is required")
+	case utf8.RuneCountInString(name) > MaxTagLength:
+		verr.Add(field, fmt.Sprintf("can't be longer than %d characters", MaxTagLength))
+	case strings.Contains(name, ","):
+		verr.Add(field, "can't contain commas")
+	}
+	return verr
+}
@@ -0,0 +1,106 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"field_archive/server/entities"
+	"field_archive/server/repositories"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type mockTagRepo struct {
+	tags   map[int][]string
+	viewer repositories.Viewer
+	prefix string
+}
+
+func (m *mockTagRepo) Attach(recordingID int, name string, ctx context.Context) error {
+	if !slices.Contains(m.tags[recordingID], name) {
+		m.tags[recordingID] = append(m.tags[recordingID], name)
+	}
+	return nil
+}
+
+func (m *mockTagRepo) Detach(recordingID int, name string, ctx context.Context) error {
+	i := slices.Index(m.tags[recordingID], name)
+	if i < 0 {
+		return fmt.Errorf("tag %q %w", name, repositories.ErrNotFound)
+	}
+	m.tags[recordingID] = slices.Delete(m.tags[recordingID], i, i+1)
+	return nil
+}
+
+func (m *mockTagRepo) ListByRecording(recordingID int, ctx context.Context) ([]string, error) {
+	return slices.Sorted(slices.Values(m.tags[recordingID])), nil
+}
+
+func (m *mockTagRepo) Search(ctx context.Context, viewer repositories.Viewer, prefix string, limit int) ([]entities.Tag, error) {
+	m.viewer, m.prefix = viewer, prefix
+	return []entities.Tag{}, nil
+}
+
+func TestTagLifecycle(t *testing.T) {
+	recordings := &mockRepo{
+		mockGetRowByID: func(id int, ctx context.Context) (entities.Recording, error) {
+			if id != 2 {
+				return entities.Recording{}, fmt.Errorf("recording with id %d %w", id, repositories.ErrNotFound)
+			}
+			return entities.Recording{ID: 2, UserID: 7}, nil
+		},
+	}
+	repo := &mockTagRepo{tags: map[int][]string{}}
+	s := NewTagService(repo, recordings)
+	owner := actingAs(7, entities.RoleContributor)
+
+	tags, err := s.Attach(2, "  Dawn   Chorus ", owner)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"dawn chorus"}, tags)
+	tags, err = s.Attach(2, "hydrophone", owner)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"dawn chorus", "hydrophone"}, tags)
+
+	// Tagging someone else's recording is an edit they aren't allowed.
+	_, err = s.Attach(2, "wind", actingAs(8, entities.RoleContributor))
+	assert.ErrorIs(t, err, ErrForbidden)
+	assert.ErrorIs(t, s.Detach(2, "hydrophone", actingAs(8, entities.RoleContributor)), ErrForbidden)
+	_, err = s.Attach(3, "wind", owner)
+	assert.ErrorIs(t, err, repositories.ErrNotFound)
+
+	assert.NoError(t, s.Detach(2, "Dawn Chorus", owner))
+	assert.ErrorIs(t, s.Detach(2, "dawn chorus", owner), repositories.ErrNotFound)
+	tags, err = s.ListForRecording(2, context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"hydrophone"}, tags)
+}
+
+func TestAttachTagValidation(t *testing.T) {
+	s := NewTagService(&mockTagRepo{}, &mockRepo{})
+	for _, name := range []string{" ", "wind, rain", strings.Repeat("a", MaxTagLength+1)} {
+		_, err := s.Attach(2, name, actingAs(7, entities.RoleContributor))
+		var verr *ValidationError
+		if !errors.As(err, &verr) {
+			t.Fatalf("expected a validation error for %q, got %v", name, err)
+		}
+		assert.Contains(t, verr.Fields, "name")
+	}
+}
+
+func TestAutocompleteTags(t *testing.T) {
+	repo := &mockTagRepo{}
+	s := NewTagService(repo, &mockRepo{})
+
+	_, err := s.Autocomplete("Dawn ", 10, actingAs(7, entities.RoleContributor))
+	assert.NoError(t, err)
+	assert.Equal(t, "dawn", repo.prefix)
+	assert.Equal(t, repositories.Viewer{UserID: 7}, repo.viewer)
+
+	_, err = s.Autocomplete("dawn", MaxTagSuggestions+1, context.Background())
+	var verr *ValidationError
+	assert.ErrorAs(t, err, &verr)
+	assert.Contains(t, verr.Fields, "limit")
+}
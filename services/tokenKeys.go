@@ -0,0 +1,282 @@
+package services
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"field_archive/server/internal/config"
+	"fmt"
+	"math/big"
+	"os"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// minHMACSecret is the shortest JWT_SECRET accepted, the size of an HS256
+// output.
+const minHMACSecret = 32
+
+// minRSABits is the smallest RSA modulus accepted for RS256 keys.
+const minRSABits = 2048
+
+// TokenKeys holds the key tokens are signed with and every key tokens are
+// still accepted from, looked up by the "kid" header. Keeping the previous
+// signing key as a verification key lets keys be rotated without logging
+// everyone out.
+type TokenKeys struct {
+	signing *tokenKey
+	verify  map[string]*tokenKey
+	order   []string
+}
+
+type tokenKey struct {
+	id      string
+	method  jwt.SigningMethod
+	private any // crypto.Signer or []byte for HMAC; nil for verification only keys
+	public  any // crypto.PublicKey or []byte for HMAC
+}
+
+// LoadTokenKeys builds the key set from the config. JWT_SIGNING_KEY names a
+// PEM encoded RSA or Ed25519 private key used to sign new tokens, and
+// JWT_VERIFY_KEYS lists further PEM files (public or private keys) whose
+// tokens are still accepted. Without a signing key tokens are signed with
+// HS256 using JWT_SECRET. It is an error for no usable signing key to be
+// configured.
+func LoadTokenKeys(cfg config.Config) (*TokenKeys, error) {
+	keys := &TokenKeys{verify: map[string]*tokenKey{}}
+	if cfg.JwtSigningKey != "" {
+		key, err := loadKeyFile(cfg.JwtSigningKey)
+		if err != nil {
+			return nil, err
+		}
+		if key.private == nil {
+			return nil, fmt.Errorf("token keys: %s holds a public key, signing needs a private key", cfg.JwtSigningKey)
+		}
+		keys.add(key)
+		keys.signing = key
+	}
+	for _, path := range cfg.JwtVerifyKeys {
+		key, err := loadKeyFile(path)
+		if err != nil {
+			return nil, err
+		}
+		keys.add(key)
+	}
+	if cfg.JwtSecret != "" {
+		key, err := hmacKey([]byte(cfg.JwtSecret))
+		if err != nil {
+			return nil, err
+		}
+		keys.add(key)
+		if keys.signing == nil {
+			keys.signing = key
+		}
+	}
+	if keys.signing == nil {
+		return nil, errors.New("token keys: no signing key configured, set JWT_SIGNING_KEY or JWT_SECRET")
+	}
+	return keys, nil
+}
+
+// NewHMACKeys returns a key set that signs and verifies with HS256 only.
+func NewHMACKeys(secret []byte) (*TokenKeys, error) {
+	key, err := hmacKey(secret)
+	if err != nil {
+		return nil, err
+	}
+	keys := &TokenKeys{verify: map[string]*tokenKey{}}
+	keys.add(key)
+	keys.signing = key
+	return keys, nil
+}
+
+// NewSigningKeys returns a key set that signs with signer, an RSA or Ed25519
+// private key, and also accepts tokens from the public keys in verify.
+func NewSigningKeys(signer crypto.Signer, verify ...crypto.PublicKey) (*TokenKeys, error) {
+	keys := &TokenKeys{verify: map[string]*tokenKey{}}
+	key, err := asymmetricKey(signer, signer.Public())
+	if err != nil {
+		return nil, err
+	}
+	keys.add(key)
+	keys.signing = key
+	for _, pub := range verify {
+		key, err := asymmetricKey(nil, pub)
+		if err != nil {
+			return nil, err
+		}
+		keys.add(key)
+	}
+	return keys, nil
+}
+
+func (k *TokenKeys) add(key *tokenKey) {
+	if _, ok := k.verify[key.id]; !ok {
+		k.order = append(k.order, key.id)
+	}
+	k.verify[key.id] = key
+}
+
+// sign returns claims as a token signed with the signing key.
+func (k *TokenKeys) sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(k.signing.method, claims)
+	token.Header["kid"] = k.signing.id
+	return token.SignedString(k.signing.private)
+}
+
+// parse verifies tokenString against the key named by its kid header,
+// checking that the algorithm is the one that key is for.
+func (k *TokenKeys) parse(tokenString string) (*jwt.Token, error) {
+	return jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, ok := k.verify[kid]
+		if !ok {
+			return nil, fmt.Errorf("unknown key id %q", kid)
+		}
+		if token.Method.Alg() != key.method.Alg() {
+			return nil, errors.New("unexpected Signing method")
+		}
+		return key.public, nil
+	}, jwt.WithExpirationRequired())
+}
+
+// JWK is a public key in RFC 7517 JSON Web Key form.
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns the public halves of the asymmetric verification keys.
+// HMAC secrets are never published.
+func (k *TokenKeys) JWKS() JWKSet {
+	set := JWKSet{Keys: []JWK{}}
+	for _, id := range k.order {
+		if jwk, ok := publicJWK(k.verify[id]); ok {
+			set.Keys = append(set.Keys, jwk)
+		}
+	}
+	return set
+}
+
+func publicJWK(key *tokenKey) (JWK, bool) {
+	b64 := base64.RawURLEncoding.EncodeToString
+	switch pub := key.public.(type) {
+	case *rsa.PublicKey:
+		return JWK{Kty: "RSA", Kid: key.id, Use: "sig", Alg: key.method.Alg(),
+			N: b64(pub.N.Bytes()), E: b64(big.NewInt(int64(pub.E)).Bytes())}, true
+	case ed25519.PublicKey:
+		return JWK{Kty: "OKP", Kid: key.id, Use: "sig", Alg: key.method.Alg(),
+			Crv: "Ed25519", X: b64(pub)}, true
+	}
+	return JWK{}, false
+}
+
+func hmacKey(secret []byte) (*tokenKey, error) {
+	if len(secret) < minHMACSecret {
+		return nil, fmt.Errorf("token keys: JWT_SECRET must be at least %d bytes", minHMACSecret)
+	}
+	sum := sha256.Sum256(secret)
+	return &tokenKey{
+		id:      "hs256-" + hex.EncodeToString(sum[:8]),
+		method:  jwt.SigningMethodHS256,
+		private: secret,
+		public:  secret,
+	}, nil
+}
+
+// asymmetricKey wraps an RSA or Ed25519 key pair. private may be nil for a
+// key that only verifies. Its id is the key's RFC 7638 thumbprint.
+func asymmetricKey(private crypto.Signer, public crypto.PublicKey) (*tokenKey, error) {
+	key := &tokenKey{public: public}
+	if private != nil {
+		key.private = private
+	}
+	switch pub := public.(type) {
+	case *rsa.PublicKey:
+		if pub.N.BitLen() < minRSABits {
+			return nil, fmt.Errorf("token keys: RSA keys must be at least %d bits", minRSABits)
+		}
+		key.method = jwt.SigningMethodRS256
+	case ed25519.PublicKey:
+		key.method = jwt.SigningMethodEdDSA
+	default:
+		return nil, fmt.Errorf("token keys: unsupported key type %T, expected RSA or Ed25519", public)
+	}
+	jwk, _ := publicJWK(key)
+	// The thumbprint is the hash of the required members in lexical order.
+	var members any
+	if jwk.Kty == "RSA" {
+		members = struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{jwk.E, jwk.Kty, jwk.N}
+	} else {
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{jwk.Crv, jwk.Kty, jwk.X}
+	}
+	b, err := json.Marshal(members)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(b)
+	key.id = base64.RawURLEncoding.EncodeToString(sum[:])
+	return key, nil
+}
+
+// loadKeyFile reads a PEM encoded PKCS #8 or PKCS #1 private key, or a PKIX
+// public key.
+func loadKeyFile(path string) (*tokenKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("token keys: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("token keys: %s is not PEM encoded", path)
+	}
+	var parsed any
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("token keys: %s holds an unsupported %q block", path, block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("token keys: problem parsing %s, %w", path, err)
+	}
+	var key *tokenKey
+	if signer, ok := parsed.(crypto.Signer); ok {
+		key, err = asymmetricKey(signer, signer.Public())
+	} else {
+		key, err = asymmetricKey(nil, parsed)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w (%s)", err, path)
+	}
+	return key, nil
+}
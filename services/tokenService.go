@@ -8,31 +8,43 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 )
 
-func CreateToken(username string, cfg config.Config) (string, error) {
-	if username == "" {
-		return "", errors.New("username cannot be blank for token creation")
+// Token lifetimes used when the config doesn't set one.
+const (
+	DefaultAccessTTL  = 10 * time.Minute
+	DefaultRefreshTTL = 30 * 24 * time.Hour
+)
+
+// accessTTL is how long a token from CreateToken is valid for.
+func accessTTL(cfg config.Config) time.Duration {
+	if cfg.AccessTTL > 0 {
+		return cfg.AccessTTL
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256,
-		jwt.MapClaims{
-			"username": username,
-			"exp":      time.Now().Add(time.Minute * 10).Unix(), // 10 minute expiry time
-		})
-	secret := []byte(cfg.JwtSecret)
-	tokenString, err := token.SignedString(secret)
-	if err != nil {
-		return "", err
+	return DefaultAccessTTL
+}
+
+func refreshTTL(cfg config.Config) time.Duration {
+	if cfg.RefreshTTL > 0 {
+		return cfg.RefreshTTL
 	}
-	return tokenString, nil
+	return DefaultRefreshTTL
 }
 
-func VerifyToken(tokenString string, cfg config.Config) (string, error) {
-	secret := []byte(cfg.JwtSecret)
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, errors.New("unexpected Signing method")
-		}
-		return secret, nil
+// CreateToken returns an access token for username, valid for ttl and signed
+// with the signing key from keys.
+func CreateToken(username string, keys *TokenKeys, ttl time.Duration) (string, error) {
+	if username == "" {
+		return "", errors.New("username cannot be blank for token creation")
+	}
+	return keys.sign(jwt.MapClaims{
+		"username": username,
+		"exp":      time.Now().Add(ttl).Unix(),
 	})
+}
+
+// VerifyToken checks tokenString against keys and returns the username it
+// was issued for.
+func VerifyToken(tokenString string, keys *TokenKeys) (string, error) {
+	token, err := keys.parse(tokenString)
 	if err != nil {
 		return "", err
 	}
@@ -1,18 +1,37 @@
 package services
 
 import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
 	"errors"
 	"field_archive/server/internal/config"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
 )
 
+const testSecret = "a test secret of at least 32 bytes"
+
+func testKeys(t *testing.T) *TokenKeys {
+	keys, err := NewHMACKeys([]byte(testSecret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return keys
+}
+
 func TestCreateToken(t *testing.T) {
-	Mockcfg := config.Config{JwtSecret: "Test"}
-	hmacSampleSecret := []byte("Test")
+	hmacSampleSecret := []byte(testSecret)
 	u := "Mockuser"
-	token, err := CreateToken(u, Mockcfg)
+	token, err := CreateToken(u, testKeys(t), time.Minute)
 	if err != nil {
 		t.Errorf("Error in token creation, %v", err)
 	}
@@ -34,20 +53,23 @@ func TestCreateToken(t *testing.T) {
 	if u != claims["username"] {
 		t.Errorf("usernames do not match %v should be %v", claims["username"], u)
 	}
+	assert.NotEmpty(t, check.Header["kid"])
 }
 
 func TestVerifyToken(t *testing.T) {
-	Mockcfg := config.Config{JwtSecret: "Test"}
-	hmacSampleSecret := []byte("Test")
+	keys := testKeys(t)
+	hmacSampleSecret := []byte(testSecret)
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256,
 		jwt.MapClaims{
 			"username": "Mockuser",
+			"exp":      time.Now().Add(time.Minute).Unix(),
 		})
+	token.Header["kid"] = keys.signing.id
 	tokenString, err := token.SignedString(hmacSampleSecret)
 	if err != nil {
 		t.Errorf("error creating token string %v", err)
 	}
-	username, err := VerifyToken(tokenString, Mockcfg)
+	username, err := VerifyToken(tokenString, keys)
 	if err != nil {
 		t.Errorf("error varifying token %v", err)
 	}
@@ -55,3 +77,134 @@ func TestVerifyToken(t *testing.T) {
 		t.Errorf("username return from verification: %v does not match %v", username, "Mockuser")
 	}
 }
+
+func TestVerifyTokenRejects(t *testing.T) {
+	keys := testKeys(t)
+	sign := func(claims jwt.MapClaims, kid string) string {
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+		token.Header["kid"] = kid
+		s, _ := token.SignedString([]byte(testSecret))
+		return s
+	}
+	exp := time.Now().Add(time.Minute).Unix()
+	for name, token := range map[string]string{
+		"no expiry":   sign(jwt.MapClaims{"username": "a"}, keys.signing.id),
+		"expired":     sign(jwt.MapClaims{"username": "a", "exp": time.Now().Add(-time.Minute).Unix()}, keys.signing.id),
+		"unknown kid": sign(jwt.MapClaims{"username": "a", "exp": exp}, "other"),
+		"no kid":      sign(jwt.MapClaims{"username": "a", "exp": exp}, ""),
+	} {
+		_, err := VerifyToken(token, keys)
+		assert.Error(t, err, name)
+	}
+}
+
+func TestAsymmetricKeys(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+
+	for alg, signer := range map[string]crypto.Signer{"RS256": rsaKey, "EdDSA": edKey} {
+		t.Run(alg, func(t *testing.T) {
+			keys, err := NewSigningKeys(signer)
+			assert.NoError(t, err)
+			token, err := CreateToken("wren", keys, time.Minute)
+			assert.NoError(t, err)
+			parsed, _, _ := jwt.NewParser().ParseUnverified(token, jwt.MapClaims{})
+			assert.Equal(t, alg, parsed.Method.Alg())
+			username, err := VerifyToken(token, keys)
+			assert.NoError(t, err)
+			assert.Equal(t, "wren", username)
+		})
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	_, oldKey, _ := ed25519.GenerateKey(rand.Reader)
+	_, newKey, _ := ed25519.GenerateKey(rand.Reader)
+	before, _ := NewSigningKeys(oldKey)
+	after, _ := NewSigningKeys(newKey, oldKey.Public())
+	oldToken, _ := CreateToken("wren", before, time.Minute)
+	newToken, _ := CreateToken("wren", after, time.Minute)
+
+	_, err := VerifyToken(oldToken, after)
+	assert.NoError(t, err, "tokens from the previous key are still accepted")
+	_, err = VerifyToken(newToken, before)
+	assert.Error(t, err)
+
+	jwks := after.JWKS()
+	if assert.Len(t, jwks.Keys, 2) {
+		assert.Equal(t, after.signing.id, jwks.Keys[0].Kid)
+		assert.Equal(t, "OKP", jwks.Keys[0].Kty)
+		assert.Equal(t, "Ed25519", jwks.Keys[0].Crv)
+		assert.Equal(t, "EdDSA", jwks.Keys[0].Alg)
+	}
+}
+
+// TestAlgorithmConfusion checks an HS256 token signed with the RSA public key
+// as its secret is rejected, even under the RSA key's kid.
+func TestAlgorithmConfusion(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	keys, _ := NewSigningKeys(rsaKey)
+	pub, _ := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	pemPub := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pub})
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"username": "admin", "exp": time.Now().Add(time.Minute).Unix()})
+	token.Header["kid"] = keys.signing.id
+	forged, _ := token.SignedString(pemPub)
+	_, err := VerifyToken(forged, keys)
+	assert.Error(t, err)
+}
+
+func TestLoadTokenKeys(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, blockType string, der []byte) string {
+		path := filepath.Join(dir, name)
+		os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600)
+		return path
+	}
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	rsaDER, _ := x509.MarshalPKCS8PrivateKey(rsaKey)
+	edPub, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	edPubDER, _ := x509.MarshalPKIXPublicKey(edPub)
+	smallKey, _ := rsa.GenerateKey(rand.Reader, 1024)
+
+	signing := write("signing.pem", "PRIVATE KEY", rsaDER)
+	previous := write("previous.pem", "PUBLIC KEY", edPubDER)
+	pkcs1 := write("pkcs1.pem", "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(rsaKey))
+	small := write("small.pem", "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(smallKey))
+	junk := filepath.Join(dir, "junk.pem")
+	os.WriteFile(junk, []byte("not a key"), 0o600)
+
+	keys, err := LoadTokenKeys(config.Config{JwtSigningKey: signing, JwtVerifyKeys: []string{previous}})
+	if assert.NoError(t, err) {
+		assert.Equal(t, "RS256", keys.signing.method.Alg())
+		assert.Len(t, keys.JWKS().Keys, 2)
+		oldKeys, _ := NewSigningKeys(edKey)
+		oldToken, _ := CreateToken("wren", oldKeys, time.Minute)
+		_, err = VerifyToken(oldToken, keys)
+		assert.NoError(t, err)
+	}
+
+	keys, err = LoadTokenKeys(config.Config{JwtSigningKey: pkcs1, JwtSecret: testSecret})
+	if assert.NoError(t, err) {
+		assert.Equal(t, "RS256", keys.signing.method.Alg())
+		assert.Len(t, keys.JWKS().Keys, 1, "HMAC secrets are never published")
+	}
+
+	keys, err = LoadTokenKeys(config.Config{JwtSecret: testSecret})
+	if assert.NoError(t, err) {
+		assert.Equal(t, "HS256", keys.signing.method.Alg())
+		assert.Empty(t, keys.JWKS().Keys)
+	}
+
+	for name, cfg := range map[string]config.Config{
+		"nothing":        {},
+		"short secret":   {JwtSecret: "secret"},
+		"public signing": {JwtSigningKey: previous},
+		"missing file":   {JwtSigningKey: filepath.Join(dir, "missing.pem")},
+		"small RSA key":  {JwtSigningKey: small},
+		"bad verify key": {JwtSecret: testSecret, JwtVerifyKeys: []string{filepath.Join(dir, "missing.pem")}},
+		"not PEM":        {JwtSigningKey: junk},
+	} {
+		_, err := LoadTokenKeys(cfg)
+		assert.Error(t, err, name)
+	}
+}
@@ -0,0 +1,309 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"field_archive/server/entities"
+	"field_archive/server/internal/config"
+	"field_archive/server/repositories"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+type UserService interface {
+	Register(registration Registration, ctx context.Context) (entities.User, error)
+	Login(username, password string, ctx context.Context) (TokenPair, error)
+	Refresh(refreshToken string, ctx context.Context) (TokenPair, error)
+	Logout(refreshToken string, ctx context.Context) error
+	Authenticate(token string, ctx context.Context) (entities.User, error)
+	Create(registration Registration, role string, ctx context.Context) (entities.User, error)
+	SetRole(username, role string, ctx context.Context) (entities.User, error)
+	Disable(username string, ctx context.Context) (entities.User, error)
+}
+
+// TokenPair is a short lived access token and the refresh token that can be
+// exchanged for the next pair.
+type TokenPair struct {
+	AccessToken      string
+	AccessExpiresIn  time.Duration
+	RefreshToken     string
+	RefreshExpiresIn time.Duration
+}
+
+// ErrInvalidCredentials is returned by Login for an unknown username or a
+// wrong password alike, so callers can't tell which it was.
+var ErrInvalidCredentials = errors.New("invalid username or password")
+
+const (
+	minPasswordLength = 8
+	maxPasswordLength = 256
+)
+
+var usernamePattern = regexp.MustCompile(`^[a-z0-9_.-]{3,32}$`)
+
+type Registration struct {
+	Username string
+	Email    string
+	Password string
+}
+
+type userService struct {
+	repo   repositories.UserRepository
+	tokens repositories.RefreshTokenRepository
+	keys   *TokenKeys
+	cfg    config.Config
+}
+
+func NewUserService(repo repositories.UserRepository, tokens repositories.RefreshTokenRepository, keys *TokenKeys, cfg config.Config) *userService {
+	return &userService{repo: repo, tokens: tokens, keys: keys, cfg: cfg}
+}
+
+// Register creates a contributor. Usernames and emails are stored lower
+// cased so they are unique regardless of case.
+func (s *userService) Register(registration Registration, ctx context.Context) (entities.User, error) {
+	return s.Create(registration, entities.RoleContributor, ctx)
+}
+
+// Create creates a user with role, validated as Register does. It doesn't
+// authorize anyone, so it's only for operators, e.g. from the admin CLI.
+func (s *userService) Create(registration Registration, role string, ctx context.Context) (entities.User, error) {
+	user := entities.User{
+		Username: strings.ToLower(strings.TrimSpace(registration.Username)),
+		Email:    strings.ToLower(strings.TrimSpace(registration.Email)),
+		Role:     role,
+	}
+	verr := &ValidationError{}
+	if _, ok := roleRanks[role]; !ok {
+		verr.Add("role", "must be viewer, contributor, curator or admin")
+	}
+	if !usernamePattern.MatchString(user.Username) {
+		verr.Add("username", "must be 3 to 32 letters, digits or . _ -")
+	}
+	if at := strings.Index(user.Email, "@"); at < 1 || at == len(user.Email)-1 || strings.ContainsAny(user.Email, " \t\r\n") {
+		verr.Add("email", "must be a valid email address")
+	}
+	if n := len(registration.Password); n < minPasswordLength || n > maxPasswordLength {
+		verr.Add("password", fmt.Sprintf("must be between %d and %d characters", minPasswordLength, maxPasswordLength))
+	}
+	if verr.HasErrors() {
+		return entities.User{}, verr
+	}
+
+	hash, err := hashPassword(registration.Password)
+	if err != nil {
+		return entities.User{}, fmt.Errorf("service: problem hashing password, %w", err)
+	}
+	user.PasswordHash = hash
+	id, err := s.repo.Insert(user, ctx)
+	if err != nil {
+		return entities.User{}, fmt.Errorf("service: problem inserting user, %w", err)
+	}
+	user, err = s.repo.GetRowByID(id, ctx)
+	if err != nil {
+		return entities.User{}, fmt.Errorf("service: problem retrieving user, %w", err)
+	}
+	return user, nil
+}
+
+// Login checks a username and password and starts a new refresh token family
+// for the user.
+func (s *userService) Login(username, password string, ctx context.Context) (TokenPair, error) {
+	user, err := s.repo.GetByUsername(strings.ToLower(strings.TrimSpace(username)), ctx)
+	if errors.Is(err, repositories.ErrNotFound) {
+		// Hash anyway so unknown usernames take as long to reject as wrong
+		// passwords.
+		verifyPassword(password, dummyHash())
+		return TokenPair{}, ErrInvalidCredentials
+	}
+	if err != nil {
+		return TokenPair{}, fmt.Errorf("service: problem retrieving user, %w", err)
+	}
+	ok, err := verifyPassword(password, user.PasswordHash)
+	if err != nil {
+		return TokenPair{}, fmt.Errorf("service: problem checking password, %w", err)
+	}
+	if !ok {
+		return TokenPair{}, ErrInvalidCredentials
+	}
+	if user.DisabledAt != nil {
+		return TokenPair{}, fmt.Errorf("%w: user disabled", ErrInvalidCredentials)
+	}
+	family, err := randomToken(16)
+	if err != nil {
+		return TokenPair{}, fmt.Errorf("service: problem creating token family, %w", err)
+	}
+	return s.issue(user, family, ctx)
+}
+
+// Refresh exchanges a refresh token for a new pair. Each refresh token can
+// only be used once; presenting one that has already been exchanged means it
+// has leaked, so every token in its family is revoked.
+func (s *userService) Refresh(refreshToken string, ctx context.Context) (TokenPair, error) {
+	stored, err := s.tokens.GetByHash(hashToken(refreshToken), ctx)
+	if errors.Is(err, repositories.ErrNotFound) {
+		return TokenPair{}, ErrInvalidCredentials
+	}
+	if err != nil {
+		return TokenPair{}, fmt.Errorf("service: problem retrieving refresh token, %w", err)
+	}
+	if stored.RevokedAt != nil || time.Now().After(stored.ExpiresAt) {
+		return TokenPair{}, ErrInvalidCredentials
+	}
+	fresh := stored.UsedAt == nil
+	if fresh {
+		if fresh, err = s.tokens.MarkUsed(stored.ID, ctx); err != nil {
+			return TokenPair{}, fmt.Errorf("service: problem updating refresh token, %w", err)
+		}
+	}
+	if !fresh {
+		if err := s.tokens.RevokeFamily(stored.FamilyID, ctx); err != nil {
+			return TokenPair{}, fmt.Errorf("service: problem revoking refresh tokens, %w", err)
+		}
+		return TokenPair{}, fmt.Errorf("%w: refresh token reused", ErrInvalidCredentials)
+	}
+
+	user, err := s.repo.GetRowByID(stored.UserID, ctx)
+	if errors.Is(err, repositories.ErrNotFound) {
+		return TokenPair{}, ErrInvalidCredentials
+	}
+	if err != nil {
+		return TokenPair{}, fmt.Errorf("service: problem retrieving user, %w", err)
+	}
+	if user.DisabledAt != nil {
+		return TokenPair{}, fmt.Errorf("%w: user disabled", ErrInvalidCredentials)
+	}
+	return s.issue(user, stored.FamilyID, ctx)
+}
+
+// Logout revokes the refresh token's family. Access tokens already issued
+// stay valid until they expire. Unknown tokens are ignored.
+func (s *userService) Logout(refreshToken string, ctx context.Context) error {
+	stored, err := s.tokens.GetByHash(hashToken(refreshToken), ctx)
+	if errors.Is(err, repositories.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("service: problem retrieving refresh token, %w", err)
+	}
+	if err := s.tokens.RevokeFamily(stored.FamilyID, ctx); err != nil {
+		return fmt.Errorf("service: problem revoking refresh tokens, %w", err)
+	}
+	return nil
+}
+
+// issue creates an access token and a refresh token in family for user.
+func (s *userService) issue(user entities.User, family string, ctx context.Context) (TokenPair, error) {
+	access, err := CreateToken(user.Username, s.keys, accessTTL(s.cfg))
+	if err != nil {
+		return TokenPair{}, fmt.Errorf("service: problem creating token, %w", err)
+	}
+	refresh, err := randomToken(32)
+	if err != nil {
+		return TokenPair{}, fmt.Errorf("service: problem creating refresh token, %w", err)
+	}
+	ttl := refreshTTL(s.cfg)
+	_, err = s.tokens.Insert(entities.RefreshToken{
+		UserID:    user.ID,
+		FamilyID:  family,
+		TokenHash: hashToken(refresh),
+		ExpiresAt: time.Now().Add(ttl),
+	}, ctx)
+	if err != nil {
+		return TokenPair{}, fmt.Errorf("service: problem storing refresh token, %w", err)
+	}
+	return TokenPair{
+		AccessToken:      access,
+		AccessExpiresIn:  accessTTL(s.cfg),
+		RefreshToken:     refresh,
+		RefreshExpiresIn: ttl,
+	}, nil
+}
+
+// Authenticate verifies token and returns the user it was issued to. Bad or
+// expired tokens and tokens for users that no longer exist or are disabled
+// all give ErrInvalidCredentials.
+func (s *userService) Authenticate(token string, ctx context.Context) (entities.User, error) {
+	username, err := VerifyToken(token, s.keys)
+	if err != nil {
+		return entities.User{}, fmt.Errorf("%w: %v", ErrInvalidCredentials, err)
+	}
+	user, err := s.repo.GetByUsername(username, ctx)
+	if errors.Is(err, repositories.ErrNotFound) {
+		return entities.User{}, ErrInvalidCredentials
+	}
+	if err != nil {
+		return entities.User{}, fmt.Errorf("service: problem retrieving user, %w", err)
+	}
+	if user.DisabledAt != nil {
+		return entities.User{}, fmt.Errorf("%w: user disabled", ErrInvalidCredentials)
+	}
+	return user, nil
+}
+
+// SetRole changes the role of the user with username. Like Create, it's only
+// for operators.
+func (s *userService) SetRole(username, role string, ctx context.Context) (entities.User, error) {
+	if _, ok := roleRanks[role]; !ok {
+		verr := &ValidationError{}
+		verr.Add("role", "must be viewer, contributor, curator or admin")
+		return entities.User{}, verr
+	}
+	user, err := s.repo.GetByUsername(strings.ToLower(strings.TrimSpace(username)), ctx)
+	if err != nil {
+		return entities.User{}, fmt.Errorf("service: problem retrieving user, %w", err)
+	}
+	if err := s.repo.UpdateRole(user.ID, role, ctx); err != nil {
+		return entities.User{}, fmt.Errorf("service: problem updating user, %w", err)
+	}
+	user.Role = role
+	return user, nil
+}
+
+// Disable stops the user with username from logging in and revokes their
+// refresh tokens. Access tokens and API keys they hold are refused from then
+// on too, as Authenticate checks. Like Create, it's only for operators.
+func (s *userService) Disable(username string, ctx context.Context) (entities.User, error) {
+	user, err := s.repo.GetByUsername(strings.ToLower(strings.TrimSpace(username)), ctx)
+	if err != nil {
+		return entities.User{}, fmt.Errorf("service: problem retrieving user, %w", err)
+	}
+	if err := s.repo.Disable(user.ID, ctx); err != nil {
+		return entities.User{}, fmt.Errorf("service: problem disabling user, %w", err)
+	}
+	if err := s.tokens.RevokeUser(user.ID, ctx); err != nil {
+		return entities.User{}, fmt.Errorf("service: problem revoking refresh tokens, %w", err)
+	}
+	user, err = s.repo.GetRowByID(user.ID, ctx)
+	if err != nil {
+		return entities.User{}, fmt.Errorf("service: problem retrieving user, %w", err)
+	}
+	return user, nil
+}
+
+// randomToken returns n random bytes, base64url encoded.
+func randomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashToken is how refresh tokens are stored. They're long and random, so an
+// unsalted fast hash is enough to keep a database leak from exposing them.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+var dummyHash = sync.OnceValue(func() string {
+	hash, _ := hashPassword("")
+	return hash
+})
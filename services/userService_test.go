@@ -0,0 +1,281 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"field_archive/server/entities"
+	"field_archive/server/internal/config"
+	"field_archive/server/repositories"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type mockUserRepo struct {
+	users map[string]entities.User
+}
+
+func (m *mockUserRepo) Insert(user entities.User, ctx context.Context) (int, error) {
+	if m.users == nil {
+		m.users = map[string]entities.User{}
+	}
+	if _, ok := m.users[user.Username]; ok {
+		return 0, fmt.Errorf("user %w", repositories.ErrConflict)
+	}
+	user.ID = len(m.users) + 1
+	m.users[user.Username] = user
+	return user.ID, nil
+}
+
+func (m *mockUserRepo) GetRowByID(id int, ctx context.Context) (entities.User, error) {
+	for _, user := range m.users {
+		if user.ID == id {
+			return user, nil
+		}
+	}
+	return entities.User{}, fmt.Errorf("user with id %d %w", id, repositories.ErrNotFound)
+}
+
+func (m *mockUserRepo) GetByUsername(username string, ctx context.Context) (entities.User, error) {
+	user, ok := m.users[username]
+	if !ok {
+		return entities.User{}, fmt.Errorf("user %q %w", username, repositories.ErrNotFound)
+	}
+	return user, nil
+}
+
+func (m *mockUserRepo) UpdateRole(id int, role string, ctx context.Context) error {
+	for name, user := range m.users {
+		if user.ID == id {
+			user.Role = role
+			m.users[name] = user
+			return nil
+		}
+	}
+	return fmt.Errorf("user with id %d %w", id, repositories.ErrNotFound)
+}
+
+func (m *mockUserRepo) Disable(id int, ctx context.Context) error {
+	for name, user := range m.users {
+		if user.ID == id {
+			now := time.Now()
+			user.DisabledAt = &now
+			m.users[name] = user
+			return nil
+		}
+	}
+	return fmt.Errorf("user with id %d %w", id, repositories.ErrNotFound)
+}
+
+type mockRefreshRepo struct {
+	tokens []entities.RefreshToken
+}
+
+func (m *mockRefreshRepo) Insert(token entities.RefreshToken, ctx context.Context) (int, error) {
+	token.ID = len(m.tokens) + 1
+	m.tokens = append(m.tokens, token)
+	return token.ID, nil
+}
+
+func (m *mockRefreshRepo) GetByHash(hash string, ctx context.Context) (entities.RefreshToken, error) {
+	for _, token := range m.tokens {
+		if token.TokenHash == hash {
+			return token, nil
+		}
+	}
+	return entities.RefreshToken{}, fmt.Errorf("refresh token %w", repositories.ErrNotFound)
+}
+
+func (m *mockRefreshRepo) MarkUsed(id int, ctx context.Context) (bool, error) {
+	token := &m.tokens[id-1]
+	if token.UsedAt != nil || token.RevokedAt != nil {
+		return false, nil
+	}
+	now := time.Now()
+	token.UsedAt = &now
+	return true, nil
+}
+
+func (m *mockRefreshRepo) RevokeFamily(familyID string, ctx context.Context) error {
+	now := time.Now()
+	for i := range m.tokens {
+		if m.tokens[i].FamilyID == familyID && m.tokens[i].RevokedAt == nil {
+			m.tokens[i].RevokedAt = &now
+		}
+	}
+	return nil
+}
+
+func (m *mockRefreshRepo) RevokeUser(userID int, ctx context.Context) error {
+	now := time.Now()
+	for i := range m.tokens {
+		if m.tokens[i].UserID == userID && m.tokens[i].RevokedAt == nil {
+			m.tokens[i].RevokedAt = &now
+		}
+	}
+	return nil
+}
+
+func TestPasswordHashing(t *testing.T) {
+	hash, err := hashPassword("correct horse")
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(hash, "$argon2id$v=19$m=65536,t=3,p=4$"))
+
+	ok, err := verifyPassword("correct horse", hash)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	ok, err = verifyPassword("battery staple", hash)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	other, _ := hashPassword("correct horse")
+	assert.NotEqual(t, hash, other)
+
+	for _, bad := range []string{"", "plain", "$bcrypt$x$y$z$w", "$argon2id$v=19$m=65536,t=0,p=4$c2FsdA$a2V5"} {
+		_, err = verifyPassword("x", bad)
+		assert.Error(t, err, bad)
+	}
+}
+
+func TestRegisterAndLogin(t *testing.T) {
+	repo := &mockUserRepo{}
+	s := NewUserService(repo, &mockRefreshRepo{}, testKeys(t), config.Config{})
+
+	user, err := s.Register(Registration{Username: " Wren ", Email: "Wren@Example.com", Password: "correct horse"}, context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, "wren", user.Username)
+	assert.Equal(t, "wren@example.com", user.Email)
+	assert.NotContains(t, user.PasswordHash, "correct horse")
+
+	_, err = s.Register(Registration{Username: "wren", Email: "other@example.com", Password: "correct horse"}, context.Background())
+	assert.ErrorIs(t, err, repositories.ErrConflict)
+
+	tokens, err := s.Login("WREN", "correct horse", context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultAccessTTL, tokens.AccessExpiresIn)
+	assert.NotEmpty(t, tokens.RefreshToken)
+	token := tokens.AccessToken
+	username, err := VerifyToken(token, testKeys(t))
+	assert.NoError(t, err)
+	assert.Equal(t, "wren", username)
+	authed, err := s.Authenticate(token, context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, user, authed)
+	_, err = s.Authenticate(token+"x", context.Background())
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+
+	_, err = s.Login("wren", "wrong password", context.Background())
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+	_, err = s.Login("nobody", "correct horse", context.Background())
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+}
+
+func TestRegisterValidation(t *testing.T) {
+	s := NewUserService(&mockUserRepo{}, &mockRefreshRepo{}, testKeys(t), config.Config{})
+	_, err := s.Register(Registration{Username: "a b", Email: "nope", Password: "short"}, context.Background())
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("expected a validation error, got %v", err)
+	}
+	for _, field := range []string{"username", "email", "password"} {
+		assert.Contains(t, verr.Fields, field)
+	}
+}
+
+func TestRefreshRotation(t *testing.T) {
+	tokens := &mockRefreshRepo{}
+	s := NewUserService(&mockUserRepo{}, tokens, testKeys(t), config.Config{RefreshTTL: time.Hour})
+	s.Register(Registration{Username: "wren", Email: "wren@example.com", Password: "correct horse"}, context.Background())
+
+	first, err := s.Login("wren", "correct horse", context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, time.Hour, first.RefreshExpiresIn)
+	assert.NotEqual(t, first.RefreshToken, tokens.tokens[0].TokenHash, "refresh tokens are stored hashed")
+
+	second, err := s.Refresh(first.RefreshToken, context.Background())
+	assert.NoError(t, err)
+	assert.NotEqual(t, first.RefreshToken, second.RefreshToken)
+	assert.Equal(t, tokens.tokens[0].FamilyID, tokens.tokens[1].FamilyID)
+
+	third, err := s.Refresh(second.RefreshToken, context.Background())
+	assert.NoError(t, err)
+
+	// Replaying an exchanged token revokes the whole family, including the
+	// latest token.
+	_, err = s.Refresh(first.RefreshToken, context.Background())
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+	_, err = s.Refresh(third.RefreshToken, context.Background())
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+
+	// Other logins are unaffected.
+	other, err := s.Login("wren", "correct horse", context.Background())
+	assert.NoError(t, err)
+	assert.NotEqual(t, tokens.tokens[0].FamilyID, tokens.tokens[len(tokens.tokens)-1].FamilyID)
+	_, err = s.Refresh("not a token", context.Background())
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+
+	assert.NoError(t, s.Logout(other.RefreshToken, context.Background()))
+	_, err = s.Refresh(other.RefreshToken, context.Background())
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+	assert.NoError(t, s.Logout("not a token", context.Background()))
+}
+
+func TestRefreshExpired(t *testing.T) {
+	tokens := &mockRefreshRepo{}
+	s := NewUserService(&mockUserRepo{}, tokens, testKeys(t), config.Config{})
+	s.Register(Registration{Username: "wren", Email: "wren@example.com", Password: "correct horse"}, context.Background())
+	pair, err := s.Login("wren", "correct horse", context.Background())
+	assert.NoError(t, err)
+	tokens.tokens[0].ExpiresAt = time.Now().Add(-time.Minute)
+	_, err = s.Refresh(pair.RefreshToken, context.Background())
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+}
+
+func TestCreateAndSetRole(t *testing.T) {
+	s := NewUserService(&mockUserRepo{}, &mockRefreshRepo{}, testKeys(t), config.Config{})
+
+	user, err := s.Create(Registration{Username: "heron", Email: "heron@example.com", Password: "correct horse"}, entities.RoleAdmin, context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, entities.RoleAdmin, user.Role)
+
+	_, err = s.Create(Registration{Username: "egret", Email: "egret@example.com", Password: "correct horse"}, "owner", context.Background())
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("expected a validation error, got %v", err)
+	}
+	assert.Contains(t, verr.Fields, "role")
+
+	user, err = s.SetRole("Heron", entities.RoleCurator, context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, entities.RoleCurator, user.Role)
+	_, err = s.SetRole("heron", "owner", context.Background())
+	assert.True(t, errors.As(err, &verr))
+	_, err = s.SetRole("nobody", entities.RoleCurator, context.Background())
+	assert.ErrorIs(t, err, repositories.ErrNotFound)
+}
+
+func TestDisable(t *testing.T) {
+	tokens := &mockRefreshRepo{}
+	s := NewUserService(&mockUserRepo{}, tokens, testKeys(t), config.Config{})
+	s.Register(Registration{Username: "wren", Email: "wren@example.com", Password: "correct horse"}, context.Background())
+	pair, err := s.Login("wren", "correct horse", context.Background())
+	assert.NoError(t, err)
+
+	user, err := s.Disable("wren", context.Background())
+	assert.NoError(t, err)
+	assert.NotNil(t, user.DisabledAt)
+	assert.NotNil(t, tokens.tokens[0].RevokedAt)
+
+	_, err = s.Login("wren", "correct horse", context.Background())
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+	_, err = s.Authenticate(pair.AccessToken, context.Background())
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+	_, err = s.Refresh(pair.RefreshToken, context.Background())
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+
+	_, err = s.Disable("nobody", context.Background())
+	assert.ErrorIs(t, err, repositories.ErrNotFound)
+}